@@ -343,6 +343,21 @@ func (db *PluginDB) ListApps(o *database.ListAppOptions) ([]*database.App, error
 	return cl, err
 }
 
+func (db *PluginDB) ListTrash(owner string) (t *database.Trash, err error) {
+	api := fmt.Sprintf("/api/users/%s/trash", url.PathEscape(owner))
+
+	err = db.UnmarshalRequest(&t, "GET", api, nil)
+	return
+}
+func (db *PluginDB) RestoreObject(id string) error {
+	api := fmt.Sprintf("/api/objects/%s/restore", url.PathEscape(id))
+	return db.BasicRequest("POST", api, nil)
+}
+func (db *PluginDB) RestoreApp(id string) error {
+	api := fmt.Sprintf("/api/apps/%s/restore", url.PathEscape(id))
+	return db.BasicRequest("POST", api, nil)
+}
+
 func (db *PluginDB) ReadUserSettings(username string) (v map[string]map[string]interface{}, err error) {
 	api := fmt.Sprintf("/api/users/%s/settings", url.PathEscape(username))
 
@@ -211,7 +211,11 @@ func (a *Assets) Reload() error {
 			if host == "" {
 				host = GetOutboundIP()
 			}
-			myurl := fmt.Sprintf("http://%s:%s", host, port)
+			scheme := "http"
+			if c.TLSCert != nil && *c.TLSCert != "" {
+				scheme = "https"
+			}
+			myurl := fmt.Sprintf("%s://%s:%s", scheme, host, port)
 			c.URL = &myurl
 		}
 	}
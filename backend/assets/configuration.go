@@ -2,8 +2,10 @@ package assets
 
 import (
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
@@ -25,6 +27,46 @@ func (e *Event) Validate() error {
 	return nil
 }
 
+// DefaultHookTimeout is how long heedy waits for a hook that doesn't set its timeout
+const DefaultHookTimeout = "5s"
+
+// Hook is called before a write is committed, and can modify or reject the written data
+type Hook struct {
+	Hook    string  `hcl:"hook,label" json:"hook,omitempty"`
+	Type    *string `hcl:"type" json:"type,omitempty"`
+	Tags    *string `hcl:"tags" json:"tags,omitempty"`
+	Plugin  *string `hcl:"plugin" json:"plugin,omitempty"`
+	Key     *string `hcl:"key" json:"key,omitempty"`
+	Post    *string `hcl:"post" json:"post,omitempty"`
+	Timeout *string `hcl:"timeout" json:"timeout,omitempty"`
+}
+
+func (h *Hook) Validate() error {
+	if h.Hook == "" {
+		return errors.New("'hook' must have the name of the write it is called for")
+	}
+	if h.Post == nil {
+		return errors.New("'hook' must have post specified")
+	}
+	if _, err := h.GetTimeout(); err != nil {
+		return fmt.Errorf("hook %s: invalid timeout: %w", h.Hook, err)
+	}
+	return nil
+}
+
+// GetTimeout returns how long to wait for the hook before rejecting the write
+func (h *Hook) GetTimeout() (time.Duration, error) {
+	timeout := DefaultHookTimeout
+	if h.Timeout != nil {
+		timeout = *h.Timeout
+	}
+	d, err := time.ParseDuration(timeout)
+	if err == nil && d <= 0 {
+		err = errors.New("the timeout must be positive")
+	}
+	return d, err
+}
+
 // Object represents a object that is to be auto-created inside a app on behalf of a plugin
 type Object struct {
 	Name        string                  `json:"name"`
@@ -81,7 +123,8 @@ type Plugin struct {
 	Routes *map[string]string `json:"routes,omitempty"`
 	Events *map[string]string `json:"events,omitempty"`
 
-	On []Event `hcl:"on,block" json:"on,omitempty"`
+	On    []Event `hcl:"on,block" json:"on,omitempty"`
+	Hooks []Hook  `hcl:"hook,block" json:"hook,omitempty"`
 
 	Run                map[string]Run         `json:"run,omitempty"`
 	Config             map[string]interface{} `json:"config,omitempty"`
@@ -100,6 +143,7 @@ func (p *Plugin) Copy() *Plugin {
 	np.UserSettingsSchema = make(map[string]interface{})
 	np.ConfigSchema = make(map[string]interface{})
 	np.On = make([]Event, len(p.On))
+	np.Hooks = make([]Hook, len(p.Hooks))
 
 	for ekey, eval := range p.Run {
 		newrun := Run{
@@ -124,6 +168,7 @@ func (p *Plugin) Copy() *Plugin {
 	for si, sval := range p.On {
 		np.On[si] = sval
 	}
+	copy(np.Hooks, p.Hooks)
 
 	return &np
 }
@@ -255,6 +300,7 @@ type Configuration struct {
 	ActivePlugins  *[]string `hcl:"active_plugins" json:"active_plugins,omitempty"`
 	AdminUsers     *[]string `hcl:"admin_users" json:"admin_users,omitempty"`
 	ForbiddenUsers *[]string `hcl:"forbidden_users" json:"forbidden_users,omitempty"`
+	Registration   *string   `hcl:"registration" json:"registration,omitempty"`
 
 	Language         *string `hcl:"language" json:"language,omitempty"`
 	FallbackLanguage *string `hcl:"fallback_language" json:"fallback_language,omitempty"`
@@ -266,6 +312,11 @@ type Configuration struct {
 
 	RunTimeout *string `json:"run_timeout,omitempty"`
 
+	TrashRetention *string `hcl:"trash_retention" json:"trash_retention,omitempty"`
+
+	StorageQuota      *int64            `hcl:"storage_quota" json:"storage_quota,omitempty"`
+	UserStorageQuotas *map[string]int64 `hcl:"user_storage_quotas" json:"user_storage_quotas,omitempty"`
+
 	Scope *map[string]string `json:"scope,omitempty" hcl:"scope"`
 
 	ObjectTypes map[string]ObjectType `json:"type,omitempty" hcl:"type"`
@@ -274,6 +325,26 @@ type Configuration struct {
 	RequestBodyByteLimit *int64 `hcl:"request_body_byte_limit" json:"request_body_byte_limit,omitempty"`
 	AllowPublicWebsocket *bool  `hcl:"allow_public_websocket" json:"allow_public_websocket,omitempty"`
 
+	LoginAttempts  *int     `hcl:"login_attempts" json:"login_attempts,omitempty"`
+	LoginLockout   *string  `hcl:"login_lockout" json:"login_lockout,omitempty"`
+	RateLimit      *float64 `hcl:"rate_limit" json:"rate_limit,omitempty"`
+	RateLimitBurst *int     `hcl:"rate_limit_burst" json:"rate_limit_burst,omitempty"`
+
+	TLSCert         *string `hcl:"tls_cert" json:"tls_cert,omitempty"`
+	TLSKey          *string `hcl:"tls_key" json:"tls_key,omitempty"`
+	TLSRedirectAddr *string `hcl:"tls_redirect_addr" json:"tls_redirect_addr,omitempty"`
+
+	MQTTAddr          *string `hcl:"mqtt_addr" json:"mqtt_addr,omitempty"`
+	MQTTPublishEvents *bool   `hcl:"mqtt_publish_events" json:"mqtt_publish_events,omitempty"`
+
+	SMTPAddr                *string `hcl:"smtp_addr" json:"smtp_addr,omitempty"`
+	SMTPUsername            *string `hcl:"smtp_username" json:"smtp_username,omitempty"`
+	SMTPPassword            *string `hcl:"smtp_password" json:"smtp_password,omitempty"`
+	SMTPFrom                *string `hcl:"smtp_from" json:"smtp_from,omitempty"`
+	PasswordResetExpiration *string `hcl:"password_reset_expiration" json:"password_reset_expiration,omitempty"`
+
+	WatchConfig *bool `hcl:"watch_config" json:"watch_config,omitempty"`
+
 	Plugins map[string]*Plugin `json:"plugin,omitempty"`
 
 	LogLevel *string `json:"log_level,omitempty" hcl:"log_level"`
@@ -476,6 +547,7 @@ func MergeConfig(base *Configuration, overlay *Configuration) *Configuration {
 			for _, oV := range oplugin.On {
 				bplugin.On = append(bplugin.On, oV)
 			}
+			bplugin.Hooks = append(bplugin.Hooks, oplugin.Hooks...)
 
 			for cName, ocValue := range oplugin.Apps {
 				bcValue, ok := bplugin.Apps[cName]
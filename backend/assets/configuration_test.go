@@ -123,3 +123,111 @@ func TestSchemaValidation(t *testing.T) {
 	}
 	require.Error(t, c.ValidateObjectMeta("timeseries", &v))
 }
+
+func TestConfigurationUpdate(t *testing.T) {
+	c, err := LoadConfigBytes([]byte(`
+		addr = ":1324"
+		rate_limit = 0
+		type "timeseries" {
+			scope = { "read" = "Read" }
+		}
+		plugin "myplugin" {
+			run "server" {
+				cmd = ["./server"]
+			}
+			run "job" {
+				cmd = ["./job"]
+				cron = "@every 1h"
+			}
+		}
+	`), "heedy.conf")
+	require.NoError(t, err)
+	nc, err := LoadConfigBytes([]byte(`
+		addr = ":8000"
+		rate_limit = 10
+		type "timeseries" {
+			scope = { "read" = "Read", "write" = "Write" }
+		}
+		plugin "myplugin" {
+			run "server" {
+				cmd = ["./server", "--port=5"]
+			}
+			run "job" {
+				cmd = ["./job"]
+				cron = "@every 5m"
+			}
+			on "object_create" {
+				post = "run:server/create"
+			}
+		}
+	`), "heedy.conf")
+	require.NoError(t, err)
+	oldPlugins := c.Plugins
+	oldPlugin := c.Plugins["myplugin"]
+
+	cc := c.Update(nc)
+	require.Equal(t, []string{"plugin.myplugin.on", "plugin.myplugin.run.job.cron", "rate_limit", "type.timeseries.scope"}, cc.Applied)
+	require.Equal(t, []string{"addr", "plugin.myplugin.run.server"}, cc.RestartRequired)
+
+	// Only the reloadable options are changed
+	require.Equal(t, ":1324", c.GetAddr())
+	rate, _ := c.GetRateLimit()
+	require.Equal(t, float64(10), rate)
+	scope, err := c.GetObjectScope("timeseries")
+	require.NoError(t, err)
+	require.Len(t, scope, 2)
+	require.Len(t, c.Plugins["myplugin"].On, 1)
+	require.Equal(t, "@every 5m", *c.Plugins["myplugin"].Run["job"].Cron)
+	require.Equal(t, []interface{}{"./server"}, c.Plugins["myplugin"].Run["server"].Config["cmd"])
+
+	// The plugins being used while the update happens are not modified
+	require.Equal(t, oldPlugin, oldPlugins["myplugin"])
+	require.Len(t, oldPlugin.On, 0)
+	require.Equal(t, "@every 1h", *oldPlugin.Run["job"].Cron)
+
+	// Options that require a restart keep being reported until heedy restarts
+	cc = c.Update(nc)
+	require.Empty(t, cc.Applied)
+	require.Equal(t, []string{"addr", "plugin.myplugin.run.server"}, cc.RestartRequired)
+}
+
+func TestConfigFromSettings(t *testing.T) {
+	c, err := ConfigFromSettings([]string{
+		"addr=:8000",
+		"rate_limit=10",
+		"active_plugins=[\"myplugin\"]",
+		"login_lockout=1h",
+		"language=123",
+		"plugin.myplugin.config.batch_size=100",
+		"plugin.myplugin.config.name=hello",
+	})
+	require.NoError(t, err)
+	require.Equal(t, ":8000", c.GetAddr())
+	rate, _ := c.GetRateLimit()
+	require.Equal(t, float64(10), rate)
+	require.Equal(t, []string{"myplugin"}, c.GetActivePlugins())
+	require.Equal(t, "1h", *c.LoginLockout)
+	require.Equal(t, "123", *c.Language)
+	require.Equal(t, float64(100), c.Plugins["myplugin"].Config["batch_size"])
+	require.Equal(t, "hello", c.Plugins["myplugin"].Config["name"])
+
+	_, err = ConfigFromSettings([]string{"not_an_option=1"})
+	require.Error(t, err)
+	_, err = ConfigFromSettings([]string{"rate_limit=fast"})
+	require.Error(t, err)
+	_, err = ConfigFromSettings([]string{"rate_limit"})
+	require.Error(t, err)
+
+	c, err = ConfigFromEnv([]string{"HOME=/root", "HEEDY_RATE_LIMIT_BURST=5", "HEEDY_PLUGIN__MYPLUGIN__CONFIG__BATCH_SIZE=10"})
+	require.NoError(t, err)
+	_, burst := c.GetRateLimit()
+	require.Equal(t, 5, burst)
+	require.Equal(t, float64(10), c.Plugins["myplugin"].Config["batch_size"])
+
+	// The overrides are validated with the rest of the configuration
+	base, err := LoadConfigBytes([]byte(`rate_limit = 1`), "heedy.conf")
+	require.NoError(t, err)
+	c, err = ConfigFromSettings([]string{"rate_limit=-1"})
+	require.NoError(t, err)
+	require.Error(t, Validate(MergeConfig(base, c)))
+}
@@ -3,6 +3,8 @@ package assets
 import (
 	"fmt"
 	"time"
+
+	"github.com/sirupsen/logrus"
 )
 
 func (c *Configuration) GetRequestBodyByteLimit() int64 {
@@ -23,6 +25,19 @@ func (c *Configuration) GetAddr() string {
 	return ""
 }
 
+// GetURL returns the URL at which heedy can be accessed, without a trailing slash
+func (c *Configuration) GetURL() string {
+	c.RLock()
+	defer c.RUnlock()
+	if c.URL != nil {
+		return *c.URL
+	}
+	if c.Addr != nil {
+		return "http://" + *c.Addr
+	}
+	return ""
+}
+
 func (c *Configuration) GetAPI() string {
 	c.RLock()
 	defer c.RUnlock()
@@ -44,6 +59,32 @@ func (c *Configuration) GetActivePlugins() []string {
 	return *c.ActivePlugins
 }
 
+// UserIsForbidden checks if the given username is not permitted for new users
+func (c *Configuration) UserIsForbidden(username string) bool {
+	c.RLock()
+	defer c.RUnlock()
+	if c.ForbiddenUsers == nil {
+		return false
+	}
+	for _, v := range *c.ForbiddenUsers {
+		if v == username {
+			return true
+		}
+	}
+	return false
+}
+
+// GetRegistration returns how new users can sign up: "invite" only permits users with an invite code,
+// "approval" additionally lets anyone sign up, with an admin approving the account, and "open" lets anyone create an account.
+func (c *Configuration) GetRegistration() string {
+	c.RLock()
+	defer c.RUnlock()
+	if c.Registration != nil {
+		return *c.Registration
+	}
+	return "invite"
+}
+
 // UserIsAdmin checks if the given user is an admin
 func (c *Configuration) UserIsAdmin(username string) bool {
 	c.RLock()
@@ -127,3 +168,176 @@ func (c *Configuration) GetRunTimeout() time.Duration {
 	d, _ := time.ParseDuration(("5s"))
 	return d
 }
+
+// GetTrashRetention gets the duration for which deleted objects and apps are kept
+// in the trash before being permanently removed
+func (c *Configuration) GetTrashRetention() time.Duration {
+	c.RLock()
+	defer c.RUnlock()
+	if c.TrashRetention != nil {
+		d, err := time.ParseDuration(*c.TrashRetention)
+		if err == nil {
+			return d
+		}
+	}
+	return 30 * 24 * time.Hour
+}
+
+// GetStorageQuota returns the number of bytes the user can store, or 0 if the storage is unlimited
+func (c *Configuration) GetStorageQuota(username string) int64 {
+	c.RLock()
+	defer c.RUnlock()
+	if c.UserStorageQuotas != nil {
+		if q, ok := (*c.UserStorageQuotas)[username]; ok {
+			return q
+		}
+	}
+	if c.StorageQuota != nil {
+		return *c.StorageQuota
+	}
+	return 0
+}
+
+// HasStorageQuotas returns whether the storage of any user is limited
+func (c *Configuration) HasStorageQuotas() bool {
+	c.RLock()
+	defer c.RUnlock()
+	if c.StorageQuota != nil && *c.StorageQuota > 0 {
+		return true
+	}
+	if c.UserStorageQuotas != nil {
+		for _, q := range *c.UserStorageQuotas {
+			if q > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GetLoginLimits returns the number of failed logins permitted from a single client or for a single user,
+// and the duration of the lockout once the limit is reached. 0 attempts disables the lockout.
+func (c *Configuration) GetLoginLimits() (int, time.Duration) {
+	c.RLock()
+	defer c.RUnlock()
+	attempts := 0
+	if c.LoginAttempts != nil {
+		attempts = *c.LoginAttempts
+	}
+	lockout := 15 * time.Minute
+	if c.LoginLockout != nil {
+		d, err := time.ParseDuration(*c.LoginLockout)
+		if err == nil {
+			lockout = d
+		}
+	}
+	return attempts, lockout
+}
+
+// GetRateLimit returns the number of requests per second permitted for each client, and the
+// burst size of the token bucket. A rate of 0 disables rate limiting.
+func (c *Configuration) GetRateLimit() (float64, int) {
+	c.RLock()
+	defer c.RUnlock()
+	rate := float64(0)
+	if c.RateLimit != nil {
+		rate = *c.RateLimit
+	}
+	burst := 1
+	if c.RateLimitBurst != nil {
+		burst = *c.RateLimitBurst
+	}
+	return rate, burst
+}
+
+// GetTLS returns the paths to the TLS certificate and key files used to serve heedy over https.
+// The paths are relative to the heedy folder. Empty strings are returned if TLS is not enabled.
+func (c *Configuration) GetTLS() (string, string) {
+	c.RLock()
+	defer c.RUnlock()
+	if c.TLSCert == nil || c.TLSKey == nil {
+		return "", ""
+	}
+	return *c.TLSCert, *c.TLSKey
+}
+
+// GetTLSRedirectAddr returns the address on which to run a plain http server that redirects
+// all requests to https, or an empty string if no redirect server is to be run.
+func (c *Configuration) GetTLSRedirectAddr() string {
+	c.RLock()
+	defer c.RUnlock()
+	if c.TLSRedirectAddr != nil {
+		return *c.TLSRedirectAddr
+	}
+	return ""
+}
+
+// GetMQTT returns the address of the embedded MQTT listener, or an empty string if it is disabled,
+// and whether heedy events are published to MQTT clients.
+func (c *Configuration) GetMQTT() (string, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	addr := ""
+	if c.MQTTAddr != nil {
+		addr = *c.MQTTAddr
+	}
+	publishEvents := false
+	if c.MQTTPublishEvents != nil {
+		publishEvents = *c.MQTTPublishEvents
+	}
+	return addr, publishEvents
+}
+
+// GetSMTP returns the address of the SMTP server used to send email, or an empty string if email is disabled,
+// along with the credentials to log in to the server, and the address from which the emails are sent.
+func (c *Configuration) GetSMTP() (addr, username, password, from string) {
+	c.RLock()
+	defer c.RUnlock()
+	if c.SMTPAddr != nil {
+		addr = *c.SMTPAddr
+	}
+	if c.SMTPUsername != nil {
+		username = *c.SMTPUsername
+	}
+	if c.SMTPPassword != nil {
+		password = *c.SMTPPassword
+	}
+	if c.SMTPFrom != nil {
+		from = *c.SMTPFrom
+	}
+	return
+}
+
+// GetPasswordResetExpiration returns how long a password reset link can be used
+func (c *Configuration) GetPasswordResetExpiration() time.Duration {
+	c.RLock()
+	defer c.RUnlock()
+	if c.PasswordResetExpiration != nil {
+		d, err := time.ParseDuration(*c.PasswordResetExpiration)
+		if err == nil {
+			return d
+		}
+	}
+	return 24 * time.Hour
+}
+
+// GetLogLevel returns the level at which heedy logs. Running heedy in verbose mode always logs debug messages.
+func (c *Configuration) GetLogLevel() logrus.Level {
+	c.RLock()
+	defer c.RUnlock()
+	if c.Verbose || c.LogLevel == nil {
+		return logrus.DebugLevel
+	}
+	l, err := logrus.ParseLevel(*c.LogLevel)
+	if err != nil {
+		return logrus.DebugLevel
+	}
+	return l
+}
+
+// GetWatchConfig returns whether heedy.conf is watched for changes, which are then reloaded automatically
+func (c *Configuration) GetWatchConfig() bool {
+	c.RLock()
+	defer c.RUnlock()
+	return c.WatchConfig != nil && *c.WatchConfig
+}
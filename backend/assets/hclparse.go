@@ -88,8 +88,9 @@ type hclPlugin struct {
 
 	Run []hclRun `hcl:"run,block"`
 
-	Apps []hclApp `hcl:"app,block"`
-	On   []Event  `hcl:"on,block" json:"on,omitempty"`
+	Apps  []hclApp `hcl:"app,block"`
+	On    []Event  `hcl:"on,block" json:"on,omitempty"`
+	Hooks []Hook   `hcl:"hook,block" json:"hook,omitempty"`
 
 	// The remaining stuff is plugin-specific settings
 	// that will be passed to the plugin executables,
@@ -121,6 +122,7 @@ type hclConfiguration struct {
 	ActivePlugins  *[]string `hcl:"active_plugins" json:"active_plugins,omitempty"`
 	AdminUsers     *[]string `hcl:"admin_users" json:"admin_users,omitempty"`
 	ForbiddenUsers *[]string `hcl:"forbidden_users" json:"forbidden_users,omitempty"`
+	Registration   *string   `hcl:"registration" json:"registration,omitempty"`
 
 	Language         *string `hcl:"language" json:"language"`
 	FallbackLanguage *string `hcl:"fallback_language" json:"fallback_language"`
@@ -132,6 +134,11 @@ type hclConfiguration struct {
 
 	RunTimeout *string `hcl:"run_timeout"`
 
+	TrashRetention *string `hcl:"trash_retention" json:"trash_retention,omitempty"`
+
+	StorageQuota      *int64            `hcl:"storage_quota" json:"storage_quota,omitempty"`
+	UserStorageQuotas *map[string]int64 `hcl:"user_storage_quotas" json:"user_storage_quotas,omitempty"`
+
 	Scope       *map[string]string `json:"scope,omitempty" hcl:"scope"`
 	NewAppScope *[]string          `json:"new_app_scope,omitempty" hcl:"new_app_scope"`
 
@@ -141,6 +148,26 @@ type hclConfiguration struct {
 	RequestBodyByteLimit *int64 `hcl:"request_body_byte_limit" json:"request_body_byte_limit,omitempty"`
 	AllowPublicWebsocket *bool  `hcl:"allow_public_websocket" json:"allow_public_websocket,omitempty"`
 
+	LoginAttempts  *int     `hcl:"login_attempts" json:"login_attempts,omitempty"`
+	LoginLockout   *string  `hcl:"login_lockout" json:"login_lockout,omitempty"`
+	RateLimit      *float64 `hcl:"rate_limit" json:"rate_limit,omitempty"`
+	RateLimitBurst *int     `hcl:"rate_limit_burst" json:"rate_limit_burst,omitempty"`
+
+	TLSCert         *string `hcl:"tls_cert" json:"tls_cert,omitempty"`
+	TLSKey          *string `hcl:"tls_key" json:"tls_key,omitempty"`
+	TLSRedirectAddr *string `hcl:"tls_redirect_addr" json:"tls_redirect_addr,omitempty"`
+
+	MQTTAddr          *string `hcl:"mqtt_addr" json:"mqtt_addr,omitempty"`
+	MQTTPublishEvents *bool   `hcl:"mqtt_publish_events" json:"mqtt_publish_events,omitempty"`
+
+	SMTPAddr                *string `hcl:"smtp_addr" json:"smtp_addr,omitempty"`
+	SMTPUsername            *string `hcl:"smtp_username" json:"smtp_username,omitempty"`
+	SMTPPassword            *string `hcl:"smtp_password" json:"smtp_password,omitempty"`
+	SMTPFrom                *string `hcl:"smtp_from" json:"smtp_from,omitempty"`
+	PasswordResetExpiration *string `hcl:"password_reset_expiration" json:"password_reset_expiration,omitempty"`
+
+	WatchConfig *bool `hcl:"watch_config" json:"watch_config,omitempty"`
+
 	Plugins []hclPlugin `hcl:"plugin,block"`
 
 	LogLevel *string `json:"log_level" hcl:"log_level"`
@@ -359,6 +386,12 @@ func loadConfigFromHcl(f *hcl.File, filename string) (*Configuration, error) {
 			}
 		}
 		p.On = hp.On
+		for h := range hp.Hooks {
+			if err := hp.Hooks[h].Validate(); err != nil {
+				return nil, fmt.Errorf("%s: Plugin %s - %w", filename, hp.Name, err)
+			}
+		}
+		p.Hooks = hp.Hooks
 		if hp.ConfigSchema != nil {
 			sobj, err := loadJSONObject(hp.ConfigSchema)
 			if err != nil {
@@ -0,0 +1,107 @@
+package assets
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// EnvPrefix is the prefix of environment variables that set configuration options
+const EnvPrefix = "HEEDY_"
+
+// settingConfig decodes a single key=value setting into a configuration
+func settingConfig(setting string) (*Configuration, error) {
+	eq := strings.IndexByte(setting, '=')
+	if eq < 0 {
+		return nil, fmt.Errorf("Invalid setting '%s': must be of the form key=value", setting)
+	}
+	key, value := setting[:eq], setting[eq+1:]
+	levels := strings.Split(key, ".")
+	for _, l := range levels {
+		if l == "" {
+			return nil, fmt.Errorf("Invalid setting key '%s'", key)
+		}
+	}
+
+	decode := func(v interface{}) (*Configuration, error) {
+		// Build the nested object that represents the setting in the configuration's json
+		for i := len(levels) - 1; i >= 0; i-- {
+			v = map[string]interface{}{levels[i]: v}
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		c := NewConfiguration()
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		return c, dec.Decode(c)
+	}
+
+	// Values are json, but anything that isn't valid json, or doesn't fit the option as json, is used as a string
+	var v interface{}
+	if err := json.Unmarshal([]byte(value), &v); err != nil {
+		v = value
+	}
+	c, err := decode(v)
+	if _, isString := v.(string); err != nil && !isString {
+		c, err = decode(value)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Invalid setting '%s': %s", key, err.Error())
+	}
+
+	// Plugins decoded from json don't have their maps initialized
+	for _, p := range c.Plugins {
+		if p.Run == nil {
+			p.Run = make(map[string]Run)
+		}
+		if p.Config == nil {
+			p.Config = make(map[string]interface{})
+		}
+		if p.Apps == nil {
+			p.Apps = make(map[string]*App)
+		}
+	}
+	return c, nil
+}
+
+// ConfigFromSettings creates a configuration from settings of the form key=value. Keys are the names of options
+// in heedy.conf, with nested values separated by periods, such as plugin.timeseries.config.batch_size.
+// Values are parsed as json, and are used as strings if they are not valid json for the option.
+func ConfigFromSettings(settings []string) (*Configuration, error) {
+	c := NewConfiguration()
+	for _, s := range settings {
+		sc, err := settingConfig(s)
+		if err != nil {
+			return nil, err
+		}
+		c = MergeConfig(c, sc)
+	}
+	return c, nil
+}
+
+// ConfigFromEnv creates a configuration from the HEEDY_* variables in the given environment (as returned by os.Environ).
+// The variable name after the prefix is lowercased, with double underscores separating nested values, so that
+// HEEDY_PLUGIN__TIMESERIES__CONFIG__BATCH_SIZE=100 is equivalent to the setting plugin.timeseries.config.batch_size=100
+func ConfigFromEnv(environ []string) (*Configuration, error) {
+	settings := []string{}
+	for _, e := range environ {
+		if !strings.HasPrefix(e, EnvPrefix) {
+			continue
+		}
+		e = e[len(EnvPrefix):]
+		eq := strings.IndexByte(e, '=')
+		if eq < 0 {
+			continue
+		}
+		key := strings.ReplaceAll(strings.ToLower(e[:eq]), "__", ".")
+		settings = append(settings, key+e[eq:])
+	}
+	c, err := ConfigFromSettings(settings)
+	if err != nil {
+		return nil, fmt.Errorf("%s environment variables: %w", EnvPrefix, err)
+	}
+	return c, nil
+}
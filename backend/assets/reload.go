@@ -0,0 +1,259 @@
+package assets
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// reloadableOptions are the top-level options that are read from the configuration each time they are used,
+// so changing them takes effect without restarting heedy
+var reloadableOptions = map[string]bool{
+	"log_level":               true,
+	"request_body_byte_limit": true,
+	"allow_public_websocket":  true,
+	"login_attempts":          true,
+	"login_lockout":           true,
+	"rate_limit":              true,
+	"rate_limit_burst":        true,
+	"scope":                   true,
+	"user_settings_schema":    true,
+	"admin_users":             true,
+	"registration":            true,
+	"trash_retention":         true,
+	"storage_quota":           true,
+	"user_storage_quotas":     true,
+
+	"smtp_addr":                 true,
+	"smtp_username":             true,
+	"smtp_password":             true,
+	"smtp_from":                 true,
+	"password_reset_expiration": true,
+}
+
+// ConfigChanges lists the options that differ between the running configuration and a newly loaded one
+type ConfigChanges struct {
+	// Applied holds the options that were updated in the running configuration
+	Applied []string `json:"applied"`
+	// RestartRequired holds the options that only take effect once heedy is restarted
+	RestartRequired []string `json:"restart_required"`
+}
+
+// Changed returns whether the configurations differed at all
+func (cc *ConfigChanges) Changed() bool {
+	return len(cc.Applied) > 0 || len(cc.RestartRequired) > 0
+}
+
+func (cc *ConfigChanges) apply(name string) {
+	cc.Applied = append(cc.Applied, name)
+}
+
+func (cc *ConfigChanges) restart(name string) {
+	cc.RestartRequired = append(cc.RestartRequired, name)
+}
+
+// jsonEqual compares the values by their json representation, which ignores cached (unexported) fields
+func jsonEqual(a, b interface{}) bool {
+	ab, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	bb, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return string(ab) == string(bb)
+}
+
+// changedFields calls f with the json name and values of each exported field that differs between the two structs
+func changedFields(a, b interface{}, f func(name string, av, bv reflect.Value)) {
+	av := reflect.ValueOf(a).Elem()
+	bv := reflect.ValueOf(b).Elem()
+	t := av.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" || field.Anonymous {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		if !jsonEqual(av.Field(i).Interface(), bv.Field(i).Interface()) {
+			f(name, av.Field(i), bv.Field(i))
+		}
+	}
+}
+
+// appsWithoutEvents returns a copy of the apps with their "on" blocks removed
+func appsWithoutEvents(apps map[string]*App) map[string]App {
+	res := make(map[string]App, len(apps))
+	for k, v := range apps {
+		a := *v
+		a.On = nil
+		a.Objects = make(map[string]*Object, len(v.Objects))
+		for ok, ov := range v.Objects {
+			o := *ov
+			o.On = nil
+			a.Objects[ok] = &o
+		}
+		res[k] = a
+	}
+	return res
+}
+
+// Update sets the options of the running configuration that can change without restarting heedy to their values
+// in nc, and returns the list of changes. All other options keep their current values, since the running server
+// was set up with them, and are only reported as requiring a restart.
+func (c *Configuration) Update(nc *Configuration) *ConfigChanges {
+	cc := &ConfigChanges{
+		Applied:         []string{},
+		RestartRequired: []string{},
+	}
+	c.Lock()
+	defer c.Unlock()
+
+	changedFields(c, nc, func(name string, v, nv reflect.Value) {
+		switch {
+		case name == "plugin" || name == "type":
+			// Handled separately below
+		case reloadableOptions[name]:
+			v.Set(nv)
+			cc.apply(name)
+		default:
+			cc.restart(name)
+		}
+	})
+	for _, name := range cc.Applied {
+		if name == "user_settings_schema" {
+			c.userSettingsSchema = nil
+		}
+	}
+
+	// The object type and plugin maps are read without holding the lock, so changes are made to copies,
+	// which then replace the running maps
+	types := make(map[string]ObjectType, len(c.ObjectTypes))
+	for k, ot := range c.ObjectTypes {
+		types[k] = ot
+	}
+	plugins := make(map[string]*Plugin, len(c.Plugins))
+	for k, p := range c.Plugins {
+		plugins[k] = p
+	}
+
+	// Object types can only have their scopes changed
+	for k := range nc.ObjectTypes {
+		if _, ok := c.ObjectTypes[k]; !ok {
+			cc.restart("type." + k)
+		}
+	}
+	for k, ot := range c.ObjectTypes {
+		nt, ok := nc.ObjectTypes[k]
+		if !ok {
+			cc.restart("type." + k)
+			continue
+		}
+		scope := nt.Scope
+		ot2, nt2 := ot, nt
+		ot2.Scope, nt2.Scope = nil, nil
+		if !jsonEqual(ot2, nt2) {
+			cc.restart("type." + k)
+		} else if !jsonEqual(ot.Scope, scope) {
+			ot.Scope = scope
+			types[k] = ot
+			cc.apply("type." + k + ".scope")
+		}
+	}
+
+	for pname := range nc.Plugins {
+		if _, ok := c.Plugins[pname]; !ok {
+			cc.restart("plugin." + pname)
+		}
+	}
+	for pname, p := range c.Plugins {
+		np, ok := nc.Plugins[pname]
+		if !ok {
+			cc.restart("plugin." + pname)
+			continue
+		}
+		plugins[pname] = p.update(np, "plugin."+pname+".", cc)
+	}
+	c.ObjectTypes = types
+	c.Plugins = plugins
+
+	sort.Strings(cc.Applied)
+	sort.Strings(cc.RestartRequired)
+	return cc
+}
+
+// update returns a copy of the plugin with its event subscriptions, hooks, user settings schema and cron schedules
+// set to those of np. The plugin itself is left unchanged, since it might be in use by running code.
+func (p *Plugin) update(np *Plugin, prefix string, cc *ConfigChanges) *Plugin {
+	up := *p
+	changedFields(p, np, func(name string, v, nv reflect.Value) {
+		switch name {
+		case "on":
+			up.On = np.On
+			cc.apply(prefix + name)
+		case "hook":
+			up.Hooks = np.Hooks
+			cc.apply(prefix + name)
+		case "user_settings_schema":
+			up.UserSettingsSchema = np.UserSettingsSchema
+			up.userSettingsSchema = nil
+			cc.apply(prefix + name)
+		case "apps":
+			if !jsonEqual(appsWithoutEvents(p.Apps), appsWithoutEvents(np.Apps)) {
+				cc.restart(prefix + name)
+				return
+			}
+			up.Apps = np.Apps
+			cc.apply(prefix + "apps.on")
+		case "run":
+			up.Run = make(map[string]Run, len(p.Run))
+			for rname, r := range p.Run {
+				up.Run[rname] = r
+			}
+			for rname := range np.Run {
+				if _, ok := p.Run[rname]; !ok {
+					cc.restart(prefix + "run." + rname)
+				}
+			}
+			for rname, r := range p.Run {
+				nr, ok := np.Run[rname]
+				if !ok {
+					cc.restart(prefix + "run." + rname)
+					continue
+				}
+				r2, nr2 := r, nr
+				r2.Cron, nr2.Cron = nil, nil
+				cronChanged := !jsonEqual(r.Cron, nr.Cron)
+				if !jsonEqual(r2, nr2) || cronChanged && (r.Cron == nil || nr.Cron == nil) {
+					// Switching between a cron job and a long-running process requires a restart
+					cc.restart(prefix + "run." + rname)
+				} else if cronChanged {
+					r.Cron = nr.Cron
+					up.Run[rname] = r
+					cc.apply(prefix + "run." + rname + ".cron")
+				}
+			}
+		default:
+			cc.restart(prefix + name)
+		}
+	})
+	return &up
+}
+
+// ReloadConfig loads the configuration from disk again, and updates the options of the running configuration
+// that can change without restarting heedy. If the new configuration is invalid, nothing is changed.
+func (a *Assets) ReloadConfig() (*ConfigChanges, error) {
+	na := &Assets{
+		FolderPath:     a.FolderPath,
+		ConfigOverride: a.ConfigOverride,
+	}
+	if err := na.Reload(); err != nil {
+		return nil, err
+	}
+	return a.Config.Update(na.Config), nil
+}
@@ -3,8 +3,11 @@ package assets
 import (
 	"errors"
 	"fmt"
+	"net"
 	"strings"
 	"time"
+
+	"github.com/sirupsen/logrus"
 )
 
 // The http verbs to permit in router
@@ -131,6 +134,77 @@ func Validate(c *Configuration) error {
 		}
 	}
 
+	if c.LoginLockout != nil {
+		d, err := time.ParseDuration(*c.LoginLockout)
+		if err != nil || d < 0 {
+			return errors.New("Invalid login_lockout")
+		}
+	}
+	if c.LoginAttempts != nil && *c.LoginAttempts < 0 {
+		return errors.New("login_attempts can't be negative")
+	}
+	if c.RateLimit != nil && *c.RateLimit < 0 {
+		return errors.New("rate_limit can't be negative")
+	}
+	if c.RateLimitBurst != nil && *c.RateLimitBurst < 1 {
+		return errors.New("rate_limit_burst must be at least 1")
+	}
+
+	if (c.TLSCert == nil || *c.TLSCert == "") != (c.TLSKey == nil || *c.TLSKey == "") {
+		return errors.New("tls_cert and tls_key must be set together")
+	}
+	if c.TLSRedirectAddr != nil && *c.TLSRedirectAddr != "" && (c.TLSCert == nil || *c.TLSCert == "") {
+		return errors.New("tls_redirect_addr requires tls_cert and tls_key to be set")
+	}
+
+	if c.MQTTAddr != nil && *c.MQTTAddr != "" {
+		if _, _, err := net.SplitHostPort(*c.MQTTAddr); err != nil {
+			return errors.New("Invalid mqtt_addr")
+		}
+	}
+
+	if c.SMTPAddr != nil && *c.SMTPAddr != "" {
+		if _, _, err := net.SplitHostPort(*c.SMTPAddr); err != nil {
+			return errors.New("Invalid smtp_addr")
+		}
+		if c.SMTPFrom == nil || *c.SMTPFrom == "" {
+			return errors.New("smtp_from must be set to send email")
+		}
+	}
+	if c.PasswordResetExpiration != nil {
+		d, err := time.ParseDuration(*c.PasswordResetExpiration)
+		if err != nil || d <= 0 {
+			return errors.New("Invalid password_reset_expiration")
+		}
+	}
+
+	if c.Registration != nil && *c.Registration != "invite" && *c.Registration != "approval" && *c.Registration != "open" {
+		return errors.New("Invalid registration: must be one of invite, approval or open")
+	}
+
+	if c.LogLevel != nil {
+		if _, err := logrus.ParseLevel(*c.LogLevel); err != nil {
+			return errors.New("Invalid log_level")
+		}
+	}
+
+	if c.StorageQuota != nil && *c.StorageQuota < 0 {
+		return errors.New("storage_quota can't be negative")
+	}
+	if c.UserStorageQuotas != nil {
+		for u, q := range *c.UserStorageQuotas {
+			if q < 0 {
+				return fmt.Errorf("The storage quota of %s can't be negative", u)
+			}
+		}
+	}
+	if c.TrashRetention != nil {
+		d, err := time.ParseDuration(*c.TrashRetention)
+		if err != nil || d < 0 {
+			return errors.New("Invalid trash_retention")
+		}
+	}
+
 	// Now make sure all runners are set up correctly
 	runners := make(map[string]*JSONSchema)
 	for k, v := range c.RunTypes {
@@ -196,6 +270,14 @@ func Validate(c *Configuration) error {
 				return err
 			}
 		}
+		for _, h := range p.Hooks {
+			if err := h.Validate(); err != nil {
+				return fmt.Errorf("Plugin %s: %w", pname, err)
+			}
+			if err := isValidTarget(c, pname, *h.Post); err != nil {
+				return err
+			}
+		}
 		for appname, app := range p.Apps {
 			for _, e := range app.On {
 				if e.Post == nil {
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/heedy/heedy/backend/assets"
+)
+
+var ConfigCmd = &cobra.Command{
+	Use:   "config [location of database]",
+	Short: "Shows the effective configuration",
+	Long:  `Validates and prints the configuration that heedy would run with as json. It merges the builtin configuration, active plugins, heedy.conf, HEEDY_* environment variables and --set flags.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		directory, err := GetDirectory(args)
+		if err != nil {
+			return err
+		}
+		c, err := configOverride()
+		if err != nil {
+			return err
+		}
+		a, err := assets.Open(directory, c)
+		if err != nil {
+			return err
+		}
+		b, err := json.MarshalIndent(a.Config, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(ConfigCmd)
+}
@@ -22,6 +22,7 @@ var (
 	addr       string
 	username   string
 	password   string
+	selfSigned bool
 )
 
 // CreateCmd creates a new database
@@ -69,6 +70,7 @@ It is recommended that new users use the web setup, which will guide you in prep
 				UserName: username,
 				Password: password,
 			},
+			SelfSignedTLS: selfSigned,
 		}
 
 		if noserver {
@@ -119,6 +121,7 @@ func init() {
 	CreateCmd.Flags().StringVarP(&configFile, "config", "c", "", "Path to an existing configuration file to use for the database.")
 	CreateCmd.Flags().StringVar(&username, "username", "", "Default user's username")
 	CreateCmd.Flags().StringVar(&password, "password", "", "Default user's password")
+	CreateCmd.Flags().BoolVar(&selfSigned, "tls", false, "Generate a self-signed certificate, and serve heedy over https")
 	CreateCmd.Flags().StringVar(&testapp, "testapp", "", "Whether to create a test app with the given access token. Only works in noserver mode")
 
 	RootCmd.AddCommand(CreateCmd)
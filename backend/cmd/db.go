@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/heedy/heedy/backend/database"
+)
+
+var migrateDryRun bool
+var checkRepair bool
+var checkJSON bool
+
+// DBCmd groups the command-line tools for maintaining the database
+var DBCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Maintenance of the heedy database",
+}
+
+// MigrateCmd upgrades the core tables of an old database to the current schema
+var MigrateCmd = &cobra.Command{
+	Use:   "migrate [location of database]",
+	Short: "Upgrades the database to the current schema",
+	Long: `Upgrades heedy's core tables to the schema used by this version of heedy, backing up the database to data/backups first.
+Migrations also run automatically when heedy starts. With --dry-run, the pending migrations are only listed.
+The database can't be migrated while heedy is running, unless --force is given.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		a, err := openAssets(args)
+		if err != nil {
+			return err
+		}
+		db, err := database.OpenWithoutMigrations(a)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		curversion, err := db.ReadPluginDatabaseVersion("heedy")
+		if err != nil {
+			return err
+		}
+		pending, err := database.CoreMigrations.Pending(curversion)
+		if err != nil {
+			return err
+		}
+		if len(pending) == 0 {
+			fmt.Printf("The database is up to date at version %d\n", curversion)
+			return nil
+		}
+		for _, m := range pending {
+			fmt.Printf("%d -> %d: %s\n", m.Version-1, m.Version, m.Description)
+		}
+		if migrateDryRun {
+			return nil
+		}
+		if err = checkRunning(a.FolderPath); err != nil {
+			return err
+		}
+		if err = db.Migrate("heedy", database.CoreMigrations); err != nil {
+			return err
+		}
+		fmt.Printf("Migrated the database to version %d\n", database.CoreMigrations.Latest())
+		return nil
+	},
+}
+
+// CheckCmd verifies the consistency of the database, optionally repairing the problems it finds
+var CheckCmd = &cobra.Command{
+	Use:   "check [location of database]",
+	Short: "Checks the database for corruption and inconsistencies",
+	Long: `Runs sqlite's integrity check, finds rows that belong to deleted objects, apps or users, and verifies the data of plugins,
+such as whether each timeseries batch can be decoded and matches its metadata. With --repair, the problems that can be fixed
+automatically are repaired. Back up the database before repairing it. The command fails if any problems remain.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := OpenDatabase(args)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		r, err := db.Check(checkRepair)
+		if err != nil {
+			return err
+		}
+		if checkJSON {
+			if err = printJSON(r); err != nil {
+				return err
+			}
+		}
+		remaining := 0
+		for _, p := range r.Problems {
+			if !p.Repaired {
+				remaining++
+			}
+			if checkJSON {
+				continue
+			}
+			msg := p.Description
+			if p.Object != "" {
+				msg = fmt.Sprintf("object %s: %s", p.Object, msg)
+			}
+			switch {
+			case p.Repaired:
+				msg += " (repaired)"
+			case p.RepairError != "":
+				msg += fmt.Sprintf(" (repair failed: %s)", p.RepairError)
+			case p.Repair != "":
+				msg += fmt.Sprintf(" (repair: %s)", p.Repair)
+			}
+			fmt.Printf("[%s] %s\n", p.Check, msg)
+		}
+		if remaining > 0 {
+			return fmt.Errorf("Found %d problems that were not repaired", remaining)
+		}
+		if !checkJSON {
+			fmt.Printf("The database is consistent\n")
+		}
+		return nil
+	},
+}
+
+// VacuumCmd compacts the database file
+var VacuumCmd = &cobra.Command{
+	Use:   "vacuum [location of database]",
+	Short: "Compacts the database file",
+	Long: `Rebuilds the database file, which returns the space freed by deleted data to the filesystem.
+The database is locked while it is rebuilt, and the rebuild temporarily needs up to twice the space of the database.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := OpenDatabase(args)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		reclaimed, err := db.Vacuum()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Reclaimed %d bytes\n", reclaimed)
+		return nil
+	},
+}
+
+func init() {
+	MigrateCmd.Flags().BoolVar(&migrateDryRun, "dry-run", false, "Only list the pending migrations, without changing the database")
+	CheckCmd.Flags().BoolVar(&checkRepair, "repair", false, "Repair the problems that can be fixed automatically")
+	CheckCmd.Flags().BoolVar(&checkJSON, "json", false, "Output the report as json")
+	DBCmd.AddCommand(MigrateCmd, CheckCmd, VacuumCmd)
+	RootCmd.AddCommand(DBCmd)
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/heedy/heedy/backend/database"
+)
+
+var listJSON bool
+var listObjects database.ListObjectsOptions
+var purgeObject bool
+
+// printJSON writes the value to stdout as indented json
+func printJSON(v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+	return nil
+}
+
+func strOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// ObjectCmd groups the command-line tools for managing objects
+var ObjectCmd = &cobra.Command{
+	Use:   "object",
+	Short: "Manage the objects in a database",
+}
+
+// ListObjectsCmd shows the objects in the database
+var ListObjectsCmd = &cobra.Command{
+	Use:   "list [location of database]",
+	Short: "Lists the objects",
+	Long:  `Lists the objects in the database. Objects in the trash are not shown.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := OpenDatabase(args)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		// Unset flags don't filter the results
+		o := listObjects
+		for _, s := range []**string{&o.Owner, &o.App, &o.Key, &o.Tags, &o.Type} {
+			if **s == "" {
+				*s = nil
+			}
+		}
+		if *o.Limit <= 0 {
+			o.Limit = nil
+		}
+		objects, err := db.ListObjects(&o)
+		if err != nil {
+			return err
+		}
+		if listJSON {
+			if objects == nil {
+				objects = []*database.Object{}
+			}
+			return printJSON(objects)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tTYPE\tOWNER\tAPP\tTAGS")
+		for _, s := range objects {
+			tags := ""
+			if s.Tags != nil {
+				tags = strings.Join(s.Tags.Strings, " ")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", s.ID, strOrEmpty(s.Name), strOrEmpty(s.Type), strOrEmpty(s.Owner), strOrEmpty(s.App), tags)
+		}
+		return w.Flush()
+	},
+}
+
+// DelObjectCmd moves an object to the trash, or permanently deletes it
+var DelObjectCmd = &cobra.Command{
+	Use:   "delete [object id] [location of database]",
+	Short: "Deletes the object",
+	Long:  `Moves the object to the trash, from which it is removed after trash_retention. With --purge, the object and its data are deleted immediately.`,
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := OpenDatabase(args[1:])
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		if purgeObject {
+			if err = db.PurgeObject(args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("Permanently deleted object %s\n", args[0])
+			return nil
+		}
+		if err = db.DelObject(args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("Deleted object %s\n", args[0])
+		return nil
+	},
+}
+
+func init() {
+	lf := ListObjectsCmd.Flags()
+	listObjects.Owner = lf.String("owner", "", "Only list the objects of the given user")
+	listObjects.App = lf.String("app", "", "Only list the objects of the given app")
+	listObjects.Key = lf.String("key", "", "Only list objects with the given key")
+	listObjects.Tags = lf.String("tags", "", "Only list objects with all of the given space-separated tags")
+	listObjects.Type = lf.String("type", "", "Only list objects of the given type")
+	listObjects.Limit = lf.Int("limit", 0, "The maximum number of objects to list")
+	lf.BoolVar(&listJSON, "json", false, "Output the objects as json")
+	DelObjectCmd.Flags().BoolVar(&purgeObject, "purge", false, "Permanently delete the object instead of moving it to the trash")
+	ObjectCmd.AddCommand(ListObjectsCmd, DelObjectCmd)
+	RootCmd.AddCommand(ObjectCmd)
+}
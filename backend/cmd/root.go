@@ -17,6 +17,7 @@ import (
 
 	"github.com/heedy/heedy/backend/assets"
 	"github.com/heedy/heedy/backend/buildinfo"
+	"github.com/heedy/heedy/backend/database"
 	"github.com/heedy/heedy/backend/server"
 	"github.com/heedy/heedy/backend/updater"
 )
@@ -28,6 +29,7 @@ var (
 )
 
 var verbose bool
+var settings []string
 var revert bool
 var applyUpdates bool
 
@@ -100,6 +102,10 @@ var RootCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
+		c, err = configOverride()
+		if err != nil {
+			return err
+		}
 		logrus.Infof("Using database at %s", directory)
 		if err = writepid(directory); err != nil {
 			return err
@@ -161,6 +167,22 @@ func Execute() {
 	}
 }
 
+// configOverride returns the configuration set by HEEDY_* environment variables and --set flags, which
+// overrides the options in heedy.conf
+func configOverride() (*assets.Configuration, error) {
+	ec, err := assets.ConfigFromEnv(os.Environ())
+	if err != nil {
+		return nil, err
+	}
+	sc, err := assets.ConfigFromSettings(settings)
+	if err != nil {
+		return nil, err
+	}
+	c := assets.MergeConfig(ec, sc)
+	c.Verbose = verbose
+	return c, nil
+}
+
 func GetDirectory(args []string) (string, error) {
 	if len(args) > 1 {
 		return "", ErrTooManyArgs
@@ -184,6 +206,30 @@ func GetDirectory(args []string) (string, error) {
 	return directory, err
 }
 
+// openAssets opens the assets of the database in the directory given in args, with the configuration
+// overridden by environment variables and --set flags
+func openAssets(args []string) (*assets.Assets, error) {
+	directory, err := GetDirectory(args)
+	if err != nil {
+		return nil, err
+	}
+	c, err := configOverride()
+	if err != nil {
+		return nil, err
+	}
+	return assets.Open(directory, c)
+}
+
+// OpenDatabase opens the database in the directory given in args directly, without starting the server,
+// which allows managing its contents from the command line even if heedy won't start.
+func OpenDatabase(args []string) (*database.AdminDB, error) {
+	a, err := openAssets(args)
+	if err != nil {
+		return nil, err
+	}
+	return database.Open(a)
+}
+
 func getpid(directory string) (*os.Process, error) {
 	b, err := ioutil.ReadFile(path.Join(directory, "heedy.pid"))
 	if err != nil {
@@ -196,19 +242,25 @@ func getpid(directory string) (*os.Process, error) {
 	return os.FindProcess(pid)
 }
 
+// checkRunning returns an error if another heedy instance is running in the directory, unless --force is given
+func checkRunning(cdir string) error {
+	p, err := getpid(cdir)
+	if err == nil && os.Getpid() != p.Pid && p.Signal(syscall.Signal(0)) == nil && !forceRun {
+		return fmt.Errorf("Heedy is already running at pid %d", p.Pid)
+	}
+	return nil
+}
+
 func writepid(cdir string) error {
 	// First check if the pid exists and is running
 	p, err := getpid(cdir)
-	if err == nil {
-		if os.Getpid() == p.Pid {
-			// The pid written is same as current process. This happens whenever heedy is updated,
-			// since heedy replaces itself with a new instance (inheriting the pid), so the correct pid is already written.
-			return nil
-		}
-		err = p.Signal(syscall.Signal(0))
-		if err == nil && !forceRun {
-			return fmt.Errorf("Heedy is already running at pid %d", p.Pid)
-		}
+	if err == nil && os.Getpid() == p.Pid {
+		// The pid written is same as current process. This happens whenever heedy is updated,
+		// since heedy replaces itself with a new instance (inheriting the pid), so the correct pid is already written.
+		return nil
+	}
+	if err = checkRunning(cdir); err != nil {
+		return err
 	}
 
 	// Create pid
@@ -221,9 +273,10 @@ func delpid(directory string) error {
 
 func init() {
 	RootCmd.PersistentFlags().BoolVar(&verbose, "verbose", false, "Extremely verbose logging of server requests and responses. Only works in DEBUG log level.")
+	RootCmd.PersistentFlags().StringArrayVar(&settings, "set", nil, "Overrides a configuration option from heedy.conf (key=value, such as --set rate_limit=10 or --set plugin.timeseries.config.batch_size=1000)")
 	RootCmd.PersistentFlags().BoolVar(&revert, "revert", false, "Reverts an update from backup if server fails to start")
 	RootCmd.PersistentFlags().BoolVar(&applyUpdates, "update", false, "Applies any pending updates")
-	RootCmd.PersistentFlags().BoolVar(&forceRun, "force", false, "Force the server to start even if it detects a running heedy instance")
+	RootCmd.PersistentFlags().BoolVar(&forceRun, "force", false, "Force the server to start, or the database to be migrated, even if it detects a running heedy instance")
 	RootCmd.PersistentFlags().StringVar(&cpuprofile, "cpuprofile", "", "Saves a CPU profile to the given file")
 	RootCmd.PersistentFlags().StringVar(&memprofile, "memprofile", "", "Saves a memory profile to the given file")
 }
@@ -17,8 +17,10 @@ var RunCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		c := assets.NewConfiguration()
-		c.Verbose = verbose
+		c, err := configOverride()
+		if err != nil {
+			return err
+		}
 
 		if err = writepid(directory); err != nil {
 			return err
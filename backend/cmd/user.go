@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+
+	"github.com/heedy/heedy/backend/database"
+)
+
+var newPassword string
+var newUserName string
+var newUserAdmin bool
+var removeAdmin bool
+
+// UserCmd groups the command-line tools for managing users
+var UserCmd = &cobra.Command{
+	Use:   "user",
+	Short: "Manage the users of a database",
+}
+
+// readNewPassword asks for the new password on the terminal
+func readNewPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		return "", errors.New("No password given: use the --password flag")
+	}
+	fmt.Print("New password: ")
+	p1, err := terminal.ReadPassword(fd)
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+	fmt.Print("Repeat password: ")
+	p2, err := terminal.ReadPassword(fd)
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+	if string(p1) != string(p2) {
+		return "", errors.New("The passwords don't match")
+	}
+	return string(p1), nil
+}
+
+// ResetPasswordCmd sets a user's password directly in the database
+var ResetPasswordCmd = &cobra.Command{
+	Use:   "reset-password [username] [location of database]",
+	Short: "Sets a new password for the user",
+	Long: `Sets a new password for the user directly in the database, which allows recovering from a forgotten admin password.
+All of the user's sessions are logged out. If --password is not given, the password is read from the terminal.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := OpenDatabase(args[1:])
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		password := newPassword
+		if password == "" {
+			if password, err = readNewPassword(); err != nil {
+				return err
+			}
+		}
+		if err = db.SetUserPassword(args[0], password); err != nil {
+			return err
+		}
+		fmt.Printf("Set the password of %s\n", args[0])
+		return nil
+	},
+}
+
+// AddUserCmd creates a new user directly in the database
+var AddUserCmd = &cobra.Command{
+	Use:   "add [username] [location of database]",
+	Short: "Creates a new user",
+	Long:  `Creates a new user directly in the database. If --password is not given, the password is read from the terminal.`,
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := OpenDatabase(args[1:])
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		password := newPassword
+		if password == "" {
+			if password, err = readNewPassword(); err != nil {
+				return err
+			}
+		}
+		u := &database.User{
+			UserName: &args[0],
+			Password: &password,
+		}
+		if newUserName != "" {
+			u.Name = &newUserName
+		}
+		if err = db.CreateUser(u); err != nil {
+			return err
+		}
+		if newUserAdmin {
+			if err = db.Assets().AddAdmin(args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("Created admin user %s\n", args[0])
+			return nil
+		}
+		fmt.Printf("Created user %s\n", args[0])
+		return nil
+	},
+}
+
+// ListUsersCmd shows the users in the database
+var ListUsersCmd = &cobra.Command{
+	Use:   "list [location of database]",
+	Short: "Lists the users",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := OpenDatabase(args)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		users, err := db.ListUsers(nil)
+		if err != nil {
+			return err
+		}
+		a := db.Assets()
+		if listJSON {
+			type adminUser struct {
+				*database.User
+				Admin bool `json:"admin"`
+			}
+			ul := make([]adminUser, len(users))
+			for i, u := range users {
+				u.Password = nil
+				ul[i] = adminUser{u, a.IsAdmin(*u.UserName)}
+			}
+			return printJSON(ul)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "USERNAME\tNAME\tADMIN")
+		for _, u := range users {
+			fmt.Fprintf(w, "%s\t%s\t%v\n", *u.UserName, strOrEmpty(u.Name), a.IsAdmin(*u.UserName))
+		}
+		return w.Flush()
+	},
+}
+
+// DelUserCmd deletes a user, along with all of their apps and objects
+var DelUserCmd = &cobra.Command{
+	Use:   "delete [username] [location of database]",
+	Short: "Deletes the user and all of their data",
+	Long:  `Deletes the user along with all of their apps and objects. The user is also removed from the admin users.`,
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := OpenDatabase(args[1:])
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		if err = db.DelUser(args[0]); err != nil {
+			return err
+		}
+		if err = db.Assets().RemAdmin(args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("Deleted user %s\n", args[0])
+		return nil
+	},
+}
+
+// SetAdminCmd gives or removes a user's admin status, which is stored in heedy.conf
+var SetAdminCmd = &cobra.Command{
+	Use:   "set-admin [username] [location of database]",
+	Short: "Makes the user an admin",
+	Long:  `Adds the user to admin_users in heedy.conf. With --remove, the user's admin status is removed instead.`,
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := OpenDatabase(args[1:])
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		a := db.Assets()
+		if removeAdmin {
+			if err = a.RemAdmin(args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("%s is no longer an admin\n", args[0])
+			return nil
+		}
+		if _, err = db.ReadUser(args[0], nil); err != nil {
+			return err
+		}
+		if err = a.AddAdmin(args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("%s is now an admin\n", args[0])
+		return nil
+	},
+}
+
+func init() {
+	ResetPasswordCmd.Flags().StringVar(&newPassword, "password", "", "The new password. Read from the terminal if not given.")
+	AddUserCmd.Flags().StringVar(&newPassword, "password", "", "The user's password. Read from the terminal if not given.")
+	AddUserCmd.Flags().StringVar(&newUserName, "name", "", "The user's full name")
+	AddUserCmd.Flags().BoolVar(&newUserAdmin, "admin", false, "Make the user an admin")
+	ListUsersCmd.Flags().BoolVar(&listJSON, "json", false, "Output the users as json")
+	SetAdminCmd.Flags().BoolVar(&removeAdmin, "remove", false, "Remove the user's admin status instead")
+	UserCmd.AddCommand(ResetPasswordCmd, AddUserCmd, ListUsersCmd, DelUserCmd, SetAdminCmd)
+	RootCmd.AddCommand(UserCmd)
+}
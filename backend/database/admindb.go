@@ -11,6 +11,7 @@ import (
 	"github.com/heedy/heedy/backend/assets"
 	"github.com/heedy/heedy/backend/database/dbutil"
 	"github.com/heedy/heedy/backend/events"
+	"github.com/patrickmn/go-cache"
 	"github.com/sirupsen/logrus"
 )
 
@@ -19,6 +20,9 @@ type AdminDB struct {
 	SqlxCache
 
 	a *assets.Assets
+
+	// storageUsage caches the bytes used by each user when checking storage quotas
+	storageUsage *cache.Cache
 }
 
 func (db *AdminDB) ReadPluginDatabaseVersion(plugin string) (int, error) {
@@ -46,6 +50,13 @@ func (db *AdminDB) As(identifier string) (DB, error) {
 	if identifier == "public" {
 		return NewPublicDB(db), nil
 	}
+	if strings.HasPrefix(identifier, "share:") {
+		l, err := db.ReadShareLink(identifier[len("share:"):])
+		if err != nil {
+			return nil, err
+		}
+		return NewShareLinkDB(db, l), nil
+	}
 	// Now check if there is a slash in the identifier
 	i := strings.Index(identifier, "/")
 
@@ -53,6 +64,16 @@ func (db *AdminDB) As(identifier string) (DB, error) {
 	if i > -1 {
 		username = identifier[:i]
 		appid := identifier[i+1:]
+		if strings.HasPrefix(appid, "token:") {
+			t, err := db.ReadUserToken(appid[len("token:"):])
+			if err != nil {
+				return nil, err
+			}
+			if t.Owner != username {
+				return nil, fmt.Errorf("User %s doesn't have access token %s", username, t.ID)
+			}
+			return NewTokenDB(db, t), nil
+		}
 		app, err := db.ReadApp(appid, nil)
 		if err != nil {
 			return nil, err
@@ -141,7 +162,7 @@ func (db *AdminDB) GetAppByAccessToken(accessToken string) (*App, error) {
 		return nil, ErrNotFound
 	}
 	c := &App{}
-	err := db.Get(c, "SELECT * FROM apps WHERE (access_token=?) LIMIT 1;", accessToken)
+	err := db.Get(c, "SELECT * FROM apps WHERE (access_token=?) AND deleted_date IS NULL LIMIT 1;", accessToken)
 	if err == sql.ErrNoRows {
 		return nil, ErrNotFound
 	}
@@ -263,11 +284,14 @@ func (db *AdminDB) CreateObject(s *Object) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	if err = db.checkCreateQuota(s); err != nil {
+		return "", err
+	}
 
 	if s.App != nil {
 		// We must insert while also setting the owner to the app's owner
 		sValues = append(sValues, *s.App)
-		result, err := db.Exec(fmt.Sprintf("INSERT INTO objects (%s,owner) VALUES (%s,(SELECT owner FROM apps WHERE id=?));", sColumns, QQ(len(sValues)-1)), sValues...)
+		result, err := db.Exec(fmt.Sprintf("INSERT INTO objects (%s,owner) VALUES (%s,(SELECT owner FROM apps WHERE id=? AND deleted_date IS NULL));", sColumns, QQ(len(sValues)-1)), sValues...)
 		err = GetExecError(result, err)
 
 		return s.ID, err
@@ -282,19 +306,18 @@ func (db *AdminDB) CreateObject(s *Object) (string, error) {
 
 // ReadObject gets the object by ID
 func (db *AdminDB) ReadObject(id string, o *ReadObjectOptions) (s *Object, err error) {
-	s, err = readObject(db, id, o, `SELECT *,'["*"]' AS access FROM objects WHERE (id=?) LIMIT 1;`, id)
+	s, err = readObject(db, id, o, `SELECT *,'["*"]' AS access FROM objects WHERE (id=?) AND `+objectNotTrashed+` LIMIT 1;`, id)
 	return
 }
 
 // UpdateObject updates the given object by ID
 func (db *AdminDB) UpdateObject(s *Object) error {
-	return updateObject(db, s, `SELECT type,'["*"]' AS access FROM objects WHERE id=? LIMIT 1;`, s.ID)
+	return updateObject(db, s, `SELECT type,'["*"]' AS access FROM objects WHERE id=? AND `+objectNotTrashed+` LIMIT 1;`, s.ID)
 }
 
-// DelObject deletes the given object
+// DelObject moves the given object to the trash
 func (db *AdminDB) DelObject(id string) error {
-	result, err := db.Exec("DELETE FROM objects WHERE id=?;", id)
-	return GetExecError(result, err)
+	return trashObject(db, "id=?", id)
 }
 
 // ShareObject shares the given object with the given user, allowing the given set of scope
@@ -327,7 +350,7 @@ func (db *AdminDB) GetObjectShares(objectid string) (m map[string]*ScopeArray, e
 
 // ListObjects lists the given objects
 func (db *AdminDB) ListObjects(o *ListObjectsOptions) ([]*Object, error) {
-	return listObjects(db, o, `SELECT *,'["*"]' AS access FROM objects WHERE %s %s;`)
+	return listObjects(db, o, `SELECT *,'["*"]' AS access FROM objects WHERE %s AND `+objectNotTrashed+` %s;`)
 }
 
 // CreateApp creates a new app. Nuff said.
@@ -358,7 +381,7 @@ func (db *AdminDB) CreateApp(c *App) (string, string, error) {
 
 // ReadApp gets the app associated with the given API key
 func (db *AdminDB) ReadApp(aid string, o *ReadAppOptions) (*App, error) {
-	return readApp(db, aid, o, "SELECT * FROM apps WHERE (id=?) LIMIT 1;", aid)
+	return readApp(db, aid, o, "SELECT * FROM apps WHERE (id=?) AND deleted_date IS NULL LIMIT 1;", aid)
 }
 
 // UpdateApp updates the given app (by ID). Note that the inserted values will be written directly to
@@ -424,35 +447,30 @@ func (db *AdminDB) UpdateApp(c *App) (err error) {
 	cValues = append(cValues, c.ID)
 
 	// Allow updating groups that are not users
-	result, err := tx.Exec(fmt.Sprintf("UPDATE apps SET %s WHERE id=?;", cColumns), cValues...)
+	result, err := tx.Exec(fmt.Sprintf("UPDATE apps SET %s WHERE id=? AND deleted_date IS NULL;", cColumns), cValues...)
 	return GetExecError(result, err)
 
 }
 
-// DelApp deletes the given app.
+// DelApp moves the given app to the trash.
 func (db *AdminDB) DelApp(id string) error {
-	result, err := db.Exec("DELETE FROM apps WHERE id=?;", id)
-	return GetExecError(result, err)
+	return trashApp(db, "id=?", id)
 }
 
 // ListApps lists apps
 func (db *AdminDB) ListApps(o *ListAppOptions) ([]*App, error) {
 	a := []interface{}{}
-	selectStmt := "SELECT * FROM apps"
-	if o != nil && (o.Owner != nil || o.Plugin != nil) {
-		selectStmt = selectStmt + " WHERE"
+	selectStmt := "SELECT * FROM apps WHERE deleted_date IS NULL"
+	if o != nil {
 		if o.Owner != nil {
-			selectStmt = selectStmt + " owner=?"
+			selectStmt = selectStmt + " AND owner=?"
 			a = append(a, *o.Owner)
 		}
 		if o.Plugin != nil {
-			if o.Owner != nil {
-				selectStmt = selectStmt + " AND"
-			}
 			if *o.Plugin == "" {
-				selectStmt = selectStmt + " plugin IS NULL"
+				selectStmt = selectStmt + " AND plugin IS NULL"
 			} else {
-				selectStmt = selectStmt + " plugin=?"
+				selectStmt = selectStmt + " AND plugin=?"
 				a = append(a, *o.Plugin)
 			}
 
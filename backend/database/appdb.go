@@ -2,7 +2,6 @@ package database
 
 import (
 	"errors"
-	"fmt"
 	"strings"
 )
 
@@ -159,13 +158,20 @@ func (db *AppDB) ListUsers(o *ListUsersOptions) ([]*User, error) {
 
 // CanCreateObject returns whether the given object can be
 func (db *AppDB) CanCreateObject(s *Object) error {
-	_, _, err := objectCreateQuery(db.adb.Assets().Config, s)
+	if s.App != nil && *s.App != "self" && *s.App != db.c.ID {
+		return ErrAccessDenied("Can't create a object for a different app")
+	}
+	if s.Owner != nil && *s.Owner != *db.c.Owner {
+		return ErrAccessDenied("Can't create a object for a different user")
+	}
+	// The object will belong to the app, just like in CreateObject
+	so := *s
+	so.App = &db.c.ID
+	so.Owner = nil
+	_, _, err := objectCreateQuery(db.adb.Assets().Config, &so)
 	if err != nil {
 		return err
 	}
-	if s.App != nil && *s.App != db.c.ID {
-		return ErrAccessDenied("Can't create a object for a different app")
-	}
 	if !db.c.Scope.HasScope("self.objects:create") && !db.c.Scope.HasScope("self.objects."+*s.Type+":create") {
 		return ErrAccessDenied("Insufficient access to create a object of this type")
 	}
@@ -233,15 +239,7 @@ func (db *AppDB) UpdateObject(s *Object) error {
 		}
 	}
 
-	sColumns, sValues, err := objectUpdateQuery(db.adb.Assets().Config, s, *curs.Type)
-	if err != nil {
-		return err
-	}
-
-	sValues = append(sValues, s.ID)
-
-	result, err := db.adb.Exec(fmt.Sprintf("UPDATE objects SET %s WHERE id=?;", sColumns), sValues...)
-	return GetExecError(result, err)
+	return writeObjectUpdate(db.adb, s, *curs.Type)
 }
 
 // Can only delete objects that belong to *us*
@@ -256,8 +254,7 @@ func (db *AppDB) DelObject(id string) error {
 	if !curs.Access.HasScope("delete") {
 		return ErrAccessDenied("Insufficient permissions to delete the object")
 	}
-	result, err := db.adb.Exec("DELETE FROM objects WHERE id=?;", id)
-	return GetExecError(result, err)
+	return trashObject(db.adb, "id=?", id)
 }
 
 func (db *AppDB) ShareObject(objectid, userid string, sa *ScopeArray) error {
@@ -306,7 +303,7 @@ func (db *AppDB) ReadApp(cid string, o *ReadAppOptions) (*App, error) {
 	if cid != db.c.ID {
 		return nil, ErrAccessDenied("Can't read other apps")
 	}
-	return readApp(db.adb, cid, o, `SELECT * FROM apps WHERE owner=? AND id=?;`, *db.c.Owner, cid)
+	return readApp(db.adb, cid, o, `SELECT * FROM apps WHERE owner=? AND id=? AND deleted_date IS NULL;`, *db.c.Owner, cid)
 }
 func (db *AppDB) UpdateApp(c *App) error {
 	if c.ID == "self" {
@@ -321,7 +318,7 @@ func (db *AppDB) UpdateApp(c *App) error {
 	if c.Plugin != nil {
 		return ErrAccessDenied("Cannot modify app plugin value")
 	}
-	return updateApp(db.adb, c, "id=?", c.ID)
+	return updateApp(db.adb, c, "id=? AND deleted_date IS NULL", c.ID)
 }
 func (db *AppDB) DelApp(cid string) error {
 	return ErrUnimplemented
@@ -330,6 +327,16 @@ func (db *AppDB) ListApps(o *ListAppOptions) ([]*App, error) {
 	return nil, ErrUnimplemented
 }
 
+func (db *AppDB) ListTrash(owner string) (*Trash, error) {
+	return nil, ErrUnimplemented
+}
+func (db *AppDB) RestoreObject(id string) error {
+	return ErrUnimplemented
+}
+func (db *AppDB) RestoreApp(cid string) error {
+	return ErrUnimplemented
+}
+
 func (db *AppDB) ReadUserSettings(username string) (map[string]map[string]interface{}, error) {
 	return nil, ErrUnimplemented
 }
@@ -32,6 +32,14 @@ func TestAppObject(t *testing.T) {
 
 	name := "tree"
 	stype := "timeseries"
+	self := "self"
+	other := "other"
+	// Objects without an app, or with the app "self", belong to the app
+	require.NoError(t, cdb.CanCreateObject(&Object{Details: Details{Name: &name}, Type: &stype}))
+	require.NoError(t, cdb.CanCreateObject(&Object{Details: Details{Name: &name}, Type: &stype, App: &self}))
+	require.Error(t, cdb.CanCreateObject(&Object{Details: Details{Name: &name}, Type: &stype, App: &other}))
+	require.NoError(t, udb.CanCreateObject(&Object{Details: Details{Name: &name}, Type: &stype}))
+
 	sid, err := cdb.CreateObject(&Object{
 		Details: Details{
 			Name: &name,
@@ -0,0 +1,237 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// CheckProblem is an inconsistency found in the database by Check
+type CheckProblem struct {
+	// Check is the name of the check that found the problem, such as integrity or orphans
+	Check string `json:"check"`
+	// Object is the ID of the object that has the problem, if the problem belongs to an object
+	Object      string `json:"object,omitempty"`
+	Description string `json:"description"`
+
+	// Repair describes how the problem is fixed by a repair. It is empty if the problem can't be repaired automatically.
+	Repair   string `json:"repair,omitempty"`
+	Repaired bool   `json:"repaired"`
+	// RepairError is set if the repair was attempted, but failed
+	RepairError string `json:"repair_error,omitempty"`
+}
+
+// CheckReport holds the problems found by a database check
+type CheckReport struct {
+	Problems []*CheckProblem `json:"problems"`
+}
+
+// CheckHook checks the consistency of a plugin's data, returning the problems it found.
+// If repair is true, the problems that can be fixed automatically are also repaired.
+type CheckHook func(db *AdminDB, repair bool) ([]*CheckProblem, error)
+
+var checkHooks = make([]CheckHook, 0)
+
+// AddCheckHook registers a check of plugin data that is run along with the core database checks
+func AddCheckHook(f CheckHook) {
+	checkHooks = append(checkHooks, f)
+}
+
+// RepairWith runs the repair function if repair is true, recording its result in the problem
+func (p *CheckProblem) RepairWith(repair bool, f func() error) {
+	if !repair || p.Repair == "" {
+		return
+	}
+	if err := f(); err != nil {
+		p.RepairError = err.Error()
+		return
+	}
+	p.Repaired = true
+}
+
+// checkIntegrity runs sqlite's integrity check, which finds corruption of the database file
+func checkIntegrity(db *AdminDB) ([]*CheckProblem, error) {
+	var res []string
+	if err := db.DB.Select(&res, "PRAGMA integrity_check;"); err != nil {
+		return nil, err
+	}
+	problems := []*CheckProblem{}
+	for _, r := range res {
+		if r != "ok" {
+			problems = append(problems, &CheckProblem{
+				Check:       "integrity",
+				Description: r,
+			})
+		}
+	}
+	return problems, nil
+}
+
+// checkOrphans finds the rows of the registered object, app and user tables that belong to an object,
+// app or user that no longer exists, which can happen if they were written with foreign keys disabled
+func checkOrphans(db *AdminDB, repair bool) ([]*CheckProblem, error) {
+	parents := []struct {
+		table, column string
+		tables        []StorageTable
+	}{
+		{"objects", "id", objectStorage},
+		{"apps", "id", appStorage},
+		{"users", "username", userStorage},
+	}
+	problems := []*CheckProblem{}
+	for _, parent := range parents {
+		ptable, pcolumn := parent.table, parent.column
+		tables, err := db.storageTables(parent.tables)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tables {
+			if t.Table == ptable {
+				continue
+			}
+			where := fmt.Sprintf("%s NOT IN (SELECT %s FROM %s)", t.Column, pcolumn, ptable)
+			var n int64
+			if err := db.DB.Get(&n, fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s;", t.Table, where)); err != nil {
+				return nil, err
+			}
+			if n == 0 {
+				continue
+			}
+			p := &CheckProblem{
+				Check:       "orphans",
+				Description: fmt.Sprintf("%d rows of %s belong to nonexistent %s", n, t.Table, ptable),
+				Repair:      "Delete the rows",
+			}
+			p.RepairWith(repair, func() error {
+				_, err := db.ExecUncached(fmt.Sprintf("DELETE FROM %s WHERE %s;", t.Table, where))
+				return err
+			})
+			problems = append(problems, p)
+		}
+	}
+	return problems, nil
+}
+
+// checkForeignKeys finds rows that violate foreign key constraints in tables that are not checked by checkOrphans
+func checkForeignKeys(db *AdminDB, repair bool, checked map[string]bool) ([]*CheckProblem, error) {
+	rows, err := db.DB.Query("PRAGMA foreign_key_check;")
+	if err != nil {
+		return nil, err
+	}
+	type violation struct {
+		parent string
+		rowids []int64
+	}
+	violations := make(map[string]*violation)
+	tables := []string{}
+	for rows.Next() {
+		var table, parent string
+		var rowid sql.NullInt64
+		var fkid int
+		if err = rows.Scan(&table, &rowid, &parent, &fkid); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if checked[table] {
+			continue
+		}
+		v, ok := violations[table]
+		if !ok {
+			v = &violation{parent: parent}
+			violations[table] = v
+			tables = append(tables, table)
+		}
+		if rowid.Valid {
+			v.rowids = append(v.rowids, rowid.Int64)
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	problems := []*CheckProblem{}
+	for _, table := range tables {
+		v := violations[table]
+		p := &CheckProblem{
+			Check:       "foreign_keys",
+			Description: fmt.Sprintf("Rows of %s reference nonexistent rows of %s", table, v.parent),
+		}
+		if len(v.rowids) > 0 {
+			p.Repair = "Delete the rows"
+		}
+		p.RepairWith(repair, func() error {
+			for _, rowid := range v.rowids {
+				if _, err := db.ExecUncached(fmt.Sprintf("DELETE FROM %s WHERE rowid=?;", table), rowid); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		problems = append(problems, p)
+	}
+	return problems, nil
+}
+
+// Check verifies the consistency of the database: the integrity of the sqlite file, rows belonging
+// to deleted objects, apps or users, and the data of plugins that registered a CheckHook.
+// If repair is true, the problems that can be fixed automatically are repaired.
+func (db *AdminDB) Check(repair bool) (*CheckReport, error) {
+	r := &CheckReport{}
+	problems, err := checkIntegrity(db)
+	if err != nil {
+		return nil, err
+	}
+	r.Problems = problems
+
+	if problems, err = checkOrphans(db, repair); err != nil {
+		return nil, err
+	}
+	r.Problems = append(r.Problems, problems...)
+
+	checked := make(map[string]bool)
+	for _, tables := range [][]StorageTable{objectStorage, appStorage, userStorage} {
+		for _, t := range tables {
+			checked[t.Table] = true
+		}
+	}
+	if problems, err = checkForeignKeys(db, repair, checked); err != nil {
+		return nil, err
+	}
+	r.Problems = append(r.Problems, problems...)
+
+	for _, h := range checkHooks {
+		if problems, err = h(db, repair); err != nil {
+			return nil, err
+		}
+		r.Problems = append(r.Problems, problems...)
+	}
+	return r, nil
+}
+
+// databaseSize returns the number of bytes used by the database file
+func databaseSize(db *AdminDB) (int64, error) {
+	var pages, pageSize int64
+	if err := db.DB.Get(&pages, "PRAGMA page_count;"); err != nil {
+		return 0, err
+	}
+	err := db.DB.Get(&pageSize, "PRAGMA page_size;")
+	return pages * pageSize, err
+}
+
+// Vacuum rebuilds the database file, returning the space of deleted data to the filesystem.
+// It returns the number of bytes that were reclaimed.
+func (db *AdminDB) Vacuum() (int64, error) {
+	before, err := databaseSize(db)
+	if err != nil {
+		return 0, err
+	}
+	if _, err = db.ExecUncached("VACUUM;"); err != nil {
+		return 0, err
+	}
+	// Vacuuming a database in WAL mode writes the rebuilt pages to the WAL, so they are moved into the file right away
+	if _, err = db.ExecUncached("PRAGMA wal_checkpoint(TRUNCATE);"); err != nil {
+		return 0, err
+	}
+	after, err := databaseSize(db)
+	return before - after, err
+}
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	adb, cleanup := newDBWithUser(t)
+	defer cleanup()
+
+	r, err := adb.Check(false)
+	require.NoError(t, err)
+	require.Len(t, r.Problems, 0)
+
+	// Rows of plugin tables without a foreign key can belong to deleted objects
+	_, err = adb.ExecUncached("CREATE TABLE checktest (object_id VARCHAR(36), data BLOB);")
+	require.NoError(t, err)
+	AddObjectStorage(StorageTable{Table: "checktest", Column: "object_id", Size: "LENGTH(data)"})
+	_, err = adb.Exec("INSERT INTO checktest VALUES ('notanobject',X'00'),('notanobject',X'01');")
+	require.NoError(t, err)
+
+	r, err = adb.Check(false)
+	require.NoError(t, err)
+	require.Len(t, r.Problems, 1)
+	require.Equal(t, "orphans", r.Problems[0].Check)
+	require.False(t, r.Problems[0].Repaired)
+
+	r, err = adb.Check(true)
+	require.NoError(t, err)
+	require.Len(t, r.Problems, 1)
+	require.True(t, r.Problems[0].Repaired)
+
+	r, err = adb.Check(false)
+	require.NoError(t, err)
+	require.Len(t, r.Problems, 0)
+
+	_, err = adb.Vacuum()
+	require.NoError(t, err)
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/heedy/heedy/backend/assets"
 	"github.com/jmoiron/sqlx"
+	"github.com/patrickmn/go-cache"
 
 	"github.com/sirupsen/logrus"
 
@@ -25,10 +26,6 @@ CREATE TABLE dbversion (
 	version INTEGER
 );
 
--- This makes sure that the heedy version is specified, so that future upgrades will know
--- whether a schema modification is necessary
-INSERT INTO dbversion VALUES ('heedy',1);
-
 CREATE TABLE users (
 	username VARCHAR(36) PRIMARY KEY NOT NULL,
 	name VARCHAR NOT NULL DEFAULT '',
@@ -75,6 +72,9 @@ CREATE TABLE apps (
 	-- the "plugin key" of the app if it was generated for a plugin
 	plugin VARCHAR DEFAULT NULL,
 
+	-- apps that were deleted are kept in the trash until purged
+	deleted_date DATETIME DEFAULT NULL,
+
 	CONSTRAINT valid_settings CHECK (json_valid(settings) AND json_type(settings)='object'),
 	CONSTRAINT valid_settings_schema CHECK (json_valid(settings_schema)  AND json_type(settings)='object'),
 
@@ -113,6 +113,9 @@ CREATE TABLE objects (
 	-- Maximal scope that the owner has
 	owner_scope VARCHAR NOT NULL DEFAULT '["*"]',
 
+	-- objects that were deleted are kept in the trash until purged
+	deleted_date DATETIME DEFAULT NULL,
+
 	CONSTRAINT objectapp
 		FOREIGN KEY(app) 
 		REFERENCES apps(id)
@@ -163,6 +166,10 @@ CREATE TABLE shared_objects (
 
 CREATE INDEX share_objectid on shared_objects(objectid);
 
+-- The trash is periodically purged by deleted date
+CREATE INDEX apptrash ON apps(deleted_date) WHERE deleted_date IS NOT NULL;
+CREATE INDEX objecttrash ON objects(deleted_date) WHERE deleted_date IS NOT NULL;
+
 
 ------------------------------------------------------------------
 -- User Sessions
@@ -218,19 +225,40 @@ CREATE TABLE user_settings (
 
 
 ------------------------------------------------------------------
--- Database Views
+-- Invites & Registrations
 ------------------------------------------------------------------
 
-CREATE VIEW user_object_scope(user,object,scope) AS
-	SELECT objects.owner,objects.id,'*' FROM objects WHERE objects.app IS NULL
-	UNION ALL
-	SELECT objects.owner,objects.id,value FROM objects,json_each(objects.owner_scope) WHERE objects.app IS NOT NULL
-	UNION ALL
-	SELECT shared_objects.username,objects.id,ss.value FROM objects,shared_objects,json_each(shared_objects.scope) AS ss WHERE shared_objects.objectid=objects.id AND ss.value<>'*' AND EXISTS (SELECT sss.value FROM json_each(objects.owner_scope) AS sss WHERE sss.value=ss.value OR sss.value='*')
-	UNION ALL
-	SELECT shared_objects.username,objects.id,sss.value FROM objects,shared_objects,json_each(objects.owner_scope) AS sss WHERE shared_objects.objectid=objects.id AND EXISTS (SELECT 1 FROM json_each(shared_objects.scope) AS ss WHERE ss.value='*')
-	;
+` + registrationSchema + `
+
+------------------------------------------------------------------
+-- Password Resets
+------------------------------------------------------------------
+
+` + passwordResetSchema + `
+
+------------------------------------------------------------------
+-- Share Links
+------------------------------------------------------------------
+
+` + shareLinkSchema + `
+
+------------------------------------------------------------------
+-- Personal Access Tokens
+------------------------------------------------------------------
 
+` + userTokenSchema + `
+
+------------------------------------------------------------------
+-- Object Transfers
+------------------------------------------------------------------
+
+` + objectTransferSchema + `
+
+------------------------------------------------------------------
+-- Database Views
+------------------------------------------------------------------
+
+` + userObjectScopeView + `
 
 ------------------------------------------------------------------
 -- Database Default Users
@@ -265,6 +293,22 @@ INSERT INTO users (username,name,description,icon,password) VALUES
 
 `
 
+// objectNotTrashed is true for objects that are not in the trash, either directly or through their app
+const objectNotTrashed = "objects.deleted_date IS NULL AND (objects.app IS NULL OR EXISTS (SELECT 1 FROM apps WHERE apps.id=objects.app AND apps.deleted_date IS NULL))"
+
+// userObjectScopeView gives the scope that each user has to each object that is not in the trash
+const userObjectScopeView = `
+CREATE VIEW user_object_scope(user,object,scope) AS
+	SELECT objects.owner,objects.id,'*' FROM objects WHERE objects.app IS NULL AND objects.deleted_date IS NULL
+	UNION ALL
+	SELECT objects.owner,objects.id,value FROM objects,json_each(objects.owner_scope) WHERE objects.app IS NOT NULL AND ` + objectNotTrashed + `
+	UNION ALL
+	SELECT shared_objects.username,objects.id,ss.value FROM objects,shared_objects,json_each(shared_objects.scope) AS ss WHERE shared_objects.objectid=objects.id AND ` + objectNotTrashed + ` AND ss.value<>'*' AND EXISTS (SELECT sss.value FROM json_each(objects.owner_scope) AS sss WHERE sss.value=ss.value OR sss.value='*')
+	UNION ALL
+	SELECT shared_objects.username,objects.id,sss.value FROM objects,shared_objects,json_each(objects.owner_scope) AS sss WHERE shared_objects.objectid=objects.id AND ` + objectNotTrashed + ` AND EXISTS (SELECT 1 FROM json_each(shared_objects.scope) AS ss WHERE ss.value='*')
+	;
+`
+
 var createHooks = make([]func(*AdminDB) error, 0)
 
 // AddCreateHook executes code when a database is created
@@ -314,8 +358,15 @@ func Create(a *assets.Assets) error {
 		return err
 	}
 
+	// The schema is the latest version of heedy's core tables, so no migrations are needed when it is opened
+	_, err = db.Exec("INSERT INTO dbversion VALUES ('heedy',?);", CoreMigrations.Latest())
+	if err != nil {
+		return err
+	}
+
 	adb := &AdminDB{
-		a: a,
+		a:            a,
+		storageUsage: cache.New(storageUsageExpiration, 2*storageUsageExpiration),
 	}
 	adb.SqlxCache.InitCache(db)
 	if a.Config.Verbose {
@@ -180,6 +180,9 @@ type App struct {
 
 	Settings       *dbutil.JSONObject `json:"settings" db:"settings"`
 	SettingsSchema *dbutil.JSONObject `json:"settings_schema" db:"settings_schema"`
+
+	// The date the app was moved to the trash. It is only set for apps in the trash.
+	DeletedDate *dbutil.Date `json:"deleted_date,omitempty" db:"deleted_date"`
 }
 
 func (a *App) String() string {
@@ -206,6 +209,9 @@ type Object struct {
 	// The scope the owner has to the object. This allows apps to control objects belonging to them.
 	OwnerScope *ScopeArray `json:"owner_scope,omitempty" db:"owner_scope"`
 
+	// The date the object was moved to the trash. It is only set for objects in the trash.
+	DeletedDate *dbutil.Date `json:"deleted_date,omitempty" db:"deleted_date"`
+
 	// The access array, giving the permissions the currently logged in thing has
 	// It is generated manually for each read query, it does not exist in the database.
 	Access ScopeArray `json:"access,omitempty" db:"access"`
@@ -223,6 +229,12 @@ type UserSession struct {
 	CreatedDate    dbutil.Date `db:"created_date" json:"created_date"`
 }
 
+// Trash holds the objects and apps that were deleted, but can still be restored
+type Trash struct {
+	Objects []*Object `json:"objects"`
+	Apps    []*App    `json:"apps"`
+}
+
 // ReadUserOptions gives options for reading a user
 type ReadUserOptions struct {
 	Icon bool `json:"icon,omitempty" schema:"icon"`
@@ -325,6 +337,11 @@ type DB interface {
 
 	ListObjects(o *ListObjectsOptions) ([]*Object, error)
 
+	// The trash holds deleted objects and apps until they are purged
+	ListTrash(owner string) (*Trash, error)
+	RestoreObject(id string) error
+	RestoreApp(id string) error
+
 	ReadUserSettings(username string) (map[string]map[string]interface{}, error)
 	UpdateUserPluginSettings(username string, plugin string, preferences map[string]interface{}) error
 	ReadUserPluginSettings(username string, plugin string) (map[string]interface{}, error)
@@ -429,8 +446,9 @@ func extractUser(u *User) (userColumns []string, userValues []interface{}, err e
 }
 
 func extractApp(c *App) (cColumns []string, cValues []interface{}, err error) {
-	// We don't allow modifying last access date
+	// We don't allow modifying last access date, and the trash is managed separately
 	c.LastAccessDate = nil
+	c.DeletedDate = nil
 	cColumns, cValues, err = extractDetails(&c.Details)
 	if err != nil {
 		return
@@ -477,6 +495,8 @@ func extractApp(c *App) (cColumns []string, cValues []interface{}, err error) {
 }
 
 func extractObject(s *Object) (sColumns []string, sValues []interface{}, err error) {
+	// The trash is managed separately
+	s.DeletedDate = nil
 	sColumns, sValues, err = extractDetails(&s.Details)
 	if err != nil {
 		return
@@ -654,6 +674,55 @@ func objectCreateQuery(c *assets.Configuration, s *Object) (string, []interface{
 	return strings.Join(sColumns, ","), sValues, err
 }
 
+// ObjectMetaHook is run before an update to the meta of an object is written, inside the update's transaction.
+// It is given the object's ID and the meta values being updated, and can reject the update by returning an error.
+type ObjectMetaHook func(tx TxWrapper, id string, meta map[string]interface{}) error
+
+var objectMetaHooks = make(map[string][]ObjectMetaHook)
+
+// AddObjectMetaHook registers a hook that is run whenever the meta of an object of the given type is updated.
+// This allows object types to check that the new meta is consistent with the object's data.
+func AddObjectMetaHook(objectType string, f ObjectMetaHook) {
+	objectMetaHooks[objectType] = append(objectMetaHooks[objectType], f)
+}
+
+// writeObjectUpdate performs the update of the given object, running any meta hooks for its object type
+func writeObjectUpdate(adb *AdminDB, s *Object, objectType string) (err error) {
+	metav := s.Meta
+	sColumns, sValues, err := objectUpdateQuery(adb.Assets().Config, s, objectType)
+	if err != nil {
+		return err
+	}
+	sValues = append(sValues, s.ID)
+	updateStatement := fmt.Sprintf("UPDATE objects SET %s WHERE id=?;", sColumns)
+
+	hooks := objectMetaHooks[objectType]
+	if metav == nil || len(hooks) == 0 {
+		result, err := adb.Exec(updateStatement, sValues...)
+		return GetExecError(result, err)
+	}
+
+	var tx TxWrapper
+	tx, err = adb.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+	for _, h := range hooks {
+		if err = h(tx, s.ID, *metav); err != nil {
+			return err
+		}
+	}
+	result, err := tx.Exec(updateStatement, sValues...)
+	return GetExecError(result, err)
+}
+
 // The object s is assumed to have the underlying object type added in.
 func objectUpdateQuery(c *assets.Configuration, s *Object, objectType string) (string, []interface{}, error) {
 	metav := s.Meta
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Migration is a single upgrade step of a database schema, which brings the schema from Version-1 to Version
+type Migration struct {
+	Version     int
+	Description string
+
+	// Up modifies the schema. It is run in a transaction, which also updates the version in dbversion,
+	// so the step either completes fully or not at all.
+	Up func(tx TxWrapper) error
+}
+
+// Migrations is the ordered list of schema upgrades of heedy's core tables, or of a plugin's tables
+type Migrations []Migration
+
+// Latest returns the version of the schema after all migrations are run
+func (m Migrations) Latest() int {
+	if len(m) == 0 {
+		return 0
+	}
+	return m[len(m)-1].Version
+}
+
+// Pending returns the migrations that need to be run, in order, to bring a database at the given version up to date
+func (m Migrations) Pending(curversion int) ([]Migration, error) {
+	latest := m.Latest()
+	if curversion == latest {
+		return nil, nil
+	}
+	if curversion > latest {
+		return nil, fmt.Errorf("database version %d is newer than the latest supported version %d", curversion, latest)
+	}
+	for i := range m {
+		if m[i].Version != curversion+1 {
+			continue
+		}
+		pending := m[i:]
+		for j := 1; j < len(pending); j++ {
+			if pending[j].Version != pending[j-1].Version+1 {
+				return nil, fmt.Errorf("migration to version %d does not follow version %d", pending[j].Version, pending[j-1].Version)
+			}
+		}
+		return pending, nil
+	}
+	return nil, fmt.Errorf("database version %d can't be migrated to version %d", curversion, latest)
+}
+
+// Backup writes a consistent copy of the database to the given file
+func (db *AdminDB) Backup(filename string) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0750); err != nil {
+		return err
+	}
+	_, err := db.ExecUncached("VACUUM INTO ?;", filename)
+	return err
+}
+
+// Migrate runs the pending migrations of the given plugin's tables ("heedy" for the core tables), recording each
+// completed step in dbversion. If the database already has the plugin's tables, it is first backed up to the
+// data/backups folder, so that a failed upgrade can be recovered.
+func (db *AdminDB) Migrate(plugin string, m Migrations) error {
+	curversion, err := db.ReadPluginDatabaseVersion(plugin)
+	if err != nil {
+		return err
+	}
+	pending, err := m.Pending(curversion)
+	if err != nil {
+		return fmt.Errorf("The %s database is incompatible with this version of heedy: %w", plugin, err)
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	if curversion > 0 {
+		backup := filepath.Join(db.Assets().DataDir(), "backups", fmt.Sprintf("%s-v%d-%s.db", plugin, curversion, time.Now().UTC().Format("20060102T150405")))
+		if err = db.Backup(backup); err != nil {
+			return fmt.Errorf("Could not back up the database before migrating %s: %w", plugin, err)
+		}
+		logrus.Infof("Backed up the database to %s", backup)
+	}
+	for _, mi := range pending {
+		logrus.Infof("Migrating %s database to version %d: %s", plugin, mi.Version, mi.Description)
+		tx, err := db.Beginx()
+		if err != nil {
+			return err
+		}
+		if err = mi.Up(tx); err == nil {
+			_, err = tx.Exec("INSERT OR REPLACE INTO dbversion(plugin,version) VALUES (?,?);", plugin, mi.Version)
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("Migrating %s database to version %d failed: %w", plugin, mi.Version, err)
+		}
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrationsPending(t *testing.T) {
+	noop := func(tx TxWrapper) error { return nil }
+	m := Migrations{{Version: 1, Up: noop}, {Version: 2, Up: noop}, {Version: 3, Up: noop}}
+	require.Equal(t, 3, m.Latest())
+
+	p, err := m.Pending(0)
+	require.NoError(t, err)
+	require.Len(t, p, 3)
+	p, err = m.Pending(2)
+	require.NoError(t, err)
+	require.Len(t, p, 1)
+	require.Equal(t, 3, p[0].Version)
+	p, err = m.Pending(3)
+	require.NoError(t, err)
+	require.Len(t, p, 0)
+
+	_, err = m.Pending(4)
+	require.Error(t, err)
+	_, err = m[1:].Pending(0)
+	require.Error(t, err)
+	_, err = Migrations{{Version: 1, Up: noop}, {Version: 3, Up: noop}}.Pending(0)
+	require.Error(t, err)
+}
+
+func TestCoreMigrations(t *testing.T) {
+	adb, cleanup := newDB(t)
+	defer cleanup()
+
+	// New databases are created at the latest version
+	v, err := adb.ReadPluginDatabaseVersion("heedy")
+	require.NoError(t, err)
+	require.Equal(t, CoreMigrations.Latest(), v)
+
+	// Roll back the personal access tokens and object transfers, and upgrade again
+	_, err = adb.ExecUncached("DROP TABLE user_tokens; DROP TABLE object_transfers; UPDATE dbversion SET version=5 WHERE plugin='heedy';")
+	require.NoError(t, err)
+	require.NoError(t, adb.Migrate("heedy", CoreMigrations))
+	v, err = adb.ReadPluginDatabaseVersion("heedy")
+	require.NoError(t, err)
+	require.Equal(t, 7, v)
+	_, err = adb.ListUserTokens("testy")
+	require.NoError(t, err)
+	_, err = adb.ListObjectTransfers("testy")
+	require.NoError(t, err)
+
+	// The database was backed up before the upgrade
+	files, err := ioutil.ReadDir(filepath.Join(adb.Assets().DataDir(), "backups"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	require.Contains(t, files[0].Name(), "heedy-v5-")
+}
+
+func TestPluginMigrations(t *testing.T) {
+	adb, cleanup := newDB(t)
+	defer cleanup()
+
+	m := Migrations{{
+		Version:     1,
+		Description: "Create the table",
+		Up: func(tx TxWrapper) error {
+			_, err := tx.Exec("CREATE TABLE migratetest (a INTEGER);")
+			return err
+		},
+	}}
+	require.NoError(t, adb.Migrate("migratetest", m))
+	v, err := adb.ReadPluginDatabaseVersion("migratetest")
+	require.NoError(t, err)
+	require.Equal(t, 1, v)
+
+	// A failed step is rolled back completely
+	m = append(m, Migration{
+		Version:     2,
+		Description: "Add a column",
+		Up: func(tx TxWrapper) error {
+			_, err := tx.Exec("ALTER TABLE migratetest ADD COLUMN b INTEGER;")
+			if err != nil {
+				return err
+			}
+			return errors.New("failed")
+		},
+	})
+	require.Error(t, adb.Migrate("migratetest", m))
+	v, err = adb.ReadPluginDatabaseVersion("migratetest")
+	require.NoError(t, err)
+	require.Equal(t, 1, v)
+	_, err = adb.Exec("INSERT INTO migratetest(a) VALUES (1);")
+	require.NoError(t, err)
+	_, err = adb.Exec("INSERT INTO migratetest(b) VALUES (1);")
+	require.Error(t, err)
+}
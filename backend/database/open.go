@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/heedy/heedy/backend/assets"
+	"github.com/patrickmn/go-cache"
 
 	"github.com/jmoiron/sqlx"
 
@@ -14,8 +15,81 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 )
 
-// Open opens the database given assets.
+// CoreMigrations are the upgrades of heedy's core tables. Version 1 is the original schema, and new databases
+// are created directly at the latest version by Create.
+var CoreMigrations = Migrations{
+	{
+		Version:     2,
+		Description: "Add the trash",
+		Up: func(tx TxWrapper) error {
+			_, err := tx.Exec(`
+				ALTER TABLE apps ADD COLUMN deleted_date DATETIME DEFAULT NULL;
+				ALTER TABLE objects ADD COLUMN deleted_date DATETIME DEFAULT NULL;
+				CREATE INDEX apptrash ON apps(deleted_date) WHERE deleted_date IS NOT NULL;
+				CREATE INDEX objecttrash ON objects(deleted_date) WHERE deleted_date IS NOT NULL;
+				DROP VIEW user_object_scope;
+				` + userObjectScopeView)
+			return err
+		},
+	},
+	{
+		Version:     3,
+		Description: "Add invites and registrations",
+		Up: func(tx TxWrapper) error {
+			_, err := tx.Exec(registrationSchema)
+			return err
+		},
+	},
+	{
+		Version:     4,
+		Description: "Add password resets",
+		Up: func(tx TxWrapper) error {
+			_, err := tx.Exec(passwordResetSchema)
+			return err
+		},
+	},
+	{
+		Version:     5,
+		Description: "Add share links",
+		Up: func(tx TxWrapper) error {
+			_, err := tx.Exec(shareLinkSchema)
+			return err
+		},
+	},
+	{
+		Version:     6,
+		Description: "Add personal access tokens",
+		Up: func(tx TxWrapper) error {
+			_, err := tx.Exec(userTokenSchema)
+			return err
+		},
+	},
+	{
+		Version:     7,
+		Description: "Add object transfers",
+		Up: func(tx TxWrapper) error {
+			_, err := tx.Exec(objectTransferSchema)
+			return err
+		},
+	},
+}
+
+// Open opens the database given assets, migrating the core tables to the current schema if necessary.
 func Open(a *assets.Assets) (*AdminDB, error) {
+	adminDB, err := OpenWithoutMigrations(a)
+	if err != nil {
+		return nil, err
+	}
+	if err = adminDB.Migrate("heedy", CoreMigrations); err != nil {
+		adminDB.Close()
+		return nil, err
+	}
+	return adminDB, nil
+}
+
+// OpenWithoutMigrations opens the database without upgrading its schema, which allows
+// inspecting the pending migrations of an old database.
+func OpenWithoutMigrations(a *assets.Assets) (*AdminDB, error) {
 
 	if a.Config.SQL == nil {
 		return nil, errors.New("No SQL app string specified")
@@ -52,20 +126,13 @@ func Open(a *assets.Assets) (*AdminDB, error) {
 	}
 
 	adminDB := &AdminDB{
-		a: a,
+		a:            a,
+		storageUsage: cache.New(storageUsageExpiration, 2*storageUsageExpiration),
 	}
 	adminDB.SqlxCache.InitCache(db)
 	if a.Config.Verbose {
 		adminDB.SqlxCache.Verbose = true
 	}
 
-	hversion, err := adminDB.ReadPluginDatabaseVersion("heedy")
-	if err != nil {
-		return nil, err
-	}
-	if hversion != 1 {
-		return nil, errors.New("The given database is incompatible with this version of Heedy")
-	}
-
 	return adminDB, nil
 }
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// passwordResetSchema holds the tokens used to reset forgotten passwords
+const passwordResetSchema = `
+-- Password resets are single-use tokens that allow setting a user's password without knowing the old one
+CREATE TABLE user_password_resets (
+	token VARCHAR PRIMARY KEY NOT NULL,
+	username VARCHAR(36) NOT NULL,
+	created_date DATE NOT NULL DEFAULT CURRENT_DATE,
+	-- unix timestamp after which the token can no longer be used
+	expires REAL NOT NULL,
+
+	CONSTRAINT resetuser
+		FOREIGN KEY(username)
+		REFERENCES users(username)
+		ON UPDATE CASCADE
+		ON DELETE CASCADE
+);
+`
+
+var ErrInvalidResetToken = errors.New("access_denied: The password reset link is invalid or expired")
+
+// CreatePasswordReset creates a token that allows setting the user's password until it expires
+func (db *AdminDB) CreatePasswordReset(username string, expiration time.Duration) (string, error) {
+	token, err := generateCode(24)
+	if err != nil {
+		return "", err
+	}
+	expires := unixNow() + expiration.Seconds()
+	result, err := db.Exec("INSERT INTO user_password_resets (token,username,expires) SELECT ?,username,? FROM users WHERE username=?;", token, expires, username)
+	err = GetExecError(result, err)
+	if err == ErrNotFound {
+		return "", ErrUserNotFound
+	}
+	return token, err
+}
+
+// setPassword sets the user's password in the transaction, and logs the user out of all sessions
+func setPassword(tx TxWrapper, username, password string) error {
+	if password == "" {
+		return ErrNoPasswordGiven
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	result, err := tx.Exec("UPDATE users SET password=? WHERE username=?;", hash, username)
+	if err = GetExecError(result, err); err != nil {
+		if err == ErrNotFound {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM user_sessions WHERE username=?;", username); err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM user_password_resets WHERE username=?;", username)
+	return err
+}
+
+// SetUserPassword sets the user's password, invalidating all of the user's sessions and password reset tokens
+func (db *AdminDB) SetUserPassword(username, password string) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	if err = setPassword(tx, username, password); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// ResetPassword uses up the password reset token to set the password of its user, returning the username.
+// All of the user's sessions are invalidated.
+func (db *AdminDB) ResetPassword(token, password string) (string, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return "", err
+	}
+	var username string
+	err = tx.Get(&username, "SELECT username FROM user_password_resets WHERE token=? AND expires>?;", token, unixNow())
+	if err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return "", ErrInvalidResetToken
+		}
+		return "", err
+	}
+	if err = setPassword(tx, username, password); err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	return username, tx.Commit()
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordReset(t *testing.T) {
+	db, cleanup := newDBWithUser(t)
+	defer cleanup()
+
+	_, err := db.CreatePasswordReset("notauser", time.Hour)
+	require.Equal(t, ErrUserNotFound, err)
+
+	token, err := db.CreatePasswordReset("testy", time.Hour)
+	require.NoError(t, err)
+	_, _, err = db.CreateUserSession("testy", "browser")
+	require.NoError(t, err)
+
+	_, err = db.ResetPassword("notatoken", "newpass")
+	require.Equal(t, ErrInvalidResetToken, err)
+	_, err = db.ResetPassword(token, "")
+	require.Equal(t, ErrNoPasswordGiven, err)
+
+	username, err := db.ResetPassword(token, "newpass")
+	require.NoError(t, err)
+	require.Equal(t, "testy", username)
+	_, _, err = db.AuthUser("testy", "testpass")
+	require.Error(t, err)
+	_, _, err = db.AuthUser("testy", "newpass")
+	require.NoError(t, err)
+
+	// Resetting logs the user out everywhere, and the token can't be reused
+	sessions, err := db.ListUserSessions("testy")
+	require.NoError(t, err)
+	require.Len(t, sessions, 0)
+	_, err = db.ResetPassword(token, "newpass2")
+	require.Equal(t, ErrInvalidResetToken, err)
+
+	// Expired tokens are refused
+	token, err = db.CreatePasswordReset("testy", -time.Second)
+	require.NoError(t, err)
+	_, err = db.ResetPassword(token, "newpass2")
+	require.Equal(t, ErrInvalidResetToken, err)
+
+	// Setting the password directly also invalidates sessions and outstanding tokens
+	token, err = db.CreatePasswordReset("testy", time.Hour)
+	require.NoError(t, err)
+	_, _, err = db.CreateUserSession("testy", "browser")
+	require.NoError(t, err)
+	require.NoError(t, db.SetUserPassword("testy", "newpass3"))
+	sessions, err = db.ListUserSessions("testy")
+	require.NoError(t, err)
+	require.Len(t, sessions, 0)
+	_, err = db.ResetPassword(token, "newpass4")
+	require.Equal(t, ErrInvalidResetToken, err)
+	_, _, err = db.AuthUser("testy", "newpass3")
+	require.NoError(t, err)
+
+	require.Equal(t, ErrUserNotFound, db.SetUserPassword("notauser", "pass"))
+}
@@ -149,16 +149,7 @@ func updateObject(adb *AdminDB, s *Object, selectStatement string, args ...inter
 		}
 	}
 
-	sColumns, sValues, err := objectUpdateQuery(adb.Assets().Config, s, sv.Stype)
-	if err != nil {
-		return err
-	}
-
-	sValues = append(sValues, s.ID)
-
-	// Allow updating groups that are not users
-	result, err := adb.Exec(fmt.Sprintf("UPDATE objects SET %s WHERE id=?;", sColumns), sValues...)
-	return GetExecError(result, err)
+	return writeObjectUpdate(adb, s, sv.Stype)
 }
 
 func updateApp(adb *AdminDB, c *App, whereStatement string, args ...interface{}) (err error) {
@@ -118,6 +118,16 @@ func (db *PublicDB) DelApp(cid string) error {
 func (db *PublicDB) ListApps(o *ListAppOptions) ([]*App, error) {
 	return nil, ErrAccessDenied("You must be logged in to list apps")
 }
+func (db *PublicDB) ListTrash(owner string) (*Trash, error) {
+	return nil, ErrAccessDenied("You must be logged in to list the trash")
+}
+func (db *PublicDB) RestoreObject(id string) error {
+	return ErrAccessDenied("You must be logged in to restore objects")
+}
+func (db *PublicDB) RestoreApp(cid string) error {
+	return ErrAccessDenied("You must be logged in to restore apps")
+}
+
 func (db *PublicDB) ReadUserSettings(username string) (map[string]map[string]interface{}, error) {
 	return nil, ErrAccessDenied("You must be logged in to read preferences")
 }
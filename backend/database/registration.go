@@ -0,0 +1,215 @@
+package database
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/heedy/heedy/backend/database/dbutil"
+)
+
+// registrationSchema holds the tables used for inviting and registering new users
+const registrationSchema = `
+-- Invites are single-use codes that allow creating a user account
+CREATE TABLE user_invites (
+	code VARCHAR PRIMARY KEY NOT NULL,
+	description VARCHAR NOT NULL DEFAULT '',
+	created_by VARCHAR(36) NOT NULL,
+	created_date DATE NOT NULL DEFAULT CURRENT_DATE,
+	-- unix timestamp after which the invite can no longer be used
+	expires REAL DEFAULT NULL,
+
+	CONSTRAINT invitecreator
+		FOREIGN KEY(created_by)
+		REFERENCES users(username)
+		ON UPDATE CASCADE
+		ON DELETE CASCADE
+);
+
+-- Registrations are user accounts waiting for an admin's approval
+CREATE TABLE user_registrations (
+	username VARCHAR(36) PRIMARY KEY NOT NULL,
+	name VARCHAR NOT NULL DEFAULT '',
+	-- bcrypt-encoded password hash
+	password VARCHAR NOT NULL,
+	created_date DATE NOT NULL DEFAULT CURRENT_DATE
+);
+`
+
+var (
+	ErrInvalidInvite = errors.New("access_denied: The invite is invalid or expired")
+	ErrUserExists    = errors.New("bad_request: The username is already taken")
+)
+
+// Invite is a single-use code that allows creating a user account
+type Invite struct {
+	Code        string      `json:"code" db:"code"`
+	Description string      `json:"description" db:"description"`
+	CreatedBy   string      `json:"created_by" db:"created_by"`
+	CreatedDate dbutil.Date `json:"created_date" db:"created_date"`
+
+	// The unix timestamp after which the invite can't be used, or nil if it doesn't expire
+	Expires *float64 `json:"expires" db:"expires"`
+}
+
+// Registration is a user account that is waiting for an admin's approval
+type Registration struct {
+	UserName    string      `json:"username" db:"username"`
+	Name        string      `json:"name" db:"name"`
+	Password    string      `json:"-" db:"password"`
+	CreatedDate dbutil.Date `json:"created_date" db:"created_date"`
+}
+
+// generateCode creates a random code that can be used in URLs
+func generateCode(length int) (string, error) {
+	b := make([]byte, length)
+	_, err := rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b), err
+}
+
+func unixNow() float64 {
+	return float64(time.Now().UnixNano()) * 1e-9
+}
+
+// CreateInvite creates an invite with a new code, which is written to i.Code
+func (db *AdminDB) CreateInvite(i *Invite) error {
+	if err := ValidUserName(i.CreatedBy); err != nil {
+		return err
+	}
+	code, err := generateCode(15)
+	if err != nil {
+		return err
+	}
+	result, err := db.Exec("INSERT INTO user_invites (code,description,created_by,expires) VALUES (?,?,?,?);", code, i.Description, i.CreatedBy, i.Expires)
+	if err = GetExecError(result, err); err != nil {
+		return err
+	}
+	i.Code = code
+	return nil
+}
+
+// ListInvites lists all invites that were not yet used, including expired ones
+func (db *AdminDB) ListInvites() ([]*Invite, error) {
+	invites := []*Invite{}
+	err := db.Select(&invites, "SELECT * FROM user_invites ORDER BY created_date DESC;")
+	return invites, err
+}
+
+// DelInvite deletes the given invite
+func (db *AdminDB) DelInvite(code string) error {
+	result, err := db.Exec("DELETE FROM user_invites WHERE code=?;", code)
+	return GetExecError(result, err)
+}
+
+// RegisterUser creates the user with the given invite code, which is used up in the process
+func (db *AdminDB) RegisterUser(u *User, code string) error {
+	userColumns, userValues, err := userCreateQuery(u)
+	if err != nil {
+		return err
+	}
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	result, err := tx.Exec("DELETE FROM user_invites WHERE code=? AND (expires IS NULL OR expires>?);", code, unixNow())
+	if err = GetExecError(result, err); err != nil {
+		tx.Rollback()
+		if err == ErrNotFound {
+			return ErrInvalidInvite
+		}
+		return err
+	}
+	var exists bool
+	if err = tx.Get(&exists, "SELECT EXISTS (SELECT 1 FROM users WHERE username=?);", *u.UserName); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if exists {
+		tx.Rollback()
+		return ErrUserExists
+	}
+	result, err = tx.Exec("INSERT INTO users ("+userColumns+") VALUES ("+QQ(len(userValues))+");", userValues...)
+	if err = GetExecError(result, err); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// AddRegistration queues the user for an admin's approval
+func (db *AdminDB) AddRegistration(u *User) error {
+	if u.UserName == nil {
+		return ErrInvalidUserName
+	}
+	if err := ValidUserName(*u.UserName); err != nil {
+		return err
+	}
+	if u.Password == nil || *u.Password == "" {
+		return ErrNoPasswordGiven
+	}
+	name := ""
+	if u.Name != nil {
+		name = *u.Name
+	}
+	password, err := HashPassword(*u.Password)
+	if err != nil {
+		return err
+	}
+	result, err := db.Exec(`INSERT INTO user_registrations (username,name,password) SELECT ?,?,? WHERE NOT EXISTS (SELECT 1 FROM users WHERE username=?)
+		AND NOT EXISTS (SELECT 1 FROM user_registrations WHERE username=?);`, *u.UserName, name, password, *u.UserName, *u.UserName)
+	err = GetExecError(result, err)
+	if err == ErrNotFound {
+		return ErrUserExists
+	}
+	return err
+}
+
+// ListRegistrations lists the users waiting for approval
+func (db *AdminDB) ListRegistrations() ([]*Registration, error) {
+	r := []*Registration{}
+	err := db.Select(&r, "SELECT * FROM user_registrations ORDER BY created_date ASC;")
+	return r, err
+}
+
+// ApproveRegistration creates the user from its pending registration
+func (db *AdminDB) ApproveRegistration(username string) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	var r Registration
+	err = tx.Get(&r, "SELECT * FROM user_registrations WHERE username=?;", username)
+	if err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM user_registrations WHERE username=?;", username); err != nil {
+		tx.Rollback()
+		return err
+	}
+	var exists bool
+	if err = tx.Get(&exists, "SELECT EXISTS (SELECT 1 FROM users WHERE username=?);", username); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if exists {
+		tx.Rollback()
+		return ErrUserExists
+	}
+	if _, err = tx.Exec("INSERT INTO users (username,name,password) VALUES (?,?,?);", r.UserName, r.Name, r.Password); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// DelRegistration rejects the pending registration
+func (db *AdminDB) DelRegistration(username string) error {
+	result, err := db.Exec("DELETE FROM user_registrations WHERE username=?;", username)
+	return GetExecError(result, err)
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvites(t *testing.T) {
+	db, cleanup := newDBWithUser(t)
+	defer cleanup()
+
+	inv := &Invite{CreatedBy: "testy", Description: "for a friend"}
+	require.NoError(t, db.CreateInvite(inv))
+	require.NotEmpty(t, inv.Code)
+
+	invites, err := db.ListInvites()
+	require.NoError(t, err)
+	require.Len(t, invites, 1)
+	require.Equal(t, "for a friend", invites[0].Description)
+
+	name := "friend"
+	passwd := "friendpass"
+	require.Equal(t, ErrInvalidInvite, db.RegisterUser(&User{UserName: &name, Password: &passwd}, "notacode"))
+	require.NoError(t, db.RegisterUser(&User{UserName: &name, Password: &passwd}, inv.Code))
+	_, _, err = db.AuthUser("friend", "friendpass")
+	require.NoError(t, err)
+
+	// Invites can only be used once
+	name2 := "friend2"
+	require.Equal(t, ErrInvalidInvite, db.RegisterUser(&User{UserName: &name2, Password: &passwd}, inv.Code))
+	invites, err = db.ListInvites()
+	require.NoError(t, err)
+	require.Len(t, invites, 0)
+
+	// Expired invites are refused
+	expired := unixNow() - 10
+	inv = &Invite{CreatedBy: "testy", Expires: &expired}
+	require.NoError(t, db.CreateInvite(inv))
+	require.Equal(t, ErrInvalidInvite, db.RegisterUser(&User{UserName: &name2, Password: &passwd}, inv.Code))
+
+	// A taken username doesn't use up the invite
+	future := unixNow() + 1000
+	inv = &Invite{CreatedBy: "testy", Expires: &future}
+	require.NoError(t, db.CreateInvite(inv))
+	require.Equal(t, ErrUserExists, db.RegisterUser(&User{UserName: &name, Password: &passwd}, inv.Code))
+	require.NoError(t, db.RegisterUser(&User{UserName: &name2, Password: &passwd}, inv.Code))
+
+	inv = &Invite{CreatedBy: "testy"}
+	require.NoError(t, db.CreateInvite(inv))
+	require.NoError(t, db.DelInvite(inv.Code))
+	require.Equal(t, ErrNotFound, db.DelInvite(inv.Code))
+}
+
+func TestRegistrations(t *testing.T) {
+	db, cleanup := newDBWithUser(t)
+	defer cleanup()
+
+	name := "newbie"
+	passwd := "newpass"
+	require.NoError(t, db.AddRegistration(&User{UserName: &name, Password: &passwd}))
+	require.Equal(t, ErrUserExists, db.AddRegistration(&User{UserName: &name, Password: &passwd}))
+	testy := "testy"
+	require.Equal(t, ErrUserExists, db.AddRegistration(&User{UserName: &testy, Password: &passwd}))
+
+	reg, err := db.ListRegistrations()
+	require.NoError(t, err)
+	require.Len(t, reg, 1)
+	require.Equal(t, "newbie", reg[0].UserName)
+
+	// The user can't log in until approved
+	_, _, err = db.AuthUser("newbie", "newpass")
+	require.Error(t, err)
+	require.NoError(t, db.ApproveRegistration("newbie"))
+	_, _, err = db.AuthUser("newbie", "newpass")
+	require.NoError(t, err)
+	require.Equal(t, ErrNotFound, db.ApproveRegistration("newbie"))
+
+	name = "spammer"
+	require.NoError(t, db.AddRegistration(&User{UserName: &name, Password: &passwd}))
+	require.NoError(t, db.DelRegistration("spammer"))
+	reg, err = db.ListRegistrations()
+	require.NoError(t, err)
+	require.Len(t, reg, 0)
+	_, err = db.ReadUser("spammer", nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,177 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/heedy/heedy/backend/database/dbutil"
+)
+
+// shareLinkSchema holds the links that give anyone with the token access to a single object
+const shareLinkSchema = `
+CREATE TABLE share_links (
+	id VARCHAR(36) PRIMARY KEY NOT NULL,
+	-- the secret token that gives access to the object
+	token VARCHAR UNIQUE NOT NULL,
+	object VARCHAR(36) NOT NULL,
+	name VARCHAR NOT NULL DEFAULT '',
+	-- the scopes of the object that the link gives, which are limited to the scopes of the object's owner
+	scope VARCHAR NOT NULL DEFAULT '["read"]',
+	-- optional unix timestamps limiting the range of timeseries data that can be read
+	tstart REAL DEFAULT NULL,
+	tend REAL DEFAULT NULL,
+	created_date DATE NOT NULL DEFAULT CURRENT_DATE,
+	-- unix timestamp after which the link can no longer be used
+	expires REAL DEFAULT NULL,
+
+	CONSTRAINT valid_scope CHECK (json_valid(scope)),
+
+	CONSTRAINT sharedobject
+		FOREIGN KEY(object)
+		REFERENCES objects(id)
+		ON UPDATE CASCADE
+		ON DELETE CASCADE
+);
+CREATE INDEX share_link_objects ON share_links(object);
+`
+
+var ErrInvalidShareLink = errors.New("access_denied: The share link is invalid or expired")
+
+// ShareLink gives anyone who has its token access to a single object, without logging in
+type ShareLink struct {
+	ID     string      `json:"id" db:"id"`
+	Token  string      `json:"token" db:"token"`
+	Object string      `json:"object" db:"object"`
+	Name   string      `json:"name" db:"name"`
+	Scope  *ScopeArray `json:"scope" db:"scope"`
+
+	// TStart and TEnd limit the timeseries data that can be read through the link
+	TStart *float64 `json:"tstart,omitempty" db:"tstart"`
+	TEnd   *float64 `json:"tend,omitempty" db:"tend"`
+
+	CreatedDate dbutil.Date `json:"created_date" db:"created_date"`
+	// The unix timestamp after which the link can't be used, or nil if it doesn't expire
+	Expires *float64 `json:"expires" db:"expires"`
+}
+
+// CreateShareLink creates a link to the object, writing the new ID and token to l. Share links can only
+// read the object, so the link's scope can only be read, which must be in access, the scopes that the
+// link's creator has for the object.
+func (db *AdminDB) CreateShareLink(l *ShareLink, access *ScopeArray) error {
+	if l.Scope == nil || len(l.Scope.Scope) == 0 {
+		l.Scope = &ScopeArray{Scope: []string{"read"}}
+	}
+	for _, s := range l.Scope.Scope {
+		if s != "read" {
+			return ErrBadQuery("Share links can only have the read scope")
+		}
+	}
+	if access != nil && !access.HasScope("read") {
+		return ErrAccessDenied("Can't share the read scope, which you don't have")
+	}
+	if l.TStart != nil && l.TEnd != nil && *l.TStart > *l.TEnd {
+		return ErrBadQuery("The share link's time range ends before it starts")
+	}
+	if l.Expires != nil && *l.Expires <= unixNow() {
+		return ErrBadQuery("The share link expires in the past")
+	}
+	l.Name = strings.TrimSpace(l.Name)
+
+	token, err := generateCode(32)
+	if err != nil {
+		return err
+	}
+	id := uuid.New().String()
+	result, err := db.Exec(`INSERT INTO share_links (id,token,object,name,scope,tstart,tend,expires)
+		SELECT ?,?,id,?,?,?,?,? FROM objects WHERE id=? AND `+objectNotTrashed+`;`,
+		id, token, l.Name, l.Scope, l.TStart, l.TEnd, l.Expires, l.Object)
+	if err = GetExecError(result, err); err != nil {
+		return err
+	}
+	l.ID = id
+	l.Token = token
+	return nil
+}
+
+// ListShareLinks returns the share links of the given object, including expired links
+func (db *AdminDB) ListShareLinks(objectid string) ([]*ShareLink, error) {
+	var links []*ShareLink
+	err := db.Select(&links, "SELECT * FROM share_links WHERE object=? ORDER BY created_date ASC;", objectid)
+	return links, err
+}
+
+// ReadShareLink returns the given share link if it can still be used
+func (db *AdminDB) ReadShareLink(id string) (*ShareLink, error) {
+	var l ShareLink
+	err := db.Get(&l, "SELECT * FROM share_links WHERE id=? AND (expires IS NULL OR expires > ?);", id, unixNow())
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidShareLink
+	}
+	return &l, err
+}
+
+// GetShareLinkByToken returns the share link with the given token if it can still be used
+func (db *AdminDB) GetShareLinkByToken(token string) (*ShareLink, error) {
+	var l ShareLink
+	err := db.Get(&l, "SELECT * FROM share_links WHERE token=? AND (expires IS NULL OR expires > ?);", token, unixNow())
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidShareLink
+	}
+	return &l, err
+}
+
+// DelShareLink revokes the given share link of the object
+func (db *AdminDB) DelShareLink(objectid, id string) error {
+	result, err := db.Exec("DELETE FROM share_links WHERE object=? AND id=?;", objectid, id)
+	return GetExecError(result, err)
+}
+
+// ShareLinkDB is the database view of someone using a share link, which can only access the linked object
+type ShareLinkDB struct {
+	PublicDB
+	Link *ShareLink
+}
+
+// NewShareLinkDB returns the database accessible through the given share link
+func NewShareLinkDB(db *AdminDB, l *ShareLink) *ShareLinkDB {
+	return &ShareLinkDB{PublicDB: PublicDB{adb: db}, Link: l}
+}
+
+func (db *ShareLinkDB) ID() string {
+	return "share:" + db.Link.ID
+}
+
+// ReadObject reads the linked object, with the link's scopes that the object's owner still has
+func (db *ShareLinkDB) ReadObject(id string, o *ReadObjectOptions) (*Object, error) {
+	if id != db.Link.Object {
+		return nil, ErrNotFound
+	}
+	return readObject(db.adb, id, o, `SELECT objects.*,json_group_array(ls.value) AS access FROM objects, share_links, json_each(share_links.scope) AS ls
+		WHERE objects.id=? AND share_links.id=? AND share_links.object=objects.id
+		AND EXISTS (SELECT 1 FROM user_object_scope AS uos WHERE uos.user=objects.owner AND uos.object=objects.id AND (uos.scope=ls.value OR uos.scope='*'));`, id, db.Link.ID)
+}
+
+// UpdateObject is not allowed through share links
+func (db *ShareLinkDB) UpdateObject(s *Object) error {
+	return ErrAccessDenied("Share links can't modify objects")
+}
+
+// ListObjects lists the linked object if it matches the options
+func (db *ShareLinkDB) ListObjects(o *ListObjectsOptions) ([]*Object, error) {
+	return listObjects(db.adb, o, `SELECT objects.*,json_group_array(ls.value) AS access FROM objects, share_links, json_each(share_links.scope) AS ls
+		WHERE %s AND share_links.id=? AND share_links.object=objects.id
+		AND EXISTS (SELECT 1 FROM user_object_scope AS uos WHERE uos.user=objects.owner AND uos.object=objects.id AND (uos.scope=ls.value OR uos.scope='*'))
+		GROUP BY objects.id %s;`, db.Link.ID)
+}
+
+// TimeRange returns the range of timeseries data that can be read through the given database,
+// which is only limited for share links
+func TimeRange(db DB) (tstart, tend *float64) {
+	if sdb, ok := db.(*ShareLinkDB); ok {
+		return sdb.Link.TStart, sdb.Link.TEnd
+	}
+	return nil, nil
+}
@@ -0,0 +1,105 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShareLinks(t *testing.T) {
+	db, cleanup := newDBWithUser(t)
+	defer cleanup()
+
+	name := "myobj"
+	stype := "timeseries"
+	owner := "testy"
+	oid, err := db.CreateObject(&Object{
+		Details: Details{
+			Name: &name,
+		},
+		Owner: &owner,
+		Type:  &stype,
+	})
+	require.NoError(t, err)
+	oid2, err := db.CreateObject(&Object{
+		Details: Details{
+			Name: &name,
+		},
+		Owner: &owner,
+		Type:  &stype,
+	})
+	require.NoError(t, err)
+
+	// The link's scope can only be read, which the creator must have
+	access := &ScopeArray{Scope: []string{"read", "write"}}
+	require.Error(t, db.CreateShareLink(&ShareLink{Object: oid, Scope: &ScopeArray{Scope: []string{"write"}}}, access))
+	require.Error(t, db.CreateShareLink(&ShareLink{Object: oid, Scope: &ScopeArray{Scope: []string{"read", "write"}}}, access))
+	require.Error(t, db.CreateShareLink(&ShareLink{Object: oid, Scope: &ScopeArray{Scope: []string{"*"}}}, nil))
+	require.Error(t, db.CreateShareLink(&ShareLink{Object: oid}, &ScopeArray{Scope: []string{"write"}}))
+	require.Equal(t, ErrNotFound, db.CreateShareLink(&ShareLink{Object: "notanobject"}, nil))
+
+	tstart := 100.0
+	tend := 50.0
+	require.Error(t, db.CreateShareLink(&ShareLink{Object: oid, TStart: &tstart, TEnd: &tend}, nil))
+	tend = 200
+	l := &ShareLink{Object: oid, Name: "doctor", TStart: &tstart, TEnd: &tend}
+	require.NoError(t, db.CreateShareLink(l, access))
+	require.NotEmpty(t, l.Token)
+
+	l2, err := db.GetShareLinkByToken(l.Token)
+	require.NoError(t, err)
+	require.Equal(t, l.ID, l2.ID)
+	_, err = db.GetShareLinkByToken("notatoken")
+	require.Equal(t, ErrInvalidShareLink, err)
+
+	sdb, err := db.As("share:" + l.ID)
+	require.NoError(t, err)
+	require.Equal(t, PublicType, sdb.Type())
+	o, err := sdb.ReadObject(oid, nil)
+	require.NoError(t, err)
+	require.True(t, o.Access.HasScope("read"))
+	require.False(t, o.Access.HasScope("write"))
+	_, err = sdb.ReadObject(oid2, nil)
+	require.Equal(t, ErrNotFound, err)
+	objs, err := sdb.ListObjects(nil)
+	require.NoError(t, err)
+	require.Len(t, objs, 1)
+	require.Equal(t, oid, objs[0].ID)
+	require.Error(t, sdb.UpdateObject(&Object{Details: Details{ID: oid, Name: &name}}))
+
+	ts, te := TimeRange(sdb)
+	require.Equal(t, tstart, *ts)
+	require.Equal(t, tend, *te)
+	ts, te = TimeRange(db)
+	require.Nil(t, ts)
+	require.Nil(t, te)
+
+	// Objects in the trash can't be read through links
+	require.NoError(t, db.DelObject(oid))
+	_, err = sdb.ReadObject(oid, nil)
+	require.Equal(t, ErrNotFound, err)
+	require.NoError(t, db.RestoreObject(oid))
+	_, err = sdb.ReadObject(oid, nil)
+	require.NoError(t, err)
+
+	// Expired links can't be used
+	expires := unixNow() + 1000
+	l3 := &ShareLink{Object: oid, Expires: &expires}
+	require.NoError(t, db.CreateShareLink(l3, nil))
+	require.True(t, l3.Scope.HasScope("read"))
+	_, err = db.Exec("UPDATE share_links SET expires=? WHERE id=?;", unixNow()-1, l3.ID)
+	require.NoError(t, err)
+	_, err = db.GetShareLinkByToken(l3.Token)
+	require.Equal(t, ErrInvalidShareLink, err)
+	_, err = db.As("share:" + l3.ID)
+	require.Equal(t, ErrInvalidShareLink, err)
+
+	links, err := db.ListShareLinks(oid)
+	require.NoError(t, err)
+	require.Len(t, links, 2)
+
+	require.NoError(t, db.DelShareLink(oid, l.ID))
+	require.Equal(t, ErrNotFound, db.DelShareLink(oid, l.ID))
+	_, err = db.GetShareLinkByToken(l.Token)
+	require.Equal(t, ErrInvalidShareLink, err)
+}
@@ -0,0 +1,267 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// storageUsageExpiration is how long the storage used by a user is cached when checking quotas,
+// so that writes don't need to sum up all of the user's data each time
+const storageUsageExpiration = 30 * time.Second
+
+var ErrQuotaExceeded = errors.New("quota_exceeded: The user's storage quota is used up")
+
+// StorageTable describes a table whose rows count towards the storage used by users and objects
+type StorageTable struct {
+	// Table is the name of the table
+	Table string
+	// Column holds the ID of the object or app, or the username, that each row belongs to
+	Column string
+	// Size is an SQL expression giving the number of bytes used by a row, such as LENGTH(data)
+	Size string
+}
+
+var (
+	storageLock   sync.RWMutex
+	objectStorage = []StorageTable{
+		{Table: "objects", Column: "id", Size: "IFNULL(LENGTH(name),0)+IFNULL(LENGTH(description),0)+IFNULL(LENGTH(icon),0)+IFNULL(LENGTH(tags),0)+IFNULL(LENGTH(meta),0)"},
+	}
+	appStorage = []StorageTable{
+		{Table: "apps", Column: "id", Size: "IFNULL(LENGTH(name),0)+IFNULL(LENGTH(description),0)+IFNULL(LENGTH(icon),0)+IFNULL(LENGTH(settings),0)"},
+	}
+	userStorage = []StorageTable{
+		{Table: "users", Column: "username", Size: "IFNULL(LENGTH(name),0)+IFNULL(LENGTH(description),0)+IFNULL(LENGTH(icon),0)"},
+		{Table: "user_settings", Column: "user", Size: "LENGTH(key)+IFNULL(LENGTH(value),0)"},
+	}
+)
+
+// AddObjectStorage registers a table whose rows belong to objects, so that they are counted
+// in the storage of the object and its owner
+func AddObjectStorage(t StorageTable) {
+	storageLock.Lock()
+	objectStorage = append(objectStorage, t)
+	storageLock.Unlock()
+}
+
+// AddAppStorage registers a table whose rows belong to apps, so that they are counted in the storage of the app's owner
+func AddAppStorage(t StorageTable) {
+	storageLock.Lock()
+	appStorage = append(appStorage, t)
+	storageLock.Unlock()
+}
+
+// AddUserStorage registers a table whose rows belong to users, so that they are counted in the user's storage
+func AddUserStorage(t StorageTable) {
+	storageLock.Lock()
+	userStorage = append(userStorage, t)
+	storageLock.Unlock()
+}
+
+// Storage is the space used by a user or object
+type Storage struct {
+	// Bytes is the size of the data, which for compressed data is its compressed size
+	Bytes int64 `json:"bytes" db:"bytes"`
+	// Rows is the number of database rows holding the data
+	Rows int64 `json:"rows" db:"rows"`
+}
+
+func (s *Storage) add(s2 *Storage) {
+	s.Bytes += s2.Bytes
+	s.Rows += s2.Rows
+}
+
+// UserStorage is the space used by a user, including all of the user's objects and apps
+type UserStorage struct {
+	Storage
+
+	// Quota is the number of bytes that the user can use, or 0 if unlimited
+	Quota int64 `json:"quota"`
+
+	// Objects holds the storage used by each of the user's objects, including objects in the trash
+	Objects map[string]*Storage `json:"objects"`
+}
+
+// storageTables returns the registered tables that exist in the database, since plugins
+// can register tables that are only created once the plugin is first run
+func (db *AdminDB) storageTables(tables []StorageTable) ([]StorageTable, error) {
+	var existing []string
+	if err := db.Select(&existing, "SELECT name FROM sqlite_master WHERE type='table';"); err != nil {
+		return nil, err
+	}
+	exists := make(map[string]bool, len(existing))
+	for _, t := range existing {
+		exists[t] = true
+	}
+	storageLock.RLock()
+	defer storageLock.RUnlock()
+	res := make([]StorageTable, 0, len(tables))
+	for _, t := range tables {
+		if exists[t.Table] {
+			res = append(res, t)
+		}
+	}
+	return res, nil
+}
+
+func (db *AdminDB) sumStorage(tables []StorageTable, where string, args ...interface{}) (*Storage, error) {
+	tables, err := db.storageTables(tables)
+	if err != nil {
+		return nil, err
+	}
+	total := &Storage{}
+	for _, t := range tables {
+		var s Storage
+		err = db.Get(&s, fmt.Sprintf("SELECT COALESCE(SUM(%s),0) AS bytes, COUNT(*) AS rows FROM %s WHERE %s %s;", t.Size, t.Table, t.Column, where), args...)
+		if err != nil {
+			return nil, err
+		}
+		total.add(&s)
+	}
+	return total, nil
+}
+
+// ObjectStorage returns the storage used by the given object
+func (db *AdminDB) ObjectStorage(id string) (*Storage, error) {
+	var exists bool
+	if err := db.Get(&exists, "SELECT EXISTS (SELECT 1 FROM objects WHERE id=?);", id); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return db.sumStorage(objectStorage, "=?", id)
+}
+
+// userStorageBytes returns the total number of bytes used by the user
+func (db *AdminDB) userStorageBytes(username string) (int64, error) {
+	s, err := db.sumStorage(userStorage, "=?", username)
+	if err != nil {
+		return 0, err
+	}
+	as, err := db.sumStorage(appStorage, "IN (SELECT id FROM apps WHERE owner=?)", username)
+	if err != nil {
+		return 0, err
+	}
+	s.add(as)
+	obs, err := db.sumStorage(objectStorage, "IN (SELECT id FROM objects WHERE owner=?)", username)
+	if err != nil {
+		return 0, err
+	}
+	s.add(obs)
+	return s.Bytes, nil
+}
+
+// ReadUserStorage returns the storage used by the user, along with the storage of each of the user's objects
+func (db *AdminDB) ReadUserStorage(username string) (*UserStorage, error) {
+	var exists bool
+	if err := db.Get(&exists, "SELECT EXISTS (SELECT 1 FROM users WHERE username=?);", username); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+	us := &UserStorage{
+		Quota:   db.a.Config.GetStorageQuota(username),
+		Objects: make(map[string]*Storage),
+	}
+	s, err := db.sumStorage(userStorage, "=?", username)
+	if err != nil {
+		return nil, err
+	}
+	us.add(s)
+	s, err = db.sumStorage(appStorage, "IN (SELECT id FROM apps WHERE owner=?)", username)
+	if err != nil {
+		return nil, err
+	}
+	us.add(s)
+
+	tables, err := db.storageTables(objectStorage)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tables {
+		var res []struct {
+			ID string `db:"id"`
+			Storage
+		}
+		err = db.Select(&res, fmt.Sprintf("SELECT %s AS id, COALESCE(SUM(%s),0) AS bytes, COUNT(*) AS rows FROM %s WHERE %s IN (SELECT id FROM objects WHERE owner=?) GROUP BY %s;",
+			t.Column, t.Size, t.Table, t.Column, t.Column), username)
+		if err != nil {
+			return nil, err
+		}
+		for i := range res {
+			obs, ok := us.Objects[res[i].ID]
+			if !ok {
+				obs = &Storage{}
+				us.Objects[res[i].ID] = obs
+			}
+			obs.add(&res[i].Storage)
+			us.add(&res[i].Storage)
+		}
+	}
+	return us, nil
+}
+
+// CheckStorageQuota returns ErrQuotaExceeded if the user has used up their storage quota.
+// The storage used is cached for a short time, so the quota can be exceeded by the data written in that time.
+func (db *AdminDB) CheckStorageQuota(username string) error {
+	quota := db.a.Config.GetStorageQuota(username)
+	if quota <= 0 {
+		return nil
+	}
+	var used int64
+	if v, ok := db.storageUsage.Get(username); ok {
+		used = v.(int64)
+	} else {
+		var err error
+		if used, err = db.userStorageBytes(username); err != nil {
+			return err
+		}
+		db.storageUsage.SetDefault(username, used)
+	}
+	if used >= quota {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// CheckObjectStorageQuota checks the storage quota of the object's owner, returning ErrQuotaExceeded if it was used up.
+// It is used by object types before writing data to the object.
+func (db *AdminDB) CheckObjectStorageQuota(id string) error {
+	if !db.a.Config.HasStorageQuotas() {
+		return nil
+	}
+	var owner string
+	if err := db.Get(&owner, "SELECT owner FROM objects WHERE id=?;", id); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return err
+	}
+	return db.CheckStorageQuota(owner)
+}
+
+// checkCreateQuota checks the storage quota of the user who will own the object
+func (db *AdminDB) checkCreateQuota(s *Object) error {
+	if !db.a.Config.HasStorageQuotas() {
+		return nil
+	}
+	if s.Owner != nil {
+		return db.CheckStorageQuota(*s.Owner)
+	}
+	if s.App == nil {
+		return nil
+	}
+	var owner string
+	if err := db.Get(&owner, "SELECT owner FROM apps WHERE id=?;", *s.App); err != nil {
+		if err == sql.ErrNoRows {
+			// The insert fails with the app not being found
+			return nil
+		}
+		return err
+	}
+	return db.CheckStorageQuota(owner)
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage(t *testing.T) {
+	db, cleanup := newDBWithUser(t)
+	defer cleanup()
+
+	name := "myobj"
+	stype := "timeseries"
+	owner := "testy"
+	sid, err := db.CreateObject(&Object{
+		Details: Details{
+			Name: &name,
+		},
+		Owner: &owner,
+		Type:  &stype,
+	})
+	require.NoError(t, err)
+
+	s, err := db.ObjectStorage(sid)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, s.Rows)
+	require.True(t, s.Bytes > 0)
+	_, err = db.ObjectStorage("notanobject")
+	require.Equal(t, ErrNotFound, err)
+
+	us, err := db.ReadUserStorage("testy")
+	require.NoError(t, err)
+	require.Len(t, us.Objects, 1)
+	require.Equal(t, *s, *us.Objects[sid])
+	require.True(t, us.Bytes >= s.Bytes)
+	require.True(t, us.Rows > s.Rows)
+	require.EqualValues(t, 0, us.Quota)
+	_, err = db.ReadUserStorage("notauser")
+	require.Equal(t, ErrUserNotFound, err)
+
+	// Once the quota is used up, the user can't create more objects
+	quota := int64(1)
+	db.Assets().Config.StorageQuota = &quota
+	_, err = db.CreateObject(&Object{
+		Details: Details{
+			Name: &name,
+		},
+		Owner: &owner,
+		Type:  &stype,
+	})
+	require.Equal(t, ErrQuotaExceeded, err)
+	require.Equal(t, ErrQuotaExceeded, db.CheckObjectStorageQuota(sid))
+
+	// Per-user quotas override the default
+	db.Assets().Config.UserStorageQuotas = &map[string]int64{"testy": 0}
+	require.NoError(t, db.CheckObjectStorageQuota(sid))
+	us, err = db.ReadUserStorage("testy")
+	require.NoError(t, err)
+	require.EqualValues(t, 0, us.Quota)
+}
@@ -0,0 +1,268 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/heedy/heedy/backend/database/dbutil"
+	"github.com/heedy/heedy/backend/events"
+)
+
+// objectTransferSchema holds the pending transfers of objects to other users, which wait for the recipient's acceptance
+const objectTransferSchema = `
+CREATE TABLE object_transfers (
+	-- an object can only have one pending transfer
+	object VARCHAR(36) PRIMARY KEY NOT NULL,
+	from_user VARCHAR(36) NOT NULL,
+	to_user VARCHAR(36) NOT NULL,
+	created_date DATE NOT NULL DEFAULT CURRENT_DATE,
+
+	CONSTRAINT transferobject
+		FOREIGN KEY(object)
+		REFERENCES objects(id)
+		ON UPDATE CASCADE
+		ON DELETE CASCADE,
+
+	CONSTRAINT transferfrom
+		FOREIGN KEY(from_user)
+		REFERENCES users(username)
+		ON UPDATE CASCADE
+		ON DELETE CASCADE,
+
+	CONSTRAINT transferto
+		FOREIGN KEY(to_user)
+		REFERENCES users(username)
+		ON UPDATE CASCADE
+		ON DELETE CASCADE
+);
+CREATE INDEX object_transfer_recipients ON object_transfers(to_user);
+`
+
+// ObjectTransfer is a request to give an object to another user, which the recipient can accept or reject
+type ObjectTransfer struct {
+	Object      string      `json:"object" db:"object"`
+	From        string      `json:"from" db:"from_user"`
+	To          string      `json:"to" db:"to_user"`
+	CreatedDate dbutil.Date `json:"created_date" db:"created_date"`
+}
+
+// ObjectTransferEvent is the data of the object_transfer event, which is fired both for the object's previous
+// owner and app, and for its new owner and app
+type ObjectTransferEvent struct {
+	FromUser string  `json:"from_user"`
+	ToUser   string  `json:"to_user"`
+	FromApp  *string `json:"from_app"`
+	ToApp    *string `json:"to_app"`
+}
+
+// transferredObject is the ownership of an object before a transfer
+type transferredObject struct {
+	Owner string  `db:"owner"`
+	App   *string `db:"app"`
+	Key   *string `db:"key"`
+}
+
+func readTransferredObject(tx TxWrapper, objectid string) (*transferredObject, error) {
+	var o transferredObject
+	err := tx.Get(&o, "SELECT owner,app,key FROM objects WHERE id=? AND "+objectNotTrashed+";", objectid)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return &o, err
+}
+
+// transferEvent returns the object_transfer event targeting the object's current owner and app
+func transferEvent(db *AdminDB, objectid string, data *ObjectTransferEvent) (*events.Event, error) {
+	e := &events.Event{
+		Event:  "object_transfer",
+		Object: objectid,
+		Data:   data,
+	}
+	return e, FillEvent(db, e)
+}
+
+// RequestObjectTransfer asks the given user to take ownership of the object. The transfer only happens once
+// the recipient accepts it, and replaces any pending transfer of the object. The recipient is notified
+// with the object_transfer_request event.
+func (db *AdminDB) RequestObjectTransfer(objectid, to string) error {
+	if err := ValidUserName(to); err != nil {
+		return err
+	}
+	var owner string
+	err := db.Get(&owner, "SELECT owner FROM objects WHERE id=? AND "+objectNotTrashed+";", objectid)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if owner == to {
+		return ErrBadQuery("The object is already owned by %s", to)
+	}
+	var exists bool
+	if err = db.Get(&exists, "SELECT EXISTS (SELECT 1 FROM users WHERE username=?);", to); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrUserNotFound
+	}
+	_, err = db.Exec("INSERT OR REPLACE INTO object_transfers (object,from_user,to_user) VALUES (?,?,?);", objectid, owner, to)
+	if err != nil {
+		return err
+	}
+	t, err := db.ReadObjectTransfer(objectid)
+	if err != nil {
+		return err
+	}
+	e := &events.Event{
+		Event:  "object_transfer_request",
+		Object: objectid,
+		Data:   t,
+	}
+	if FillEvent(db, e) == nil {
+		// The request is sent to the recipient rather than the object's owner
+		e.User = to
+		events.Fire(e)
+	}
+	return nil
+}
+
+// ReadObjectTransfer returns the pending transfer of the object
+func (db *AdminDB) ReadObjectTransfer(objectid string) (*ObjectTransfer, error) {
+	var t ObjectTransfer
+	err := db.Get(&t, "SELECT * FROM object_transfers WHERE object=?;", objectid)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return &t, err
+}
+
+// ListObjectTransfers returns the pending transfers of objects to and from the given user
+func (db *AdminDB) ListObjectTransfers(username string) ([]*ObjectTransfer, error) {
+	var transfers []*ObjectTransfer
+	err := db.Select(&transfers, "SELECT * FROM object_transfers WHERE to_user=? OR from_user=? ORDER BY created_date ASC;", username, username)
+	return transfers, err
+}
+
+// DelObjectTransfer cancels or rejects the pending transfer of the object
+func (db *AdminDB) DelObjectTransfer(objectid string) error {
+	result, err := db.Exec("DELETE FROM object_transfers WHERE object=?;", objectid)
+	return GetExecError(result, err)
+}
+
+// AcceptObjectTransfer gives the object to the recipient of its pending transfer, who must be the given user.
+// The object is detached from its app, since the app belongs to the previous owner, and the new owner gets
+// full access to it. The object's shares and share links are removed, since they were given by the previous
+// owner, who could otherwise keep access through them.
+func (db *AdminDB) AcceptObjectTransfer(objectid, username string) (err error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	var prev *events.Event
+	data := &ObjectTransferEvent{ToUser: username}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		if err = tx.Commit(); err == nil {
+			events.Fire(prev)
+			if e, err2 := transferEvent(db, objectid, data); err2 == nil {
+				events.Fire(e)
+			}
+		}
+	}()
+	o, err := readTransferredObject(tx, objectid)
+	if err != nil {
+		return err
+	}
+	var exists bool
+	if err = tx.Get(&exists, "SELECT EXISTS (SELECT 1 FROM object_transfers WHERE object=? AND from_user=? AND to_user=?);", objectid, o.Owner, username); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	data.FromUser = o.Owner
+	data.FromApp = o.App
+	if prev, err = transferEvent(db, objectid, data); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(`UPDATE objects SET owner=?,app=NULL,key=NULL,owner_scope='["*"]' WHERE id=?;`, username, objectid); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM shared_objects WHERE objectid=?;", objectid); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM share_links WHERE object=?;", objectid); err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM object_transfers WHERE object=?;", objectid)
+	return err
+}
+
+// MoveObjectToApp re-parents the object to another app of its owner, or detaches it from its app if appid is nil.
+// The object keeps its key unless a new key is given, which must not be used by another object of the app.
+// An object without an app has no key, and its owner gets full access to it. The owner doesn't change,
+// so the object's shares and share links are kept.
+func (db *AdminDB) MoveObjectToApp(objectid string, appid, key *string) (err error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	var prev *events.Event
+	data := &ObjectTransferEvent{ToApp: appid}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		if err = tx.Commit(); err == nil {
+			events.Fire(prev)
+			if e, err2 := transferEvent(db, objectid, data); err2 == nil {
+				events.Fire(e)
+			}
+		}
+	}()
+	o, err := readTransferredObject(tx, objectid)
+	if err != nil {
+		return err
+	}
+	data.FromUser = o.Owner
+	data.ToUser = o.Owner
+	data.FromApp = o.App
+	if prev, err = transferEvent(db, objectid, data); err != nil {
+		return err
+	}
+
+	if appid == nil {
+		if key != nil {
+			return ErrBadQuery("Only objects that belong to an app can have a key")
+		}
+		_, err = tx.Exec(`UPDATE objects SET app=NULL,key=NULL,owner_scope='["*"]' WHERE id=?;`, objectid)
+		return err
+	}
+	var exists bool
+	if err = tx.Get(&exists, "SELECT EXISTS (SELECT 1 FROM apps WHERE id=? AND owner=? AND deleted_date IS NULL);", *appid, o.Owner); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrBadQuery("The object can only be moved to an app of its owner")
+	}
+	if key == nil {
+		key = o.Key
+	} else if *key == "" {
+		key = nil
+	}
+	if key != nil {
+		if err = tx.Get(&exists, "SELECT EXISTS (SELECT 1 FROM objects WHERE app=? AND key=? AND id<>?);", *appid, *key, objectid); err != nil {
+			return err
+		}
+		if exists {
+			return ErrBadQuery("The app already has an object with key '%s'", *key)
+		}
+	}
+	_, err = tx.Exec("UPDATE objects SET app=?,key=? WHERE id=?;", *appid, key, objectid)
+	return err
+}
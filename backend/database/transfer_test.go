@@ -0,0 +1,151 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestObjectTransfer(t *testing.T) {
+	db, cleanup := newDBWithUser(t)
+	defer cleanup()
+
+	name := "testy"
+	other := "other"
+	passwd := "testpass"
+	otype := "timeseries"
+	require.NoError(t, db.CreateUser(&User{
+		UserName: &other,
+		Password: &passwd,
+	}))
+	appid, _, err := db.CreateApp(&App{
+		Details: Details{
+			Name: &name,
+		},
+		Owner: &name,
+	})
+	require.NoError(t, err)
+	oid, err := db.CreateObject(&Object{
+		Details: Details{
+			Name: &name,
+		},
+		App:        &appid,
+		Key:        &name,
+		Type:       &otype,
+		OwnerScope: &ScopeArray{Scope: []string{"read"}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, db.ShareObject(oid, "public", &ScopeArray{Scope: []string{"read"}}))
+	require.NoError(t, db.CreateShareLink(&ShareLink{Object: oid}, nil))
+
+	require.Error(t, db.RequestObjectTransfer(oid, name))
+	require.Equal(t, ErrUserNotFound, db.RequestObjectTransfer(oid, "notauser"))
+	require.Equal(t, ErrNotFound, db.RequestObjectTransfer("notanobject", other))
+	require.NoError(t, db.RequestObjectTransfer(oid, other))
+
+	for _, u := range []string{name, other} {
+		transfers, err := db.ListObjectTransfers(u)
+		require.NoError(t, err)
+		require.Len(t, transfers, 1)
+		require.Equal(t, name, transfers[0].From)
+		require.Equal(t, other, transfers[0].To)
+	}
+
+	// Only the recipient can accept the transfer
+	require.Equal(t, ErrNotFound, db.AcceptObjectTransfer(oid, name))
+	require.NoError(t, db.AcceptObjectTransfer(oid, other))
+
+	o, err := db.ReadObject(oid, nil)
+	require.NoError(t, err)
+	require.Equal(t, other, *o.Owner)
+	require.Nil(t, o.App)
+	require.Nil(t, o.Key)
+	require.True(t, o.OwnerScope.HasScope("delete"))
+
+	// The previous owner loses access, along with the shares and links that they gave
+	udb := NewUserDB(db, name)
+	_, err = udb.ReadObject(oid, nil)
+	require.Error(t, err)
+	shares, err := db.GetObjectShares(oid)
+	require.NoError(t, err)
+	require.Len(t, shares, 0)
+	links, err := db.ListShareLinks(oid)
+	require.NoError(t, err)
+	require.Len(t, links, 0)
+	_, err = db.ReadObjectTransfer(oid)
+	require.Equal(t, ErrNotFound, err)
+
+	// Transfers can be rejected
+	require.NoError(t, db.RequestObjectTransfer(oid, name))
+	require.NoError(t, db.DelObjectTransfer(oid))
+	require.Equal(t, ErrNotFound, db.AcceptObjectTransfer(oid, name))
+}
+
+func TestMoveObjectToApp(t *testing.T) {
+	db, cleanup := newDBWithUser(t)
+	defer cleanup()
+
+	name := "testy"
+	other := "other"
+	passwd := "testpass"
+	otype := "timeseries"
+	require.NoError(t, db.CreateUser(&User{
+		UserName: &other,
+		Password: &passwd,
+	}))
+	newApp := func(owner string) string {
+		appid, _, err := db.CreateApp(&App{
+			Details: Details{
+				Name: &name,
+			},
+			Owner: &owner,
+		})
+		require.NoError(t, err)
+		return appid
+	}
+	app1 := newApp(name)
+	app2 := newApp(name)
+	otherApp := newApp(other)
+
+	oid, err := db.CreateObject(&Object{
+		Details: Details{
+			Name: &name,
+		},
+		App:        &app1,
+		Key:        &name,
+		Type:       &otype,
+		OwnerScope: &ScopeArray{Scope: []string{"read"}},
+	})
+	require.NoError(t, err)
+	_, err = db.CreateObject(&Object{
+		Details: Details{
+			Name: &name,
+		},
+		App:  &app2,
+		Key:  &name,
+		Type: &otype,
+	})
+	require.NoError(t, err)
+
+	// Objects can only move to apps of their owner, and keys stay unique
+	require.Error(t, db.MoveObjectToApp(oid, &otherApp, nil))
+	require.Error(t, db.MoveObjectToApp(oid, &app2, nil))
+	newkey := "newkey"
+	require.NoError(t, db.MoveObjectToApp(oid, &app2, &newkey))
+
+	o, err := db.ReadObject(oid, nil)
+	require.NoError(t, err)
+	require.Equal(t, app2, *o.App)
+	require.Equal(t, newkey, *o.Key)
+	require.False(t, o.OwnerScope.HasScope("delete"))
+
+	// Detaching the object from its app gives the owner full access
+	require.Error(t, db.MoveObjectToApp(oid, nil, &newkey))
+	require.NoError(t, db.MoveObjectToApp(oid, nil, nil))
+	o, err = db.ReadObject(oid, nil)
+	require.NoError(t, err)
+	require.Nil(t, o.App)
+	require.Nil(t, o.Key)
+	require.True(t, o.OwnerScope.HasScope("delete"))
+	require.Equal(t, name, *o.Owner)
+}
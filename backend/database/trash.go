@@ -0,0 +1,159 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// trashedKey is the key of an object in the trash, which is prefixed with the object's ID so that the app
+// can create a new object with the same key. The original key is given by restoredKey.
+const trashedKey = "id||'/'||key"
+const restoredKey = "substr(key,length(id)+2)"
+
+// trashObject moves the objects matching the where statement to the trash. If the trash
+// is disabled (trash_retention is 0), the objects are deleted immediately.
+func trashObject(adb *AdminDB, whereStatement string, args ...interface{}) error {
+	if adb.Assets().Config.GetTrashRetention() == 0 {
+		result, err := adb.Exec(fmt.Sprintf("DELETE FROM objects WHERE %s;", whereStatement), args...)
+		return GetExecError(result, err)
+	}
+	result, err := adb.Exec(fmt.Sprintf("UPDATE objects SET deleted_date=CURRENT_TIMESTAMP,key="+trashedKey+" WHERE %s AND "+objectNotTrashed+";", whereStatement), args...)
+	return GetExecError(result, err)
+}
+
+// trashApp moves the app matching the where statement to the trash. The app's objects are hidden
+// along with the app, and come back when the app is restored.
+func trashApp(adb *AdminDB, whereStatement string, args ...interface{}) error {
+	if adb.Assets().Config.GetTrashRetention() == 0 {
+		result, err := adb.Exec(fmt.Sprintf("DELETE FROM apps WHERE %s;", whereStatement), args...)
+		return GetExecError(result, err)
+	}
+	result, err := adb.Exec(fmt.Sprintf("UPDATE apps SET deleted_date=CURRENT_TIMESTAMP WHERE %s AND deleted_date IS NULL;", whereStatement), args...)
+	return GetExecError(result, err)
+}
+
+// restoreObject removes the object from the trash, giving it back its key. Objects belonging to an app in the trash
+// can only be restored once the app is restored, and objects can't be restored if the app has since created
+// another object with the same key.
+func restoreObject(adb *AdminDB, whereStatement string, args ...interface{}) error {
+	var key string
+	err := adb.Get(&key, fmt.Sprintf(`SELECT %s FROM objects AS t WHERE %s AND deleted_date IS NOT NULL AND key IS NOT NULL
+		AND EXISTS (SELECT 1 FROM objects WHERE objects.app=t.app AND objects.key=substr(t.key,length(t.id)+2)) LIMIT 1;`, restoredKey, whereStatement), args...)
+	if err == nil {
+		return ErrBadQuery("The app already has an object with key '%s', so the object can't be restored", key)
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+	result, err := adb.Exec(fmt.Sprintf(`UPDATE objects SET deleted_date=NULL,key=`+restoredKey+` WHERE %s AND deleted_date IS NOT NULL
+		AND (app IS NULL OR EXISTS (SELECT 1 FROM apps WHERE apps.id=objects.app AND apps.deleted_date IS NULL));`, whereStatement), args...)
+	return GetExecError(result, err)
+}
+
+// restoreApp removes the app from the trash, which also makes its objects visible again. A unique plugin app
+// can't be restored if it was created again while the app was in the trash.
+func restoreApp(adb *AdminDB, whereStatement string, args ...interface{}) error {
+	var apps []struct {
+		Owner  string `db:"owner"`
+		Plugin string `db:"plugin"`
+	}
+	err := adb.Select(&apps, fmt.Sprintf("SELECT owner,plugin FROM apps WHERE %s AND deleted_date IS NOT NULL AND plugin IS NOT NULL;", whereStatement), args...)
+	if err != nil {
+		return err
+	}
+	for _, a := range apps {
+		if !isUniquePluginApp(adb, a.Plugin) {
+			continue
+		}
+		var exists bool
+		if err = adb.Get(&exists, "SELECT EXISTS (SELECT 1 FROM apps WHERE owner=? AND plugin=? AND deleted_date IS NULL);", a.Owner, a.Plugin); err != nil {
+			return err
+		}
+		if exists {
+			return ErrBadQuery("The unique plugin app %s already exists, so the app can't be restored", a.Plugin)
+		}
+	}
+	result, err := adb.Exec(fmt.Sprintf("UPDATE apps SET deleted_date=NULL WHERE %s AND deleted_date IS NOT NULL;", whereStatement), args...)
+	return GetExecError(result, err)
+}
+
+// isUniquePluginApp returns whether the plugin app given by its "plugin:app" key can only exist once per user
+func isUniquePluginApp(adb *AdminDB, pluginKey string) bool {
+	pk := strings.SplitN(pluginKey, ":", 2)
+	if len(pk) != 2 {
+		return false
+	}
+	p, ok := adb.Assets().Config.Plugins[pk[0]]
+	if !ok {
+		return false
+	}
+	app, ok := p.Apps[pk[1]]
+	return ok && app.Unique != nil && *app.Unique
+}
+
+// listTrash lists the objects and apps in the trash that match the where statement. Objects belonging
+// to an app in the trash are not listed separately.
+func listTrash(adb *AdminDB, whereStatement string, args ...interface{}) (*Trash, error) {
+	t := &Trash{}
+	err := adb.Select(&t.Objects, fmt.Sprintf(`SELECT *,'["*"]' AS access FROM objects WHERE %s AND deleted_date IS NOT NULL
+		AND (app IS NULL OR EXISTS (SELECT 1 FROM apps WHERE apps.id=objects.app AND apps.deleted_date IS NULL)) ORDER BY deleted_date DESC;`, whereStatement), args...)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range t.Objects {
+		s.Icon = nil
+		if s.Key != nil {
+			k := strings.TrimPrefix(*s.Key, s.ID+"/")
+			s.Key = &k
+		}
+	}
+	t.Apps, err = listApps(adb, nil, fmt.Sprintf("SELECT * FROM apps WHERE %s AND deleted_date IS NOT NULL ORDER BY deleted_date DESC;", whereStatement), args...)
+	if err != nil {
+		return nil, err
+	}
+	if t.Objects == nil {
+		t.Objects = []*Object{}
+	}
+	if t.Apps == nil {
+		t.Apps = []*App{}
+	}
+	return t, nil
+}
+
+// ListTrash lists the deleted objects and apps belonging to the given user. An empty owner lists the trash of all users.
+func (db *AdminDB) ListTrash(owner string) (*Trash, error) {
+	if owner == "" {
+		return listTrash(db, "1=1")
+	}
+	return listTrash(db, "owner=?", owner)
+}
+
+// RestoreObject removes the given object from the trash
+func (db *AdminDB) RestoreObject(id string) error {
+	return restoreObject(db, "id=?", id)
+}
+
+// RestoreApp removes the given app and its objects from the trash
+func (db *AdminDB) RestoreApp(id string) error {
+	return restoreApp(db, "id=?", id)
+}
+
+// PurgeTrash permanently deletes the objects and apps that have been in the trash for longer
+// than the given duration. The deletions fire the standard object_delete and app_delete events.
+func (db *AdminDB) PurgeTrash(olderThan time.Duration) error {
+	before := time.Now().UTC().Add(-olderThan).Format("2006-01-02 15:04:05")
+	_, err := db.Exec("DELETE FROM apps WHERE deleted_date<=?;", before)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("DELETE FROM objects WHERE deleted_date<=?;", before)
+	return err
+}
+
+// PurgeObject permanently deletes the given object, whether or not it is in the trash
+func (db *AdminDB) PurgeObject(id string) error {
+	result, err := db.Exec("DELETE FROM objects WHERE id=?;", id)
+	return GetExecError(result, err)
+}
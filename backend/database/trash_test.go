@@ -0,0 +1,237 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/heedy/heedy/backend/assets"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrashObject(t *testing.T) {
+	adb, cleanup := newDBWithUser(t)
+	defer cleanup()
+
+	db := NewUserDB(adb, "testy")
+
+	name := "tree"
+	stype := "timeseries"
+	sid, err := db.CreateObject(&Object{
+		Details: Details{
+			Name: &name,
+		},
+		Type: &stype,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, db.DelObject(sid))
+	require.Error(t, db.DelObject(sid))
+
+	_, err = db.ReadObject(sid, nil)
+	require.Error(t, err)
+	_, err = adb.ReadObject(sid, nil)
+	require.Error(t, err)
+	sl, err := db.ListObjects(nil)
+	require.NoError(t, err)
+	require.Len(t, sl, 0)
+
+	tr, err := db.ListTrash("testy")
+	require.NoError(t, err)
+	require.Len(t, tr.Objects, 1)
+	require.Equal(t, sid, tr.Objects[0].ID)
+	require.NotNil(t, tr.Objects[0].DeletedDate)
+
+	_, err = db.ListTrash("heedy")
+	require.Error(t, err)
+
+	require.NoError(t, db.RestoreObject(sid))
+	require.Error(t, db.RestoreObject(sid))
+	s, err := db.ReadObject(sid, nil)
+	require.NoError(t, err)
+	require.Nil(t, s.DeletedDate)
+
+	// The purge only removes objects that are older than the retention
+	require.NoError(t, db.DelObject(sid))
+	require.NoError(t, adb.PurgeTrash(adb.Assets().Config.GetTrashRetention()))
+	tr, err = db.ListTrash("testy")
+	require.NoError(t, err)
+	require.Len(t, tr.Objects, 1)
+
+	require.NoError(t, adb.PurgeTrash(0))
+	tr, err = db.ListTrash("testy")
+	require.NoError(t, err)
+	require.Len(t, tr.Objects, 0)
+	require.Error(t, db.RestoreObject(sid))
+
+	// Objects can be purged directly, whether or not they are in the trash
+	sid, err = db.CreateObject(&Object{
+		Details: Details{
+			Name: &name,
+		},
+		Type: &stype,
+	})
+	require.NoError(t, err)
+	require.NoError(t, adb.PurgeObject(sid))
+	require.Error(t, adb.PurgeObject(sid))
+	tr, err = db.ListTrash("testy")
+	require.NoError(t, err)
+	require.Len(t, tr.Objects, 0)
+}
+
+func TestTrashApp(t *testing.T) {
+	adb, cleanup := newDBWithUser(t)
+	defer cleanup()
+
+	db := NewUserDB(adb, "testy")
+
+	name := "myapp"
+	cid, accessToken, err := db.CreateApp(&App{
+		Details: Details{
+			Name: &name,
+		},
+	})
+	require.NoError(t, err)
+
+	stype := "timeseries"
+	sid, err := adb.CreateObject(&Object{
+		Details: Details{
+			Name: &name,
+		},
+		App:  &cid,
+		Type: &stype,
+	})
+	require.NoError(t, err)
+	sid2, err := adb.CreateObject(&Object{
+		Details: Details{
+			Name: &name,
+		},
+		App:  &cid,
+		Type: &stype,
+	})
+	require.NoError(t, err)
+
+	// Users can't directly delete objects belonging to apps
+	require.Error(t, db.DelObject(sid2))
+	// Deleted separately before the app, so it should stay in the trash when the app is restored
+	require.NoError(t, adb.DelObject(sid2))
+
+	require.NoError(t, db.DelApp(cid))
+
+	_, err = db.ReadApp(cid, nil)
+	require.Error(t, err)
+	_, err = adb.GetAppByAccessToken(accessToken)
+	require.Error(t, err)
+	_, err = db.ReadObject(sid, nil)
+	require.Error(t, err)
+	al, err := db.ListApps(nil)
+	require.NoError(t, err)
+	require.Len(t, al, 0)
+
+	tr, err := db.ListTrash("testy")
+	require.NoError(t, err)
+	require.Len(t, tr.Apps, 1)
+	require.Len(t, tr.Objects, 0)
+
+	// Objects deleted with their app can only be restored through the app
+	require.Error(t, db.RestoreObject(sid))
+	require.NoError(t, db.RestoreApp(cid))
+
+	_, err = adb.GetAppByAccessToken(accessToken)
+	require.NoError(t, err)
+	_, err = db.ReadObject(sid, nil)
+	require.NoError(t, err)
+	_, err = db.ReadObject(sid2, nil)
+	require.Error(t, err)
+
+	tr, err = db.ListTrash("testy")
+	require.NoError(t, err)
+	require.Len(t, tr.Apps, 0)
+	require.Len(t, tr.Objects, 1)
+
+	require.NoError(t, db.DelApp(cid))
+	require.NoError(t, adb.PurgeTrash(0))
+	_, err = adb.ReadObject(sid, nil)
+	require.Error(t, err)
+	tr, err = adb.ListTrash("")
+	require.NoError(t, err)
+	require.Len(t, tr.Apps, 0)
+	require.Len(t, tr.Objects, 0)
+}
+
+func TestTrashObjectKey(t *testing.T) {
+	adb, cleanup := newDBWithUser(t)
+	defer cleanup()
+
+	name := "myapp"
+	owner := "testy"
+	key := "mykey"
+	stype := "timeseries"
+	cid, _, err := adb.CreateApp(&App{
+		Details: Details{
+			Name: &name,
+		},
+		Owner: &owner,
+	})
+	require.NoError(t, err)
+	newObject := func() (string, error) {
+		return adb.CreateObject(&Object{
+			Details: Details{
+				Name: &name,
+			},
+			App:  &cid,
+			Key:  &key,
+			Type: &stype,
+		})
+	}
+	sid, err := newObject()
+	require.NoError(t, err)
+	require.NoError(t, adb.DelObject(sid))
+
+	// The key is freed while the object is in the trash, but the trash still shows it
+	tr, err := adb.ListTrash(owner)
+	require.NoError(t, err)
+	require.Len(t, tr.Objects, 1)
+	require.Equal(t, key, *tr.Objects[0].Key)
+	sid2, err := newObject()
+	require.NoError(t, err)
+
+	// The object can't be restored while its key is taken
+	require.Error(t, adb.RestoreObject(sid))
+	require.NoError(t, adb.PurgeObject(sid2))
+	require.NoError(t, adb.RestoreObject(sid))
+	o, err := adb.ReadObject(sid, nil)
+	require.NoError(t, err)
+	require.Equal(t, key, *o.Key)
+}
+
+func TestTrashUniquePluginApp(t *testing.T) {
+	adb, cleanup := newDBWithUser(t)
+	defer cleanup()
+
+	unique := true
+	adb.Assets().Config.Plugins["kv"].Apps = map[string]*assets.App{
+		"myapp": &assets.App{Unique: &unique},
+	}
+
+	name := "myapp"
+	owner := "testy"
+	plugin := "kv:myapp"
+	newApp := func() string {
+		cid, _, err := adb.CreateApp(&App{
+			Details: Details{
+				Name: &name,
+			},
+			Owner:  &owner,
+			Plugin: &plugin,
+		})
+		require.NoError(t, err)
+		return cid
+	}
+	cid := newApp()
+	require.NoError(t, adb.DelApp(cid))
+
+	// The plugin app was created again while the original was in the trash
+	cid2 := newApp()
+	require.Error(t, adb.RestoreApp(cid))
+	require.NoError(t, adb.DelApp(cid2))
+	require.NoError(t, adb.RestoreApp(cid))
+}
@@ -80,6 +80,12 @@ func (db *UserDB) ListUsers(o *ListUsersOptions) ([]*User, error) {
 
 // CanCreateObject returns whether the given object can be
 func (db *UserDB) CanCreateObject(s *Object) error {
+	if s.Owner == nil {
+		// The object will belong to the current user
+		so := *s
+		so.Owner = &db.user
+		s = &so
+	}
 	_, _, err := objectCreateQuery(db.adb.Assets().Config, s)
 	if err != nil {
 		return err
@@ -130,12 +136,11 @@ func (db *UserDB) UpdateObject(s *Object) error {
 
 // Can only delete objects that belong to *us*
 func (db *UserDB) DelObject(id string) error {
-	result, err := db.adb.Exec("DELETE FROM objects WHERE id=? AND owner=? AND app IS NULL;", id, db.user)
-	return GetExecError(result, err)
+	return trashObject(db.adb, "id=? AND owner=? AND app IS NULL", id, db.user)
 }
 
 func (db *UserDB) ShareObject(objectid, userid string, sa *ScopeArray) error {
-	return shareObject(db, objectid, userid, sa, `SELECT 1 FROM objects WHERE owner=? AND id=?`, db.user, objectid)
+	return shareObject(db, objectid, userid, sa, `SELECT 1 FROM objects WHERE owner=? AND id=? AND `+objectNotTrashed, db.user, objectid)
 }
 
 func (db *UserDB) UnshareObjectFromUser(objectid, userid string) error {
@@ -178,7 +183,7 @@ func (db *UserDB) CreateApp(c *App) (string, string, error) {
 }
 func (db *UserDB) ReadApp(cid string, o *ReadAppOptions) (*App, error) {
 	// Can only read apps that belong to us
-	return readApp(db.adb, cid, o, `SELECT * FROM apps WHERE owner=? AND id=?;`, db.user, cid)
+	return readApp(db.adb, cid, o, `SELECT * FROM apps WHERE owner=? AND id=? AND deleted_date IS NULL;`, db.user, cid)
 }
 func (db *UserDB) UpdateApp(c *App) error {
 	if c.Plugin != nil {
@@ -187,19 +192,18 @@ func (db *UserDB) UpdateApp(c *App) error {
 	if c.SettingsSchema != nil {
 		return ErrAccessDenied("Cannot modify app settings schema - only the app itself can do that.")
 	}
-	return updateApp(db.adb, c, `id=? AND owner=?`, c.ID, db.user)
+	return updateApp(db.adb, c, `id=? AND owner=? AND deleted_date IS NULL`, c.ID, db.user)
 }
 func (db *UserDB) DelApp(cid string) error {
 	// Can only delete apps that are not plugin-generated, unless the plugin is no longer active
-	result, err := db.adb.Exec("DELETE FROM apps WHERE id=? AND owner=?;", cid, db.user)
-	return GetExecError(result, err)
+	return trashApp(db.adb, "id=? AND owner=?", cid, db.user)
 }
 func (db *UserDB) ListApps(o *ListAppOptions) ([]*App, error) {
 	if o != nil && o.Owner != nil && *o.Owner != db.user && *o.Owner != "self" {
 		return nil, ErrAccessDenied("Can only list your own apps")
 	}
 	a := []interface{}{db.user}
-	selectStmt := `SELECT * FROM apps WHERE owner=?`
+	selectStmt := `SELECT * FROM apps WHERE owner=? AND deleted_date IS NULL`
 	if o != nil && o.Plugin != nil {
 		if *o.Plugin == "" {
 			selectStmt = selectStmt + " AND plugin IS NULL"
@@ -212,6 +216,24 @@ func (db *UserDB) ListApps(o *ListAppOptions) ([]*App, error) {
 	return listApps(db.adb, o, selectStmt, a...)
 }
 
+// ListTrash lists the user's deleted objects and apps
+func (db *UserDB) ListTrash(owner string) (*Trash, error) {
+	if owner != db.user && owner != "self" {
+		return nil, ErrAccessDenied("Can only list your own trash")
+	}
+	return listTrash(db.adb, "owner=?", db.user)
+}
+
+// RestoreObject restores an object belonging to the user from the trash
+func (db *UserDB) RestoreObject(id string) error {
+	return restoreObject(db.adb, "id=? AND owner=?", id, db.user)
+}
+
+// RestoreApp restores an app belonging to the user from the trash
+func (db *UserDB) RestoreApp(cid string) error {
+	return restoreApp(db.adb, "id=? AND owner=?", cid, db.user)
+}
+
 func (db *UserDB) ReadUserSettings(username string) (map[string]map[string]interface{}, error) {
 	if username != db.user {
 		return nil, ErrAccessDenied("Cannot read other users' settings.")
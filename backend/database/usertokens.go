@@ -0,0 +1,210 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/heedy/heedy/backend/database/dbutil"
+)
+
+// userTokenSchema holds personal access tokens, which give scripts scoped access to a user's data without creating an app
+const userTokenSchema = `
+CREATE TABLE user_tokens (
+	id VARCHAR(36) PRIMARY KEY NOT NULL,
+	token VARCHAR UNIQUE NOT NULL,
+	owner VARCHAR(36) NOT NULL,
+	name VARCHAR NOT NULL DEFAULT '',
+	-- the token has the same scopes as apps, which are limited to the owner's access
+	scope VARCHAR NOT NULL DEFAULT '[]',
+	created_date DATE NOT NULL DEFAULT CURRENT_DATE,
+	-- a token that has not yet been used has this as null
+	last_access_date DATE DEFAULT NULL,
+	-- unix timestamp after which the token can no longer be used
+	expires REAL DEFAULT NULL,
+
+	CONSTRAINT valid_scope CHECK (json_valid(scope)),
+
+	CONSTRAINT tokenowner
+		FOREIGN KEY(owner)
+		REFERENCES users(username)
+		ON UPDATE CASCADE
+		ON DELETE CASCADE
+);
+CREATE INDEX user_token_owners ON user_tokens(owner);
+`
+
+// UserToken is a personal access token, which acts as its owner, limited to the token's scope
+type UserToken struct {
+	ID    string `json:"id" db:"id"`
+	Owner string `json:"owner" db:"owner"`
+	Name  string `json:"name" db:"name"`
+	// The token is only returned when it is created
+	Token *string        `json:"token,omitempty" db:"token"`
+	Scope *AppScopeArray `json:"scope" db:"scope"`
+
+	CreatedDate    dbutil.Date  `json:"created_date" db:"created_date"`
+	LastAccessDate *dbutil.Date `json:"last_access_date" db:"last_access_date"`
+	// The unix timestamp after which the token can't be used, or nil if it doesn't expire
+	Expires *float64 `json:"expires" db:"expires"`
+}
+
+// userTokenColumns are the columns of user_tokens that are returned when reading tokens, which leave out the token itself
+const userTokenColumns = "id,owner,name,scope,created_date,last_access_date,expires"
+
+// CreateUserToken creates a personal access token for t.Owner, writing the new ID and token to t
+func (db *AdminDB) CreateUserToken(t *UserToken) error {
+	if err := ValidUserName(t.Owner); err != nil {
+		return err
+	}
+	t.Name = strings.TrimSpace(t.Name)
+	if t.Name == "" {
+		return ErrBadQuery("An access token needs a name")
+	}
+	if t.Scope == nil || len(t.Scope.Scope) == 0 {
+		return ErrBadQuery("An access token needs at least one scope")
+	}
+	for _, s := range t.Scope.Scope {
+		if s == "*" {
+			return ErrBadQuery("Access tokens must list their scopes explicitly")
+		}
+		if strings.HasPrefix(s, "self.") {
+			return ErrBadQuery("Access tokens can't have the '%s' scope, since they don't own objects", s)
+		}
+	}
+	if t.Expires != nil && *t.Expires <= unixNow() {
+		return ErrBadQuery("The access token expires in the past")
+	}
+
+	token, err := generateCode(32)
+	if err != nil {
+		return err
+	}
+	id := uuid.New().String()
+	result, err := db.Exec(`INSERT INTO user_tokens (id,token,owner,name,scope,expires) VALUES (?,?,?,?,?,?);`,
+		id, token, t.Owner, t.Name, t.Scope, t.Expires)
+	if err = GetExecError(result, err); err != nil {
+		if strings.Contains(err.Error(), "FOREIGN KEY") {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	t.ID = id
+	t.Token = &token
+	return nil
+}
+
+// ListUserTokens returns the user's access tokens, including expired tokens
+func (db *AdminDB) ListUserTokens(owner string) ([]*UserToken, error) {
+	var tokens []*UserToken
+	err := db.Select(&tokens, "SELECT "+userTokenColumns+" FROM user_tokens WHERE owner=? ORDER BY created_date ASC;", owner)
+	return tokens, err
+}
+
+// ReadUserToken returns the given access token if it can still be used
+func (db *AdminDB) ReadUserToken(id string) (*UserToken, error) {
+	var t UserToken
+	err := db.Get(&t, "SELECT "+userTokenColumns+" FROM user_tokens WHERE id=? AND (expires IS NULL OR expires > ?);", id, unixNow())
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return &t, err
+}
+
+// GetUserTokenByToken returns the access token if it can still be used, and sets its last access date if not today
+func (db *AdminDB) GetUserTokenByToken(token string) (*UserToken, error) {
+	if token == "" {
+		return nil, ErrNotFound
+	}
+	var t UserToken
+	err := db.Get(&t, "SELECT "+userTokenColumns+" FROM user_tokens WHERE token=? AND (expires IS NULL OR expires > ?);", token, unixNow())
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err == nil && (t.LastAccessDate == nil || shouldUpdateLastUsed(*t.LastAccessDate)) {
+		_, err = db.Exec("UPDATE user_tokens SET last_access_date=DATE('now') WHERE id=?;", t.ID)
+	}
+	return &t, err
+}
+
+// DelUserToken revokes the given access token of the user
+func (db *AdminDB) DelUserToken(owner, id string) error {
+	result, err := db.Exec("DELETE FROM user_tokens WHERE owner=? AND id=?;", owner, id)
+	return GetExecError(result, err)
+}
+
+// TokenDB is the database view of a personal access token. It has the same access as an app
+// with the token's scope, except that objects it creates belong directly to the user.
+type TokenDB struct {
+	*AppDB
+	Token *UserToken
+}
+
+// NewTokenDB returns the database accessible with the given access token
+func NewTokenDB(adb *AdminDB, t *UserToken) *TokenDB {
+	return &TokenDB{
+		AppDB: NewAppDB(adb, &App{
+			Details: Details{ID: "token:" + t.ID},
+			Owner:   &t.Owner,
+			Scope:   t.Scope,
+		}),
+		Token: t,
+	}
+}
+
+// CanCreateObject returns whether the token can create the given object
+func (db *TokenDB) CanCreateObject(s *Object) error {
+	if s.App != nil {
+		return ErrAccessDenied("Access tokens can't create objects for apps")
+	}
+	if s.Owner != nil && *s.Owner != db.Token.Owner {
+		return ErrAccessDenied("Can't create a object for a different user")
+	}
+	so := *s
+	so.Owner = &db.Token.Owner
+	_, _, err := objectCreateQuery(db.adb.Assets().Config, &so)
+	if err != nil {
+		return err
+	}
+	if !db.c.Scope.HasScope("objects:create") && !db.c.Scope.HasScope("objects."+*s.Type+":create") {
+		return ErrAccessDenied("Insufficient access to create a object of this type")
+	}
+	return nil
+}
+
+// CreateObject creates an object belonging to the token's owner
+func (db *TokenDB) CreateObject(s *Object) (string, error) {
+	if s.ModifiedDate != nil {
+		return "", ErrAccessDenied("Last Modified for object is readonly")
+	}
+	if s.App != nil {
+		return "", ErrAccessDenied("Access tokens can't create objects for apps")
+	}
+	if s.Owner != nil && *s.Owner != db.Token.Owner {
+		return "", ErrAccessDenied("Can't create a object for a different user")
+	}
+	s.Owner = &db.Token.Owner
+	if s.Type == nil || !db.c.Scope.HasScope("objects:create") && !db.c.Scope.HasScope("objects."+*s.Type+":create") {
+		return "", ErrAccessDenied("Insufficient access to create a object of this type")
+	}
+	return db.adb.CreateObject(s)
+}
+
+// ListObjects lists the objects that the token can read. Since objects created with the token belong
+// directly to its owner, "self" refers to the owner's objects that don't belong to an app.
+func (db *TokenDB) ListObjects(o *ListObjectsOptions) ([]*Object, error) {
+	if o != nil && o.App != nil && *o.App == "self" {
+		noapp := ""
+		o.App = &noapp
+		o.Owner = &db.Token.Owner
+	}
+	return db.AppDB.ListObjects(o)
+}
+
+func (db *TokenDB) ReadApp(cid string, o *ReadAppOptions) (*App, error) {
+	return nil, ErrAccessDenied("Access tokens can't read apps")
+}
+func (db *TokenDB) UpdateApp(c *App) error {
+	return ErrAccessDenied("Access tokens can't modify apps")
+}
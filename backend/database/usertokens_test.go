@@ -0,0 +1,90 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserTokens(t *testing.T) {
+	db, cleanup := newDBWithUser(t)
+	defer cleanup()
+
+	require.Error(t, db.CreateUserToken(&UserToken{Owner: "testy", Name: "script"}))
+	require.Error(t, db.CreateUserToken(&UserToken{Owner: "testy", Name: "script", Scope: &AppScopeArray{ScopeArray: ScopeArray{Scope: []string{"*"}}}}))
+	require.Error(t, db.CreateUserToken(&UserToken{Owner: "testy", Name: "script", Scope: &AppScopeArray{ScopeArray: ScopeArray{Scope: []string{"self.objects"}}}}))
+	require.Equal(t, ErrUserNotFound, db.CreateUserToken(&UserToken{Owner: "notauser", Name: "script", Scope: &AppScopeArray{ScopeArray: ScopeArray{Scope: []string{"objects:read"}}}}))
+	expires := 1.0
+	require.Error(t, db.CreateUserToken(&UserToken{Owner: "testy", Name: "script", Expires: &expires, Scope: &AppScopeArray{ScopeArray: ScopeArray{Scope: []string{"objects:read"}}}}))
+
+	tok := &UserToken{Owner: "testy", Name: "script", Scope: &AppScopeArray{ScopeArray: ScopeArray{Scope: []string{"objects.timeseries", "owner:read"}}}}
+	require.NoError(t, db.CreateUserToken(tok))
+	require.NotNil(t, tok.Token)
+
+	rtok := &UserToken{Owner: "testy", Name: "reader", Scope: &AppScopeArray{ScopeArray: ScopeArray{Scope: []string{"objects:read"}}}}
+	require.NoError(t, db.CreateUserToken(rtok))
+
+	tokens, err := db.ListUserTokens("testy")
+	require.NoError(t, err)
+	require.Len(t, tokens, 2)
+	require.Nil(t, tokens[0].Token)
+
+	t2, err := db.GetUserTokenByToken(*tok.Token)
+	require.NoError(t, err)
+	require.Equal(t, tok.ID, t2.ID)
+	_, err = db.GetUserTokenByToken("notatoken")
+	require.Equal(t, ErrNotFound, err)
+
+	// The token can create and modify the user's timeseries
+	tdb, err := db.As("testy/token:" + tok.ID)
+	require.NoError(t, err)
+	require.Equal(t, AppType, tdb.Type())
+	require.Equal(t, "testy/token:"+tok.ID, tdb.ID())
+	_, err = tdb.ReadUser("testy", nil)
+	require.NoError(t, err)
+
+	name := "myts"
+	stype := "timeseries"
+	oid, err := tdb.CreateObject(&Object{
+		Details: Details{Name: &name},
+		Type:    &stype,
+	})
+	require.NoError(t, err)
+	o, err := tdb.ReadObject(oid, nil)
+	require.NoError(t, err)
+	require.Equal(t, "testy", *o.Owner)
+	require.Nil(t, o.App)
+	require.True(t, o.Access.HasScope("write"))
+	self := "self"
+	ol, err := tdb.ListObjects(&ListObjectsOptions{App: &self})
+	require.NoError(t, err)
+	require.Len(t, ol, 1)
+	_, err = tdb.ReadApp("self", nil)
+	require.Error(t, err)
+
+	// The read-only token can't modify the timeseries, or create objects
+	rdb := NewTokenDB(db, rtok)
+	o, err = rdb.ReadObject(oid, nil)
+	require.NoError(t, err)
+	require.True(t, o.Access.HasScope("read"))
+	require.False(t, o.Access.HasScope("write"))
+	name = "renamed"
+	require.Error(t, rdb.UpdateObject(&Object{Details: Details{ID: oid, Name: &name}}))
+	_, err = rdb.CreateObject(&Object{
+		Details: Details{Name: &name},
+		Type:    &stype,
+	})
+	require.Error(t, err)
+	_, err = rdb.ReadUser("testy", nil)
+	require.Error(t, err)
+	ol, err = rdb.ListObjects(nil)
+	require.NoError(t, err)
+	require.Len(t, ol, 1)
+
+	require.NoError(t, db.DelUserToken("testy", tok.ID))
+	require.Error(t, db.DelUserToken("testy", tok.ID))
+	_, err = db.GetUserTokenByToken(*tok.Token)
+	require.Equal(t, ErrNotFound, err)
+	_, err = db.As("testy/token:" + tok.ID)
+	require.Error(t, err)
+}
@@ -0,0 +1,147 @@
+package events
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync"
+)
+
+// HookHandler is called synchronously before a write is committed. It returns the data to write,
+// which replaces e.Data, or an error to reject the write. The write is made by the database with ID as.
+type HookHandler interface {
+	Call(e *Event, as string) (json.RawMessage, error)
+}
+
+type hookListElement struct {
+	e Event
+	h HookHandler
+}
+
+// Hooks holds pre-write hooks, along with the events that they are called for.
+// Unlike event handlers, hooks are called in the order they were added, and each one gets the data returned by the previous one.
+type Hooks struct {
+	sync.RWMutex
+	list []hookListElement
+}
+
+// NewHooks returns an empty set of hooks
+func NewHooks() *Hooks {
+	return &Hooks{
+		list: make([]hookListElement, 0),
+	}
+}
+
+// Add calls h before writes matching the given event
+func (hs *Hooks) Add(e Event, h HookHandler) {
+	hs.Lock()
+	defer hs.Unlock()
+	hs.list = append(hs.list, hookListElement{
+		e: e,
+		h: h,
+	})
+}
+
+// Replace atomically swaps the hooks for those of nhs
+func (hs *Hooks) Replace(nhs *Hooks) {
+	nhs.RLock()
+	defer nhs.RUnlock()
+	hs.Lock()
+	defer hs.Unlock()
+	hs.list = nhs.list
+}
+
+// Has returns whether there is a hook for the given event name
+func (hs *Hooks) Has(event string) bool {
+	hs.RLock()
+	defer hs.RUnlock()
+	for i := range hs.list {
+		if hs.list[i].e.Event == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Run calls the hooks matching e, returning whether any of them modified the data. The hooks are called
+// without holding the lock, since a hook's handler can make writes that run hooks again.
+func (hs *Hooks) Run(e *Event, as string) (modified bool, err error) {
+	hs.RLock()
+	list := make([]hookListElement, 0, len(hs.list))
+	for i := range hs.list {
+		if hs.list[i].e.Event == e.Event && matches(&hs.list[i].e, e) {
+			list = append(list, hs.list[i])
+		}
+	}
+	hs.RUnlock()
+	for i := range list {
+		d, err := list[i].h.Call(e, as)
+		if err != nil {
+			return modified, err
+		}
+		if d != nil {
+			e.Data = d
+			modified = true
+		}
+	}
+	return modified, nil
+}
+
+var globalHooks = struct {
+	sync.RWMutex
+	hooks []*Hooks
+}{}
+
+// AddHooks adds a set of hooks to those that are run before writes
+func AddHooks(hs *Hooks) {
+	globalHooks.Lock()
+	defer globalHooks.Unlock()
+	globalHooks.hooks = append(globalHooks.hooks, hs)
+}
+
+// RemoveHooks removes a set of hooks added with AddHooks
+func RemoveHooks(hs *Hooks) {
+	globalHooks.Lock()
+	defer globalHooks.Unlock()
+	for i, h := range globalHooks.hooks {
+		if h == hs {
+			globalHooks.hooks = append(globalHooks.hooks[:i], globalHooks.hooks[i+1:]...)
+			return
+		}
+	}
+}
+
+// Hooked returns whether there are hooks for the given event name, so that
+// writes without hooks can skip preparing the hook's event
+func Hooked(event string) bool {
+	globalHooks.RLock()
+	defer globalHooks.RUnlock()
+	for _, hs := range globalHooks.hooks {
+		if hs.Has(event) {
+			return true
+		}
+	}
+	return false
+}
+
+// RunHooks calls the hooks that match the event, with e.Data holding the data to be written.
+// If a hook modified the data, the final result is decoded into out, and modified is true.
+// An error from any hook rejects the write.
+func RunHooks(e *Event, as string, out interface{}) (modified bool, err error) {
+	globalHooks.RLock()
+	hooks := append([]*Hooks{}, globalHooks.hooks...)
+	globalHooks.RUnlock()
+	for _, hs := range hooks {
+		m, err := hs.Run(e, as)
+		if err != nil {
+			return false, err
+		}
+		modified = modified || m
+	}
+	if !modified {
+		return false, nil
+	}
+	// Fields that the hooks removed must not keep their original values
+	v := reflect.ValueOf(out).Elem()
+	v.Set(reflect.Zero(v.Type()))
+	return true, json.Unmarshal(e.Data.(json.RawMessage), out)
+}
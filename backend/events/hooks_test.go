@@ -0,0 +1,79 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testHook func(e *Event, as string) (json.RawMessage, error)
+
+func (th testHook) Call(e *Event, as string) (json.RawMessage, error) {
+	return th(e, as)
+}
+
+func TestHooks(t *testing.T) {
+	hs := NewHooks()
+	AddHooks(hs)
+	defer RemoveHooks(hs)
+
+	require.False(t, Hooked("object_update"))
+
+	calls := 0
+	hs.Add(Event{Event: "object_update", Type: "timeseries"}, testHook(func(e *Event, as string) (json.RawMessage, error) {
+		calls++
+		require.Equal(t, "testy", as)
+		return json.RawMessage(`{"name":"hooked"}`), nil
+	}))
+	hs.Add(Event{Event: "object_update", Type: "timeseries"}, testHook(func(e *Event, as string) (json.RawMessage, error) {
+		calls++
+		// Each hook gets the data returned by the previous one
+		b, err := json.Marshal(e.Data)
+		require.NoError(t, err)
+		require.JSONEq(t, `{"name":"hooked"}`, string(b))
+		return nil, nil
+	}))
+	require.True(t, Hooked("object_update"))
+
+	type update struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+	u := update{Name: "myts", Description: "removed by the hook"}
+	modified, err := RunHooks(&Event{Event: "object_update", Type: "timeseries", Data: &u}, "testy", &u)
+	require.NoError(t, err)
+	require.True(t, modified)
+	require.Equal(t, update{Name: "hooked"}, u)
+	require.Equal(t, 2, calls)
+
+	// Hooks are only called for matching events
+	u = update{Name: "myts"}
+	modified, err = RunHooks(&Event{Event: "object_update", Type: "dashboard", Data: &u}, "testy", &u)
+	require.NoError(t, err)
+	require.False(t, modified)
+	require.Equal(t, "myts", u.Name)
+	require.Equal(t, 2, calls)
+
+	// An error from a hook rejects the write
+	nhs := NewHooks()
+	nhs.Add(Event{Event: "object_update"}, testHook(func(e *Event, as string) (json.RawMessage, error) {
+		return nil, errors.New("access_denied: not allowed")
+	}))
+	hs.Replace(nhs)
+	_, err = RunHooks(&Event{Event: "object_update", Type: "timeseries", Data: &u}, "testy", &u)
+	require.Error(t, err)
+
+	// The hooks can change while a hook is running, such as when a plugin stops during a write
+	nhs = NewHooks()
+	nhs.Add(Event{Event: "object_update"}, testHook(func(e *Event, as string) (json.RawMessage, error) {
+		RemoveHooks(hs)
+		hs.Replace(NewHooks())
+		return nil, nil
+	}))
+	hs.Replace(nhs)
+	_, err = RunHooks(&Event{Event: "object_update", Type: "timeseries", Data: &u}, "testy", &u)
+	require.NoError(t, err)
+	require.False(t, Hooked("object_update"))
+}
@@ -16,24 +16,31 @@ type eventList struct {
 	list []eventListElement
 }
 
-func (el eventList) Fire(e *Event) {
-	for i := range el.list {
-		e2 := el.list[i].e
-		if e2.App != "" && e2.App != "*" && e2.App != e.App {
+// matches returns whether the event e is one of the events subscribed to by e2
+func matches(e2 *Event, e *Event) bool {
+	if e2.App != "" && e2.App != "*" && e2.App != e.App {
+
+	} else if e2.Tags != nil && len(e2.Tags.Strings) != 0 && (e.Tags == nil || len(e.Tags.Strings) == 0 || !e.Tags.HasSubset(e2.Tags.Strings)) {
 
-		} else if e2.Tags != nil && len(e2.Tags.Strings) != 0 && (e.Tags == nil || len(e.Tags.Strings) == 0 || !e.Tags.HasSubset(e2.Tags.Strings)) {
+	} else if e2.Object != "" && e2.Object != "*" && e2.Object != e.Object {
 
-		} else if e2.Object != "" && e2.Object != "*" && e2.Object != e.Object {
+	} else if e2.Plugin != nil && (e.Plugin == nil || *e2.Plugin != *e.Plugin) {
 
-		} else if e2.Plugin != nil && (e.Plugin == nil || *e2.Plugin != *e.Plugin) {
+	} else if e2.Key != nil && (e.Key == nil || *e2.Key != *e.Key) {
 
-		} else if e2.Key != nil && (e.Key == nil || *e2.Key != *e.Key) {
+	} else if e2.Type != "" && e2.Type != "*" && e2.Type != e.Type {
 
-		} else if e2.Type != "" && e2.Type != "*" && e2.Type != e.Type {
+	} else if e2.User != "" && e2.User != "*" && e2.User != e.User {
 
-		} else if e2.User != "" && e2.User != "*" && e2.User != e.User {
+	} else {
+		return true
+	}
+	return false
+}
 
-		} else {
+func (el eventList) Fire(e *Event) {
+	for i := range el.list {
+		if matches(&el.list[i].e, e) {
 			el.list[i].h.Fire(e)
 		}
 	}
@@ -149,6 +156,16 @@ func (r *Router) Unsubscribe(e Event, h Handler) error {
 	return em.Unsubscribe(e, h)
 }
 
+// Replace atomically swaps the router's subscriptions for those of nr
+func (r *Router) Replace(nr *Router) {
+	nr.RLock()
+	defer nr.RUnlock()
+	r.Lock()
+	defer r.Unlock()
+	r.EventMap = nr.EventMap
+	r.NoEvent = nr.NoEvent
+}
+
 func (r *Router) Fire(e *Event) {
 	r.RLock()
 	defer r.RUnlock()
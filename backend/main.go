@@ -8,6 +8,7 @@ import (
 	// Add the plugins, which will register their own routes
 	// _ "github.com/heedy/heedy/plugins/registry/backend/registry"
 	// _ "github.com/heedy/heedy/plugins/dashboard/backend/dashboard"
+	_ "github.com/heedy/heedy/plugins/files/backend/files"
 	_ "github.com/heedy/heedy/plugins/kv/backend/kv"
 	_ "github.com/heedy/heedy/plugins/notifications/backend/notifications"
 	_ "github.com/heedy/heedy/plugins/python/backend/python"
@@ -0,0 +1,275 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MQTT control packet types
+const (
+	packetConnect     = 1
+	packetConnack     = 2
+	packetPublish     = 3
+	packetPuback      = 4
+	packetPubrec      = 5
+	packetPubrel      = 6
+	packetPubcomp     = 7
+	packetSubscribe   = 8
+	packetSuback      = 9
+	packetUnsubscribe = 10
+	packetUnsuback    = 11
+	packetPingreq     = 12
+	packetPingresp    = 13
+	packetDisconnect  = 14
+)
+
+// CONNACK return codes and protocol constants
+const (
+	connAccepted         = 0
+	connBadProtocol      = 1
+	connBadClientID      = 2
+	connBadCredentials   = 4
+	connNotAuthorized    = 5
+	subackFailure        = 0x80
+	protocolLevel311     = 4
+	protocolLevel31      = 3
+	protocolName311      = "MQTT"
+	protocolName31       = "MQIsdp"
+	defaultMaxPacketSize = 1024 * 1024
+)
+
+var errMalformed = errors.New("malformed packet")
+
+// packet is a raw MQTT control packet
+type packet struct {
+	Type  byte
+	Flags byte
+	Body  []byte
+}
+
+// readPacket reads a single control packet, failing if its body is larger than maxSize
+func readPacket(r *bufio.Reader, maxSize int) (*packet, error) {
+	h, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	length := 0
+	for i, mult := 0, 1; ; i, mult = i+1, mult*128 {
+		if i == 4 {
+			return nil, errMalformed
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		length += int(b&127) * mult
+		if b&128 == 0 {
+			break
+		}
+	}
+	if length > maxSize {
+		return nil, fmt.Errorf("packet of %d bytes exceeds the maximum of %d", length, maxSize)
+	}
+	p := &packet{
+		Type:  h >> 4,
+		Flags: h & 0x0f,
+		Body:  make([]byte, length),
+	}
+	_, err = io.ReadFull(r, p.Body)
+	return p, err
+}
+
+// encode returns the packet in wire format
+func (p *packet) encode() []byte {
+	b := make([]byte, 0, len(p.Body)+5)
+	b = append(b, p.Type<<4|p.Flags)
+	length := len(p.Body)
+	for {
+		d := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			d |= 128
+		}
+		b = append(b, d)
+		if length == 0 {
+			break
+		}
+	}
+	return append(b, p.Body...)
+}
+
+// decoder reads the fields of a packet body
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil || len(d.b) < 1 {
+		d.err = errMalformed
+		return 0
+	}
+	v := d.b[0]
+	d.b = d.b[1:]
+	return v
+}
+
+func (d *decoder) uint16() uint16 {
+	if d.err != nil || len(d.b) < 2 {
+		d.err = errMalformed
+		return 0
+	}
+	v := binary.BigEndian.Uint16(d.b)
+	d.b = d.b[2:]
+	return v
+}
+
+func (d *decoder) bytes() []byte {
+	l := int(d.uint16())
+	if d.err != nil || len(d.b) < l {
+		d.err = errMalformed
+		return nil
+	}
+	v := d.b[:l]
+	d.b = d.b[l:]
+	return v
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes())
+}
+
+// encoder builds a packet body
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) byte(v byte) {
+	e.b = append(e.b, v)
+}
+
+func (e *encoder) uint16(v uint16) {
+	e.b = append(e.b, byte(v>>8), byte(v))
+}
+
+func (e *encoder) string(s string) {
+	e.uint16(uint16(len(s)))
+	e.b = append(e.b, s...)
+}
+
+// connectPacket holds the fields of a CONNECT packet that are used by the server
+type connectPacket struct {
+	ProtocolName  string
+	ProtocolLevel byte
+	CleanSession  bool
+	KeepAlive     uint16
+	ClientID      string
+	Username      string
+	Password      string
+}
+
+func decodeConnect(p *packet) (*connectPacket, error) {
+	d := &decoder{b: p.Body}
+	c := &connectPacket{
+		ProtocolName:  d.string(),
+		ProtocolLevel: d.byte(),
+	}
+	flags := d.byte()
+	c.CleanSession = flags&0x02 != 0
+	c.KeepAlive = d.uint16()
+	c.ClientID = d.string()
+	if flags&0x04 != 0 {
+		// The will message is not supported, but needs to be read to get to the credentials
+		d.string()
+		d.bytes()
+	}
+	if flags&0x80 != 0 {
+		c.Username = d.string()
+	}
+	if flags&0x40 != 0 {
+		c.Password = string(d.bytes())
+	}
+	return c, d.err
+}
+
+// publishPacket is a PUBLISH packet
+type publishPacket struct {
+	Topic    string
+	QoS      byte
+	Dup      bool
+	Retain   bool
+	PacketID uint16
+	Payload  []byte
+}
+
+func decodePublish(p *packet) (*publishPacket, error) {
+	d := &decoder{b: p.Body}
+	pp := &publishPacket{
+		Topic:  d.string(),
+		QoS:    (p.Flags >> 1) & 0x03,
+		Dup:    p.Flags&0x08 != 0,
+		Retain: p.Flags&0x01 != 0,
+	}
+	if pp.QoS > 2 {
+		return nil, errMalformed
+	}
+	if pp.QoS > 0 {
+		pp.PacketID = d.uint16()
+	}
+	pp.Payload = d.b
+	return pp, d.err
+}
+
+func (pp *publishPacket) encode() []byte {
+	e := &encoder{}
+	e.string(pp.Topic)
+	flags := pp.QoS << 1
+	if pp.QoS > 0 {
+		e.uint16(pp.PacketID)
+	}
+	if pp.Dup {
+		flags |= 0x08
+	}
+	if pp.Retain {
+		flags |= 0x01
+	}
+	e.b = append(e.b, pp.Payload...)
+	return (&packet{Type: packetPublish, Flags: flags, Body: e.b}).encode()
+}
+
+// subscription is a single topic filter of a SUBSCRIBE or UNSUBSCRIBE packet
+type subscription struct {
+	Filter string
+	QoS    byte
+}
+
+func decodeSubscribe(p *packet, withQoS bool) (uint16, []subscription, error) {
+	d := &decoder{b: p.Body}
+	id := d.uint16()
+	subs := []subscription{}
+	for d.err == nil && len(d.b) > 0 {
+		s := subscription{Filter: d.string()}
+		if withQoS {
+			s.QoS = d.byte()
+		}
+		subs = append(subs, s)
+	}
+	if len(subs) == 0 {
+		return id, nil, errMalformed
+	}
+	return id, subs, d.err
+}
+
+// ackPacket encodes the packets that only hold a packet ID
+func ackPacket(packetType byte, id uint16) []byte {
+	e := &encoder{}
+	e.uint16(id)
+	flags := byte(0)
+	if packetType == packetPubrel {
+		flags = 0x02
+	}
+	return (&packet{Type: packetType, Flags: flags, Body: e.b}).encode()
+}
@@ -0,0 +1,340 @@
+// Package mqtt implements a minimal MQTT 3.1.1 server. Unlike a general purpose broker, it does not route
+// messages between clients: messages published by clients are handed to the Handler, and clients only receive
+// the messages published by the server itself. Retained messages, will messages and persistent sessions are not
+// supported, and messages are sent to subscribers with QoS 0.
+package mqtt
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrNotAuthorized can be returned by Handler.Connect to reject a client that gave valid credentials,
+// but is not permitted to connect
+var ErrNotAuthorized = errors.New("not authorized")
+
+// Handler processes the actions of connected clients
+type Handler interface {
+	// Connect authenticates a client, returning the session value that is stored in the Client
+	Connect(c *Client, username, password string) (interface{}, error)
+	// Publish processes a message published by the client
+	Publish(c *Client, topic string, payload []byte) error
+	// Subscribe returns whether the client can subscribe to the topic filter
+	Subscribe(c *Client, filter string) bool
+	// Disconnect is called when an authenticated client's connection closes
+	Disconnect(c *Client)
+}
+
+// Server accepts connections from MQTT clients
+type Server struct {
+	Handler Handler
+
+	// The maximum size of a packet. Defaults to 1MiB.
+	MaxPacketSize int
+
+	sync.RWMutex
+	listener net.Listener
+	clients  map[*Client]bool
+	closed   bool
+}
+
+// NewServer creates a server that passes client actions to the given handler
+func NewServer(h Handler) *Server {
+	return &Server{
+		Handler:       h,
+		MaxPacketSize: defaultMaxPacketSize,
+		clients:       make(map[*Client]bool),
+	}
+}
+
+// Serve accepts connections on the listener until the server is closed
+func (s *Server) Serve(l net.Listener) error {
+	s.Lock()
+	s.listener = l
+	s.Unlock()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.RLock()
+			closed := s.closed
+			s.RUnlock()
+			if closed {
+				return nil
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Temporary() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops the listener, and disconnects all clients
+func (s *Server) Close() error {
+	s.Lock()
+	s.closed = true
+	l := s.listener
+	clients := make([]*Client, 0, len(s.clients))
+	for c := range s.clients {
+		clients = append(clients, c)
+	}
+	s.Unlock()
+	var err error
+	if l != nil {
+		err = l.Close()
+	}
+	for _, c := range clients {
+		c.conn.Close()
+	}
+	return err
+}
+
+// Publish sends the message to all clients subscribed to the topic for which the filter returns true.
+// The filter can be nil to send to all subscribed clients.
+func (s *Server) Publish(topic string, payload []byte, filter func(c *Client) bool) {
+	s.RLock()
+	clients := make([]*Client, 0, len(s.clients))
+	for c := range s.clients {
+		if c.subscribed(topic) {
+			clients = append(clients, c)
+		}
+	}
+	s.RUnlock()
+	if len(clients) == 0 {
+		return
+	}
+	b := (&publishPacket{Topic: topic, Payload: payload}).encode()
+	for _, c := range clients {
+		if filter == nil || filter(c) {
+			if err := c.write(b); err != nil {
+				c.conn.Close()
+			}
+		}
+	}
+}
+
+// Clients returns the number of connected clients
+func (s *Server) Clients() int {
+	s.RLock()
+	defer s.RUnlock()
+	return len(s.clients)
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	c := &Client{
+		conn:          conn,
+		subscriptions: make(map[string]bool),
+		received:      make(map[uint16]bool),
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	// The client has a few seconds to send the CONNECT packet
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	p, err := readPacket(r, s.MaxPacketSize)
+	if err != nil || p.Type != packetConnect {
+		return
+	}
+	cp, err := decodeConnect(p)
+	if err != nil {
+		return
+	}
+	c.ID = cp.ClientID
+	if !(cp.ProtocolName == protocolName311 && cp.ProtocolLevel == protocolLevel311 || cp.ProtocolName == protocolName31 && cp.ProtocolLevel == protocolLevel31) {
+		c.connack(connBadProtocol)
+		return
+	}
+	if c.ID == "" && !cp.CleanSession {
+		c.connack(connBadClientID)
+		return
+	}
+	c.Session, err = s.Handler.Connect(c, cp.Username, cp.Password)
+	if err != nil {
+		if err == ErrNotAuthorized {
+			c.connack(connNotAuthorized)
+		} else {
+			c.connack(connBadCredentials)
+		}
+		return
+	}
+	if err = c.connack(connAccepted); err != nil {
+		s.Handler.Disconnect(c)
+		return
+	}
+
+	s.Lock()
+	if s.closed {
+		s.Unlock()
+		s.Handler.Disconnect(c)
+		return
+	}
+	s.clients[c] = true
+	s.Unlock()
+	defer func() {
+		s.Lock()
+		delete(s.clients, c)
+		s.Unlock()
+		s.Handler.Disconnect(c)
+	}()
+
+	var timeout time.Duration
+	if cp.KeepAlive > 0 {
+		timeout = time.Duration(cp.KeepAlive) * 1500 * time.Millisecond
+	}
+	for {
+		if timeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(timeout))
+		} else {
+			conn.SetReadDeadline(time.Time{})
+		}
+		p, err = readPacket(r, s.MaxPacketSize)
+		if err != nil {
+			return
+		}
+		if err = s.handlePacket(c, p); err != nil {
+			return
+		}
+	}
+}
+
+// errDisconnect is returned when the client disconnects cleanly
+var errDisconnect = errors.New("disconnect")
+
+func (s *Server) handlePacket(c *Client, p *packet) error {
+	switch p.Type {
+	case packetPublish:
+		pp, err := decodePublish(p)
+		if err != nil {
+			return err
+		}
+		if !ValidTopic(pp.Topic) {
+			return errMalformed
+		}
+		if pp.QoS == 2 {
+			// A QoS 2 message is handled once: until the client releases its packet ID with PUBREL, a resent
+			// message with the same ID (sent with DUP after a lost PUBREC) is only acknowledged again
+			if c.received[pp.PacketID] {
+				return c.write(ackPacket(packetPubrec, pp.PacketID))
+			}
+			c.received[pp.PacketID] = true
+		}
+		// MQTT 3.1.1 has no way to reject a message, so errors are logged, and the message is still acknowledged,
+		// so that the client doesn't resend data that will never be accepted
+		if err = s.Handler.Publish(c, pp.Topic, pp.Payload); err != nil {
+			logrus.WithField("mqtt", c.ID).Warnf("Message published to %s was not accepted: %s", pp.Topic, err.Error())
+		}
+		switch pp.QoS {
+		case 1:
+			return c.write(ackPacket(packetPuback, pp.PacketID))
+		case 2:
+			return c.write(ackPacket(packetPubrec, pp.PacketID))
+		}
+		return nil
+	case packetPubrel:
+		d := &decoder{b: p.Body}
+		id := d.uint16()
+		if d.err != nil {
+			return d.err
+		}
+		delete(c.received, id)
+		return c.write(ackPacket(packetPubcomp, id))
+	case packetPuback, packetPubrec, packetPubcomp:
+		// The server only sends QoS 0 messages, so there is nothing to acknowledge
+		return nil
+	case packetSubscribe:
+		id, subs, err := decodeSubscribe(p, true)
+		if err != nil {
+			return err
+		}
+		e := &encoder{}
+		e.uint16(id)
+		for _, sub := range subs {
+			if ValidFilter(sub.Filter) && s.Handler.Subscribe(c, sub.Filter) {
+				c.subscribe(sub.Filter, true)
+				e.byte(0)
+			} else {
+				e.byte(subackFailure)
+			}
+		}
+		return c.write((&packet{Type: packetSuback, Body: e.b}).encode())
+	case packetUnsubscribe:
+		id, subs, err := decodeSubscribe(p, false)
+		if err != nil {
+			return err
+		}
+		for _, sub := range subs {
+			c.subscribe(sub.Filter, false)
+		}
+		return c.write(ackPacket(packetUnsuback, id))
+	case packetPingreq:
+		return c.write((&packet{Type: packetPingresp}).encode())
+	case packetDisconnect:
+		return errDisconnect
+	}
+	return errMalformed
+}
+
+// Client is a connected MQTT client
+type Client struct {
+	// The client identifier given when connecting
+	ID string
+	// The value returned by the handler's Connect method
+	Session interface{}
+
+	conn net.Conn
+
+	wlock sync.Mutex
+
+	slock         sync.RWMutex
+	subscriptions map[string]bool
+
+	// The packet IDs of QoS 2 messages that were handled, but not yet released by the client.
+	// They are only accessed by the connection's read loop.
+	received map[uint16]bool
+}
+
+// RemoteAddr returns the network address of the client
+func (c *Client) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+func (c *Client) write(b []byte) error {
+	c.wlock.Lock()
+	defer c.wlock.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := c.conn.Write(b)
+	return err
+}
+
+func (c *Client) connack(code byte) error {
+	return c.write((&packet{Type: packetConnack, Body: []byte{0, code}}).encode())
+}
+
+func (c *Client) subscribe(filter string, subscribe bool) {
+	c.slock.Lock()
+	defer c.slock.Unlock()
+	if subscribe {
+		c.subscriptions[filter] = true
+	} else {
+		delete(c.subscriptions, filter)
+	}
+}
+
+func (c *Client) subscribed(topic string) bool {
+	c.slock.RLock()
+	defer c.slock.RUnlock()
+	for f := range c.subscriptions {
+		if MatchTopic(f, topic) {
+			return true
+		}
+	}
+	return false
+}
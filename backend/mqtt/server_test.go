@@ -0,0 +1,168 @@
+package mqtt
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testHandler struct {
+	sync.Mutex
+	published map[string]string
+	count     int
+}
+
+func (h *testHandler) Connect(c *Client, username, password string) (interface{}, error) {
+	if password != "secret" {
+		return nil, errors.New("bad password")
+	}
+	return username, nil
+}
+
+func (h *testHandler) Publish(c *Client, topic string, payload []byte) error {
+	h.Lock()
+	defer h.Unlock()
+	h.published[topic] = string(payload)
+	h.count++
+	return nil
+}
+
+func (h *testHandler) Subscribe(c *Client, filter string) bool {
+	return filter != "forbidden"
+}
+
+func (h *testHandler) Disconnect(c *Client) {}
+
+// testClient is a minimal MQTT client
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dial(t *testing.T, addr, password string) (*testClient, byte) {
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	c := &testClient{t, conn, bufio.NewReader(conn)}
+	e := &encoder{}
+	e.string("MQTT")
+	e.byte(protocolLevel311)
+	e.byte(0x02 | 0x80 | 0x40) // clean session, username, password
+	e.uint16(30)
+	e.string("testclient")
+	e.string("user")
+	e.string(password)
+	c.send(&packet{Type: packetConnect, Body: e.b})
+	p := c.read()
+	require.Equal(t, byte(packetConnack), p.Type)
+	return c, p.Body[1]
+}
+
+func (c *testClient) send(p *packet) {
+	_, err := c.conn.Write(p.encode())
+	require.NoError(c.t, err)
+}
+
+func (c *testClient) read() *packet {
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	p, err := readPacket(c.r, defaultMaxPacketSize)
+	require.NoError(c.t, err)
+	return p
+}
+
+func TestServer(t *testing.T) {
+	h := &testHandler{published: make(map[string]string)}
+	s := NewServer(h)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go s.Serve(l)
+	defer s.Close()
+
+	c, code := dial(t, l.Addr().String(), "wrong")
+	require.Equal(t, byte(connBadCredentials), code)
+	c.conn.Close()
+
+	c, code = dial(t, l.Addr().String(), "secret")
+	require.Equal(t, byte(connAccepted), code)
+	defer c.conn.Close()
+
+	// A QoS 1 message is acknowledged after being handled
+	c.conn.Write((&publishPacket{Topic: "sensors/temp", QoS: 1, PacketID: 7, Payload: []byte("21.5")}).encode())
+	p := c.read()
+	require.Equal(t, byte(packetPuback), p.Type)
+	require.Equal(t, []byte{0, 7}, p.Body)
+	h.Lock()
+	require.Equal(t, "21.5", h.published["sensors/temp"])
+	h.Unlock()
+
+	// A QoS 2 message that is resent before its packet ID is released is acknowledged, but only handled once
+	qos2 := &publishPacket{Topic: "sensors/hum", QoS: 2, PacketID: 8, Payload: []byte("40")}
+	for i := 0; i < 2; i++ {
+		c.conn.Write(qos2.encode())
+		p = c.read()
+		require.Equal(t, byte(packetPubrec), p.Type)
+		require.Equal(t, []byte{0, 8}, p.Body)
+		qos2.Dup = true
+	}
+	c.send(&packet{Type: packetPubrel, Flags: 0x02, Body: []byte{0, 8}})
+	p = c.read()
+	require.Equal(t, byte(packetPubcomp), p.Type)
+	h.Lock()
+	require.Equal(t, 2, h.count)
+	h.Unlock()
+
+	// Once released, the packet ID can be reused for a new message
+	qos2.Dup = false
+	c.conn.Write(qos2.encode())
+	require.Equal(t, byte(packetPubrec), c.read().Type)
+	h.Lock()
+	require.Equal(t, 3, h.count)
+	h.Unlock()
+
+	e := &encoder{}
+	e.uint16(3)
+	e.string("events/+/write")
+	e.byte(1)
+	e.string("forbidden")
+	e.byte(0)
+	c.send(&packet{Type: packetSubscribe, Flags: 0x02, Body: e.b})
+	p = c.read()
+	require.Equal(t, byte(packetSuback), p.Type)
+	require.Equal(t, []byte{0, 3, 0, subackFailure}, p.Body)
+
+	// Only messages matching the subscription, for which the filter passes, are received
+	s.Publish("events/a/delete", []byte("no"), nil)
+	s.Publish("events/b/write", []byte("no"), func(c *Client) bool { return false })
+	s.Publish("events/c/write", []byte("yes"), func(c *Client) bool { return c.Session.(string) == "user" })
+	p = c.read()
+	require.Equal(t, byte(packetPublish), p.Type)
+	pp, err := decodePublish(p)
+	require.NoError(t, err)
+	require.Equal(t, "events/c/write", pp.Topic)
+	require.Equal(t, "yes", string(pp.Payload))
+
+	c.send(&packet{Type: packetPingreq})
+	require.Equal(t, byte(packetPingresp), c.read().Type)
+	require.Equal(t, 1, s.Clients())
+}
+
+func TestMatchTopic(t *testing.T) {
+	require.True(t, MatchTopic("a/b", "a/b"))
+	require.False(t, MatchTopic("a/b", "a/b/c"))
+	require.True(t, MatchTopic("a/+/c", "a/b/c"))
+	require.False(t, MatchTopic("a/+", "a/b/c"))
+	require.True(t, MatchTopic("a/#", "a"))
+	require.True(t, MatchTopic("a/#", "a/b/c"))
+	require.True(t, MatchTopic("#", "a/b"))
+	require.False(t, MatchTopic("#", "$SYS/a"))
+
+	require.True(t, ValidFilter("a/+/#"))
+	require.False(t, ValidFilter("a/#/b"))
+	require.False(t, ValidFilter("a/b+"))
+	require.False(t, ValidTopic("a/+"))
+}
@@ -0,0 +1,48 @@
+package mqtt
+
+import "strings"
+
+// ValidTopic checks whether the topic name can be published to. Topic names can't be empty or contain wildcards.
+func ValidTopic(topic string) bool {
+	return topic != "" && !strings.ContainsAny(topic, "+#\x00")
+}
+
+// ValidFilter checks whether the topic filter of a subscription is well formed
+func ValidFilter(filter string) bool {
+	if filter == "" || strings.Contains(filter, "\x00") {
+		return false
+	}
+	levels := strings.Split(filter, "/")
+	for i, l := range levels {
+		if strings.Contains(l, "#") && (l != "#" || i != len(levels)-1) {
+			return false
+		}
+		if strings.Contains(l, "+") && l != "+" {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchTopic returns whether the topic name matches the topic filter, which can contain the + (single level)
+// and # (all remaining levels) wildcards
+func MatchTopic(filter, topic string) bool {
+	// Topics starting with $ are not matched by wildcards at the first level
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+	f := strings.Split(filter, "/")
+	t := strings.Split(topic, "/")
+	for i, l := range f {
+		if l == "#" {
+			return true
+		}
+		if i >= len(t) {
+			return false
+		}
+		if l != "+" && l != t[i] {
+			return false
+		}
+	}
+	return len(f) == len(t)
+}
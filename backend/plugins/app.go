@@ -141,7 +141,8 @@ func CreateApp(c *rest.Context, owner string, pluginKey string) (string, string,
 		if sv.AutoCreate == nil || *sv.AutoCreate == true {
 			_, err := c.Request(c, "POST", "/api/objects", AppObject(aid, skey, sv), map[string]string{"X-Heedy-As": "heedy"})
 			if err != nil {
-				adb.DelApp(aid)
+				// The app was never fully created, so it is removed directly rather than moved to the trash
+				adb.Exec("DELETE FROM apps WHERE id=?;", aid)
 				return "", "", err
 			}
 		}
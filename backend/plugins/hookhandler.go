@@ -0,0 +1,85 @@
+package plugins
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/heedy/heedy/backend/assets"
+	"github.com/heedy/heedy/backend/events"
+	"github.com/heedy/heedy/backend/plugins/run"
+	"github.com/sirupsen/logrus"
+)
+
+// PluginHookHandler posts writes to a plugin's hook endpoint before they are committed
+type PluginHookHandler struct {
+	Plugin  string
+	Post    string
+	Timeout time.Duration
+	Handler http.Handler
+}
+
+func NewPluginHookHandler(p *Plugin, h *assets.Hook) (*PluginHookHandler, error) {
+	if h.Post == nil {
+		return nil, errors.New("Plugin hook doesn't have post")
+	}
+	timeout, err := h.GetTimeout()
+	if err != nil {
+		return nil, err
+	}
+	handler, err := p.Run.GetHandler(p.Name, *h.Post)
+	return &PluginHookHandler{
+		Plugin:  p.Name,
+		Post:    *h.Post,
+		Timeout: timeout,
+		Handler: handler,
+	}, err
+}
+
+type hookResult struct {
+	Data json.RawMessage `json:"data"`
+}
+
+// Call posts the event to the plugin as the database doing the write. The plugin responds with {"data": ...}
+// to replace the written data, with an empty body or object to accept it unchanged, or with an error to reject it.
+// The write is rejected if the plugin doesn't respond within the hook's timeout.
+func (hh *PluginHookHandler) Call(e *events.Event, as string) (json.RawMessage, error) {
+	logrus.Debugf("%s: %s <- hook %s", hh.Plugin, hh.Post, e.String())
+	ctx, cancel := context.WithTimeout(context.Background(), hh.Timeout)
+	defer cancel()
+
+	type response struct {
+		res hookResult
+		err error
+	}
+	done := make(chan response, 1)
+	go func() {
+		var r response
+		b, err := run.RequestContext(ctx, hh.Handler, "POST", "", e, map[string]string{"X-Heedy-As": as})
+		if err == nil && b.Len() > 0 {
+			err = json.Unmarshal(b.Bytes(), &r.res)
+		}
+		r.err = err
+		done <- r
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("hook_timeout: The %s hook of plugin %s did not respond in time", e.Event, hh.Plugin)
+			}
+			return nil, r.err
+		}
+		if string(r.res.Data) == "null" {
+			return nil, nil
+		}
+		return r.res.Data, nil
+	case <-ctx.Done():
+		logrus.Warnf("%s: Hook %s timed out after %s", hh.Plugin, hh.Post, hh.Timeout)
+		return nil, fmt.Errorf("hook_timeout: The %s hook of plugin %s did not respond in time", e.Event, hh.Plugin)
+	}
+}
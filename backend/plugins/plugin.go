@@ -23,6 +23,7 @@ type Plugin struct {
 	Server http.Handler
 
 	EventRouter *events.Router
+	Hooks       *events.Hooks
 }
 
 func NewPlugin(db *database.AdminDB, m *run.Manager, heedyServer http.Handler, pname string) (*Plugin, error) {
@@ -32,6 +33,7 @@ func NewPlugin(db *database.AdminDB, m *run.Manager, heedyServer http.Handler, p
 		Run:         m,
 		Server:      heedyServer,
 		EventRouter: events.NewRouter(),
+		Hooks:       events.NewHooks(),
 	}
 	logrus.Debugf("Loading plugin '%s'", pname)
 
@@ -94,34 +96,80 @@ func (p *Plugin) Start() error {
 	}
 
 	// Set up events that are subscribed in the config with the "on" blocks
+	er, err := p.eventRouter()
+	if err != nil {
+		return err
+	}
+	p.EventRouter = er
+
+	// Attach the event router to the event system
+	events.AddHandler(p.EventRouter)
+
+	// Set up the hooks that are called before writes
+	hooks, err := p.hooks()
+	if err != nil {
+		return err
+	}
+	p.Hooks = hooks
+	events.AddHooks(p.Hooks)
+
+	return nil
+}
+
+// hooks creates the pre-write hooks defined in the plugin's "hook" blocks
+func (p *Plugin) hooks() (*events.Hooks, error) {
+	hs := events.NewHooks()
+	psettings := p.DB.Assets().Config.Plugins[p.Name]
+	for i := range psettings.Hooks {
+		h := &psettings.Hooks[i]
+		phh, err := NewPluginHookHandler(p, h)
+		if err != nil {
+			return nil, err
+		}
+		evt := assetEventToEvent(assets.Event{
+			Event:  h.Hook,
+			Type:   h.Type,
+			Tags:   h.Tags,
+			Plugin: h.Plugin,
+			Key:    h.Key,
+		})
+		logrus.Debugf("%s: Hook %s -> %s", p.Name, evt.String(), *h.Post)
+		hs.Add(evt, phh)
+	}
+	return hs, nil
+}
 
+// eventRouter creates a router that forwards the events subscribed in the plugin's "on" blocks
+func (p *Plugin) eventRouter() (*events.Router, error) {
+	er := events.NewRouter()
+	psettings := p.DB.Assets().Config.Plugins[p.Name]
 	for _, ev := range psettings.On {
 		peh, err := NewPluginEventHandler(p, &ev)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		evt := assetEventToEvent(ev)
 
 		logrus.Debugf("%s: Forwarding event %s -> %s", p.Name, evt.String(), *ev.Post)
-		p.EventRouter.Subscribe(evt, peh)
+		er.Subscribe(evt, peh)
 	}
 	for cplugin, cv := range psettings.Apps {
 		for _, ev := range cv.On {
 			peh, err := NewPluginEventHandler(p, &ev)
 			if err != nil {
-				return err
+				return nil, err
 			}
 			cpn := p.Name + ":" + cplugin
 			evt := assetEventToEvent(ev)
 			evt.Plugin = &cpn
 			logrus.Debugf("%s: Forwarding event %s -> %s", p.Name, evt.String(), *ev.Post)
-			p.EventRouter.Subscribe(evt, peh)
+			er.Subscribe(evt, peh)
 		}
 		for skey, sv := range cv.Objects {
 			for _, ev := range sv.On {
 				peh, err := NewPluginEventHandler(p, &ev)
 				if err != nil {
-					return err
+					return nil, err
 				}
 				cpn := p.Name + ":" + cplugin
 				evt := assetEventToEvent(ev)
@@ -133,13 +181,34 @@ func (p *Plugin) Start() error {
 					evt.Tags.Load(skey)
 				}
 				logrus.Debugf("%s: Forwarding event %s -> %s", p.Name, evt.String(), *ev.Post)
-				p.EventRouter.Subscribe(evt, peh)
+				er.Subscribe(evt, peh)
 			}
 		}
 	}
-	// Attach the event router to the event system
-	events.AddHandler(p.EventRouter)
+	return er, nil
+}
 
+// Reload updates the plugin's event subscriptions and cron schedules after the configuration was reloaded
+func (p *Plugin) Reload() error {
+	er, err := p.eventRouter()
+	if err != nil {
+		return err
+	}
+	p.EventRouter.Replace(er)
+
+	hs, err := p.hooks()
+	if err != nil {
+		return err
+	}
+	p.Hooks.Replace(hs)
+
+	for rname, rv := range p.DB.Assets().Config.Plugins[p.Name].Run {
+		if rv.Cron != nil && (rv.Enabled == nil || *rv.Enabled) {
+			if err = p.Run.Reschedule(p.Name, rname, *rv.Cron); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
@@ -179,7 +248,7 @@ func (p *Plugin) AfterStart() error {
 		for skey, sv := range cv.Objects {
 			if sv.AutoCreate == nil || *sv.AutoCreate == true {
 				res := []string{}
-				err := p.DB.DB.Select(&res, "SELECT id FROM apps WHERE plugin=? AND NOT EXISTS (SELECT 1 FROM objects WHERE app=apps.id AND key=?);", pluginKey, skey)
+				err := p.DB.DB.Select(&res, "SELECT id FROM apps WHERE plugin=? AND deleted_date IS NULL AND NOT EXISTS (SELECT 1 FROM objects WHERE app=apps.id AND key=?);", pluginKey, skey)
 				if err != nil {
 					return err
 				}
@@ -236,5 +305,6 @@ func (p *Plugin) OnUserCreate(username string) error {
 
 func (p *Plugin) Close() error {
 	events.RemoveHandler(p.EventRouter)
+	events.RemoveHooks(p.Hooks)
 	return p.Run.StopPlugin(p.Name)
 }
@@ -273,6 +273,21 @@ func (pm *PluginManager) Close() error {
 	return nil
 }
 
+// Reload updates the event subscriptions and cron schedules of all running plugins from the configuration
+func (pm *PluginManager) Reload() error {
+	pm.RLock()
+	defer pm.RUnlock()
+	if pm.status != statusReady {
+		return errors.New("Plugins are not running")
+	}
+	for _, pname := range pm.order {
+		if err := pm.Plugins[pname].Plugin.Reload(); err != nil {
+			return fmt.Errorf("%s: %w", pname, err)
+		}
+	}
+	return nil
+}
+
 func (pm *PluginManager) Kill() error {
 	pm.Lock()
 	defer pm.Unlock()
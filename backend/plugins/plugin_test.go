@@ -0,0 +1,84 @@
+package plugins
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/heedy/heedy/backend/assets"
+	"github.com/heedy/heedy/backend/database"
+	"github.com/heedy/heedy/backend/events"
+	"github.com/heedy/heedy/backend/plugins/run"
+)
+
+// testRunType runs a server that records the paths of the requests sent to it
+type testRunType struct {
+	paths *[]string
+}
+
+func (rt testRunType) Start(*run.Info) (http.Handler, error) {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*rt.paths = append(*rt.paths, r.URL.Path)
+	}), nil
+}
+func (testRunType) Run(*run.Info) error      { return nil }
+func (testRunType) Stop(apikey string) error { return nil }
+func (testRunType) Kill(apikey string) error { return nil }
+
+func testPluginConfig(post, cron string) *assets.Plugin {
+	rtype := "test"
+	return &assets.Plugin{
+		On: []assets.Event{{Event: "user_create", Post: &post}},
+		Run: map[string]assets.Run{
+			"server": {Type: &rtype},
+			"job":    {Type: &rtype, Cron: &cron},
+		},
+	}
+}
+
+func TestPluginReload(t *testing.T) {
+	a, err := assets.Open("", nil)
+	require.NoError(t, err)
+	os.RemoveAll("./test_db")
+	defer os.RemoveAll("./test_db")
+	a.FolderPath = "./test_db"
+	sqla := "sqlite3://heedy.db?_journal=WAL&_fk=1"
+	a.Config.SQL = &sqla
+	a.Config.Plugins["testy"] = testPluginConfig("run:server/first", "@every 1h")
+	require.NoError(t, database.Create(a))
+	db, err := database.Open(a)
+	require.NoError(t, err)
+	defer db.Close()
+
+	paths := []string{}
+	m := run.NewManager(db)
+	m.RunTypes["test"] = testRunType{&paths}
+	for rname, rv := range a.Config.Plugins["testy"].Run {
+		rv := rv
+		require.NoError(t, m.Start("testy", rname, &rv))
+	}
+	defer m.StopPlugin("testy")
+
+	p, err := NewPlugin(db, m, nil, "testy")
+	require.NoError(t, err)
+	require.NoError(t, p.Reload())
+	p.EventRouter.Fire(&events.Event{Event: "user_create"})
+	require.Equal(t, []string{"/first"}, paths)
+
+	// Reloading the configuration changes where events are sent, and the schedule of cron jobs
+	nc := assets.NewConfiguration()
+	nc.Plugins["testy"] = testPluginConfig("run:server/second", "@every 2h")
+	cc := a.Config.Update(nc)
+	require.Contains(t, cc.Applied, "plugin.testy.on")
+	require.Contains(t, cc.Applied, "plugin.testy.run.job.cron")
+	require.NoError(t, p.Reload())
+
+	p.EventRouter.Fire(&events.Event{Event: "user_create"})
+	require.Equal(t, []string{"/first", "/second"}, paths)
+
+	r, err := m.Find("testy", "job")
+	require.NoError(t, err)
+	require.Equal(t, "@every 2h", *r.I.Run.Cron)
+}
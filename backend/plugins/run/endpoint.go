@@ -86,6 +86,11 @@ func RequestWithContext(adb *database.AdminDB, h http.Handler, method, path stri
 
 // Request runs the given http handler, and optionally unmarshals the result
 func Request(h http.Handler, method, path string, body interface{}, headers map[string]string) (*bytes.Buffer, error) {
+	return RequestContext(context.Background(), h, method, path, body, headers)
+}
+
+// RequestContext is just like Request, but the request is canceled once ctx is done
+func RequestContext(ctx context.Context, h http.Handler, method, path string, body interface{}, headers map[string]string) (*bytes.Buffer, error) {
 	var bodybuffer io.Reader
 	if body != nil {
 		b, ok := body.([]byte)
@@ -99,7 +104,7 @@ func Request(h http.Handler, method, path string, body interface{}, headers map[
 		bodybuffer = bytes.NewBuffer(b)
 	}
 
-	req, err := http.NewRequest(method, path, bodybuffer)
+	req, err := http.NewRequestWithContext(ctx, method, path, bodybuffer)
 	if err != nil {
 		return nil, err
 	}
@@ -208,6 +208,31 @@ func (m *Manager) Start(plugin, name string, run *assets.Run) error {
 	return nil
 }
 
+// Reschedule changes the schedule of a running cron job
+func (m *Manager) Reschedule(plugin, name, schedule string) error {
+	r, err := m.Find(plugin, name)
+	if err != nil {
+		return err
+	}
+	m.Lock()
+	defer m.Unlock()
+	if r.I.Run.Cron == nil {
+		return fmt.Errorf("%s:%s is not a cron job", plugin, name)
+	}
+	if *r.I.Run.Cron == schedule {
+		return nil
+	}
+	cid, err := m.cron.AddJob(schedule, r)
+	if err != nil {
+		return err
+	}
+	logrus.Debugf("Rescheduling cron job %s:%s (%s)", plugin, name, schedule)
+	m.cron.Remove(r.cid)
+	r.cid = cid
+	r.I.Run.Cron = &schedule
+	return nil
+}
+
 func (m *Manager) Find(plugin, name string) (*Runner, error) {
 	m.RLock()
 	defer m.RUnlock()
@@ -0,0 +1,79 @@
+package run
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/heedy/heedy/backend/assets"
+	"github.com/heedy/heedy/backend/database"
+)
+
+type testRunType struct{}
+
+func (testRunType) Start(*Info) (http.Handler, error) { return http.NotFoundHandler(), nil }
+func (testRunType) Run(*Info) error                   { return nil }
+func (testRunType) Stop(apikey string) error          { return nil }
+func (testRunType) Kill(apikey string) error          { return nil }
+
+func newManager(t *testing.T) (*Manager, func()) {
+	a, err := assets.Open("", nil)
+	require.NoError(t, err)
+	os.RemoveAll("./test_db")
+	a.FolderPath = "./test_db"
+	sqla := "sqlite3://heedy.db?_journal=WAL&_fk=1"
+	a.Config.SQL = &sqla
+	cleanup := func() {
+		os.RemoveAll("./test_db")
+	}
+	if err = database.Create(a); err != nil {
+		cleanup()
+	}
+	require.NoError(t, err)
+	db, err := database.Open(a)
+	require.NoError(t, err)
+
+	m := NewManager(db)
+	m.RunTypes["test"] = testRunType{}
+	return m, func() {
+		m.cron.Stop()
+		db.Close()
+		cleanup()
+	}
+}
+
+func TestManagerReschedule(t *testing.T) {
+	m, cleanup := newManager(t)
+	defer cleanup()
+
+	rtype := "test"
+	schedule := "@every 1h"
+	require.NoError(t, m.Start("testy", "job", &assets.Run{Type: &rtype, Cron: &schedule}))
+	require.NoError(t, m.Start("testy", "server", &assets.Run{Type: &rtype}))
+
+	r, err := m.Find("testy", "job")
+	require.NoError(t, err)
+	require.Equal(t, cron.ConstantDelaySchedule{Delay: time.Hour}, m.cron.Entry(r.cid).Schedule)
+
+	require.NoError(t, m.Reschedule("testy", "job", "@every 2h"))
+	require.Equal(t, "@every 2h", *r.I.Run.Cron)
+	require.Len(t, m.cron.Entries(), 1)
+	require.Equal(t, cron.ConstantDelaySchedule{Delay: 2 * time.Hour}, m.cron.Entry(r.cid).Schedule)
+
+	// An invalid schedule keeps the job on its current one
+	require.Error(t, m.Reschedule("testy", "job", "not a schedule"))
+	require.Equal(t, "@every 2h", *r.I.Run.Cron)
+	require.Len(t, m.cron.Entries(), 1)
+	require.Equal(t, cron.ConstantDelaySchedule{Delay: 2 * time.Hour}, m.cron.Entry(r.cid).Schedule)
+
+	// Only cron jobs can be rescheduled
+	require.Error(t, m.Reschedule("testy", "server", "@every 1h"))
+	require.Error(t, m.Reschedule("testy", "missing", "@every 1h"))
+
+	require.NoError(t, m.Stop("testy", "job"))
+	require.Len(t, m.cron.Entries(), 0)
+}
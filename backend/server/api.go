@@ -34,18 +34,38 @@ func APIMux() (*chi.Mux, error) {
 
 	apiMux.Get("/users/{username}/sessions", ListUserSessions)
 	apiMux.Delete("/users/{username}/sessions/{sessionid}", DeleteUserSession)
+	apiMux.Post("/users/{username}/password_reset", CreatePasswordReset)
+
+	apiMux.Get("/users/{username}/trash", ListTrash)
+	apiMux.Get("/users/{username}/storage", ReadUserStorage)
+	apiMux.Get("/users/{username}/tokens", ListUserTokens)
+	apiMux.Post("/users/{username}/tokens", CreateUserToken)
+	apiMux.Delete("/users/{username}/tokens/{tokenid}", DeleteUserToken)
+	apiMux.Get("/users/{username}/transfers", ListObjectTransfers)
+	apiMux.Post("/users/{username}/transfers/{objectid}", AcceptObjectTransfer)
+	apiMux.Delete("/users/{username}/transfers/{objectid}", RejectObjectTransfer)
 
 	apiMux.Post("/objects", CreateObject)
 	apiMux.Get("/objects", ListObjects)
 	apiMux.Get("/objects/{objectid}", ReadObject)
 	apiMux.Patch("/objects/{objectid}", UpdateObject)
 	apiMux.Delete("/objects/{objectid}", DeleteObject)
+	apiMux.Post("/objects/{objectid}/restore", RestoreObject)
+	apiMux.Get("/objects/{objectid}/storage", ReadObjectStorage)
+	apiMux.Get("/objects/{objectid}/share_links", ListShareLinks)
+	apiMux.Post("/objects/{objectid}/share_links", CreateShareLink)
+	apiMux.Delete("/objects/{objectid}/share_links/{linkid}", DeleteShareLink)
+	apiMux.Get("/objects/{objectid}/transfer", ReadObjectTransfer)
+	apiMux.Post("/objects/{objectid}/transfer", RequestObjectTransfer)
+	apiMux.Delete("/objects/{objectid}/transfer", CancelObjectTransfer)
+	apiMux.Post("/objects/{objectid}/move", MoveObject)
 
 	apiMux.Post("/apps", CreateApp)
 	apiMux.Get("/apps", ListApps)
 	apiMux.Get("/apps/{appid}", ReadApp)
 	apiMux.Patch("/apps/{appid}", UpdateApp)
 	apiMux.Delete("/apps/{appid}", DeleteApp)
+	apiMux.Post("/apps/{appid}/restore", RestoreApp)
 
 	apiMux.Get("/server/scope/{objecttype}", GetObjectScope)
 	apiMux.Get("/server/scope", GetAppScope)
@@ -57,13 +77,24 @@ func APIMux() (*chi.Mux, error) {
 	apiMux.Post("/server/admin/{username}", AddAdminUser)
 	apiMux.Delete("/server/admin/{username}", RemoveAdminUser)
 
+	apiMux.Get("/server/config", GetConfig)
+	apiMux.Get("/server/storage", GetStorage)
+	apiMux.Get("/server/check", CheckDatabase)
+	apiMux.Post("/server/check", RepairDatabase)
+	apiMux.Post("/server/vacuum", VacuumDatabase)
+
+	apiMux.Get("/server/invites", ListInvites)
+	apiMux.Post("/server/invites", CreateInvite)
+	apiMux.Delete("/server/invites/{code}", DeleteInvite)
+	apiMux.Get("/server/registrations", ListRegistrations)
+	apiMux.Post("/server/registrations/{username}", ApproveRegistration)
+	apiMux.Delete("/server/registrations/{username}", RejectRegistration)
+
 	apiMux.Get("/server/updates", GetUpdates)
 	apiMux.Delete("/server/updates", ClearUpdates)
 	apiMux.Get("/server/updates/status", GetUpdateStatus)
 	apiMux.Get("/server/updates/heedy.conf", GetConfigFile)
-	apiMux.Post("/server/updates/heedy.conf", PostConfigFile)
 	apiMux.Get("/server/updates/config", GetUConfig)
-	apiMux.Patch("/server/updates/config", PatchUConfig)
 	apiMux.Get("/server/updates/plugins", GetAllPlugins)
 	apiMux.Post("/server/updates/plugins", PostPlugin)
 	apiMux.Get("/server/updates/options", GetUpdateOptions)
@@ -142,6 +142,16 @@ func DeleteUserSession(w http.ResponseWriter, r *http.Request) {
 	rest.WriteResult(w, r, rest.CTX(r).DB.DelUserSession(username, sessionid))
 }
 
+func ListTrash(w http.ResponseWriter, r *http.Request) {
+	username, err := rest.URLParam(r, "username", nil)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	t, err := rest.CTX(r).DB.ListTrash(username)
+	rest.WriteJSON(w, r, t, err)
+}
+
 func ListObjects(w http.ResponseWriter, r *http.Request) {
 	var o database.ListObjectsOptions
 	err := rest.QueryDecoder.Decode(&o, r.URL.Query())
@@ -167,6 +177,10 @@ func CreateObject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	adb := rest.CTX(r).DB
+	if err = objectCreateHook(adb, &s); err != nil {
+		rest.WriteJSONError(w, r, 400, err)
+		return
+	}
 
 	sid, err := adb.CreateObject(&s)
 	if err != nil {
@@ -198,7 +212,12 @@ func UpdateObject(w http.ResponseWriter, r *http.Request) {
 		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
 		return
 	}
-	rest.WriteResult(w, r, rest.CTX(r).DB.UpdateObject(&s))
+	db := rest.CTX(r).DB
+	if err = objectUpdateHook(db, &s); err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	rest.WriteResult(w, r, db.UpdateObject(&s))
 }
 
 func DeleteObject(w http.ResponseWriter, r *http.Request) {
@@ -210,6 +229,15 @@ func DeleteObject(w http.ResponseWriter, r *http.Request) {
 	rest.WriteResult(w, r, rest.CTX(r).DB.DelObject(sid))
 }
 
+func RestoreObject(w http.ResponseWriter, r *http.Request) {
+	sid, err := rest.URLParam(r, "objectid", nil)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	rest.WriteResult(w, r, rest.CTX(r).DB.RestoreObject(sid))
+}
+
 func CreateApp(w http.ResponseWriter, r *http.Request) {
 	var c database.App
 	var o database.ReadAppOptions
@@ -226,6 +254,10 @@ func CreateApp(w http.ResponseWriter, r *http.Request) {
 	db := rest.CTX(r).DB
 	var cid string
 	if c.Plugin == nil || *c.Plugin == "" {
+		if err = appCreateHook(db, &c); err != nil {
+			rest.WriteJSONError(w, r, 400, err)
+			return
+		}
 		cid, _, err = db.CreateApp(&c)
 	} else {
 		// There is a plugin set. This means that the user might want to create
@@ -270,7 +302,12 @@ func UpdateApp(w http.ResponseWriter, r *http.Request) {
 		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
 		return
 	}
-	rest.WriteResult(w, r, rest.CTX(r).DB.UpdateApp(&c))
+	db := rest.CTX(r).DB
+	if err = appUpdateHook(db, &c); err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	rest.WriteResult(w, r, db.UpdateApp(&c))
 
 }
 
@@ -283,6 +320,15 @@ func DeleteApp(w http.ResponseWriter, r *http.Request) {
 	rest.WriteResult(w, r, rest.CTX(r).DB.DelApp(cid))
 }
 
+func RestoreApp(w http.ResponseWriter, r *http.Request) {
+	cid, err := rest.URLParam(r, "appid", nil)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	rest.WriteResult(w, r, rest.CTX(r).DB.RestoreApp(cid))
+}
+
 func ListApps(w http.ResponseWriter, r *http.Request) {
 	var o database.ListAppOptions
 	err := rest.QueryDecoder.Decode(&o, r.URL.Query())
@@ -293,3 +339,35 @@ func ListApps(w http.ResponseWriter, r *http.Request) {
 	cl, err := rest.CTX(r).DB.ListApps(&o)
 	rest.WriteJSON(w, r, cl, err)
 }
+
+// ReadUserStorage returns the storage used by the user. Users can see their own storage, and admins can see all users' storage.
+func ReadUserStorage(w http.ResponseWriter, r *http.Request) {
+	db := rest.CTX(r).DB
+	username, err := rest.URLParam(r, "username", nil)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if !isAdmin(db, db.AdminDB().Assets()) && (db.Type() != database.UserType || db.ID() != username) {
+		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("access_denied: Only the user and admins can read the user's storage"))
+		return
+	}
+	s, err := db.AdminDB().ReadUserStorage(username)
+	rest.WriteJSON(w, r, s, err)
+}
+
+// ReadObjectStorage returns the storage used by the object, which is available to anyone who can read the object
+func ReadObjectStorage(w http.ResponseWriter, r *http.Request) {
+	db := rest.CTX(r).DB
+	objectid, err := rest.URLParam(r, "objectid", nil)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if _, err = db.ReadObject(objectid, nil); err != nil {
+		rest.WriteJSONError(w, r, http.StatusForbidden, err)
+		return
+	}
+	s, err := db.AdminDB().ObjectStorage(objectid)
+	rest.WriteJSON(w, r, s, err)
+}
@@ -10,7 +10,6 @@ import (
 	"strings"
 
 	"github.com/heedy/heedy/api/golang/rest"
-	"github.com/heedy/heedy/backend/assets"
 	"github.com/heedy/heedy/backend/buildinfo"
 	"github.com/heedy/heedy/backend/database"
 	"github.com/heedy/heedy/backend/plugins"
@@ -168,6 +167,19 @@ func RemoveAdminUser(w http.ResponseWriter, r *http.Request) {
 	rest.WriteResult(w, r, a.RemAdmin(username))
 }
 
+// GetConfig returns the configuration that heedy is running with
+func GetConfig(w http.ResponseWriter, r *http.Request) {
+	db := rest.CTX(r).DB
+	a := db.AdminDB().Assets()
+	if db.Type() != database.AdminType && !a.Config.UserIsAdmin(db.ID()) {
+		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("access_denied: Server settings are admin-only"))
+		return
+	}
+	a.Config.RLock()
+	defer a.Config.RUnlock()
+	rest.WriteJSON(w, r, a.Config, nil)
+}
+
 func GetUpdates(w http.ResponseWriter, r *http.Request) {
 	db := rest.CTX(r).DB
 	a := db.AdminDB().Assets()
@@ -204,41 +216,6 @@ func GetConfigFile(w http.ResponseWriter, r *http.Request) {
 	w.Write(b)
 }
 
-func PostConfigFile(w http.ResponseWriter, r *http.Request) {
-	db := rest.CTX(r).DB
-	a := db.AdminDB().Assets()
-	if db.Type() != database.AdminType && !a.Config.UserIsAdmin(db.ID()) {
-		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("access_denied: Server settings are admin-only"))
-		return
-	}
-	defer r.Body.Close()
-
-	//Limit requests to the limit given in configuration
-	b, err := ioutil.ReadAll(io.LimitReader(r.Body, *a.Config.RequestBodyByteLimit))
-	if err != nil {
-		rest.WriteJSONError(w, r, http.StatusInternalServerError, err)
-	}
-	rest.WriteResult(w, r, updater.SetConfigFile(a.FolderPath, b))
-}
-
-func PatchUConfig(w http.ResponseWriter, r *http.Request) {
-	db := rest.CTX(r).DB
-	a := db.AdminDB().Assets()
-	if db.Type() != database.AdminType && !a.Config.UserIsAdmin(db.ID()) {
-		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("access_denied: Server settings are admin-only"))
-		return
-	}
-	defer r.Body.Close()
-
-	c := assets.NewConfiguration()
-	err := rest.UnmarshalRequest(r, c)
-	if err == nil {
-		err = updater.ModifyConfigFile(a.FolderPath, c)
-	}
-
-	rest.WriteResult(w, r, err)
-}
-
 func GetUpdateStatus(w http.ResponseWriter, r *http.Request) {
 	db := rest.CTX(r).DB
 	a := db.AdminDB().Assets()
@@ -369,3 +346,61 @@ func PostUpdateOptions(w http.ResponseWriter, r *http.Request) {
 	}
 	rest.WriteResult(w, r, updater.WriteOptions(a.FolderPath, &o))
 }
+
+// GetStorage lists the storage used by each user, without the per-object details
+func GetStorage(w http.ResponseWriter, r *http.Request) {
+	db := rest.CTX(r).DB
+	a := db.AdminDB().Assets()
+	if !isAdmin(db, a) {
+		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("access_denied: Only admins can list the storage of all users"))
+		return
+	}
+	users, err := db.AdminDB().ListUsers(nil)
+	if err != nil {
+		rest.WriteJSON(w, r, nil, err)
+		return
+	}
+	res := make(map[string]*database.UserStorage, len(users))
+	for _, u := range users {
+		s, err := db.AdminDB().ReadUserStorage(*u.UserName)
+		if err != nil {
+			rest.WriteJSON(w, r, nil, err)
+			return
+		}
+		s.Objects = nil
+		res[*u.UserName] = s
+	}
+	rest.WriteJSON(w, r, res, nil)
+}
+
+// checkDatabase runs the database check, repairing the problems found if repair is true
+func checkDatabase(w http.ResponseWriter, r *http.Request, repair bool) {
+	db := rest.CTX(r).DB
+	if !isAdmin(db, db.AdminDB().Assets()) {
+		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("access_denied: Only admins can check the database"))
+		return
+	}
+	report, err := db.AdminDB().Check(repair)
+	rest.WriteJSON(w, r, report, err)
+}
+
+// CheckDatabase returns the problems found in the database
+func CheckDatabase(w http.ResponseWriter, r *http.Request) {
+	checkDatabase(w, r, false)
+}
+
+// RepairDatabase checks the database, and repairs the problems that can be fixed automatically
+func RepairDatabase(w http.ResponseWriter, r *http.Request) {
+	checkDatabase(w, r, true)
+}
+
+// VacuumDatabase compacts the database file, returning the number of bytes reclaimed
+func VacuumDatabase(w http.ResponseWriter, r *http.Request) {
+	db := rest.CTX(r).DB
+	if !isAdmin(db, db.AdminDB().Assets()) {
+		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("access_denied: Only admins can vacuum the database"))
+		return
+	}
+	reclaimed, err := db.AdminDB().Vacuum()
+	rest.WriteJSON(w, r, map[string]int64{"reclaimed": reclaimed}, err)
+}
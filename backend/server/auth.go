@@ -60,14 +60,20 @@ func writeAuthError(w http.ResponseWriter, r *http.Request, status int, errVal,
 type Auth struct {
 	DB *database.AdminDB
 
-	codeCache *cache.Cache
+	codeCache     *cache.Cache
+	logins        *LoginLimiter
+	resets        *LoginLimiter
+	registrations *LoginLimiter
 }
 
 // NewAuth creates a new oauth flow handler using an admin DB
 func NewAuth(db *database.AdminDB) *Auth {
 	return &Auth{
-		DB:        db,
-		codeCache: cache.New(5*time.Minute, 5*time.Minute),
+		DB:            db,
+		codeCache:     cache.New(5*time.Minute, 5*time.Minute),
+		logins:        NewLoginLimiter(),
+		resets:        NewLoginLimiter(),
+		registrations: NewLoginLimiter(),
 	}
 }
 
@@ -75,11 +81,18 @@ func (a *Auth) Authenticate(w http.ResponseWriter, r *http.Request) (database.DB
 	// First, try authenticating as a app
 	accessToken := r.Header.Get("Authorization")
 	if len(accessToken) > 0 {
-		const prefix = "Bearer "
-		if len(accessToken) < len(prefix) || !strings.EqualFold(accessToken[:len(prefix)], prefix) {
+		if _, password, ok := r.BasicAuth(); ok {
+			// Clients that only support basic auth (such as Grafana) can give the access token as the password
+			if password == "" {
+				return nil, errors.New("access_denied: invalid API key")
+			}
+			accessToken = password
+		} else if i := strings.IndexByte(accessToken, ' '); i > 0 && (strings.EqualFold(accessToken[:i], "Bearer") || strings.EqualFold(accessToken[:i], "Token")) {
+			// InfluxDB clients send the access token with the Token scheme
+			accessToken = accessToken[i+1:]
+		} else {
 			return nil, errors.New("bad_request: Malformed authorization header")
 		}
-		accessToken = accessToken[len(prefix):]
 	} else {
 		// No authorization header. Check the url params for a token
 		accessToken = r.URL.Query().Get("access_token")
@@ -89,6 +102,14 @@ func (a *Auth) Authenticate(w http.ResponseWriter, r *http.Request) (database.DB
 		// Try logging in as a app
 		c, err := a.DB.GetAppByAccessToken(accessToken)
 		if err != nil {
+			// Personal access tokens act as their user, limited to the token's scope
+			if t, err := a.DB.GetUserTokenByToken(accessToken); err == nil {
+				return database.NewTokenDB(a.DB, t), nil
+			}
+			// Share links give access to a single object
+			if l, err := a.DB.GetShareLinkByToken(accessToken); err == nil {
+				return database.NewShareLinkDB(a.DB, l), nil
+			}
 			return nil, errors.New("access_denied: invalid API key")
 		}
 		if !*c.Enabled {
@@ -150,12 +171,21 @@ func (a *Auth) ServeToken(w http.ResponseWriter, r *http.Request) {
 			writeAuthError(w, r, 400, "parameter_absent", "Must have both username and password")
 			return
 		}
+		// Refuse logins from IPs or for users with too many failed attempts. The attempt is counted
+		// as failed before checking the password, and only refunded if the password is correct.
+		ip := clientIP(r)
+		attempts, lockout := a.DB.Assets().Config.GetLoginLimits()
+		if wait := a.logins.Attempt(attempts, lockout, ip, usr); wait > 0 {
+			setRetryAfter(w, wait)
+			writeAuthError(w, r, http.StatusTooManyRequests, "too_many_requests", "Too many failed login attempts, try again later")
+			return
+		}
 		uname, _, err := a.DB.AuthUser(usr, password)
 		if err != nil {
-			time.Sleep(1 * time.Second) // Wait a second before returning failure
 			writeAuthError(w, r, 400, "access_denied", "Wrong username or password")
 			return
 		}
+		a.logins.Refund(ip, usr)
 		// Add the token
 		tok, _, err := a.DB.CreateUserSession(uname, r.Header.Get("User-Agent"))
 		if err != nil {
@@ -173,6 +203,7 @@ func (a *Auth) ServeToken(w http.ResponseWriter, r *http.Request) {
 			SameSite: http.SameSiteLaxMode,
 			Path:     "/",
 			HttpOnly: true,
+			Secure:   r.TLS != nil,
 		})
 
 		// ... and also return the json response
@@ -227,6 +258,9 @@ func AuthMux(a *Auth) (*chi.Mux, error) {
 		return nil, err
 	}
 	mux.Post("/token", a.ServeToken)
+	mux.Post("/register", a.ServeRegister)
+	mux.Post("/password_reset", a.ServePasswordReset)
+	mux.Post("/password_reset/email", a.ServePasswordResetEmail)
 
 	mux.Get("/", func(w http.ResponseWriter, r *http.Request) {
 
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"github.com/heedy/heedy/backend/database"
+	"github.com/heedy/heedy/backend/events"
+)
+
+// hookUser returns the user that a new object or app will belong to, for targeting hooks
+func hookUser(db database.DB, owner *string) string {
+	if owner != nil {
+		return *owner
+	}
+	if db.Type() == database.UserType {
+		return db.ID()
+	}
+	return ""
+}
+
+// objectCreateHook runs the object_create hooks of plugins, which can modify or reject the new object
+func objectCreateHook(db database.DB, s *database.Object) error {
+	if !events.Hooked("object_create") {
+		return nil
+	}
+	if err := db.CanCreateObject(s); err != nil {
+		return err
+	}
+	evt := &events.Event{
+		Event: "object_create",
+		User:  hookUser(db, s.Owner),
+		Tags:  s.Tags,
+		Key:   s.Key,
+		Data:  s,
+	}
+	if s.Type != nil {
+		evt.Type = *s.Type
+	}
+	if s.App != nil && *s.App != "self" {
+		evt.App = *s.App
+		if err := db.AdminDB().Get(&evt.Plugin, "SELECT plugin FROM apps WHERE id=?;", evt.App); err != nil {
+			return database.ErrNotFound
+		}
+	}
+	_, err := events.RunHooks(evt, db.ID(), s)
+	return err
+}
+
+// objectUpdateHook runs the object_update hooks of plugins, which can modify or reject the update.
+// The hooks are only called if the object can be read by db.
+func objectUpdateHook(db database.DB, s *database.Object) error {
+	if !events.Hooked("object_update") {
+		return nil
+	}
+	if _, err := db.ReadObject(s.ID, nil); err != nil {
+		return err
+	}
+	evt := &events.Event{
+		Event:  "object_update",
+		Object: s.ID,
+	}
+	if err := database.FillEvent(db.AdminDB(), evt); err != nil {
+		return err
+	}
+	evt.Data = s
+	id := s.ID
+	if _, err := events.RunHooks(evt, db.ID(), s); err != nil {
+		return err
+	}
+	// Hooks can't change which object is updated
+	s.ID = id
+	return nil
+}
+
+// appCreateHook runs the app_create hooks of plugins, which can modify or reject the new app
+func appCreateHook(db database.DB, c *database.App) error {
+	if !events.Hooked("app_create") {
+		return nil
+	}
+	evt := &events.Event{
+		Event: "app_create",
+		User:  hookUser(db, c.Owner),
+		Data:  c,
+	}
+	_, err := events.RunHooks(evt, db.ID(), c)
+	return err
+}
+
+// appUpdateHook runs the app_update hooks of plugins, which can modify or reject the update.
+// The hooks are only called if the app can be read by db.
+func appUpdateHook(db database.DB, c *database.App) error {
+	if !events.Hooked("app_update") {
+		return nil
+	}
+	if _, err := db.ReadApp(c.ID, nil); err != nil {
+		return err
+	}
+	evt := &events.Event{
+		Event: "app_update",
+		App:   c.ID,
+	}
+	if err := database.FillEvent(db.AdminDB(), evt); err != nil {
+		return err
+	}
+	evt.Data = c
+	id := c.ID
+	if _, err := events.RunHooks(evt, db.ID(), c); err != nil {
+		return err
+	}
+	c.ID = id
+	return nil
+}
@@ -0,0 +1,257 @@
+package server
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+// clientIP returns the IP address of the client making the request
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// setRetryAfter sets the Retry-After header to the given duration, rounded up to the nearest second
+func setRetryAfter(w http.ResponseWriter, d time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(d.Seconds()))))
+}
+
+// BlockedClient gives information about a client that is currently being refused
+type BlockedClient struct {
+	Client string    `json:"client"`
+	Count  int       `json:"count"`
+	Until  time.Time `json:"until"`
+}
+
+// LoginLimiter tracks failed login attempts for each client IP and each username,
+// and locks out further attempts once too many have failed
+type LoginLimiter struct {
+	sync.Mutex
+	failures *cache.Cache
+}
+
+// NewLoginLimiter creates a login limiter
+func NewLoginLimiter() *LoginLimiter {
+	return &LoginLimiter{
+		failures: cache.New(15*time.Minute, 10*time.Minute),
+	}
+}
+
+// loginKeys returns the keys that are limited for the client IP and username. Without a username, only the IP is limited.
+func loginKeys(ip, username string) []string {
+	if username == "" {
+		return []string{"ip:" + ip}
+	}
+	return []string{"ip:" + ip, "user:" + username}
+}
+
+// Check returns how long the client needs to wait before being allowed to log in again,
+// or 0 if the login attempt is permitted.
+func (l *LoginLimiter) Check(attempts int, ip, username string) time.Duration {
+	l.Lock()
+	defer l.Unlock()
+	return l.check(attempts, ip, username)
+}
+
+func (l *LoginLimiter) check(attempts int, ip, username string) time.Duration {
+	if attempts <= 0 {
+		return 0
+	}
+	wait := time.Duration(0)
+	for _, k := range loginKeys(ip, username) {
+		v, exp, ok := l.failures.GetWithExpiration(k)
+		if ok && v.(int) >= attempts {
+			if d := time.Until(exp); d > wait {
+				wait = d
+			}
+		}
+	}
+	return wait
+}
+
+// Fail records a failed login attempt. Once the given number of attempts is reached, the
+// client IP or username is locked out for the lockout duration.
+func (l *LoginLimiter) Fail(attempts int, lockout time.Duration, ip, username string) {
+	l.Lock()
+	defer l.Unlock()
+	l.fail(attempts, lockout, ip, username)
+}
+
+func (l *LoginLimiter) fail(attempts int, lockout time.Duration, ip, username string) {
+	if attempts <= 0 {
+		return
+	}
+	for _, k := range loginKeys(ip, username) {
+		n, err := l.failures.IncrementInt(k, 1)
+		if err != nil {
+			// The key doesn't exist yet, or has expired
+			n = 1
+			l.failures.Set(k, n, lockout)
+		}
+		if n == attempts {
+			// The lockout starts from the final failed attempt
+			l.failures.Set(k, n, lockout)
+		}
+	}
+}
+
+// Attempt reserves a login attempt for the client IP and username, or returns how long the client needs to
+// wait if it is locked out. The reserved attempt counts as failed until it is returned with Refund, so that
+// parallel guesses can't all pass the check before any of them is recorded as failed.
+func (l *LoginLimiter) Attempt(attempts int, lockout time.Duration, ip, username string) time.Duration {
+	l.Lock()
+	defer l.Unlock()
+	if wait := l.check(attempts, ip, username); wait > 0 {
+		return wait
+	}
+	l.fail(attempts, lockout, ip, username)
+	return 0
+}
+
+// Refund returns the attempt reserved by Attempt once the login succeeds, which also resets
+// the failed attempts of the username
+func (l *LoginLimiter) Refund(ip, username string) {
+	l.Lock()
+	defer l.Unlock()
+	if n, err := l.failures.DecrementInt("ip:"+ip, 1); err == nil && n <= 0 {
+		l.failures.Delete("ip:" + ip)
+	}
+	l.failures.Delete("user:" + username)
+}
+
+// Succeed resets the failed attempts for the given username on successful login. The IP's failures
+// are not reset, since a successful login to one account should not allow guessing passwords of others.
+func (l *LoginLimiter) Succeed(username string) {
+	l.Lock()
+	defer l.Unlock()
+	l.failures.Delete("user:" + username)
+}
+
+// Blocked returns the IPs and usernames that are currently locked out
+func (l *LoginLimiter) Blocked(attempts int) []BlockedClient {
+	res := []BlockedClient{}
+	if attempts <= 0 {
+		return res
+	}
+	for k, v := range l.failures.Items() {
+		n := v.Object.(int)
+		if n >= attempts && !v.Expired() {
+			until := time.Unix(0, v.Expiration)
+			res = append(res, BlockedClient{
+				Client: k,
+				Count:  n,
+				Until:  until,
+			})
+		}
+	}
+	return res
+}
+
+// Clear removes all lockouts
+func (l *LoginLimiter) Clear() {
+	l.failures.Flush()
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	denied int
+}
+
+// RateLimiter is a token bucket rate limiter, holding a separate bucket for each client
+type RateLimiter struct {
+	sync.Mutex
+	buckets map[string]*tokenBucket
+
+	lastSweep time.Time
+}
+
+// NewRateLimiter creates a rate limiter
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time, rate float64, burst int) {
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+}
+
+// Allow takes a token from the client's bucket, which refills at rate tokens per second up to burst tokens.
+// If the bucket is empty, it returns the time until the next token becomes available, and 0 otherwise.
+func (rl *RateLimiter) Allow(client string, rate float64, burst int) time.Duration {
+	if rate <= 0 {
+		return 0
+	}
+	now := time.Now()
+	rl.Lock()
+	defer rl.Unlock()
+
+	if now.Sub(rl.lastSweep) > time.Minute {
+		// Remove buckets that have refilled completely, so that the map doesn't grow forever
+		for k, b := range rl.buckets {
+			b.refill(now, rate, burst)
+			if b.tokens >= float64(burst) {
+				delete(rl.buckets, k)
+			}
+		}
+		rl.lastSweep = now
+	}
+
+	b, ok := rl.buckets[client]
+	if !ok {
+		b = &tokenBucket{
+			tokens: float64(burst),
+			last:   now,
+		}
+		rl.buckets[client] = b
+	}
+	b.refill(now, rate, burst)
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	b.denied++
+	return time.Duration((1 - b.tokens) / rate * float64(time.Second))
+}
+
+// Blocked returns the clients whose buckets are currently empty, after having been refused a request
+func (rl *RateLimiter) Blocked(rate float64, burst int) []BlockedClient {
+	res := []BlockedClient{}
+	if rate <= 0 {
+		return res
+	}
+	now := time.Now()
+	rl.Lock()
+	defer rl.Unlock()
+	for k, b := range rl.buckets {
+		b.refill(now, rate, burst)
+		if b.denied > 0 && b.tokens < 1 {
+			wait := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+			res = append(res, BlockedClient{
+				Client: k,
+				Count:  b.denied,
+				Until:  now.Add(wait),
+			})
+		}
+	}
+	return res
+}
+
+// Clear resets all of the buckets
+func (rl *RateLimiter) Clear() {
+	rl.Lock()
+	rl.buckets = make(map[string]*tokenBucket)
+	rl.Unlock()
+}
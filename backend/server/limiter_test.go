@@ -0,0 +1,94 @@
+package server
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginLimiter(t *testing.T) {
+	l := NewLoginLimiter()
+
+	require.Zero(t, l.Check(3, "1.2.3.4", "testy"))
+	l.Fail(3, time.Minute, "1.2.3.4", "testy")
+	l.Fail(3, time.Minute, "1.2.3.4", "testy")
+	require.Zero(t, l.Check(3, "1.2.3.4", "testy"))
+	l.Fail(3, time.Minute, "1.2.3.4", "testy")
+
+	// Both the IP and the username are locked out
+	require.NotZero(t, l.Check(3, "1.2.3.4", "other"))
+	require.NotZero(t, l.Check(3, "5.6.7.8", "testy"))
+	require.Zero(t, l.Check(3, "5.6.7.8", "other"))
+	require.Len(t, l.Blocked(3), 2)
+
+	// Disabled when attempts is 0
+	require.Zero(t, l.Check(0, "1.2.3.4", "testy"))
+
+	l.Clear()
+	require.Zero(t, l.Check(3, "1.2.3.4", "testy"))
+	require.Len(t, l.Blocked(3), 0)
+}
+
+func TestLoginLimiterAttempt(t *testing.T) {
+	l := NewLoginLimiter()
+
+	// Parallel attempts can't get past the limit, since each one is reserved before the password is checked
+	var wg sync.WaitGroup
+	var allowed int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if l.Attempt(3, time.Minute, "1.2.3.4", "testy") == 0 {
+				atomic.AddInt32(&allowed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	require.EqualValues(t, 3, allowed)
+	require.NotZero(t, l.Check(3, "5.6.7.8", "testy"))
+
+	// Successful attempts are refunded
+	l.Clear()
+	for i := 0; i < 5; i++ {
+		require.Zero(t, l.Attempt(3, time.Minute, "1.2.3.4", "testy"))
+		l.Refund("1.2.3.4", "testy")
+	}
+	require.Len(t, l.Blocked(3), 0)
+}
+
+func TestRateLimiter(t *testing.T) {
+	rl := NewRateLimiter()
+
+	for i := 0; i < 5; i++ {
+		require.Zero(t, rl.Allow("testy", 1, 5))
+	}
+	wait := rl.Allow("testy", 1, 5)
+	require.NotZero(t, wait)
+	require.True(t, wait <= time.Second)
+
+	// Other clients have their own buckets
+	require.Zero(t, rl.Allow("other", 1, 5))
+
+	b := rl.Blocked(1, 5)
+	require.Len(t, b, 1)
+	require.Equal(t, "testy", b[0].Client)
+
+	// A rate of 0 disables the limiter
+	require.Zero(t, rl.Allow("testy", 0, 5))
+}
+
+func TestLoginLimiterIPOnly(t *testing.T) {
+	l := NewLoginLimiter()
+
+	// Without a username, only the IP is limited
+	for i := 0; i < 3; i++ {
+		require.Zero(t, l.Attempt(3, time.Minute, "1.2.3.4", ""))
+	}
+	require.NotZero(t, l.Attempt(3, time.Minute, "1.2.3.4", ""))
+	require.Zero(t, l.Attempt(3, time.Minute, "5.6.7.8", ""))
+	require.Len(t, l.Blocked(3), 1)
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/heedy/heedy/backend/assets"
+)
+
+// ErrEmailDisabled is returned when trying to send email without an SMTP server configured
+var ErrEmailDisabled = errors.New("bad_request: Sending email is not set up on this server")
+
+// EmailEnabled returns whether heedy can send email
+func EmailEnabled(a *assets.Assets) bool {
+	addr, _, _, _ := a.Config.GetSMTP()
+	return addr != ""
+}
+
+// SendEmail sends a plain text email using the SMTP server in the configuration
+func SendEmail(a *assets.Assets, to, subject, body string) error {
+	addr, username, password, from := a.Config.GetSMTP()
+	if addr == "" {
+		return ErrEmailDisabled
+	}
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return errors.New("bad_request: Invalid email header")
+	}
+	var auth smtp.Auth
+	if username != "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s",
+		from, to, subject, time.Now().Format(time.RFC1123Z), strings.ReplaceAll(body, "\n", "\r\n"))
+	return smtp.SendMail(addr, auth, from, []string{to}, []byte(msg))
+}
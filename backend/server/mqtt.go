@@ -0,0 +1,207 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/heedy/heedy/backend/database"
+	"github.com/heedy/heedy/backend/events"
+	"github.com/heedy/heedy/backend/mqtt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// mqttObjectPrefix is the topic prefix for publishing directly to a timeseries by its object ID
+const mqttObjectPrefix = "heedy/objects/"
+
+// mqttEventPrefix is the topic prefix on which heedy events are published
+const mqttEventPrefix = "heedy/events/"
+
+// mqttEventBuffer is the number of events that can wait to be published before new events are dropped
+const mqttEventBuffer = 1000
+
+// MQTTBridge connects the embedded MQTT server to heedy. Clients authenticate with an app's access token
+// as the password, and messages they publish are inserted as datapoints into the app's timeseries.
+// Optionally, heedy events are published to clients that subscribe to them.
+type MQTTBridge struct {
+	Server *mqtt.Server
+
+	db     *database.AdminDB
+	rh     *RequestHandler
+	events chan *events.Event
+	done   chan struct{}
+}
+
+// NewMQTTBridge creates the MQTT server, which inserts data through the given request handler
+func NewMQTTBridge(db *database.AdminDB, rh *RequestHandler, publishEvents bool) *MQTTBridge {
+	b := &MQTTBridge{
+		db:   db,
+		rh:   rh,
+		done: make(chan struct{}),
+	}
+	b.Server = mqtt.NewServer(b)
+	if limit := db.Assets().Config.GetRequestBodyByteLimit(); limit > 0 {
+		b.Server.MaxPacketSize = int(limit)
+	}
+	if publishEvents {
+		b.events = make(chan *events.Event, mqttEventBuffer)
+		events.AddHandler(b)
+		go b.publishEvents()
+	}
+	return b
+}
+
+// Close disconnects all clients, and stops publishing events
+func (b *MQTTBridge) Close() error {
+	if b.events != nil {
+		events.RemoveHandler(b)
+	}
+	close(b.done)
+	return b.Server.Close()
+}
+
+// Connect authenticates the client with an app access token given as the password
+func (b *MQTTBridge) Connect(c *mqtt.Client, username, password string) (interface{}, error) {
+	if password == "" {
+		return nil, errors.New("no access token given")
+	}
+	app, err := b.db.GetAppByAccessToken(password)
+	if err != nil {
+		time.Sleep(time.Second)
+		return nil, err
+	}
+	if !*app.Enabled {
+		return nil, mqtt.ErrNotAuthorized
+	}
+	db := database.NewAppDB(b.db, app)
+	logrus.WithField("mqtt", c.ID).Debugf("MQTT client connected from %s as %s", c.RemoteAddr(), db.ID())
+	return db, nil
+}
+
+// Disconnect is called when a client disconnects
+func (b *MQTTBridge) Disconnect(c *mqtt.Client) {
+	logrus.WithField("mqtt", c.ID).Debug("MQTT client disconnected")
+}
+
+// Subscribe permits subscriptions if events are published
+func (b *MQTTBridge) Subscribe(c *mqtt.Client, filter string) bool {
+	return b.events != nil
+}
+
+// Publish inserts the message payload into the timeseries that the topic maps to
+func (b *MQTTBridge) Publish(c *mqtt.Client, topic string, payload []byte) error {
+	db := c.Session.(*database.AppDB)
+	id, err := b.topicObject(db, topic)
+	if err != nil {
+		return err
+	}
+	_, err = b.rh.Request(nil, "POST", fmt.Sprintf("/api/objects/%s/timeseries", id), MQTTDatapoints(payload, time.Now()), map[string]string{
+		"X-Heedy-As": db.ID(),
+	})
+	return err
+}
+
+// topicObject returns the ID of the timeseries that the topic maps to. Topics of the form heedy/objects/{objectid}
+// refer to an existing timeseries. All other topics map to the app's timeseries with the topic as its key,
+// which is created if it doesn't exist.
+func (b *MQTTBridge) topicObject(db database.DB, topic string) (string, error) {
+	if strings.HasPrefix(topic, mqttObjectPrefix) {
+		return topic[len(mqttObjectPrefix):], nil
+	}
+	if strings.HasPrefix(topic, "heedy/") {
+		return "", fmt.Errorf("bad_request: heedy/ topics are reserved")
+	}
+	self := "self"
+	otype := "timeseries"
+	objs, err := db.ListObjects(&database.ListObjectsOptions{
+		App:  &self,
+		Key:  &topic,
+		Type: &otype,
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(objs) > 0 {
+		return objs[0].ID, nil
+	}
+	return db.CreateObject(&database.Object{
+		Details: database.Details{
+			Name: &topic,
+		},
+		Type: &otype,
+		Key:  &topic,
+	})
+}
+
+// MQTTDatapoints converts an MQTT message payload to the datapoints to insert. A JSON object with "t" and "d" fields
+// (or an array of such objects) is inserted as is. Any other JSON value, or a payload that is not JSON, is inserted
+// as the data of a datapoint at the given time.
+func MQTTDatapoints(payload []byte, t time.Time) []map[string]interface{} {
+	now := float64(t.UnixNano()) * 1e-9
+	var v interface{}
+	if err := json.Unmarshal(payload, &v); err != nil {
+		return []map[string]interface{}{{"t": now, "d": string(payload)}}
+	}
+	isDatapoint := func(v interface{}) bool {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		_, hasT := m["t"]
+		_, hasD := m["d"]
+		return hasT && hasD
+	}
+	if isDatapoint(v) {
+		return []map[string]interface{}{v.(map[string]interface{})}
+	}
+	if a, ok := v.([]interface{}); ok && len(a) > 0 {
+		dpa := make([]map[string]interface{}, 0, len(a))
+		for _, dp := range a {
+			if !isDatapoint(dp) {
+				return []map[string]interface{}{{"t": now, "d": v}}
+			}
+			dpa = append(dpa, dp.(map[string]interface{}))
+		}
+		return dpa
+	}
+	return []map[string]interface{}{{"t": now, "d": v}}
+}
+
+// Fire queues the event to be published to MQTT clients. Events are dropped if clients can't keep up.
+func (b *MQTTBridge) Fire(e *events.Event) {
+	if e.Object == "" {
+		return
+	}
+	select {
+	case <-b.done:
+	case b.events <- e:
+	default:
+		logrus.Debugf("MQTT event buffer full, dropping %s event", e.Event)
+	}
+}
+
+// publishEvents publishes each object event to heedy/events/{objectid}/{event}, sending it only to clients whose app can read the object
+func (b *MQTTBridge) publishEvents() {
+	for {
+		var e *events.Event
+		select {
+		case <-b.done:
+			return
+		case e = <-b.events:
+		}
+		if b.Server.Clients() == 0 {
+			continue
+		}
+		payload, err := json.Marshal(e)
+		if err != nil {
+			continue
+		}
+		b.Server.Publish(mqttEventPrefix+e.Object+"/"+e.Event, payload, func(c *mqtt.Client) bool {
+			_, err := c.Session.(*database.AppDB).ReadObject(e.Object, &database.ReadObjectOptions{})
+			return err == nil
+		})
+	}
+}
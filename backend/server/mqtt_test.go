@@ -0,0 +1,22 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMQTTDatapoints(t *testing.T) {
+	now := time.Unix(100, 0)
+
+	require.Equal(t, []map[string]interface{}{{"t": 100.0, "d": 21.5}}, MQTTDatapoints([]byte("21.5"), now))
+	require.Equal(t, []map[string]interface{}{{"t": 100.0, "d": "ON"}}, MQTTDatapoints([]byte("ON"), now))
+	require.Equal(t, []map[string]interface{}{{"t": 100.0, "d": map[string]interface{}{"temperature": 20.0}}},
+		MQTTDatapoints([]byte(`{"temperature": 20}`), now))
+
+	// Datapoints are inserted as given
+	require.Equal(t, []map[string]interface{}{{"t": 5.0, "d": 1.0, "dt": 2.0}}, MQTTDatapoints([]byte(`{"t": 5, "d": 1, "dt": 2}`), now))
+	require.Equal(t, []map[string]interface{}{{"t": 5.0, "d": 1.0}, {"t": 6.0, "d": 2.0}}, MQTTDatapoints([]byte(`[{"t": 5, "d": 1}, {"t": 6, "d": 2}]`), now))
+	require.Equal(t, []map[string]interface{}{{"t": 100.0, "d": []interface{}{1.0, 2.0}}}, MQTTDatapoints([]byte(`[1, 2]`), now))
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/heedy/heedy/api/golang/rest"
+	"github.com/heedy/heedy/backend/assets"
+	"github.com/heedy/heedy/backend/database"
+)
+
+// passwordResetResponse holds a new password reset link, which can be sent to the user
+type passwordResetResponse struct {
+	Token   string  `json:"token"`
+	URL     string  `json:"url"`
+	Expires float64 `json:"expires"`
+}
+
+type passwordResetRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type passwordResetEmailRequest struct {
+	UserName string `json:"username"`
+}
+
+func passwordResetURL(a *assets.Assets, token string) string {
+	return fmt.Sprintf("%s/#/reset_password?token=%s", a.Config.GetURL(), url.QueryEscape(token))
+}
+
+// newPasswordReset creates a reset token for the user, returning the link to the reset page
+func newPasswordReset(db *database.AdminDB, username string) (*passwordResetResponse, error) {
+	expiration := db.Assets().Config.GetPasswordResetExpiration()
+	expires := time.Now().Add(expiration)
+	token, err := db.CreatePasswordReset(username, expiration)
+	if err != nil {
+		return nil, err
+	}
+	return &passwordResetResponse{
+		Token:   token,
+		URL:     passwordResetURL(db.Assets(), token),
+		Expires: float64(expires.UnixNano()) * 1e-9,
+	}, nil
+}
+
+// CreatePasswordReset allows admins to create a link that lets the user set a new password
+func CreatePasswordReset(w http.ResponseWriter, r *http.Request) {
+	c := rest.CTX(r)
+	a := c.DB.AdminDB().Assets()
+	if !isAdmin(c.DB, a) {
+		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("access_denied: Only admins can reset passwords"))
+		return
+	}
+	username, err := rest.URLParam(r, "username", nil)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	pr, err := newPasswordReset(c.DB.AdminDB(), username)
+	if err == nil {
+		c.Log.Infof("Created password reset link for %s", username)
+	}
+	rest.WriteJSON(w, r, pr, err)
+}
+
+// ServePasswordReset sets a new password using a reset token, logging the user out of all existing sessions
+func (a *Auth) ServePasswordReset(w http.ResponseWriter, r *http.Request) {
+	c := rest.CTX(r)
+	var pr passwordResetRequest
+	if err := rest.UnmarshalRequest(r, &pr); err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	username, err := a.DB.ResetPassword(pr.Token, pr.Password)
+	if err == nil {
+		c.Log.Infof("Reset password of %s", username)
+		a.logins.Succeed(username)
+	}
+	rest.WriteResult(w, r, err)
+}
+
+// ServePasswordResetEmail sends a password reset link to the email in the user's settings. To avoid revealing
+// which users exist, the response is the same whether or not an email was sent.
+func (a *Auth) ServePasswordResetEmail(w http.ResponseWriter, r *http.Request) {
+	c := rest.CTX(r)
+	if !EmailEnabled(a.DB.Assets()) {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, ErrEmailDisabled)
+		return
+	}
+	var er passwordResetEmailRequest
+	if err := rest.UnmarshalRequest(r, &er); err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	// Email requests are limited like logins, so that they can't be used to spam users. They have their own
+	// limiter, since counting them as failed logins would let anyone lock a user out of their account.
+	ip := clientIP(r)
+	attempts, lockout := a.DB.Assets().Config.GetLoginLimits()
+	if wait := a.resets.Attempt(attempts, lockout, ip, er.UserName); wait > 0 {
+		setRetryAfter(w, wait)
+		rest.WriteJSONError(w, r, http.StatusTooManyRequests, errors.New("too_many_requests: Too many requests, try again later"))
+		return
+	}
+
+	settings, err := a.DB.ReadUserPluginSettings(er.UserName, "heedy")
+	email, _ := settings["email"].(string)
+	if err != nil || email == "" {
+		c.Log.Warnf("Password reset requested for %s, who has no email", er.UserName)
+		rest.WriteResult(w, r, nil)
+		return
+	}
+	pr, err := newPasswordReset(a.DB, er.UserName)
+	if err != nil {
+		c.Log.Warnf("Password reset requested for %s: %s", er.UserName, err.Error())
+		rest.WriteResult(w, r, nil)
+		return
+	}
+	err = SendEmail(a.DB.Assets(), email, "Heedy Password Reset", fmt.Sprintf(`A password reset was requested for your heedy account %s. To set a new password, open the following link:
+
+%s
+
+The link expires at %s. If you didn't request a password reset, you can ignore this email.
+`, er.UserName, pr.URL, time.Unix(int64(pr.Expires), 0).Format(time.RFC1123)))
+	if err != nil {
+		c.Log.Errorf("Failed to send password reset email to %s: %s", er.UserName, err.Error())
+		rest.WriteResult(w, r, nil)
+		return
+	}
+	c.Log.Infof("Sent password reset email to %s", er.UserName)
+	rest.WriteResult(w, r, nil)
+}
@@ -0,0 +1,267 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/heedy/heedy/api/golang/rest"
+	"github.com/heedy/heedy/backend/assets"
+	"github.com/heedy/heedy/backend/database"
+)
+
+// registrationRequest is sent by a user signing up for an account
+type registrationRequest struct {
+	UserName string `json:"username"`
+	Name     string `json:"name,omitempty"`
+	Password string `json:"password"`
+
+	// The invite code, which is required unless registration is set to "approval" or "open"
+	Invite string `json:"invite,omitempty"`
+}
+
+type registrationResponse struct {
+	// Status is "created" if the user can log in, and "pending" if the account is waiting for an admin's approval
+	Status string `json:"status"`
+}
+
+// inviteResponse includes the link that can be sent to the invited user
+type inviteResponse struct {
+	*database.Invite
+	URL string `json:"url"`
+}
+
+func isAdmin(db database.DB, a *assets.Assets) bool {
+	return db.Type() == database.AdminType || a.Config.UserIsAdmin(db.ID())
+}
+
+func notificationsActive(a *assets.Assets) bool {
+	for _, p := range a.Config.GetActivePlugins() {
+		if p == "notifications" {
+			return true
+		}
+	}
+	return false
+}
+
+func registrationNotificationKey(username string) string {
+	return "registration:" + username
+}
+
+// notifyAdmins tells each admin that the user is waiting for approval, if the notifications plugin is active
+func notifyAdmins(c *rest.Context, a *assets.Assets, username string) {
+	if !notificationsActive(a) {
+		return
+	}
+	a.Config.RLock()
+	admins := []string{}
+	if a.Config.AdminUsers != nil {
+		admins = append(admins, *a.Config.AdminUsers...)
+	}
+	a.Config.RUnlock()
+	for _, admin := range admins {
+		_, err := c.Request(c, "POST", "/api/notifications", map[string]interface{}{
+			"key":         registrationNotificationKey(username),
+			"user":        admin,
+			"global":      true,
+			"title":       "New User Registration",
+			"description": fmt.Sprintf("**%s** signed up, and is waiting for approval.", username),
+			"actions": []map[string]interface{}{
+				{
+					"title": "Review",
+					"href":  "#/config/users",
+				},
+			},
+		}, map[string]string{"X-Heedy-As": "heedy"})
+		if err != nil {
+			c.Log.Warnf("Failed to notify admin %s of registration: %s", admin, err.Error())
+		}
+	}
+}
+
+// clearAdminNotifications removes the registration's notifications once an admin handled it
+func clearAdminNotifications(c *rest.Context, a *assets.Assets, username string) {
+	if !notificationsActive(a) {
+		return
+	}
+	q := url.Values{}
+	q.Set("user", "*")
+	q.Set("key", registrationNotificationKey(username))
+	_, err := c.Request(c, "DELETE", "/api/notifications?"+q.Encode(), nil, map[string]string{"X-Heedy-As": "heedy"})
+	if err != nil {
+		c.Log.Warnf("Failed to remove registration notifications for %s: %s", username, err.Error())
+	}
+}
+
+// ServeRegister creates a user account. Depending on the registration setting, the user needs an invite,
+// or the account waits for an admin's approval.
+func (a *Auth) ServeRegister(w http.ResponseWriter, r *http.Request) {
+	c := rest.CTX(r)
+	var rr registrationRequest
+	if err := rest.UnmarshalRequest(r, &rr); err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	cfg := a.DB.Assets().Config
+
+	// Each signup hashes a password, and in approval mode notifies the admins, so the signups from each IP
+	// are limited like logins. Successful signups count too, so that they can't be used to flood the admins.
+	attempts, lockout := cfg.GetLoginLimits()
+	if wait := a.registrations.Attempt(attempts, lockout, clientIP(r), ""); wait > 0 {
+		setRetryAfter(w, wait)
+		rest.WriteJSONError(w, r, http.StatusTooManyRequests, errors.New("too_many_requests: Too many signups, try again later"))
+		return
+	}
+	if cfg.UserIsForbidden(rr.UserName) {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, database.ErrUserExists)
+		return
+	}
+	u := &database.User{
+		UserName: &rr.UserName,
+		Password: &rr.Password,
+	}
+	if rr.Name != "" {
+		u.Name = &rr.Name
+	}
+
+	var err error
+	status := "created"
+	switch mode := cfg.GetRegistration(); {
+	case rr.Invite != "":
+		err = a.DB.RegisterUser(u, rr.Invite)
+	case mode == "open":
+		err = a.DB.CreateUser(u)
+	case mode == "approval":
+		status = "pending"
+		err = a.DB.AddRegistration(u)
+		if err == nil {
+			notifyAdmins(c, a.DB.Assets(), rr.UserName)
+		}
+	default:
+		err = database.ErrInvalidInvite
+	}
+	if err != nil {
+		rest.WriteJSON(w, r, nil, err)
+		return
+	}
+	c.Log.Infof("Registered user %s (%s)", rr.UserName, status)
+	rest.WriteJSON(w, r, &registrationResponse{Status: status}, nil)
+}
+
+func inviteURL(a *assets.Assets, code string) string {
+	return fmt.Sprintf("%s/#/register?invite=%s", a.Config.GetURL(), url.QueryEscape(code))
+}
+
+func ListInvites(w http.ResponseWriter, r *http.Request) {
+	db := rest.CTX(r).DB
+	a := db.AdminDB().Assets()
+	if !isAdmin(db, a) {
+		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("access_denied: Only admins can list invites"))
+		return
+	}
+	invites, err := db.AdminDB().ListInvites()
+	if err != nil {
+		rest.WriteJSON(w, r, nil, err)
+		return
+	}
+	res := make([]*inviteResponse, len(invites))
+	for i, inv := range invites {
+		res[i] = &inviteResponse{Invite: inv, URL: inviteURL(a, inv.Code)}
+	}
+	rest.WriteJSON(w, r, res, nil)
+}
+
+func CreateInvite(w http.ResponseWriter, r *http.Request) {
+	db := rest.CTX(r).DB
+	a := db.AdminDB().Assets()
+	if !isAdmin(db, a) {
+		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("access_denied: Only admins can create invites"))
+		return
+	}
+	var inv database.Invite
+	if err := rest.UnmarshalRequest(r, &inv); err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	inv.CreatedBy = db.ID()
+	if db.Type() == database.AdminType {
+		// Invites need an owning user, so invites created by heedy itself belong to the first admin
+		a.Config.RLock()
+		if a.Config.AdminUsers != nil && len(*a.Config.AdminUsers) > 0 {
+			inv.CreatedBy = (*a.Config.AdminUsers)[0]
+		}
+		a.Config.RUnlock()
+	}
+	if err := db.AdminDB().CreateInvite(&inv); err != nil {
+		rest.WriteJSON(w, r, nil, err)
+		return
+	}
+	rest.WriteJSON(w, r, &inviteResponse{Invite: &inv, URL: inviteURL(a, inv.Code)}, nil)
+}
+
+func DeleteInvite(w http.ResponseWriter, r *http.Request) {
+	db := rest.CTX(r).DB
+	a := db.AdminDB().Assets()
+	if !isAdmin(db, a) {
+		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("access_denied: Only admins can delete invites"))
+		return
+	}
+	code, err := rest.URLParam(r, "code", nil)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	rest.WriteResult(w, r, db.AdminDB().DelInvite(code))
+}
+
+func ListRegistrations(w http.ResponseWriter, r *http.Request) {
+	db := rest.CTX(r).DB
+	a := db.AdminDB().Assets()
+	if !isAdmin(db, a) {
+		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("access_denied: Only admins can list registrations"))
+		return
+	}
+	reg, err := db.AdminDB().ListRegistrations()
+	rest.WriteJSON(w, r, reg, err)
+}
+
+func ApproveRegistration(w http.ResponseWriter, r *http.Request) {
+	c := rest.CTX(r)
+	a := c.DB.AdminDB().Assets()
+	if !isAdmin(c.DB, a) {
+		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("access_denied: Only admins can approve registrations"))
+		return
+	}
+	username, err := rest.URLParam(r, "username", nil)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	err = c.DB.AdminDB().ApproveRegistration(username)
+	if err == nil {
+		c.Log.Infof("Approved registration of %s", username)
+		clearAdminNotifications(c, a, username)
+	}
+	rest.WriteResult(w, r, err)
+}
+
+func RejectRegistration(w http.ResponseWriter, r *http.Request) {
+	c := rest.CTX(r)
+	a := c.DB.AdminDB().Assets()
+	if !isAdmin(c.DB, a) {
+		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("access_denied: Only admins can reject registrations"))
+		return
+	}
+	username, err := rest.URLParam(r, "username", nil)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	err = c.DB.AdminDB().DelRegistration(username)
+	if err == nil {
+		c.Log.Infof("Rejected registration of %s", username)
+		clearAdminNotifications(c, a, username)
+	}
+	rest.WriteResult(w, r, err)
+}
@@ -0,0 +1,235 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heedy/heedy/api/golang/rest"
+	"github.com/heedy/heedy/backend/assets"
+	"github.com/heedy/heedy/backend/database"
+	"github.com/heedy/heedy/backend/plugins"
+	"github.com/heedy/heedy/backend/updater"
+
+	"github.com/sirupsen/logrus"
+)
+
+// configPollInterval is how often heedy.conf is checked for changes when watch_config is set
+const configPollInterval = 5 * time.Second
+
+// ConfigReloader reloads heedy.conf while heedy is running, applying the changes that don't require a restart
+type ConfigReloader struct {
+	sync.Mutex
+
+	a  *assets.Assets
+	pm *plugins.PluginManager
+
+	modtime time.Time
+	done    chan struct{}
+}
+
+// NewConfigReloader prepares reloading of the configuration. If watch_config is set, it starts
+// watching heedy.conf for changes.
+func NewConfigReloader(a *assets.Assets, pm *plugins.PluginManager) *ConfigReloader {
+	cr := &ConfigReloader{
+		a:    a,
+		pm:   pm,
+		done: make(chan struct{}),
+	}
+	cr.modtime = cr.modTime()
+	if a.Config.GetWatchConfig() {
+		go cr.watch()
+	}
+	return cr
+}
+
+func (cr *ConfigReloader) modTime() time.Time {
+	if fi, err := os.Stat(path.Join(cr.a.FolderPath, "heedy.conf")); err == nil {
+		return fi.ModTime()
+	}
+	return time.Time{}
+}
+
+// Reload loads heedy.conf from disk, and updates the running server with the options that can change without
+// a restart. Changes to all other options are returned as requiring a restart.
+func (cr *ConfigReloader) Reload() (*assets.ConfigChanges, error) {
+	cr.Lock()
+	defer cr.Unlock()
+	return cr.reload()
+}
+
+func (cr *ConfigReloader) reload() (*assets.ConfigChanges, error) {
+	cr.modtime = cr.modTime()
+	cc, err := cr.a.ReloadConfig()
+	if err != nil {
+		return nil, err
+	}
+	logrus.SetLevel(cr.a.Config.GetLogLevel())
+	if err = cr.pm.Reload(); err != nil {
+		return cc, err
+	}
+	if !cc.Changed() {
+		logrus.Info("Reloaded configuration: no changes")
+		return cc, nil
+	}
+	if len(cc.Applied) > 0 {
+		logrus.Infof("Reloaded configuration: updated %s", strings.Join(cc.Applied, ", "))
+	}
+	if len(cc.RestartRequired) > 0 {
+		logrus.Warnf("Heedy must be restarted for changes to take effect: %s", strings.Join(cc.RestartRequired, ", "))
+	}
+	return cc, nil
+}
+
+// Apply reloads the configuration staged in updates/heedy.conf by moving it into heedy.conf, if all of its changes
+// can be made without a restart. Otherwise, or if other updates are staged, the configuration stays staged until
+// heedy restarts, so that it is applied along with the rest of the update, and all of its changes are returned
+// as requiring a restart. If the staged configuration can't be loaded, heedy.conf is restored.
+func (cr *ConfigReloader) Apply() (*assets.ConfigChanges, error) {
+	cr.Lock()
+	defer cr.Unlock()
+	cc, err := cr.stagedChanges()
+	if err != nil {
+		return nil, err
+	}
+	if len(cc.RestartRequired) == 0 {
+		applied, prev, err := updater.ApplyConfig(cr.a.FolderPath)
+		if err != nil {
+			return nil, err
+		}
+		if applied {
+			cc, err = cr.reload()
+			if cc == nil {
+				if rerr := ioutil.WriteFile(path.Join(cr.a.FolderPath, "heedy.conf"), prev, 0664); rerr != nil {
+					logrus.Errorf("Failed to restore heedy.conf: %s", rerr.Error())
+				}
+				cr.modtime = cr.modTime()
+			}
+			return cc, err
+		}
+	}
+	cc.RestartRequired = append(cc.RestartRequired, cc.Applied...)
+	cc.Applied = []string{}
+	sort.Strings(cc.RestartRequired)
+	return cc, nil
+}
+
+// stagedChanges lists the differences between heedy.conf and the configuration staged in updates/heedy.conf
+func (cr *ConfigReloader) stagedChanges() (*assets.ConfigChanges, error) {
+	c, err := assets.LoadConfigFile(path.Join(cr.a.FolderPath, "heedy.conf"))
+	if err != nil {
+		return nil, err
+	}
+	nc, err := updater.ReadConfig(cr.a.FolderPath)
+	if err != nil {
+		return nil, err
+	}
+	return c.Update(nc), nil
+}
+
+func (cr *ConfigReloader) watch() {
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			cr.Lock()
+			changed := cr.modTime().After(cr.modtime)
+			cr.Unlock()
+			if changed {
+				if _, err := cr.Reload(); err != nil {
+					logrus.Errorf("Failed to reload configuration: %s", err.Error())
+				}
+			}
+		case <-cr.done:
+			return
+		}
+	}
+}
+
+// Close stops watching heedy.conf
+func (cr *ConfigReloader) Close() {
+	close(cr.done)
+}
+
+// ServeHTTP allows admins to reload the configuration, returning the list of changes
+func (cr *ConfigReloader) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := rest.CTX(r)
+	db := ctx.DB
+	if db.Type() != database.AdminType && !cr.a.Config.UserIsAdmin(db.ID()) {
+		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("access_denied: Only admins can reload the configuration"))
+		return
+	}
+	ctx.Log.Info("Configuration reload requested")
+	cc, err := cr.Reload()
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, errors.New("bad_request: "+err.Error()))
+		return
+	}
+	rest.WriteJSON(w, r, cc, nil)
+}
+
+func (cr *ConfigReloader) isAdmin(w http.ResponseWriter, r *http.Request) bool {
+	db := rest.CTX(r).DB
+	if db.Type() != database.AdminType && !cr.a.Config.UserIsAdmin(db.ID()) {
+		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("access_denied: Server settings are admin-only"))
+		return false
+	}
+	return true
+}
+
+// writeApply applies the configuration that was just staged, and returns the resulting changes
+func (cr *ConfigReloader) writeApply(w http.ResponseWriter, r *http.Request) {
+	cc, err := cr.Apply()
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, errors.New("bad_request: "+err.Error()))
+		return
+	}
+	rest.WriteJSON(w, r, cc, nil)
+}
+
+// PostConfigFile replaces heedy.conf, and applies the new configuration
+func (cr *ConfigReloader) PostConfigFile(w http.ResponseWriter, r *http.Request) {
+	if !cr.isAdmin(w, r) {
+		return
+	}
+	defer r.Body.Close()
+
+	//Limit requests to the limit given in configuration
+	b, err := ioutil.ReadAll(io.LimitReader(r.Body, cr.a.Config.GetRequestBodyByteLimit()))
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	if err = updater.SetConfigFile(cr.a.FolderPath, b); err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	cr.writeApply(w, r)
+}
+
+// PatchConfig modifies the options given in the request in heedy.conf, and applies the new configuration
+func (cr *ConfigReloader) PatchConfig(w http.ResponseWriter, r *http.Request) {
+	if !cr.isAdmin(w, r) {
+		return
+	}
+	defer r.Body.Close()
+
+	c := assets.NewConfiguration()
+	err := rest.UnmarshalRequest(r, c)
+	if err == nil {
+		err = updater.ModifyConfigFile(cr.a.FolderPath, c)
+	}
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	cr.writeApply(w, r)
+}
@@ -35,6 +35,9 @@ type RequestHandler struct {
 	// request.
 	sync.RWMutex
 	activeRequests map[string]*rest.Context
+
+	// Requests coming directly from users/apps are rate limited
+	limiter *RateLimiter
 }
 
 // NewRequestHandler generates a new Auth middleware
@@ -44,6 +47,7 @@ func NewRequestHandler(auth *Auth, p *plugins.PluginManager) *RequestHandler {
 		auth:           auth,
 		Plugins:        p,
 		activeRequests: make(map[string]*rest.Context),
+		limiter:        NewRateLimiter(),
 	}
 
 	return rh
@@ -162,6 +166,18 @@ func (a *RequestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 		c.DB = db
 		c.Log = c.Log.WithField("auth", db.ID())
+
+		// Anonymous requests are limited per IP address, since they all share the public database
+		client := db.ID()
+		if db.Type() == database.PublicType {
+			client = "public:" + clientIP(r)
+		}
+		rate, burst := a.auth.DB.Assets().Config.GetRateLimit()
+		if wait := a.limiter.Allow(client, rate, burst); wait > 0 {
+			setRetryAfter(w, wait)
+			rest.WriteJSONError(w, r, http.StatusTooManyRequests, errors.New("too_many_requests: Rate limit exceeded, try again later"))
+			return
+		}
 	}
 
 	c.Requester = a
@@ -195,3 +211,39 @@ func (a *RequestHandler) Request(c *rest.Context, method, path string, body inte
 
 	return run.Request(a, method, path, body, header)
 }
+
+// BlockedClients lists the clients that are currently locked out of logging in, requesting password reset
+// emails or signing up, or rate limited
+type BlockedClients struct {
+	Logins         []BlockedClient `json:"logins"`
+	PasswordResets []BlockedClient `json:"password_resets"`
+	Registrations  []BlockedClient `json:"registrations"`
+	Requests       []BlockedClient `json:"requests"`
+}
+
+// ServeBlocked allows admins to view the currently blocked clients (GET), and to unblock them (DELETE)
+func (a *RequestHandler) ServeBlocked(w http.ResponseWriter, r *http.Request) {
+	db := rest.CTX(r).DB
+	cfg := db.AdminDB().Assets().Config
+	if db.Type() != database.AdminType && !cfg.UserIsAdmin(db.ID()) {
+		rest.WriteJSONError(w, r, http.StatusForbidden, errors.New("access_denied: Only admins can view blocked clients"))
+		return
+	}
+	if r.Method == http.MethodDelete {
+		rest.CTX(r).Log.Info("Clearing login lockouts and rate limits")
+		a.auth.logins.Clear()
+		a.auth.resets.Clear()
+		a.auth.registrations.Clear()
+		a.limiter.Clear()
+		rest.WriteResult(w, r, nil)
+		return
+	}
+	attempts, _ := cfg.GetLoginLimits()
+	rate, burst := cfg.GetRateLimit()
+	rest.WriteJSON(w, r, &BlockedClients{
+		Logins:         a.auth.logins.Blocked(attempts),
+		PasswordResets: a.auth.resets.Blocked(attempts),
+		Registrations:  a.auth.registrations.Blocked(attempts),
+		Requests:       a.limiter.Blocked(rate, burst),
+	}, nil)
+}
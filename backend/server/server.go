@@ -1,6 +1,7 @@
 package server
 
 import (
+	"crypto/tls"
 	"errors"
 	"net"
 	"net/http"
@@ -8,6 +9,7 @@ import (
 	"os/signal"
 	"runtime"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/go-chi/chi"
@@ -60,13 +62,16 @@ func Run(a *assets.Assets, o *RunOptions) error {
 		return err
 	}
 
-	requestHandler := http.Handler(NewRequestHandler(auth, pm))
+	rh := NewRequestHandler(auth, pm)
+	requestHandler := http.Handler(rh)
 
 	if a.Config.Verbose {
 		logrus.Warn("Running in verbose mode")
 		requestHandler = VerboseLoggingMiddleware(requestHandler, nil)
 	}
 
+	logrus.SetLevel(a.Config.GetLogLevel())
+
 	err = nil
 
 	apiAddress := a.Config.GetAPI()
@@ -86,6 +91,42 @@ func Run(a *assets.Assets, o *RunOptions) error {
 		}),
 	}
 
+	var certs *CertReloader
+	tlsCert, tlsKey := a.Config.GetTLS()
+	if tlsCert != "" {
+		certs, err = NewCertReloader(a.Abs(tlsCert), a.Abs(tlsKey))
+		if err != nil {
+			db.Close()
+			return err
+		}
+		srv.TLSConfig = &tls.Config{
+			GetCertificate: certs.GetCertificate,
+		}
+		defer certs.Close()
+	}
+
+	// SIGHUP reloads heedy.conf and the certificate, so that config changes and certificate renewals
+	// can be picked up without restarting heedy
+	reloader := NewConfigReloader(a, pm)
+	defer reloader.Close()
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if certs != nil {
+				if err := certs.Reload(); err != nil {
+					logrus.Errorf("Failed to reload TLS certificate: %s", err.Error())
+				} else {
+					logrus.Info("Reloaded TLS certificate")
+				}
+			}
+			if _, err := reloader.Reload(); err != nil {
+				logrus.Errorf("Failed to reload configuration: %s", err.Error())
+			}
+		}
+	}()
+	defer signal.Stop(hup)
+
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
 	go func() {
@@ -123,6 +164,15 @@ func Run(a *assets.Assets, o *RunOptions) error {
 		rest.WriteResult(w, r, nil)
 	})
 
+	// Admins can reload heedy.conf without restarting, and config edits are applied the same way
+	mux.Post("/api/server/reload", reloader.ServeHTTP)
+	mux.Post("/api/server/updates/heedy.conf", reloader.PostConfigFile)
+	mux.Patch("/api/server/updates/config", reloader.PatchConfig)
+
+	// Admins can see which clients are locked out or rate limited
+	mux.Get("/api/server/blocked", rh.ServeBlocked)
+	mux.Delete("/api/server/blocked", rh.ServeBlocked)
+
 	// Now start the plugin API server in one thread, and load the plugins in another,
 	// after which open the listening socket
 
@@ -160,6 +210,9 @@ func Run(a *assets.Assets, o *RunOptions) error {
 		return err
 	}
 
+	// The trash is purged once plugins are running, so that they receive the delete events
+	tp := NewTrashPurger(db)
+
 	// Only start listening once the plugins are all loaded
 	logrus.Infof("Running heedy on %s", serverAddress)
 	var srvl net.Listener
@@ -170,16 +223,69 @@ func Run(a *assets.Assets, o *RunOptions) error {
 	}
 	if err != nil {
 		logrus.Errorf("Error starting heedy: %s", err)
+		tp.Close()
 		pm.Close()
 		apisrv.Close()
 		db.Close()
 		return err
 	}
 
-	serr := srv.Serve(srvl)
+	// The MQTT listener inserts data through the timeseries plugin, so it also waits for the plugins to load
+	var mqttBridge *MQTTBridge
+	if mqttAddress, publishEvents := a.Config.GetMQTT(); mqttAddress != "" {
+		mqttl, err := net.Listen("tcp", mqttAddress)
+		if err != nil {
+			logrus.Errorf("Error starting MQTT listener: %s", err)
+			srvl.Close()
+			tp.Close()
+			pm.Close()
+			apisrv.Close()
+			db.Close()
+			return err
+		}
+		if certs != nil {
+			mqttl = tls.NewListener(mqttl, srv.TLSConfig)
+		}
+		mqttBridge = NewMQTTBridge(db, rh, publishEvents)
+		go func() {
+			logrus.Infof("Running MQTT listener on %s", mqttAddress)
+			if merr := mqttBridge.Server.Serve(mqttl); merr != nil {
+				logrus.Errorf("MQTT Server Error: %s", merr)
+			}
+		}()
+	}
+
+	var redirectsrv *http.Server
+	if redirectAddress := a.Config.GetTLSRedirectAddr(); certs != nil && redirectAddress != "" {
+		redirectsrv = &http.Server{
+			Addr:    redirectAddress,
+			Handler: RedirectHandler(serverAddress),
+		}
+		go func() {
+			logrus.Infof("Redirecting http requests on %s to https", redirectAddress)
+			rerr := redirectsrv.ListenAndServe()
+			if rerr != http.ErrServerClosed {
+				logrus.Errorf("Redirect Server Error: %s", rerr)
+			}
+		}()
+	}
+
+	var serr error
+	if certs != nil {
+		serr = srv.ServeTLS(srvl, "", "")
+	} else {
+		serr = srv.Serve(srvl)
+	}
 	if serr != http.ErrServerClosed {
 		err = serr
 	}
+	if redirectsrv != nil {
+		redirectsrv.Close()
+	}
+	if mqttBridge != nil {
+		mqttBridge.Close()
+	}
+	tp.Close()
 	logrus.Info("Stopping plugins...")
 	pm.Close()
 	apisrv.Close()
@@ -35,6 +35,9 @@ type SetupContext struct {
 	Directory string                `json:"directory,omitempty"`
 	File      string                `json:"file,omitempty"`
 	User      SetupUser             `json:"user,omitempty"`
+
+	// SelfSignedTLS generates a self-signed certificate, and sets up heedy to serve https with it
+	SelfSignedTLS bool `json:"self_signed_tls,omitempty"`
 }
 
 func SetupCreate(sc SetupContext) error {
@@ -44,6 +47,13 @@ func SetupCreate(sc SetupContext) error {
 	// Make sure the user in context is added to admin users
 	sc.Config.AdminUsers = &[]string{sc.User.UserName}
 
+	if sc.SelfSignedTLS {
+		certFile := "server.crt"
+		keyFile := "server.key"
+		sc.Config.TLSCert = &certFile
+		sc.Config.TLSKey = &keyFile
+	}
+
 	logrus.Infof("Creating database in '%s'", sc.Directory)
 	a, err := assets.Create(sc.Directory, sc.Config, sc.File)
 	if err != nil {
@@ -53,6 +63,15 @@ func SetupCreate(sc SetupContext) error {
 	a.Config.Verbose = sc.Config.Verbose
 	assets.SetGlobal(a) // Set global assets
 
+	if sc.SelfSignedTLS {
+		certFile, keyFile := a.Config.GetTLS()
+		logrus.Info("Generating self-signed TLS certificate")
+		if err = GenerateSelfSignedCert(a.Abs(certFile), a.Abs(keyFile), CertHosts(a.Config.GetAddr(), *a.Config.URL)); err != nil {
+			os.RemoveAll(sc.Directory)
+			return err
+		}
+	}
+
 	if err = database.Create(a); err != nil {
 		os.RemoveAll(sc.Directory)
 		return err
@@ -160,6 +179,7 @@ func Setup(sc SetupContext, setupBind string) error {
 			return
 		}
 		scn.Directory = sc.Directory
+		scn.SelfSignedTLS = scn.SelfSignedTLS || sc.SelfSignedTLS
 
 		err = SetupCreate(scn)
 		if err != nil {
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/heedy/heedy/api/golang/rest"
+	"github.com/heedy/heedy/backend/database"
+)
+
+// readOwnedObject reads the object in the request's URL, making sure that it is owned by the requester.
+// Only the owner of an object and admins can manage its share links and ownership. The error message says that
+// the requester can't manage what.
+func readOwnedObject(w http.ResponseWriter, r *http.Request, what string) (*database.Object, bool) {
+	db := rest.CTX(r).DB
+	objectid, err := rest.URLParam(r, "objectid", nil)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return nil, false
+	}
+	o, err := db.ReadObject(objectid, nil)
+	if err != nil {
+		rest.WriteJSON(w, r, nil, err)
+		return nil, false
+	}
+	if !isAdmin(db, db.AdminDB().Assets()) && (db.Type() != database.UserType || db.ID() != *o.Owner) {
+		rest.WriteJSONError(w, r, http.StatusForbidden, database.ErrAccessDenied("Only the object's owner can manage %s", what))
+		return nil, false
+	}
+	return o, true
+}
+
+// ListShareLinks lists the share links of an object
+func ListShareLinks(w http.ResponseWriter, r *http.Request) {
+	o, ok := readOwnedObject(w, r, "its share links")
+	if !ok {
+		return
+	}
+	links, err := rest.CTX(r).DB.AdminDB().ListShareLinks(o.ID)
+	rest.WriteJSON(w, r, links, err)
+}
+
+// CreateShareLink creates a link that gives anyone with its token access to the object
+func CreateShareLink(w http.ResponseWriter, r *http.Request) {
+	c := rest.CTX(r)
+	o, ok := readOwnedObject(w, r, "its share links")
+	if !ok {
+		return
+	}
+	var l database.ShareLink
+	if err := rest.UnmarshalRequest(r, &l); err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	l.Object = o.ID
+	err := c.DB.AdminDB().CreateShareLink(&l, &o.Access)
+	if err == nil {
+		c.Log.Infof("Created share link %s to object %s", l.ID, o.ID)
+		rest.WriteJSON(w, r, &l, nil)
+		return
+	}
+	rest.WriteJSON(w, r, nil, err)
+}
+
+// DeleteShareLink revokes a share link of the object
+func DeleteShareLink(w http.ResponseWriter, r *http.Request) {
+	c := rest.CTX(r)
+	o, ok := readOwnedObject(w, r, "its share links")
+	if !ok {
+		return
+	}
+	linkid, err := rest.URLParam(r, "linkid", nil)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	err = c.DB.AdminDB().DelShareLink(o.ID, linkid)
+	if err == nil {
+		c.Log.Infof("Revoked share link %s to object %s", linkid, o.ID)
+	}
+	rest.WriteResult(w, r, err)
+}
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// certPollInterval is how often the certificate files are checked for changes
+const certPollInterval = 30 * time.Second
+
+// CertReloader holds the server's TLS certificate, and reloads it from disk when the files change,
+// so that renewed certificates are used without restarting heedy
+type CertReloader struct {
+	sync.RWMutex
+	certFile string
+	keyFile  string
+
+	cert    *tls.Certificate
+	modtime time.Time
+
+	done chan struct{}
+}
+
+// NewCertReloader loads the given certificate and key, and starts watching them for changes
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	cr := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		done:     make(chan struct{}),
+	}
+	if err := cr.Reload(); err != nil {
+		return nil, err
+	}
+	go cr.watch()
+	return cr, nil
+}
+
+// modTime returns the most recent modification time of the certificate and key files
+func (cr *CertReloader) modTime() time.Time {
+	var t time.Time
+	for _, f := range []string{cr.certFile, cr.keyFile} {
+		if fi, err := os.Stat(f); err == nil && fi.ModTime().After(t) {
+			t = fi.ModTime()
+		}
+	}
+	return t
+}
+
+// Reload reads the certificate and key from disk. If they fail to load, the previous certificate stays in use.
+func (cr *CertReloader) Reload() error {
+	modtime := cr.modTime()
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return err
+	}
+	cr.Lock()
+	cr.cert = &cert
+	cr.modtime = modtime
+	cr.Unlock()
+	return nil
+}
+
+func (cr *CertReloader) watch() {
+	ticker := time.NewTicker(certPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			cr.RLock()
+			changed := cr.modTime().After(cr.modtime)
+			cr.RUnlock()
+			if changed {
+				if err := cr.Reload(); err != nil {
+					logrus.Errorf("Failed to reload TLS certificate: %s", err.Error())
+				} else {
+					logrus.Info("Reloaded TLS certificate")
+				}
+			}
+		case <-cr.done:
+			return
+		}
+	}
+}
+
+// GetCertificate returns the current certificate. It is used as the GetCertificate function of tls.Config.
+func (cr *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.RLock()
+	defer cr.RUnlock()
+	return cr.cert, nil
+}
+
+// Close stops watching the certificate files
+func (cr *CertReloader) Close() {
+	close(cr.done)
+}
+
+// GenerateSelfSignedCert creates a self-signed certificate valid for the given hostnames and IP addresses,
+// and writes it along with its private key to the given files in PEM format.
+func GenerateSelfSignedCert(certFile, keyFile string, hosts []string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"heedy"},
+		},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(5, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if h != "" {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+	if len(template.DNSNames) > 0 {
+		template.Subject.CommonName = template.DNSNames[0]
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err = writePEM(certFile, "CERTIFICATE", der, 0644); err != nil {
+		return err
+	}
+	return writePEM(keyFile, "EC PRIVATE KEY", keyBytes, 0600)
+}
+
+func writePEM(filename, blockType string, b []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if err = pem.Encode(f, &pem.Block{Type: blockType, Bytes: b}); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// CertHosts returns the hostnames for which a self-signed certificate is generated, based on the
+// server's address and external URL.
+func CertHosts(addr, serverURL string) []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	addHost := func(h string) {
+		if h == "" {
+			return
+		}
+		for _, v := range hosts {
+			if v == h {
+				return
+			}
+		}
+		hosts = append(hosts, h)
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addHost(host)
+	}
+	if u, err := url.Parse(serverURL); err == nil {
+		addHost(u.Hostname())
+	}
+	if h, err := os.Hostname(); err == nil {
+		addHost(h)
+	}
+	return hosts
+}
+
+// RedirectHandler redirects all requests to https, on the requested host at the port of the https server
+func RedirectHandler(addr string) http.Handler {
+	_, port, _ := net.SplitHostPort(addr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
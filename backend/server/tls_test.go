@@ -0,0 +1,60 @@
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCertReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "heedy_tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+
+	_, err = NewCertReloader(certFile, keyFile)
+	require.Error(t, err)
+
+	require.NoError(t, GenerateSelfSignedCert(certFile, keyFile, CertHosts(":1324", "https://example.com:1324")))
+	cr, err := NewCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+	defer cr.Close()
+
+	c1, err := cr.GetCertificate(nil)
+	require.NoError(t, err)
+	require.NotNil(t, c1)
+
+	// A new certificate is picked up on reload
+	require.NoError(t, GenerateSelfSignedCert(certFile, keyFile, []string{"localhost"}))
+	require.NoError(t, cr.Reload())
+	c2, err := cr.GetCertificate(nil)
+	require.NoError(t, err)
+	require.False(t, bytes.Equal(c1.Certificate[0], c2.Certificate[0]))
+
+	// A broken certificate leaves the old one in place
+	require.NoError(t, ioutil.WriteFile(certFile, []byte("invalid"), 0644))
+	require.Error(t, cr.Reload())
+	c3, err := cr.GetCertificate(nil)
+	require.NoError(t, err)
+	require.Equal(t, c2, c3)
+}
+
+func TestRedirectHandler(t *testing.T) {
+	r := httptest.NewRequest("GET", "http://example.com/api/users?q=1", nil)
+	w := httptest.NewRecorder()
+	RedirectHandler(":1324").ServeHTTP(w, r)
+	require.Equal(t, http.StatusMovedPermanently, w.Code)
+	require.Equal(t, "https://example.com:1324/api/users?q=1", w.Header().Get("Location"))
+
+	w = httptest.NewRecorder()
+	RedirectHandler(":443").ServeHTTP(w, r)
+	require.Equal(t, "https://example.com/api/users?q=1", w.Header().Get("Location"))
+}
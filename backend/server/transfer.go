@@ -0,0 +1,151 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/heedy/heedy/api/golang/rest"
+	"github.com/heedy/heedy/backend/database"
+)
+
+// readUserTransfer reads the pending transfer of the object in the request's URL, which must be to or from
+// the user in the URL. It can be managed by the user and admins.
+func readUserTransfer(w http.ResponseWriter, r *http.Request) (string, *database.ObjectTransfer, bool) {
+	db := rest.CTX(r).DB
+	username, err := rest.URLParam(r, "username", nil)
+	objectid, err := rest.URLParam(r, "objectid", err)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return "", nil, false
+	}
+	if !isUser(db, username) && !isAdmin(db, db.AdminDB().Assets()) {
+		rest.WriteJSONError(w, r, http.StatusForbidden, database.ErrAccessDenied("Only the user and admins can manage the user's object transfers"))
+		return "", nil, false
+	}
+	t, err := db.AdminDB().ReadObjectTransfer(objectid)
+	if err == nil && t.From != username && t.To != username {
+		err = database.ErrNotFound
+	}
+	if err != nil {
+		rest.WriteJSON(w, r, nil, err)
+		return "", nil, false
+	}
+	return username, t, true
+}
+
+// ListObjectTransfers lists the pending transfers of objects to and from the user
+func ListObjectTransfers(w http.ResponseWriter, r *http.Request) {
+	db := rest.CTX(r).DB
+	username, err := rest.URLParam(r, "username", nil)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if !isUser(db, username) && !isAdmin(db, db.AdminDB().Assets()) {
+		rest.WriteJSONError(w, r, http.StatusForbidden, database.ErrAccessDenied("Only the user and admins can list the user's object transfers"))
+		return
+	}
+	transfers, err := db.AdminDB().ListObjectTransfers(username)
+	rest.WriteJSON(w, r, transfers, err)
+}
+
+// AcceptObjectTransfer gives the object to the user, who must be the recipient of its pending transfer.
+// Only the recipient can accept a transfer.
+func AcceptObjectTransfer(w http.ResponseWriter, r *http.Request) {
+	c := rest.CTX(r)
+	username, t, ok := readUserTransfer(w, r)
+	if !ok {
+		return
+	}
+	if t.To != username || !isUser(c.DB, username) {
+		rest.WriteJSONError(w, r, http.StatusForbidden, database.ErrAccessDenied("Only %s can accept the transfer", t.To))
+		return
+	}
+	err := c.DB.AdminDB().AcceptObjectTransfer(t.Object, t.To)
+	if err == nil {
+		c.Log.Infof("Transferred object %s from %s to %s", t.Object, t.From, t.To)
+	}
+	rest.WriteResult(w, r, err)
+}
+
+// RejectObjectTransfer removes a pending transfer to or from the user
+func RejectObjectTransfer(w http.ResponseWriter, r *http.Request) {
+	c := rest.CTX(r)
+	_, t, ok := readUserTransfer(w, r)
+	if !ok {
+		return
+	}
+	err := c.DB.AdminDB().DelObjectTransfer(t.Object)
+	if err == nil {
+		c.Log.Infof("Removed transfer of object %s to %s", t.Object, t.To)
+	}
+	rest.WriteResult(w, r, err)
+}
+
+// ReadObjectTransfer returns the pending transfer of the object
+func ReadObjectTransfer(w http.ResponseWriter, r *http.Request) {
+	o, ok := readOwnedObject(w, r, "its ownership")
+	if !ok {
+		return
+	}
+	t, err := rest.CTX(r).DB.AdminDB().ReadObjectTransfer(o.ID)
+	rest.WriteJSON(w, r, t, err)
+}
+
+// RequestObjectTransfer asks another user to take ownership of the object
+func RequestObjectTransfer(w http.ResponseWriter, r *http.Request) {
+	c := rest.CTX(r)
+	o, ok := readOwnedObject(w, r, "its ownership")
+	if !ok {
+		return
+	}
+	var t database.ObjectTransfer
+	if err := rest.UnmarshalRequest(r, &t); err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	err := c.DB.AdminDB().RequestObjectTransfer(o.ID, t.To)
+	if err == nil {
+		c.Log.Infof("Requested transfer of object %s to %s", o.ID, t.To)
+	}
+	rest.WriteResult(w, r, err)
+}
+
+// CancelObjectTransfer removes the pending transfer of the object
+func CancelObjectTransfer(w http.ResponseWriter, r *http.Request) {
+	c := rest.CTX(r)
+	o, ok := readOwnedObject(w, r, "its ownership")
+	if !ok {
+		return
+	}
+	err := c.DB.AdminDB().DelObjectTransfer(o.ID)
+	if err == nil {
+		c.Log.Infof("Cancelled transfer of object %s", o.ID)
+	}
+	rest.WriteResult(w, r, err)
+}
+
+// MoveObject moves the object to another app of its owner, or detaches it from its app
+func MoveObject(w http.ResponseWriter, r *http.Request) {
+	c := rest.CTX(r)
+	o, ok := readOwnedObject(w, r, "its ownership")
+	if !ok {
+		return
+	}
+	var m struct {
+		App *string `json:"app"`
+		Key *string `json:"key"`
+	}
+	if err := rest.UnmarshalRequest(r, &m); err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	err := c.DB.AdminDB().MoveObjectToApp(o.ID, m.App, m.Key)
+	if err == nil {
+		if m.App == nil {
+			c.Log.Infof("Detached object %s from its app", o.ID)
+		} else {
+			c.Log.Infof("Moved object %s to app %s", o.ID, *m.App)
+		}
+	}
+	rest.WriteResult(w, r, err)
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"time"
+
+	"github.com/heedy/heedy/backend/database"
+	"github.com/sirupsen/logrus"
+)
+
+// trashPurgeInterval is how often the trash is checked for expired objects and apps
+const trashPurgeInterval = time.Hour
+
+// TrashPurger periodically removes objects and apps that have been in the trash for
+// longer than the configured trash_retention
+type TrashPurger struct {
+	db   *database.AdminDB
+	done chan struct{}
+}
+
+// NewTrashPurger starts the background purge of the trash
+func NewTrashPurger(db *database.AdminDB) *TrashPurger {
+	tp := &TrashPurger{
+		db:   db,
+		done: make(chan struct{}),
+	}
+	go tp.run()
+	return tp
+}
+
+// Purge permanently deletes everything in the trash older than the configured retention
+func (tp *TrashPurger) Purge() {
+	err := tp.db.PurgeTrash(tp.db.Assets().Config.GetTrashRetention())
+	if err != nil {
+		logrus.Errorf("Failed to purge trash: %s", err.Error())
+	}
+}
+
+func (tp *TrashPurger) run() {
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+	tp.Purge()
+	for {
+		select {
+		case <-ticker.C:
+			tp.Purge()
+		case <-tp.done:
+			return
+		}
+	}
+}
+
+// Close stops the background purge
+func (tp *TrashPurger) Close() {
+	close(tp.done)
+}
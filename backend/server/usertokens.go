@@ -0,0 +1,76 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/heedy/heedy/api/golang/rest"
+	"github.com/heedy/heedy/backend/database"
+)
+
+// isUser returns whether the request was made by the given user while logged in, and not through an app or token
+func isUser(db database.DB, username string) bool {
+	return db.Type() == database.UserType && db.ID() == username
+}
+
+// ListUserTokens lists the user's personal access tokens, which is allowed for the user and admins
+func ListUserTokens(w http.ResponseWriter, r *http.Request) {
+	db := rest.CTX(r).DB
+	username, err := rest.URLParam(r, "username", nil)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if !isUser(db, username) && !isAdmin(db, db.AdminDB().Assets()) {
+		rest.WriteJSONError(w, r, http.StatusForbidden, database.ErrAccessDenied("Only the user and admins can list the user's access tokens"))
+		return
+	}
+	tokens, err := db.AdminDB().ListUserTokens(username)
+	rest.WriteJSON(w, r, tokens, err)
+}
+
+// CreateUserToken creates a personal access token. Only the user can create their own tokens.
+func CreateUserToken(w http.ResponseWriter, r *http.Request) {
+	c := rest.CTX(r)
+	username, err := rest.URLParam(r, "username", nil)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if !isUser(c.DB, username) {
+		rest.WriteJSONError(w, r, http.StatusForbidden, database.ErrAccessDenied("Only the user can create their access tokens"))
+		return
+	}
+	var t database.UserToken
+	if err = rest.UnmarshalRequest(r, &t); err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	t.Owner = username
+	err = c.DB.AdminDB().CreateUserToken(&t)
+	if err == nil {
+		c.Log.Infof("Created access token %s", t.ID)
+		rest.WriteJSON(w, r, &t, nil)
+		return
+	}
+	rest.WriteJSON(w, r, nil, err)
+}
+
+// DeleteUserToken revokes a personal access token of the user, which is allowed for the user and admins
+func DeleteUserToken(w http.ResponseWriter, r *http.Request) {
+	c := rest.CTX(r)
+	username, err := rest.URLParam(r, "username", nil)
+	tokenid, err := rest.URLParam(r, "tokenid", err)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if !isUser(c.DB, username) && !isAdmin(c.DB, c.DB.AdminDB().Assets()) {
+		rest.WriteJSONError(w, r, http.StatusForbidden, database.ErrAccessDenied("Only the user and admins can revoke the user's access tokens"))
+		return
+	}
+	err = c.DB.AdminDB().DelUserToken(username, tokenid)
+	if err == nil {
+		c.Log.Infof("Revoked access token %s of %s", tokenid, username)
+	}
+	rest.WriteResult(w, r, err)
+}
@@ -1,6 +1,7 @@
 package updater
 
 import (
+	"io/ioutil"
 	"os"
 	"path"
 
@@ -35,3 +36,34 @@ func RevertConfig(configDir, backupDir, revertDir string) error {
 
 	return ShiftFiles(backupHeedy, configHeedy, revertHeedy)
 }
+
+// ApplyConfig moves a staged heedy.conf into place, so that it can be reloaded without restarting heedy.
+// If other updates are staged, the config stays staged with them, since they are all applied on restart.
+// It returns whether the config was applied, along with the previous heedy.conf, so that it can be restored
+// if the new config fails to load.
+func ApplyConfig(configDir string) (bool, []byte, error) {
+	configHeedy := path.Join(configDir, "heedy.conf")
+	updateDir := path.Join(configDir, "updates")
+	updateHeedy := path.Join(updateDir, "heedy.conf")
+
+	d, err := ioutil.ReadDir(updateDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil, nil
+		}
+		return false, nil, err
+	}
+	if len(d) != 1 || d[0].Name() != "heedy.conf" {
+		return false, nil, nil
+	}
+
+	prev, err := ioutil.ReadFile(configHeedy)
+	if err != nil {
+		return false, nil, err
+	}
+	logrus.Info("Updating heedy.conf")
+	if err = os.Rename(updateHeedy, configHeedy); err != nil {
+		return false, nil, err
+	}
+	return true, prev, os.Remove(updateDir)
+}
@@ -109,3 +109,34 @@ func TestBackupData(t *testing.T) {
 	require.Equal(t, string(b), "blah")
 
 }
+
+func TestApplyConfig(t *testing.T) {
+	logrus.SetLevel(logrus.DebugLevel)
+	require.NoError(t, os.MkdirAll("./tester/updates/plugins/testy", 0775))
+	defer os.RemoveAll("./tester")
+
+	ioutil.WriteFile("./tester/heedy.conf", []byte("current"), 0664)
+	ioutil.WriteFile("./tester/updates/heedy.conf", []byte("next"), 0664)
+
+	// The config stays staged while a plugin update is staged with it
+	applied, _, err := ApplyConfig("tester")
+	require.NoError(t, err)
+	require.False(t, applied)
+	b, err := ioutil.ReadFile("./tester/heedy.conf")
+	require.NoError(t, err)
+	require.Equal(t, "current", string(b))
+
+	require.NoError(t, os.RemoveAll("./tester/updates/plugins"))
+	applied, prev, err := ApplyConfig("tester")
+	require.NoError(t, err)
+	require.True(t, applied)
+	require.Equal(t, "current", string(prev))
+	b, err = ioutil.ReadFile("./tester/heedy.conf")
+	require.NoError(t, err)
+	require.Equal(t, "next", string(b))
+	require.False(t, Available("tester"))
+
+	applied, _, err = ApplyConfig("tester")
+	require.NoError(t, err)
+	require.False(t, applied)
+}
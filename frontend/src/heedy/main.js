@@ -5,6 +5,8 @@ import Theme from "./main/theme.vue";
 
 import AboutPage from "./main/about.vue";
 import Login from "./main/login.vue";
+import Register from "./main/register.vue";
+import ResetPassword from "./main/reset_password.vue";
 import Logout from "./main/logout.vue";
 
 import ConfigPage from "./main/config/index.vue";
@@ -229,6 +231,14 @@ function setup(frontend) {
       path: "/login",
       component: Login,
     });
+    frontend.addRoute({
+      path: "/register",
+      component: Register,
+    });
+    frontend.addRoute({
+      path: "/reset_password",
+      component: ResetPassword,
+    });
 
     frontend.addMenuItem({
       key: "about",
@@ -3,8 +3,10 @@ package dashboard
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/heedy/heedy/api/golang/rest"
 	"github.com/heedy/heedy/backend/assets"
@@ -13,6 +15,7 @@ import (
 	"github.com/heedy/heedy/backend/events"
 	"github.com/heedy/heedy/backend/plugins/run"
 	"github.com/mitchellh/mapstructure"
+	"github.com/robfig/cron/v3"
 	"github.com/sirupsen/logrus"
 	"github.com/xeipuuv/gojsonschema"
 )
@@ -23,6 +26,9 @@ type DashboardSettings struct {
 		QuerySchema    map[string]interface{} `mapstructure:"query_schema"`
 		FrontendSchema map[string]interface{} `mapstructure:"frontend_schema"`
 	} `mapstructure:"types"`
+
+	RefreshConcurrency int    `mapstructure:"refresh_concurrency"`
+	MinRefreshInterval string `mapstructure:"min_refresh_interval"`
 }
 
 type DashboardType struct {
@@ -66,6 +72,14 @@ type DashboardProcessor struct {
 	// The actively waiting dashboards are set here
 	sync.Mutex
 	active map[string][]chan []byte
+
+	// Elements with a refresh schedule are re-queried by the scheduler, with at most
+	// cap(refreshing) queries running at once
+	minRefresh   time.Duration
+	scheduler    *cron.Cron
+	refreshing   chan struct{}
+	scheduleLock sync.Mutex
+	scheduled    map[string]*scheduledElement
 }
 
 // Dashboard is a global variable that is initialized with NewDashboardProcessor when the plugin is set up
@@ -103,11 +117,26 @@ func NewDashboardProcessor(db *database.AdminDB, p *assets.Plugin, h HandlerGett
 		dTypes[t] = &dt
 	}
 
+	if ds.RefreshConcurrency <= 0 {
+		ds.RefreshConcurrency = 2
+	}
+	minRefresh := time.Minute
+	if ds.MinRefreshInterval != "" {
+		minRefresh, err = time.ParseDuration(ds.MinRefreshInterval)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid min_refresh_interval: %w", err)
+		}
+	}
+
 	return &DashboardProcessor{
-		ADB:    db,
-		Types:  dTypes,
-		active: make(map[string][]chan []byte),
-		h:      h,
+		ADB:        db,
+		Types:      dTypes,
+		active:     make(map[string][]chan []byte),
+		h:          h,
+		minRefresh: minRefresh,
+		scheduler:  cron.New(cron.WithChain(cron.SkipIfStillRunning(cron.PrintfLogger(logrus.StandardLogger())))),
+		refreshing: make(chan struct{}, ds.RefreshConcurrency),
+		scheduled:  make(map[string]*scheduledElement),
 	}, nil
 }
 
@@ -193,10 +222,14 @@ func (dp *DashboardProcessor) Query(as string, oid string, eid string, etype str
 		data, err = qresult.Data.MarshalJSON()
 	}
 	haderror := false
+	var lastError *string
 	if err != nil {
 		haderror = true
 		data, _ = json.Marshal(rest.NewErrorResponse(err))
+		errstring := err.Error()
+		lastError = &errstring
 	}
+	lastRun := float64(time.Now().UnixNano()) * 1e-9
 
 	tx, err := dp.ADB.Beginx()
 	if err != nil {
@@ -250,7 +283,7 @@ func (dp *DashboardProcessor) Query(as string, oid string, eid string, etype str
 	}
 
 	// Update the element in the database
-	res, err := tx.Exec(`UPDATE dashboard_elements SET outdated=?,data=? WHERE object_id=? AND element_id=?`, haderror, CompressedJSON(data), oid, eid)
+	res, err := tx.Exec(`UPDATE dashboard_elements SET outdated=?,data=?,last_run=?,last_error=? WHERE object_id=? AND element_id=?`, haderror, CompressedJSON(data), lastRun, lastError, oid, eid)
 	err = database.GetExecError(res, err)
 	if err != nil {
 		tx.Rollback()
@@ -272,6 +305,8 @@ func (dp *DashboardProcessor) UpdateElement(as string, de *DashboardElement) (ch
 		data, _ := dp.Query(as, de.ObjectID, de.ID, de.Type, q)
 		jt := CompressedJSON(data)
 		de.Data = &jt
+		// Get the status of the query that was just run
+		dp.ADB.Get(de, `SELECT last_run,last_error FROM dashboard_elements WHERE object_id=? AND element_id=?;`, de.ObjectID, de.ID)
 		c <- false
 	}()
 	return c, nil
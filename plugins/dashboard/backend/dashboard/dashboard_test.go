@@ -5,10 +5,12 @@ import (
 	"os"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/heedy/heedy/api/golang/rest"
 	"github.com/heedy/heedy/backend/assets"
 	"github.com/heedy/heedy/backend/database"
+	"github.com/heedy/heedy/backend/database/dbutil"
 	"github.com/heedy/heedy/backend/plugins/run"
 	"github.com/jmoiron/sqlx/types"
 	"github.com/stretchr/testify/require"
@@ -204,3 +206,142 @@ func TestCRUD(t *testing.T) {
 	require.Len(t, da, 0)
 
 }
+
+func TestRefresh(t *testing.T) {
+	adb, oid1, _, cleanup := newDBWithObjects(t)
+	defer cleanup()
+
+	emptyObject := types.JSONText("{}")
+	zeroObject := types.JSONText("0")
+	tooOften := "10s"
+	invalid := "not a schedule"
+	interval := "5m"
+	cronExpr := "0 * * * *"
+	noRefresh := ""
+
+	for _, r := range []*string{&tooOften, &invalid} {
+		require.Error(t, WriteDashboard(adb, "test", oid1, []DashboardElement{
+			{
+				Type:     "test",
+				Query:    &zeroObject,
+				Settings: &emptyObject,
+				Refresh:  r,
+			},
+		}))
+	}
+
+	require.NoError(t, WriteDashboard(adb, "test", oid1, []DashboardElement{
+		{
+			ID:       "myelement",
+			Type:     "test",
+			Query:    &zeroObject,
+			Settings: &emptyObject,
+			Refresh:  &interval,
+		},
+	}))
+	require.Len(t, Dashboard.scheduled, 1)
+	require.Equal(t, interval, Dashboard.scheduled[oid1+"/myelement"].Refresh)
+
+	de, err := ReadDashboardElement(adb, "test", oid1, "myelement", true)
+	require.NoError(t, err)
+	require.Equal(t, interval, *de.Refresh)
+	require.NotNil(t, de.LastRun)
+	require.Nil(t, de.LastError)
+	lastRun := *de.LastRun
+
+	// A refresh re-runs the query, even though the element is not outdated
+	require.NoError(t, Dashboard.Refresh(oid1, "myelement"))
+	de, err = ReadDashboardElement(adb, "test", oid1, "myelement", false)
+	require.NoError(t, err)
+	require.Nil(t, de.Refresh)
+	require.True(t, *de.LastRun > lastRun)
+	b, err := de.Data.MarshalJSON()
+	require.NoError(t, err)
+	require.Equal(t, "1", string(b))
+
+	require.NoError(t, WriteDashboard(adb, "test", oid1, []DashboardElement{{ID: "myelement", Refresh: &cronExpr}}))
+	require.Equal(t, cronExpr, Dashboard.scheduled[oid1+"/myelement"].Refresh)
+	require.NoError(t, WriteDashboard(adb, "test", oid1, []DashboardElement{{ID: "myelement", Refresh: &noRefresh}}))
+	require.Len(t, Dashboard.scheduled, 0)
+	de, err = ReadDashboardElement(adb, "test", oid1, "myelement", true)
+	require.NoError(t, err)
+	require.Nil(t, de.Refresh)
+
+	// Elements with a schedule are loaded when the scheduler starts
+	require.NoError(t, WriteDashboard(adb, "test", oid1, []DashboardElement{{ID: "myelement", Refresh: &interval}}))
+	Dashboard.Schedule(oid1, "myelement", "")
+	require.NoError(t, Dashboard.StartScheduler())
+	defer Dashboard.scheduler.Stop()
+	require.Len(t, Dashboard.scheduled, 1)
+
+	// Deleting the element removes its schedule
+	require.NoError(t, DeleteDashboardElement(adb, oid1, "myelement"))
+	require.Len(t, Dashboard.scheduled, 0)
+	require.Equal(t, database.ErrNotFound, Dashboard.Refresh(oid1, "myelement"))
+}
+
+func TestParseRefresh(t *testing.T) {
+	dp := &DashboardProcessor{minRefresh: 5 * time.Minute}
+
+	for _, r := range []string{"5m", "1h", "@every 10m", "@hourly", "*/5 * * * *", "0 9,17 * * 1-5", "0 0 29 2 *"} {
+		_, err := dp.ParseRefresh(r)
+		require.NoError(t, err, r)
+	}
+	// Cron expressions are not allowed to have any runs closer together than the minimum interval
+	for _, r := range []string{"1m", "@every 1m", "* * * * *", "0,1 * * * *", "0,58 0,23 * * *", "0 9 * * *x"} {
+		_, err := dp.ParseRefresh(r)
+		require.Error(t, err, r)
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	adb, oid1, _, cleanup := newDBWithObjects(t)
+	defer cleanup()
+
+	// The test template is defined by the dashboardtest plugin, so it is only available while the plugin is active
+	templates, err := ListTemplates(adb.Assets())
+	require.NoError(t, err)
+	require.Len(t, templates, 0)
+	adb.Assets().Config.ActivePlugins = &[]string{"dashboardtest"}
+	templates, err = ListTemplates(adb.Assets())
+	require.NoError(t, err)
+	require.Len(t, templates, 1)
+	require.Equal(t, "dashboardtest.test", templates[0].ID)
+	require.Equal(t, "Test Dashboard", templates[0].Name)
+	require.Len(t, templates[0].Elements, 2)
+
+	require.Equal(t, ErrTemplateNotFound, WriteTemplate(adb, "test", oid1, "test", "dashboardtest.notatemplate", nil))
+	// There is no steps object yet
+	require.Error(t, WriteTemplate(adb, "test", oid1, "test", "dashboardtest.test", nil))
+
+	owner := "test"
+	name := "steps"
+	tags := dbutil.StringArray{Strings: []string{"steps", "health"}}
+	otype := "dashboard"
+	steps, err := adb.CreateObject(&database.Object{
+		Details: database.Details{
+			Name: &name,
+		},
+		Owner: &owner,
+		Tags:  &tags,
+		Type:  &otype,
+	})
+	require.NoError(t, err)
+
+	// The sleep object is optional, so only the first element is created
+	require.NoError(t, WriteTemplate(adb, "test", oid1, "test", "dashboardtest.test", nil))
+	da, err := ReadDashboard(adb, "test", oid1, true)
+	require.NoError(t, err)
+	require.Len(t, da, 1)
+	require.Equal(t, "Steps", *da[0].Title)
+	require.JSONEq(t, `{"object": "`+steps+`"}`, string(*da[0].Settings))
+
+	// Objects can also be given explicitly
+	require.NoError(t, WriteTemplate(adb, "test", oid1, "test", "dashboardtest.test", map[string]string{"sleep": oid1}))
+	da, err = ReadDashboard(adb, "test", oid1, true)
+	require.NoError(t, err)
+	require.Len(t, da, 3)
+	require.JSONEq(t, `{"objects": ["`+oid1+`","`+steps+`"]}`, string(*da[2].Settings))
+	require.Equal(t, "1h", *da[2].Refresh)
+	require.Error(t, WriteTemplate(adb, "test", oid1, "test", "dashboardtest.test", map[string]string{"sleep": "notanobject"}))
+}
@@ -32,6 +32,16 @@ func StartDashboard(db *database.AdminDB, i *run.Info, h run.BuiltinHelper) erro
 	// Set up the event handler
 	events.AddHandler(Dashboard)
 
+	// Start refreshing the elements that have a refresh schedule
+	return Dashboard.StartScheduler()
+}
+
+// StopDashboard stops the scheduled refreshes of dashboard elements, and removes the event handler
+func StopDashboard(db *database.AdminDB, apikey string) error {
+	if Dashboard != nil {
+		events.RemoveHandler(Dashboard)
+		Dashboard.StopScheduler()
+	}
 	return nil
 }
 
@@ -41,8 +51,15 @@ func init() {
 	run.Builtin.Add(&run.BuiltinRunner{
 		Key:     PluginName,
 		Start:   StartDashboard,
+		Stop:    StopDashboard,
 		Handler: Handler,
 	})
 	// Runs schema creation on database create instead of on first start
 	database.AddCreateHook(run.WithNilInfo(dbUpdate))
+
+	database.AddObjectStorage(database.StorageTable{
+		Table:  "dashboard_elements",
+		Column: "object_id",
+		Size:   "LENGTH(title)+LENGTH(query)+COALESCE(LENGTH(data),0)+LENGTH(settings)",
+	})
 }
@@ -108,16 +108,48 @@ func WriteElementHandler(w http.ResponseWriter, r *http.Request) {
 	rest.WriteResult(w, r, err)
 }
 
+type templateRequest struct {
+	Template string            `json:"template"`
+	Objects  map[string]string `json:"objects,omitempty"`
+}
+
+// WriteTemplateHandler adds the elements of a dashboard template to the dashboard
+func WriteTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	oi, ok := validateRequest(w, r, "write")
+	if !ok {
+		return
+	}
+	c := rest.CTX(r)
+	var tr templateRequest
+	err := rest.UnmarshalRequest(r, &tr)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	err = WriteTemplate(c.DB, oi.AsObject(), oi.ID, oi.Owner, tr.Template, tr.Objects)
+	rest.WriteResult(w, r, err)
+}
+
+// ListTemplatesHandler returns the dashboard templates defined by plugins
+func ListTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	c := rest.CTX(r)
+	t, err := ListTemplates(c.DB.AdminDB().Assets())
+	rest.WriteJSON(w, r, t, err)
+}
+
 // Handler is the global router for the timeseries API
 var Handler = func() *chi.Mux {
 	m := chi.NewMux()
 
 	m.Get("/object/dashboard", ReadHandler)
 	m.Post("/object/dashboard", WriteHandler)
+	m.Post("/object/dashboard/template", WriteTemplateHandler)
 	m.Get("/object/dashboard/{element_id}", ReadElementHandler)
 	m.Patch("/object/dashboard/{element_id}", WriteElementHandler)
 	m.Delete("/object/dashboard/{element_id}", DeleteElementHandler)
 
+	m.Get("/api/dashboard/templates", ListTemplatesHandler)
+
 	m.NotFound(rest.NotFoundHandler)
 	m.MethodNotAllowed(rest.NotFoundHandler)
 
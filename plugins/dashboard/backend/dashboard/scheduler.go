@@ -0,0 +1,177 @@
+package dashboard
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/heedy/heedy/backend/database"
+	"github.com/heedy/heedy/backend/events"
+	"github.com/robfig/cron/v3"
+	"github.com/sirupsen/logrus"
+)
+
+// refreshParser parses cron expressions in the standard 5-field format, as well as descriptors such as @hourly
+var refreshParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// Cron expressions can have runs at uneven intervals, so the gaps between the runs of a refresh schedule
+// are checked over refreshWindow, or for the first refreshChecks runs, whichever comes first
+const (
+	refreshWindow = 366 * 24 * time.Hour
+	refreshChecks = 2000
+)
+
+// scheduledElement is a dashboard element that is refreshed by the scheduler
+type scheduledElement struct {
+	dp       *DashboardProcessor
+	ObjectID string `db:"object_id"`
+	ID       string `db:"element_id"`
+	Refresh  string `db:"refresh"`
+
+	eid cron.EntryID
+}
+
+// Run re-runs the element's query, waiting for a free slot if the maximum number of refreshes is already running
+func (se *scheduledElement) Run() {
+	se.dp.refreshing <- struct{}{}
+	defer func() {
+		<-se.dp.refreshing
+	}()
+	err := se.dp.Refresh(se.ObjectID, se.ID)
+	if err == database.ErrNotFound {
+		// The element or its dashboard was deleted
+		se.dp.Schedule(se.ObjectID, se.ID, "")
+		return
+	}
+	if err != nil {
+		logrus.Errorf("Failed to refresh dashboard element %s/%s: %v", se.ObjectID, se.ID, err)
+	}
+}
+
+// ParseRefresh parses the refresh schedule of an element, which is either an interval such as "30m",
+// or a cron expression. Schedules that would refresh more often than min_refresh_interval are not allowed.
+func (dp *DashboardProcessor) ParseRefresh(refresh string) (cron.Schedule, error) {
+	if d, err := time.ParseDuration(refresh); err == nil {
+		if d < dp.minRefresh {
+			return nil, fmt.Errorf("The refresh interval must be at least %s", dp.minRefresh)
+		}
+		return cron.Every(d), nil
+	}
+	s, err := refreshParser.Parse(refresh)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid refresh schedule '%s': %w", refresh, err)
+	}
+	t := s.Next(time.Now())
+	end := t.Add(refreshWindow)
+	for i := 0; i < refreshChecks && t.Before(end); i++ {
+		next := s.Next(t)
+		if next.IsZero() {
+			// There are no more runs
+			break
+		}
+		if next.Sub(t) < dp.minRefresh {
+			return nil, fmt.Errorf("The refresh interval must be at least %s", dp.minRefresh)
+		}
+		t = next
+	}
+	return s, nil
+}
+
+// Schedule sets the refresh schedule of the given element, replacing any existing schedule.
+// An empty refresh removes the element from the scheduler.
+func (dp *DashboardProcessor) Schedule(oid, eid, refresh string) {
+	key := oid + "/" + eid
+	dp.scheduleLock.Lock()
+	defer dp.scheduleLock.Unlock()
+	se, ok := dp.scheduled[key]
+	if ok {
+		if se.Refresh == refresh {
+			return
+		}
+		dp.scheduler.Remove(se.eid)
+		delete(dp.scheduled, key)
+	}
+	if refresh == "" {
+		return
+	}
+	s, err := dp.ParseRefresh(refresh)
+	if err != nil {
+		// Schedules are validated when written, so this only happens if min_refresh_interval was increased
+		logrus.Warnf("Not refreshing dashboard element %s: %v", key, err)
+		return
+	}
+	se = &scheduledElement{
+		dp:       dp,
+		ObjectID: oid,
+		ID:       eid,
+		Refresh:  refresh,
+	}
+	se.eid = dp.scheduler.Schedule(s, se)
+	dp.scheduled[key] = se
+	logrus.Debugf("Scheduled refresh of dashboard element %s (%s)", key, refresh)
+}
+
+// StartScheduler schedules all elements that have a refresh schedule, and starts running them in the background
+func (dp *DashboardProcessor) StartScheduler() error {
+	var elements []scheduledElement
+	err := dp.ADB.Select(&elements, `SELECT object_id,element_id,refresh FROM dashboard_elements WHERE refresh IS NOT NULL;`)
+	if err != nil {
+		return err
+	}
+	for _, se := range elements {
+		dp.Schedule(se.ObjectID, se.ID, se.Refresh)
+	}
+	dp.scheduler.Start()
+	return nil
+}
+
+// StopScheduler stops refreshing elements, waiting for any refreshes that are already running to finish
+func (dp *DashboardProcessor) StopScheduler() {
+	<-dp.scheduler.Stop().Done()
+}
+
+// Refresh re-runs the query of the given element as the owner of its dashboard, firing dashboard_element_update once done.
+// Elements of dashboards in the trash are not refreshed.
+func (dp *DashboardProcessor) Refresh(oid, eid string) error {
+	var de struct {
+		Type    string  `db:"type"`
+		Query   []byte  `db:"query"`
+		Owner   string  `db:"owner"`
+		App     *string `db:"app"`
+		Trashed bool    `db:"trashed"`
+	}
+	err := dp.ADB.Get(&de, `SELECT dashboard_elements.type,dashboard_elements.query,objects.owner,objects.app,objects.deleted_date IS NOT NULL AS trashed FROM dashboard_elements
+						JOIN objects ON (dashboard_elements.object_id=objects.id)
+						WHERE dashboard_elements.object_id=? AND dashboard_elements.element_id=?;`, oid, eid)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return database.ErrNotFound
+		}
+		return err
+	}
+	if de.Trashed {
+		// The schedule is kept, so that refreshes continue if the dashboard is restored
+		return nil
+	}
+	as := de.Owner
+	if de.App != nil {
+		as += "/" + *de.App
+	}
+	logrus.Debugf("Refreshing dashboard element %s/%s", oid, eid)
+	if _, err = dp.Query(as, oid, eid, de.Type, de.Query); err != nil {
+		return err
+	}
+	evt := &events.Event{
+		Event:  "dashboard_element_update",
+		Object: oid,
+		Data: map[string]interface{}{
+			"element_id":   eid,
+			"element_type": de.Type,
+		},
+	}
+	if err = database.FillEvent(dp.ADB, evt); err != nil {
+		return err
+	}
+	events.Fire(evt)
+	return nil
+}
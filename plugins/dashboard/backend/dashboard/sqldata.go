@@ -14,7 +14,7 @@ import (
 	"github.com/klauspost/compress/zstd"
 )
 
-var SQLVersion = 1
+var SQLVersion = 2
 
 const sqlSchema = `
 
@@ -40,6 +40,12 @@ CREATE TABLE dashboard_elements (
 	-- Settings for displaying the data on the frontend
 	settings BLOB NOT NULL,
 
+	-- An interval or cron expression on which the query is re-run in the background
+	refresh VARCHAR DEFAULT NULL,
+	-- The time the query was last run, and the error it gave, if any
+	last_run REAL DEFAULT NULL,
+	last_error VARCHAR DEFAULT NULL,
+
 	PRIMARY KEY (object_id,element_id),
 
 	CONSTRAINT all_valid CHECK (json_valid(query) AND json_valid(settings)),
@@ -75,6 +81,13 @@ CREATE TABLE dashboard_events (
 CREATE INDEX events_idx ON dashboard_events(event_object_id,event);
 `
 
+// sqlUpgrade1 adds refresh schedules to version 1 of the dashboard schema
+const sqlUpgrade1 = `
+ALTER TABLE dashboard_elements ADD COLUMN refresh VARCHAR DEFAULT NULL;
+ALTER TABLE dashboard_elements ADD COLUMN last_run REAL DEFAULT NULL;
+ALTER TABLE dashboard_elements ADD COLUMN last_error VARCHAR DEFAULT NULL;
+`
+
 // SQLUpdater is in the format expected by Heedy to update the database
 func SQLUpdater(db *database.AdminDB, i *run.Info, h run.BuiltinHelper, curversion int) error {
 	if curversion == SQLVersion {
@@ -83,6 +96,10 @@ func SQLUpdater(db *database.AdminDB, i *run.Info, h run.BuiltinHelper, curversi
 	if curversion >= SQLVersion {
 		return errors.New("Dashboard database version too new")
 	}
+	if curversion == 1 {
+		_, err := db.ExecUncached(sqlUpgrade1)
+		return err
+	}
 	_, err := db.ExecUncached(sqlSchema)
 	return err
 }
@@ -140,6 +157,13 @@ type DashboardElement struct {
 	Type     string `json:"type,omitempty" db:"type"`
 	OnDemand *bool  `json:"on_demand,omitempty" db:"on_demand"`
 
+	// Refresh is an interval (such as "30m") or cron expression on which the query is re-run in the background.
+	// Writing an empty string removes the schedule.
+	Refresh *string `json:"refresh,omitempty" db:"refresh"`
+	// LastRun is the unix time at which the query was last run, and LastError is the error it gave
+	LastRun   *float64 `json:"last_run,omitempty" db:"last_run"`
+	LastError *string  `json:"last_error,omitempty" db:"last_error"`
+
 	Title    *string         `json:"title,omitempty"`
 	Query    *types.JSONText `json:"query,omitempty"`
 	Data     *CompressedJSON `json:"data,omitempty"`
@@ -186,6 +210,7 @@ func ReadDashboard(adb *database.AdminDB, as string, oid string, include_query b
 		for i := range elements {
 			elements[i].Query = nil
 			elements[i].OnDemand = nil
+			elements[i].Refresh = nil
 		}
 	}
 
@@ -206,6 +231,11 @@ func WriteDashboard(adb *database.AdminDB, as string, oid string, elements []Das
 				return fmt.Errorf("Can't create dashboard element without a type")
 			}
 		}
+		if el.Refresh != nil && *el.Refresh != "" {
+			if _, err := Dashboard.ParseRefresh(*el.Refresh); err != nil {
+				return err
+			}
+		}
 
 	}
 
@@ -235,12 +265,14 @@ func WriteDashboard(adb *database.AdminDB, as string, oid string, elements []Das
 	// Prepare an array of events to fire and dashboard queries to initiate
 	requery := make([]*DashboardElement, 0)
 	evts := make([]*events.Event, 0)
+	// The refresh schedules to set once the transaction is committed
+	schedules := make(map[string]string)
 
 	for _, el := range elements {
 		if el.ID != "" {
 			// If there is an ID, check if the element already exists
 			var de DashboardElement
-			err = adb.Get(&de, `SELECT element_id,element_index,type,on_demand,query,settings,title FROM dashboard_elements WHERE element_id=? AND object_id=?;`, el.ID, oid)
+			err = adb.Get(&de, `SELECT element_id,object_id,element_index,type,on_demand,query,settings,title,refresh FROM dashboard_elements WHERE element_id=? AND object_id=?;`, el.ID, oid)
 			if err == nil {
 				// The element exists
 				if el.Type == "" {
@@ -282,6 +314,10 @@ func WriteDashboard(adb *database.AdminDB, as string, oid string, elements []Das
 				if el.Title != nil {
 					de.Title = el.Title
 				}
+				if el.Refresh != nil {
+					de.Refresh = refreshValue(el.Refresh)
+					schedules[el.ID] = *el.Refresh
+				}
 				if el.Index != nil {
 					// We are setting the index of a dashboard element, so make sure that the indices of all elements
 					// are shifted correctly
@@ -314,9 +350,10 @@ func WriteDashboard(adb *database.AdminDB, as string, oid string, elements []Das
 							settings=?,
 							query=?,
 							on_demand=?,
+							refresh=?,
 							element_index=?,outdated=?
 						WHERE element_id=? AND object_id=?;`,
-					de.Title, de.Type, de.Settings, de.Query, de.OnDemand, de.Index, de.Outdated, el.ID, oid)
+					de.Title, de.Type, de.Settings, de.Query, de.OnDemand, de.Refresh, de.Index, de.Outdated, el.ID, oid)
 				err = database.GetExecError(res, err)
 				if err != nil {
 					tx.Rollback()
@@ -396,8 +433,13 @@ func WriteDashboard(adb *database.AdminDB, as string, oid string, elements []Das
 			}
 		}
 
-		res, err := tx.Exec(`INSERT INTO dashboard_elements(title,type,settings,query,on_demand,element_index,data,outdated,object_id,element_id) VALUES (?,?,?,?,?,?,NULL,TRUE,?,?);`,
-			el.Title, el.Type, el.Settings, el.Query, el.OnDemand, el.Index, oid, el.ID)
+		el.Refresh = refreshValue(el.Refresh)
+		if el.Refresh != nil {
+			schedules[el.ID] = *el.Refresh
+		}
+
+		res, err := tx.Exec(`INSERT INTO dashboard_elements(title,type,settings,query,on_demand,refresh,element_index,data,outdated,object_id,element_id) VALUES (?,?,?,?,?,?,?,NULL,TRUE,?,?);`,
+			el.Title, el.Type, el.Settings, el.Query, el.OnDemand, el.Refresh, el.Index, oid, el.ID)
 		err = database.GetExecError(res, err)
 		if err != nil {
 			tx.Rollback()
@@ -421,6 +463,9 @@ func WriteDashboard(adb *database.AdminDB, as string, oid string, elements []Das
 	if err != nil {
 		return err
 	}
+	for eid, refresh := range schedules {
+		Dashboard.Schedule(oid, eid, refresh)
+	}
 	for i := range requery {
 		e := requery[i]
 		// Dispatch requery requests for all of the objects that are being changed which are not ondemand
@@ -474,6 +519,7 @@ func ReadDashboardElement(adb *database.AdminDB, as string, oid string, deid str
 	if !include_query {
 		de.Query = nil
 		de.OnDemand = nil
+		de.Refresh = nil
 	}
 
 	return &de, nil
@@ -512,7 +558,16 @@ func DeleteDashboardElement(adb *database.AdminDB, oid string, deid string) erro
 
 	err = tx.Commit()
 	if err == nil {
+		Dashboard.Schedule(oid, deid, "")
 		events.Fire(evt)
 	}
 	return err
 }
+
+// refreshValue returns the refresh schedule to store in the database, with an empty schedule stored as NULL
+func refreshValue(refresh *string) *string {
+	if refresh == nil || *refresh == "" {
+		return nil
+	}
+	return refresh
+}
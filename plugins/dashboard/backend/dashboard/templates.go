@@ -0,0 +1,266 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/heedy/heedy/backend/assets"
+	"github.com/heedy/heedy/backend/database"
+	"github.com/jmoiron/sqlx/types"
+	"github.com/mitchellh/mapstructure"
+)
+
+// ErrTemplateNotFound is returned when instantiating a template that doesn't exist
+var ErrTemplateNotFound = errors.New("not_found: The dashboard template was not found")
+
+// templateVariable matches the placeholders in template elements that are replaced with object IDs, such as {{sleep}}
+var templateVariable = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// TemplateObject selects the object that a template refers to by name. The first of the user's
+// objects that matches all of the given fields is used.
+type TemplateObject struct {
+	Tags *string `mapstructure:"tags" json:"tags,omitempty"`
+	Type *string `mapstructure:"type" json:"type,omitempty"`
+	Key  *string `mapstructure:"key" json:"key,omitempty"`
+
+	// Elements that refer to an optional object are left out if the object is not found
+	Optional bool `mapstructure:"optional" json:"optional,omitempty"`
+}
+
+// TemplateElement is a dashboard element whose title, query and settings can refer to the template's objects
+type TemplateElement struct {
+	Type     string      `mapstructure:"type" json:"type"`
+	Title    string      `mapstructure:"title" json:"title,omitempty"`
+	Query    interface{} `mapstructure:"query" json:"query"`
+	Settings interface{} `mapstructure:"settings" json:"settings,omitempty"`
+	OnDemand *bool       `mapstructure:"on_demand" json:"on_demand,omitempty"`
+	Refresh  string      `mapstructure:"refresh" json:"refresh,omitempty"`
+}
+
+// Template is a dashboard definition that refers to objects by tag, type or key instead of ID,
+// so that the same dashboard can be created for any user. Plugins define templates in the
+// dashboard_templates field of their configuration.
+type Template struct {
+	// ID is the plugin and template name, such as "fitbit.sleep"
+	ID          string `mapstructure:"-" json:"id"`
+	Plugin      string `mapstructure:"-" json:"plugin"`
+	Name        string `mapstructure:"name" json:"name"`
+	Description string `mapstructure:"description" json:"description,omitempty"`
+	Icon        string `mapstructure:"icon" json:"icon,omitempty"`
+
+	Objects  map[string]TemplateObject `mapstructure:"objects" json:"objects"`
+	Elements []TemplateElement         `mapstructure:"elements" json:"elements,omitempty"`
+}
+
+// Templates returns the dashboard templates defined by the dashboard plugin and all active plugins
+func Templates(a *assets.Assets) (map[string]*Template, error) {
+	plugins := append([]string{PluginName}, a.Config.GetActivePlugins()...)
+	res := make(map[string]*Template)
+	for _, pname := range plugins {
+		p, ok := a.Config.Plugins[pname]
+		if !ok || p.Config == nil {
+			continue
+		}
+		dt, ok := p.Config["dashboard_templates"]
+		if !ok {
+			continue
+		}
+		var templates map[string]*Template
+		if err := mapstructure.Decode(dt, &templates); err != nil {
+			return nil, fmt.Errorf("%s: invalid dashboard_templates: %w", pname, err)
+		}
+		for tname, t := range templates {
+			t.Plugin = pname
+			t.ID = pname + "." + tname
+			if t.Name == "" {
+				t.Name = tname
+			}
+			if err := t.validate(); err != nil {
+				return nil, fmt.Errorf("%s: %w", t.ID, err)
+			}
+			res[t.ID] = t
+		}
+	}
+	return res, nil
+}
+
+// ReadTemplate returns the template with the given ID
+func ReadTemplate(a *assets.Assets, id string) (*Template, error) {
+	templates, err := Templates(a)
+	if err != nil {
+		return nil, err
+	}
+	t, ok := templates[id]
+	if !ok {
+		return nil, ErrTemplateNotFound
+	}
+	return t, nil
+}
+
+// ListTemplates returns all templates, sorted by ID
+func ListTemplates(a *assets.Assets) ([]*Template, error) {
+	templates, err := Templates(a)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*Template, 0, len(templates))
+	for _, t := range templates {
+		res = append(res, t)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID < res[j].ID
+	})
+	return res, nil
+}
+
+// variables returns the names of the objects that the element refers to
+func (te *TemplateElement) variables() ([]string, error) {
+	b, err := json.Marshal([]interface{}{te.Title, te.Query, te.Settings})
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, m := range templateVariable.FindAllSubmatch(b, -1) {
+		res = append(res, string(m[1]))
+	}
+	return res, nil
+}
+
+func (t *Template) validate() error {
+	for name, o := range t.Objects {
+		if o.Tags == nil && o.Type == nil && o.Key == nil {
+			return fmt.Errorf("object '%s' needs tags, type or key", name)
+		}
+	}
+	for _, te := range t.Elements {
+		if te.Type == "" {
+			return errors.New("element without a type")
+		}
+		if te.Query == nil {
+			return errors.New("element without a query")
+		}
+		vars, err := te.variables()
+		if err != nil {
+			return err
+		}
+		for _, v := range vars {
+			if _, ok := t.Objects[v]; !ok {
+				return fmt.Errorf("element refers to undefined object '%s'", v)
+			}
+		}
+	}
+	return nil
+}
+
+// Resolve finds the template's objects among those belonging to owner that are accessible to db.
+// Objects given in the objects map are used instead of searching for them.
+func (t *Template) Resolve(db database.DB, owner string, objects map[string]string) (map[string]string, error) {
+	limit := 1
+	res := make(map[string]string)
+	for name, o := range t.Objects {
+		if id, ok := objects[name]; ok {
+			if _, err := db.ReadObject(id, nil); err != nil {
+				return nil, err
+			}
+			res[name] = id
+			continue
+		}
+		ol, err := db.ListObjects(&database.ListObjectsOptions{
+			Owner: &owner,
+			Tags:  o.Tags,
+			Type:  o.Type,
+			Key:   o.Key,
+			Limit: &limit,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(ol) == 0 {
+			if o.Optional {
+				continue
+			}
+			return nil, fmt.Errorf("not_found: No object was found for '%s' of dashboard template %s", name, t.ID)
+		}
+		res[name] = ol[0].ID
+	}
+	return res, nil
+}
+
+// Instantiate returns the template's dashboard elements with references replaced by the given object IDs.
+// Elements that refer to an object missing from objects are left out.
+func (t *Template) Instantiate(objects map[string]string) ([]DashboardElement, error) {
+	res := make([]DashboardElement, 0, len(t.Elements))
+	for _, te := range t.Elements {
+		vars, err := te.variables()
+		if err != nil {
+			return nil, err
+		}
+		missing := false
+		for _, v := range vars {
+			if _, ok := objects[v]; !ok {
+				missing = true
+			}
+		}
+		if missing {
+			continue
+		}
+		replace := func(s string) string {
+			return templateVariable.ReplaceAllStringFunc(s, func(m string) string {
+				return objects[templateVariable.FindStringSubmatch(m)[1]]
+			})
+		}
+
+		settings := te.Settings
+		if settings == nil {
+			settings = map[string]interface{}{}
+		}
+		q, err := json.Marshal(te.Query)
+		if err != nil {
+			return nil, err
+		}
+		s, err := json.Marshal(settings)
+		if err != nil {
+			return nil, err
+		}
+		query := types.JSONText(replace(string(q)))
+		settingsText := types.JSONText(replace(string(s)))
+		title := replace(te.Title)
+		de := DashboardElement{
+			Type:     te.Type,
+			Title:    &title,
+			Query:    &query,
+			Settings: &settingsText,
+			OnDemand: te.OnDemand,
+		}
+		if te.Refresh != "" {
+			refresh := te.Refresh
+			de.Refresh = &refresh
+		}
+		res = append(res, de)
+	}
+	return res, nil
+}
+
+// WriteTemplate adds the elements of the given template to the end of a dashboard, with objects
+// found among those belonging to the dashboard's owner
+func WriteTemplate(db database.DB, as string, oid string, owner string, templateID string, objects map[string]string) error {
+	t, err := ReadTemplate(db.AdminDB().Assets(), templateID)
+	if err != nil {
+		return err
+	}
+	resolved, err := t.Resolve(db, owner, objects)
+	if err != nil {
+		return err
+	}
+	elements, err := t.Instantiate(resolved)
+	if err != nil {
+		return err
+	}
+	if len(elements) == 0 {
+		return fmt.Errorf("not_found: None of the objects used by dashboard template %s were found", t.ID)
+	}
+	return WriteDashboard(db.AdminDB(), as, oid, elements)
+}
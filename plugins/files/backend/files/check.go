@@ -0,0 +1,52 @@
+package files
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/heedy/heedy/backend/database"
+)
+
+// CheckFiles confirms that the content of each file exists in the file store with the recorded size.
+// Files whose content is missing are repaired by removing the content, which leaves the object empty.
+func CheckFiles(db *database.AdminDB, repair bool) ([]*database.CheckProblem, error) {
+	// The table is only created once the plugin runs
+	var exists bool
+	if err := db.Get(&exists, "SELECT COUNT(*) > 0 FROM sqlite_master WHERE type='table' AND name='files';"); err != nil || !exists {
+		return nil, err
+	}
+	// The check can run from the command line, where the plugin was not started
+	if FS.DB == nil {
+		if err := Configure(db); err != nil {
+			return nil, err
+		}
+	}
+	var files []*File
+	if err := db.Select(&files, "SELECT * FROM files;"); err != nil {
+		return nil, err
+	}
+	problems := []*database.CheckProblem{}
+	for _, f := range files {
+		p := &database.CheckProblem{
+			Check:  "files",
+			Object: f.ObjectID,
+		}
+		info, err := os.Stat(FS.blobPath(f.SHA256))
+		if err != nil {
+			p.Description = fmt.Sprintf("The file's content can't be read: %s", err.Error())
+			if os.IsNotExist(err) {
+				p.Description = "The file's content is missing"
+				p.Repair = "Remove the file's content, leaving the object empty"
+			}
+		} else if info.Size() != f.Size {
+			p.Description = fmt.Sprintf("The file's content has %d bytes, but %d bytes were uploaded", info.Size(), f.Size)
+		} else {
+			continue
+		}
+		p.RepairWith(repair, func() error {
+			return FS.Delete(f.ObjectID)
+		})
+		problems = append(problems, p)
+	}
+	return problems, nil
+}
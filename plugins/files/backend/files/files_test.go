@@ -0,0 +1,273 @@
+package files
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/heedy/heedy/backend/assets"
+	"github.com/heedy/heedy/backend/database"
+	"github.com/heedy/heedy/backend/database/dbutil"
+	"github.com/heedy/heedy/backend/events"
+	"github.com/stretchr/testify/require"
+)
+
+func newDBWithFiles(t *testing.T) (*database.AdminDB, string, string, func()) {
+	a, err := assets.Open("", nil)
+	require.NoError(t, err)
+	os.RemoveAll("./test_db")
+	a.FolderPath = "./test_db"
+	sqla := "sqlite3://heedy.db?_journal=WAL&_fk=1"
+	a.Config.SQL = &sqla
+	assets.SetGlobal(a)
+	cleanup := func() {
+		os.RemoveAll("./test_db")
+	}
+
+	err = database.Create(a)
+	if err != nil {
+		cleanup()
+	}
+	require.NoError(t, err)
+	db, err := database.Open(a)
+	require.NoError(t, err)
+
+	FS = FileStore{
+		DB:          db,
+		Dir:         filepath.Join(a.DataDir(), "files"),
+		MaxFileSize: 100,
+	}
+
+	name := "test"
+	passwd := "test"
+	require.NoError(t, db.CreateUser(&database.User{
+		UserName: &name,
+		Password: &passwd,
+	}))
+	otype := "files"
+	fid1, err := db.CreateObject(&database.Object{
+		Details: database.Details{Name: &name},
+		Type:    &otype,
+		Owner:   &name,
+	})
+	require.NoError(t, err)
+	fid2, err := db.CreateObject(&database.Object{
+		Details: database.Details{Name: &name},
+		Type:    &otype,
+		Owner:   &name,
+	})
+	require.NoError(t, err)
+	return db, fid1, fid2, cleanup
+}
+
+func blobCount(t *testing.T) int {
+	n := 0
+	err := filepath.Walk(FS.Dir, func(p string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && !strings.Contains(p, "tmp") {
+			n++
+		}
+		return err
+	})
+	require.NoError(t, err)
+	return n
+}
+
+func TestFileStore(t *testing.T) {
+	db, fid1, fid2, cleanup := newDBWithFiles(t)
+	defer cleanup()
+
+	_, err := FS.Read(fid1)
+	require.Equal(t, ErrNoContent, err)
+
+	f, err := FS.Write(fid1, strings.NewReader("hello world"), FS.Limit(nil), "hello.txt", "")
+	require.NoError(t, err)
+	require.EqualValues(t, 11, f.Size)
+	require.Equal(t, "text/plain; charset=utf-8", f.Mime)
+
+	// The details of the file are mirrored in the object's meta
+	o, err := db.ReadObject(fid1, nil)
+	require.NoError(t, err)
+	require.Equal(t, f.SHA256, (*o.Meta)["sha256"])
+	require.Equal(t, "hello.txt", (*o.Meta)["filename"])
+	require.NotNil(t, o.ModifiedDate)
+
+	// Identical content shares a blob
+	_, err = FS.Write(fid2, strings.NewReader("hello world"), FS.Limit(nil), "", "")
+	require.NoError(t, err)
+	require.Equal(t, 1, blobCount(t))
+
+	fh, err := FS.Open(f)
+	require.NoError(t, err)
+	b, err := ioutil.ReadAll(fh)
+	fh.Close()
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(b))
+
+	// The size limit can be lowered by the object's meta
+	_, err = FS.Write(fid1, bytes.NewReader(make([]byte, 101)), FS.Limit(nil), "", "")
+	require.Equal(t, ErrTooLarge, err)
+	_, err = FS.Write(fid1, bytes.NewReader(make([]byte, 20)), FS.Limit(map[string]interface{}{"max_size": 10.0}), "", "")
+	require.Equal(t, ErrTooLarge, err)
+	require.EqualValues(t, 100, FS.Limit(map[string]interface{}{"max_size": 1000.0}))
+
+	// Replacing the content keeps the shared blob
+	_, err = FS.Write(fid1, strings.NewReader("%PDF-1.4 lab results"), FS.Limit(nil), "", "")
+	require.NoError(t, err)
+	f, err = FS.Read(fid1)
+	require.NoError(t, err)
+	require.Equal(t, "application/pdf", f.Mime)
+	require.Equal(t, 2, blobCount(t))
+	o, err = db.ReadObject(fid1, nil)
+	require.NoError(t, err)
+	require.Equal(t, "hello.txt", (*o.Meta)["filename"])
+
+	// The content can't be changed by editing the meta, but the filename can
+	require.Error(t, db.UpdateObject(&database.Object{
+		Details: database.Details{ID: fid1},
+		Meta:    &dbutil.JSONObject{"sha256": "abc"},
+	}))
+	require.NoError(t, db.UpdateObject(&database.Object{
+		Details: database.Details{ID: fid1},
+		Meta:    &dbutil.JSONObject{"sha256": f.SHA256, "size": f.Size, "filename": "lab.pdf"},
+	}))
+
+	require.NoError(t, FS.Delete(fid2))
+	require.Equal(t, ErrNoContent, FS.Delete(fid2))
+	require.Equal(t, 1, blobCount(t))
+
+	// Blobs of purged objects are collected
+	_, err = db.Exec("DELETE FROM objects WHERE id=?;", fid1)
+	require.NoError(t, err)
+	n, err := FS.Collect()
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Equal(t, 0, blobCount(t))
+}
+
+func TestDetectMime(t *testing.T) {
+	png := []byte("\x89PNG\x0D\x0A\x1A\x0A")
+	require.Equal(t, "image/png", DetectMime(png, "text/plain", "photo.txt"))
+	require.Equal(t, "application/json", DetectMime([]byte(`{"a":1}`), "", "data.json"))
+	require.Equal(t, "application/gpx+xml", DetectMime([]byte("abc"), "application/gpx+xml", "track.gpx"))
+	require.Equal(t, "application/octet-stream", DetectMime([]byte{0, 1, 2}, "", ""))
+	require.Equal(t, "text/plain; charset=utf-8", DetectMime([]byte("a,b"), "application/x-www-form-urlencoded", ""))
+}
+
+func TestReadHandler(t *testing.T) {
+	db, fid1, _, cleanup := newDBWithFiles(t)
+	defer cleanup()
+
+	_, err := FS.Write(fid1, strings.NewReader("0123456789"), FS.Limit(nil), "digits.txt", "")
+	require.NoError(t, err)
+	o, err := db.ReadObject(fid1, nil)
+	require.NoError(t, err)
+	meta, err := json.Marshal(o.Meta)
+	require.NoError(t, err)
+
+	request := func(access string, header map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/object/files?download=true", nil)
+		r.Header.Set("X-Heedy-Type", "files")
+		r.Header.Set("X-Heedy-Object", fid1)
+		r.Header.Set("X-Heedy-Owner", "test")
+		r.Header.Set("X-Heedy-Modified-Date", "null")
+		r.Header.Set("X-Heedy-Access", access)
+		r.Header.Set("X-Heedy-Meta", base64.StdEncoding.EncodeToString(meta))
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		Handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := request("read", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "0123456789", w.Body.String())
+	require.Equal(t, "attachment; filename=digits.txt", w.Header().Get("Content-Disposition"))
+	require.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+
+	w = request("read", map[string]string{"Range": "bytes=2-4"})
+	require.Equal(t, http.StatusPartialContent, w.Code)
+	require.Equal(t, "234", w.Body.String())
+
+	w = request("read", map[string]string{"If-None-Match": w.Header().Get("ETag")})
+	require.Equal(t, http.StatusNotModified, w.Code)
+
+	w = request("write", nil)
+	require.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestRefHook(t *testing.T) {
+	db, fid1, _, cleanup := newDBWithFiles(t)
+	defer cleanup()
+
+	name := "other"
+	passwd := "test"
+	require.NoError(t, db.CreateUser(&database.User{
+		UserName: &name,
+		Password: &passwd,
+	}))
+	otype := "files"
+
+	h := RefHook{DB: db}
+	evt := func(data string) *events.Event {
+		return &events.Event{Event: "timeseries_insert", Data: json.RawMessage(data)}
+	}
+	_, err := h.Call(evt(`[{"t":1,"d":{"recording":{"file":"`+fid1+`"}}}]`), "test")
+	require.NoError(t, err)
+	_, err = h.Call(evt(`[{"t":1,"d":{"file":"report.pdf","pages":2}}]`), "test")
+	require.NoError(t, err)
+
+	// Referenced files must exist, and be readable by the writer
+	_, err = h.Call(evt(`[{"t":1,"d":[{"file":"`+fid1+`"}]}]`), "other")
+	require.Error(t, err)
+	_, err = h.Call(evt(`[{"t":1,"d":{"file":"notanobject"}}]`), "test")
+	require.Error(t, err)
+
+	// New files can't claim to have content
+	_, err = CreateHook{}.Call(&events.Event{Event: "object_create", Data: &database.Object{
+		Type: &otype,
+		Meta: &dbutil.JSONObject{"sha256": "abc"},
+	}}, "test")
+	require.Error(t, err)
+	_, err = CreateHook{}.Call(&events.Event{Event: "object_create", Data: &database.Object{
+		Type: &otype,
+		Meta: &dbutil.JSONObject{"filename": "a.txt", "max_size": 10},
+	}}, "test")
+	require.NoError(t, err)
+}
+
+func TestCheckFiles(t *testing.T) {
+	db, fid1, fid2, cleanup := newDBWithFiles(t)
+	defer cleanup()
+
+	f, err := FS.Write(fid1, strings.NewReader("hello world"), FS.Limit(nil), "", "")
+	require.NoError(t, err)
+	_, err = FS.Write(fid2, strings.NewReader("goodbye"), FS.Limit(nil), "", "")
+	require.NoError(t, err)
+
+	problems, err := CheckFiles(db, false)
+	require.NoError(t, err)
+	require.Len(t, problems, 0)
+
+	require.NoError(t, os.Remove(FS.blobPath(f.SHA256)))
+	problems, err = CheckFiles(db, true)
+	require.NoError(t, err)
+	require.Len(t, problems, 1)
+	require.Equal(t, fid1, problems[0].Object)
+	require.True(t, problems[0].Repaired)
+
+	// The object is left without content
+	_, err = FS.Read(fid1)
+	require.Equal(t, ErrNoContent, err)
+	problems, err = CheckFiles(db, false)
+	require.NoError(t, err)
+	require.Len(t, problems, 0)
+}
@@ -0,0 +1,136 @@
+package files
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/heedy/heedy/backend/database"
+	"github.com/heedy/heedy/backend/events"
+)
+
+// The meta fields that describe the uploaded content. They are only set by uploads.
+var contentMeta = []string{"sha256", "size", "mime"}
+
+// CheckMeta is run on updates to the meta of files objects, and rejects changes to the fields describing the content
+func CheckMeta(tx database.TxWrapper, id string, meta map[string]interface{}) error {
+	changed := false
+	for _, k := range contentMeta {
+		if _, ok := meta[k]; ok {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	f := File{}
+	if err := tx.Get(&f, "SELECT * FROM files WHERE object_id=?;", id); err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if !contentMetaMatches(meta, &f) {
+		return database.ErrBadQuery("The sha256, size and mime of a file are set by uploading its content")
+	}
+	return nil
+}
+
+// contentMetaMatches checks that any content fields present in meta are equal to those of the file
+func contentMetaMatches(meta map[string]interface{}, f *File) bool {
+	if v, ok := meta["sha256"]; ok && v != f.SHA256 {
+		return false
+	}
+	if v, ok := meta["mime"]; ok && v != f.Mime {
+		return false
+	}
+	if v, ok := meta["size"]; ok {
+		if s, ok := metaInt(v); !ok || s != f.Size {
+			return false
+		}
+	}
+	return true
+}
+
+// CreateHook rejects new files objects that claim to already have content
+type CreateHook struct{}
+
+func (CreateHook) Call(e *events.Event, as string) (json.RawMessage, error) {
+	b, err := json.Marshal(e.Data)
+	if err != nil {
+		return nil, err
+	}
+	var o database.Object
+	if err = json.Unmarshal(b, &o); err != nil {
+		return nil, err
+	}
+	if o.Meta != nil && !contentMetaMatches(*o.Meta, &File{}) {
+		return nil, database.ErrBadQuery("The sha256, size and mime of a file are set by uploading its content")
+	}
+	return nil, nil
+}
+
+// RefHook rejects timeseries datapoints that reference files which the writer can't read.
+// A datapoint references a file with an object of the form {"file": "<object id>"} anywhere in its data.
+type RefHook struct {
+	DB *database.AdminDB
+}
+
+func (h RefHook) Call(e *events.Event, as string) (json.RawMessage, error) {
+	b, err := json.Marshal(e.Data)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Contains(b, []byte(`"file"`)) {
+		return nil, nil
+	}
+	var datapoints []struct {
+		Data interface{} `json:"d"`
+	}
+	if err = json.Unmarshal(b, &datapoints); err != nil {
+		return nil, err
+	}
+	refs := make(map[string]bool)
+	for _, dp := range datapoints {
+		findRefs(dp.Data, refs)
+	}
+	if len(refs) == 0 {
+		return nil, nil
+	}
+	db, err := h.DB.As(as)
+	if err != nil {
+		return nil, err
+	}
+	for id := range refs {
+		o, err := db.ReadObject(id, nil)
+		if err != nil || *o.Type != "files" {
+			return nil, fmt.Errorf("bad_request: The datapoint references '%s', which is not a file that can be read", id)
+		}
+	}
+	return nil, nil
+}
+
+// Ref returns the object ID of the file referenced by v, if v has the form {"file": "<object id>"}
+func Ref(v interface{}) (string, bool) {
+	m, ok := v.(map[string]interface{})
+	if !ok || len(m) != 1 {
+		return "", false
+	}
+	id, ok := m["file"].(string)
+	return id, ok
+}
+
+func findRefs(v interface{}, refs map[string]bool) {
+	if id, ok := Ref(v); ok {
+		refs[id] = true
+		return
+	}
+	switch d := v.(type) {
+	case map[string]interface{}:
+		for _, dv := range d {
+			findRefs(dv, refs)
+		}
+	case []interface{}:
+		for _, dv := range d {
+			findRefs(dv, refs)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package files
+
+import (
+	"errors"
+	"path/filepath"
+	"time"
+
+	"github.com/heedy/heedy/backend/database"
+	"github.com/heedy/heedy/backend/events"
+	"github.com/heedy/heedy/backend/plugins/run"
+	"github.com/mitchellh/mapstructure"
+	"github.com/sirupsen/logrus"
+)
+
+const PluginName = "files"
+
+var dbUpdate = run.WithVersion(PluginName, SQLVersion, SQLUpdater)
+
+// hooks check new files objects, and the files referenced by timeseries datapoints
+var hooks *events.Hooks
+
+// stopCleanup stops the background removal of unused blobs
+var stopCleanup chan struct{}
+
+// Configure sets up the global file store from the files plugin configuration
+func Configure(db *database.AdminDB) error {
+	fc, ok := db.Assets().Config.Plugins[PluginName]
+	if !ok {
+		return errors.New("Could not find files plugin configuration")
+	}
+	if err := mapstructure.Decode(fc.Config, &FS); err != nil {
+		return err
+	}
+	FS.DB = db
+	FS.Dir = filepath.Join(db.Assets().DataDir(), "files")
+	return nil
+}
+
+func cleanup(d time.Duration, stop chan struct{}) {
+	t := time.NewTicker(d)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			if n, err := FS.Collect(); err != nil {
+				logrus.WithField("plugin", PluginName).Errorf("Failed to remove unused files: %s", err.Error())
+			} else if n > 0 {
+				logrus.WithField("plugin", PluginName).Debugf("Removed %d unused files", n)
+			}
+		}
+	}
+}
+
+// StartFiles prepares the plugin by initializing the database and file store
+func StartFiles(db *database.AdminDB, i *run.Info, h run.BuiltinHelper) error {
+	err := dbUpdate(db, i, h)
+	if err != nil {
+		return err
+	}
+	if err = Configure(db); err != nil {
+		return err
+	}
+	// Blobs of objects that were deleted while heedy was off are removed on start
+	if _, err = FS.Collect(); err != nil {
+		return err
+	}
+
+	d, err := time.ParseDuration(FS.CleanupInterval)
+	if err != nil {
+		return errors.New("Invalid files cleanup_interval")
+	}
+	if d > 0 {
+		stopCleanup = make(chan struct{})
+		go cleanup(d, stopCleanup)
+	}
+
+	hooks = events.NewHooks()
+	hooks.Add(events.Event{Event: "object_create", Type: "files"}, CreateHook{})
+	hooks.Add(events.Event{Event: "timeseries_insert"}, RefHook{DB: db})
+	events.AddHooks(hooks)
+	return nil
+}
+
+// StopFiles stops the background cleanup, and removes the plugin's hooks
+func StopFiles(db *database.AdminDB, apikey string) error {
+	if stopCleanup != nil {
+		close(stopCleanup)
+		stopCleanup = nil
+	}
+	if hooks != nil {
+		events.RemoveHooks(hooks)
+		hooks = nil
+	}
+	return nil
+}
+
+// This is not needed for normal plugins. The init simply registers the plugin with heedy internals
+// for when it is compiled directly into the main heedy executable.
+func init() {
+	run.Builtin.Add(&run.BuiltinRunner{
+		Key:     PluginName,
+		Start:   StartFiles,
+		Stop:    StopFiles,
+		Handler: Handler,
+	})
+	// Runs schema creation on database create instead of on first start
+	database.AddCreateHook(run.WithNilInfo(dbUpdate))
+
+	// The content of a file can only be changed by uploading
+	database.AddObjectMetaHook("files", CheckMeta)
+
+	// The content of files is verified by heedy db check
+	database.AddCheckHook(CheckFiles)
+
+	database.AddObjectStorage(database.StorageTable{Table: "files", Column: "object_id", Size: "size"})
+}
@@ -0,0 +1,169 @@
+package files
+
+import (
+	"errors"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/heedy/heedy/api/golang/plugin"
+	"github.com/heedy/heedy/api/golang/rest"
+	"github.com/heedy/heedy/backend/database"
+	"github.com/heedy/heedy/backend/events"
+)
+
+func validateRequest(w http.ResponseWriter, r *http.Request, scope string) (*plugin.ObjectInfo, bool) {
+	oi, err := plugin.GetObjectInfo(r)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	if !oi.Access.HasScope(scope) {
+		rest.WriteJSONError(w, r, http.StatusForbidden, database.ErrAccessDenied("Insufficient permissions"))
+		return nil, false
+	}
+	return oi, true
+}
+
+// cleanFilename removes any directories from the filename given by the uploader
+func cleanFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" {
+		return ""
+	}
+	return name
+}
+
+// uploadReader returns the content of an upload, along with the filename and mime type given by the uploader.
+// The content is either the first file of a multipart/form-data request, or the raw request body, with
+// the filename given in the filename query parameter or the Content-Disposition header.
+func uploadReader(r *http.Request) (io.Reader, string, string, error) {
+	if mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil && mt == "multipart/form-data" {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			return nil, "", "", err
+		}
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				return nil, "", "", errors.New("bad_request: The multipart upload has no file")
+			}
+			if err != nil {
+				return nil, "", "", err
+			}
+			if p.FormName() == "file" || p.FileName() != "" {
+				return p, cleanFilename(p.FileName()), p.Header.Get("Content-Type"), nil
+			}
+		}
+	}
+	filename := r.URL.Query().Get("filename")
+	if filename == "" {
+		if _, params, err := mime.ParseMediaType(r.Header.Get("Content-Disposition")); err == nil {
+			filename = params["filename"]
+		}
+	}
+	return r.Body, cleanFilename(filename), r.Header.Get("Content-Type"), nil
+}
+
+// ReadHandler returns the content of the file, supporting range requests
+func ReadHandler(w http.ResponseWriter, r *http.Request) {
+	oi, ok := validateRequest(w, r, "read")
+	if !ok {
+		return
+	}
+	f, err := FS.Read(oi.ID)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusNotFound, err)
+		return
+	}
+	fh, err := FS.Open(f)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	defer fh.Close()
+
+	filename, _ := oi.Meta["filename"].(string)
+	disposition := "inline"
+	if r.URL.Query().Get("download") == "true" {
+		disposition = "attachment"
+	}
+	if filename != "" {
+		disposition = mime.FormatMediaType(disposition, map[string]string{"filename": filename})
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", f.Mime)
+	h.Set("Content-Disposition", disposition)
+	h.Set("ETag", `"`+f.SHA256+`"`)
+	// Uploaded files are untrusted, so they must not run scripts with the user's credentials
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Content-Security-Policy", "sandbox")
+
+	sec, frac := math.Modf(f.Modified)
+	http.ServeContent(w, r, filename, time.Unix(int64(sec), int64(frac*1e9)), fh)
+}
+
+// WriteHandler replaces the content of the file with the uploaded content
+func WriteHandler(w http.ResponseWriter, r *http.Request) {
+	oi, ok := validateRequest(w, r, "write")
+	if !ok {
+		return
+	}
+	c := rest.CTX(r)
+	body, filename, mimetype, err := uploadReader(r)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	f, err := FS.Write(oi.ID, body, FS.Limit(oi.Meta), filename, mimetype)
+	if err == ErrTooLarge {
+		rest.WriteJSONError(w, r, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+	if err == nil {
+		c.Events.Fire(&events.Event{
+			Event:  "files_data_write",
+			Object: oi.ID,
+			Data:   f,
+		})
+	}
+	rest.WriteJSON(w, r, f, err)
+}
+
+// DeleteHandler removes the content of the file, keeping the object
+func DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	oi, ok := validateRequest(w, r, "write")
+	if !ok {
+		return
+	}
+	c := rest.CTX(r)
+	err := FS.Delete(oi.ID)
+	if err == nil {
+		c.Events.Fire(&events.Event{
+			Event:  "files_data_delete",
+			Object: oi.ID,
+		})
+	}
+	rest.WriteResult(w, r, err)
+}
+
+// Handler is the global router for the files API
+var Handler = func() *chi.Mux {
+	m := chi.NewMux()
+
+	m.Get("/object/files", ReadHandler)
+	m.Head("/object/files", ReadHandler)
+	m.Post("/object/files", WriteHandler)
+	m.Delete("/object/files", DeleteHandler)
+
+	m.NotFound(rest.NotFoundHandler)
+	m.MethodNotAllowed(rest.NotFoundHandler)
+
+	return m
+}()
@@ -0,0 +1,50 @@
+package files
+
+import (
+	"github.com/heedy/heedy/backend/database"
+	"github.com/heedy/heedy/backend/plugins/run"
+)
+
+const sqlSchema = `
+CREATE TABLE files (
+	object_id VARCHAR(36) PRIMARY KEY,
+
+	-- The sha256 hash of the content, which is also the name of its blob in the data directory.
+	-- Objects with the same content share a blob.
+	sha256 VARCHAR(64) NOT NULL,
+	size INTEGER NOT NULL,
+	mime VARCHAR NOT NULL,
+
+	-- The time the content was uploaded
+	modified REAL NOT NULL,
+
+	CONSTRAINT object_updater
+		FOREIGN KEY(object_id)
+		REFERENCES objects(id)
+		ON UPDATE CASCADE
+		ON DELETE CASCADE
+);
+
+-- Blobs are removed once no file references them
+CREATE INDEX files_sha256 ON files(sha256);
+`
+
+// migrations upgrade the plugin's tables one version at a time
+var migrations = database.Migrations{
+	{
+		Version:     1,
+		Description: "Create the files table",
+		Up: func(tx database.TxWrapper) error {
+			_, err := tx.Exec(sqlSchema)
+			return err
+		},
+	},
+}
+
+// SQLVersion is the current version of the plugin's tables
+var SQLVersion = migrations.Latest()
+
+// SQLUpdater is in the format expected by Heedy to update the database
+func SQLUpdater(db *database.AdminDB, i *run.Info, h run.BuiltinHelper, curversion int) error {
+	return db.Migrate(PluginName, migrations)
+}
@@ -0,0 +1,323 @@
+package files
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heedy/heedy/backend/database"
+	"github.com/heedy/heedy/backend/database/dbutil"
+)
+
+var ErrTooLarge = errors.New("too_large: The file is larger than the object's size limit")
+var ErrNoContent = errors.New("not_found: No file was uploaded to the object")
+
+// tmpExpiration is how long partial uploads are kept in the temporary folder before being cleaned up
+const tmpExpiration = 24 * time.Hour
+
+// File holds the details of the content of a files object. The same details are mirrored in the object's meta.
+type File struct {
+	ObjectID string  `json:"-" db:"object_id"`
+	SHA256   string  `json:"sha256" db:"sha256"`
+	Size     int64   `json:"size" db:"size"`
+	Mime     string  `json:"mime" db:"mime"`
+	Modified float64 `json:"modified" db:"modified"`
+}
+
+// FileStore holds the content of files as blobs in the data directory, named by the sha256 hash of their content
+type FileStore struct {
+	DB *database.AdminDB `mapstructure:"-"`
+
+	// The folder holding all blobs
+	Dir string `mapstructure:"-"`
+
+	MaxFileSize     int64  `mapstructure:"max_file_size"`
+	CleanupInterval string `mapstructure:"cleanup_interval"`
+
+	// lock is held while blobs are referenced or removed, so that a blob that was just written
+	// isn't collected before the file referencing it is committed
+	lock sync.Mutex
+}
+
+// The global file store, which is initialized on plugin start
+var FS FileStore
+
+func (fs *FileStore) blobPath(hash string) string {
+	return filepath.Join(fs.Dir, hash[:2], hash[2:])
+}
+
+func (fs *FileStore) tmpDir() string {
+	return filepath.Join(fs.Dir, "tmp")
+}
+
+// Limit returns the maximum size of a file in the object with the given meta. The max_size of the object
+// can lower the limit, but not raise it above the plugin's max_file_size.
+func (fs *FileStore) Limit(meta map[string]interface{}) int64 {
+	if ms, ok := metaInt(meta["max_size"]); ok && ms > 0 && (ms < fs.MaxFileSize || fs.MaxFileSize <= 0) {
+		return ms
+	}
+	return fs.MaxFileSize
+}
+
+// Read returns the details of the object's file, or ErrNoContent if nothing was uploaded
+func (fs *FileStore) Read(id string) (*File, error) {
+	var f File
+	err := fs.DB.Get(&f, "SELECT * FROM files WHERE object_id=?;", id)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoContent
+	}
+	return &f, err
+}
+
+// Open opens the blob holding the file's content
+func (fs *FileStore) Open(f *File) (*os.File, error) {
+	return os.Open(fs.blobPath(f.SHA256))
+}
+
+// headWriter keeps the first bytes written to it, which are used to sniff the file's type
+type headWriter struct {
+	head []byte
+}
+
+func (hw *headWriter) Write(p []byte) (int, error) {
+	if n := 512 - len(hw.head); n > 0 {
+		if n > len(p) {
+			n = len(p)
+		}
+		hw.head = append(hw.head, p[:n]...)
+	}
+	return len(p), nil
+}
+
+// DetectMime sniffs the type of the file from its first bytes. Content that isn't recognized
+// falls back to the type given by the uploader, and then to the type of the filename's extension.
+func DetectMime(head []byte, given, filename string) string {
+	sniffed := http.DetectContentType(head)
+	if sniffed != "application/octet-stream" && !strings.HasPrefix(sniffed, "text/plain") {
+		return sniffed
+	}
+	if mt, params, err := mime.ParseMediaType(given); err == nil && mt != "application/octet-stream" && mt != "application/x-www-form-urlencoded" && !strings.HasPrefix(mt, "multipart/") {
+		return mime.FormatMediaType(mt, params)
+	}
+	if ext := path.Ext(filename); ext != "" {
+		if t := mime.TypeByExtension(ext); t != "" {
+			return t
+		}
+	}
+	return sniffed
+}
+
+// Write reads the content from r, storing it as the file of the given object. The upload fails with ErrTooLarge
+// if the content is larger than limit bytes. The filename and mime type given by the uploader are optional.
+func (fs *FileStore) Write(id string, r io.Reader, limit int64, filename, mimetype string) (*File, error) {
+	if err := fs.DB.CheckObjectStorageQuota(id); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(fs.tmpDir(), 0700); err != nil {
+		return nil, err
+	}
+	tmp, err := ioutil.TempFile(fs.tmpDir(), "upload-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if limit > 0 {
+		r = io.LimitReader(r, limit+1)
+	}
+	hasher := sha256.New()
+	hw := &headWriter{}
+	n, err := io.Copy(io.MultiWriter(tmp, hasher, hw), r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read_error: %w", err)
+	}
+	if limit > 0 && n > limit {
+		return nil, ErrTooLarge
+	}
+
+	f := &File{
+		ObjectID: id,
+		SHA256:   hex.EncodeToString(hasher.Sum(nil)),
+		Size:     n,
+		Mime:     DetectMime(hw.head, mimetype, filename),
+		Modified: float64(time.Now().UnixNano()) * 1e-9,
+	}
+
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	bp := fs.blobPath(f.SHA256)
+	if _, err = os.Stat(bp); os.IsNotExist(err) {
+		if err = os.MkdirAll(filepath.Dir(bp), 0700); err != nil {
+			return nil, err
+		}
+		if err = os.Rename(tmp.Name(), bp); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	old, err := fs.commit(f, filename)
+	if err != nil {
+		return nil, err
+	}
+	if old != "" && old != f.SHA256 {
+		err = fs.removeUnreferenced(old)
+	}
+	return f, err
+}
+
+// commit sets the file of the object, and mirrors its details in the object's meta, returning the hash of the previous content
+func (fs *FileStore) commit(f *File, filename string) (old string, err error) {
+	tx, err := fs.DB.Beginx()
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+	if err = tx.Get(&old, "SELECT sha256 FROM files WHERE object_id=?;", f.ObjectID); err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	if _, err = tx.Exec("INSERT OR REPLACE INTO files(object_id,sha256,size,mime,modified) VALUES (?,?,?,?,?);", f.ObjectID, f.SHA256, f.Size, f.Mime, f.Modified); err != nil {
+		return "", err
+	}
+	meta := "json_set(json(meta),'$.sha256',?,'$.size',?,'$.mime',?)"
+	args := []interface{}{f.SHA256, f.Size, f.Mime}
+	if filename != "" {
+		meta = "json_set(" + meta + ",'$.filename',?)"
+		args = append(args, filename)
+	}
+	args = append(args, dbutil.Date(time.Now().UTC()), f.ObjectID)
+	result, err := tx.Exec("UPDATE objects SET meta="+meta+",modified_date=? WHERE id=?;", args...)
+	return old, database.GetExecError(result, err)
+}
+
+// Delete removes the content of the object's file
+func (fs *FileStore) Delete(id string) (err error) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	tx, err := fs.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	var old string
+	if err = tx.Get(&old, "SELECT sha256 FROM files WHERE object_id=?;", id); err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return ErrNoContent
+		}
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM files WHERE object_id=?;", id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	result, err := tx.Exec("UPDATE objects SET meta=json_set(json(meta),'$.sha256','','$.size',0,'$.mime','') WHERE id=?;", id)
+	if err = database.GetExecError(result, err); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	return fs.removeUnreferenced(old)
+}
+
+// removeUnreferenced removes the blob with the given hash if no file uses it. The lock must be held.
+func (fs *FileStore) removeUnreferenced(hash string) error {
+	var used bool
+	if err := fs.DB.Get(&used, "SELECT EXISTS(SELECT 1 FROM files WHERE sha256=?);", hash); err != nil || used {
+		return err
+	}
+	bp := fs.blobPath(hash)
+	err := os.Remove(bp)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	// The folder is only removed once it's empty
+	os.Remove(filepath.Dir(bp))
+	return err
+}
+
+// Collect removes the blobs that are no longer used by any file, such as those of deleted objects,
+// as well as old partial uploads. It returns the number of blobs removed.
+func (fs *FileStore) Collect() (int, error) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	if tmpfiles, err := ioutil.ReadDir(fs.tmpDir()); err == nil {
+		for _, tf := range tmpfiles {
+			if time.Since(tf.ModTime()) > tmpExpiration {
+				os.Remove(filepath.Join(fs.tmpDir(), tf.Name()))
+			}
+		}
+	}
+
+	dirs, err := ioutil.ReadDir(fs.Dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, d := range dirs {
+		if !d.IsDir() || len(d.Name()) != 2 {
+			continue
+		}
+		blobs, err := ioutil.ReadDir(filepath.Join(fs.Dir, d.Name()))
+		if err != nil {
+			return removed, err
+		}
+		for _, b := range blobs {
+			hash := d.Name() + b.Name()
+			var used bool
+			if err = fs.DB.Get(&used, "SELECT EXISTS(SELECT 1 FROM files WHERE sha256=?);", hash); err != nil {
+				return removed, err
+			}
+			if !used {
+				if err = os.Remove(fs.blobPath(hash)); err != nil {
+					return removed, err
+				}
+				removed++
+			}
+		}
+		os.Remove(filepath.Join(fs.Dir, d.Name()))
+	}
+	return removed, nil
+}
+
+// metaInt reads an integer from a decoded meta value
+func metaInt(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return int64(n), float64(int64(n)) == n
+	case int64:
+		return n, true
+	case int:
+		return int64(n), true
+	}
+	return 0, false
+}
@@ -20,4 +20,9 @@ func init() {
 	})
 	// Runs schema creation on database create instead of on first start
 	database.AddCreateHook(run.WithNilInfo(withversion))
+
+	size := "LENGTH(namespace)+LENGTH(key)+LENGTH(value)"
+	database.AddUserStorage(database.StorageTable{Table: "kv_user", Column: "user", Size: size})
+	database.AddAppStorage(database.StorageTable{Table: "kv_app", Column: "app", Size: size})
+	database.AddObjectStorage(database.StorageTable{Table: "kv_object", Column: "object", Size: size})
 }
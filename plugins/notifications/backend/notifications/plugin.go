@@ -24,4 +24,10 @@ func init() {
 	})
 	// Runs schema creation on database create instead of on first start
 	database.AddCreateHook(run.WithNilInfo(withversion))
+
+	// App notifications are counted towards the user who owns the app
+	size := "LENGTH(key)+LENGTH(title)+LENGTH(description)+LENGTH(actions)"
+	database.AddUserStorage(database.StorageTable{Table: "notifications_user", Column: "user", Size: size})
+	database.AddUserStorage(database.StorageTable{Table: "notifications_app", Column: "user", Size: size})
+	database.AddObjectStorage(database.StorageTable{Table: "notifications_object", Column: "object", Size: size})
 }
@@ -0,0 +1,177 @@
+package timeseries
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/heedy/heedy/backend/database"
+)
+
+// zstdMagic starts every zstandard frame, which distinguishes compressed batches from raw msgpack arrays
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// decodeBatch decodes the data of a batch whether or not it is compressed, so that batches can be
+// checked without the timeseries configuration
+func decodeBatch(b []byte) (dpa DatapointArray, err error) {
+	if bytes.HasPrefix(b, zstdMagic) {
+		if b, err = zdecoder.DecodeAll(b, make([]byte, 0, len(b)*10)); err != nil {
+			return nil, err
+		}
+	}
+	_, err = dpa.UnmarshalMsg(b)
+	return
+}
+
+type checkedBatch struct {
+	TSID   string  `db:"tsid"`
+	Tstart float64 `db:"tstart"`
+	Tend   float64 `db:"tend"`
+	Length int     `db:"length"`
+	batchStats
+	Data []byte `db:"data"`
+}
+
+// checkBatch returns the problem with the batch, if any, and its datapoints if they can be used to rebuild its metadata.
+// The summary statistics are only checked if stats is true, since they are added by a migration.
+func checkBatch(b *checkedBatch, stats bool) (*database.CheckProblem, DatapointArray) {
+	p := &database.CheckProblem{
+		Check:  "timeseries",
+		Object: b.TSID,
+	}
+	dpa, err := decodeBatch(b.Data)
+	if err != nil {
+		p.Description = fmt.Sprintf("The batch starting at %v can't be decoded: %s", b.Tstart, err.Error())
+		return p, nil
+	}
+	if len(dpa) == 0 {
+		p.Description = fmt.Sprintf("The batch starting at %v has no datapoints", b.Tstart)
+		p.Repair = "Delete the empty batch"
+		return p, dpa
+	}
+	for i := range dpa {
+		if dpa[i] == nil {
+			p.Description = fmt.Sprintf("The batch starting at %v has a null datapoint", b.Tstart)
+			return p, nil
+		}
+		if i > 0 && dpa[i].Timestamp < dpa[i-1].EndTime() {
+			p.Description = fmt.Sprintf("The datapoints of the batch starting at %v are out of order", b.Tstart)
+			return p, nil
+		}
+	}
+	tstart, tend, length := dpa[0].Timestamp, dpa[len(dpa)-1].EndTime(), len(dpa)
+	if tstart != b.Tstart || tend != b.Tend || length != b.Length {
+		p.Description = fmt.Sprintf("The batch starting at %v has tend=%v and length=%d, but its datapoints have tstart=%v, tend=%v and length=%d",
+			b.Tstart, b.Tend, b.Length, tstart, tend, length)
+		p.Repair = "Rebuild the batch's metadata from its datapoints"
+		return p, dpa
+	}
+	if stats && newBatchStats(dpa) != b.batchStats {
+		p.Description = fmt.Sprintf("The summary statistics of the batch starting at %v don't match its datapoints", b.Tstart)
+		p.Repair = "Rebuild the batch's metadata from its datapoints"
+		return p, dpa
+	}
+	return nil, dpa
+}
+
+// CheckBatches confirms that all timeseries batches can be decoded, and that their tstart, tend, length and
+// summary statistics match their datapoints. Batches with incorrect metadata are repaired by rebuilding it from their contents.
+func CheckBatches(db *database.AdminDB, repair bool) ([]*database.CheckProblem, error) {
+	// The table is only created once the plugin runs
+	var exists bool
+	if err := db.Get(&exists, "SELECT COUNT(*) > 0 FROM sqlite_master WHERE type='table' AND name='timeseries';"); err != nil || !exists {
+		return nil, err
+	}
+	problems := []*database.CheckProblem{}
+
+	// The database can be checked without starting the server, in which case the table might not have been
+	// migrated yet. Until it is, the batches are checked without the statistics added by the migration.
+	version, err := db.ReadPluginDatabaseVersion(PluginName)
+	if err != nil {
+		return nil, err
+	}
+	stats := version >= statsVersion
+	if version < SQLVersion {
+		p := &database.CheckProblem{
+			Check:       "timeseries",
+			Description: fmt.Sprintf("The timeseries table is at version %d, but the current version is %d", version, SQLVersion),
+			Repair:      "Migrate the timeseries table",
+		}
+		p.RepairWith(repair, func() error {
+			return db.Migrate(PluginName, migrations)
+		})
+		stats = stats || p.Repaired
+		problems = append(problems, p)
+	}
+	columns := "tsid,tstart,tend,length,data"
+	if stats {
+		columns = "tsid,tstart,tend,length,tlast,dcount,dmin,dmax,dsum,data"
+	}
+
+	rows, err := db.Queryx(fmt.Sprintf("SELECT %s FROM timeseries ORDER BY tsid,tstart;", columns))
+	if err != nil {
+		return nil, err
+	}
+	type repairInfo struct {
+		p         *database.CheckProblem
+		tsid      string
+		oldTstart float64
+		dpa       DatapointArray
+	}
+	repairs := []repairInfo{}
+	tstarts := make(map[string]map[float64]bool)
+	for rows.Next() {
+		var b checkedBatch
+		if err = rows.StructScan(&b); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if tstarts[b.TSID] == nil {
+			tstarts[b.TSID] = make(map[float64]bool)
+		}
+		tstarts[b.TSID][b.Tstart] = true
+		p, dpa := checkBatch(&b, stats)
+		if p != nil {
+			problems = append(problems, p)
+			repairs = append(repairs, repairInfo{p, b.TSID, b.Tstart, dpa})
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// A batch's tstart is part of the table's primary key, so a batch can't be moved to the tstart of another batch
+	for _, r := range repairs {
+		p := r.p
+		if len(r.dpa) == 0 || p.Repair == "" || r.dpa[0].Timestamp == r.oldTstart {
+			continue
+		}
+		if tstarts[r.tsid][r.dpa[0].Timestamp] {
+			p.Description += fmt.Sprintf(". Another batch already starts at %v", r.dpa[0].Timestamp)
+			p.Repair = ""
+			continue
+		}
+		tstarts[r.tsid][r.dpa[0].Timestamp] = true
+	}
+
+	// The batches are repaired after the query is done, since sqlite can't modify a table while reading it
+	for _, r := range repairs {
+		r := r
+		r.p.RepairWith(repair, func() error {
+			if len(r.dpa) == 0 {
+				_, err := db.Exec("DELETE FROM timeseries WHERE tsid=? AND tstart=?;", r.tsid, r.oldTstart)
+				return err
+			}
+			if !stats {
+				_, err := db.Exec("UPDATE timeseries SET tstart=?,tend=?,length=? WHERE tsid=? AND tstart=?;",
+					r.dpa[0].Timestamp, r.dpa[len(r.dpa)-1].EndTime(), len(r.dpa), r.tsid, r.oldTstart)
+				return err
+			}
+			bs := newBatchStats(r.dpa)
+			_, err := db.Exec("UPDATE timeseries SET tstart=?,tend=?,length=?,tlast=?,dcount=?,dmin=?,dmax=?,dsum=? WHERE tsid=? AND tstart=?;",
+				r.dpa[0].Timestamp, r.dpa[len(r.dpa)-1].EndTime(), len(r.dpa), bs.Tlast, bs.DCount, bs.DMin, bs.DMax, bs.DSum, r.tsid, r.oldTstart)
+			return err
+		})
+	}
+	return problems, nil
+}
@@ -0,0 +1,102 @@
+package timeseries
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckBatches(t *testing.T) {
+	adb, oid1, oid2, cleanup := newDBWithObjects(t)
+	defer cleanup()
+
+	s := TimeseriesDB{
+		DB:           adb,
+		BatchSize:    3,
+		MaxBatchSize: 5,
+	}
+	require.NoError(t, s.Insert(oid1, NewDatapointArrayIterator(dpa6), nil))
+	require.NoError(t, s.Insert(oid2, NewDatapointArrayIterator(dpa4), nil))
+
+	problems, err := CheckBatches(adb, false)
+	require.NoError(t, err)
+	require.Len(t, problems, 0)
+
+	// Corrupt the metadata of a batch, and the data of another
+	_, err = adb.Exec("UPDATE timeseries SET length=length+1, tend=tend+10 WHERE tsid=? AND tstart=?", oid1, dpa6[0].Timestamp)
+	require.NoError(t, err)
+	_, err = adb.Exec("UPDATE timeseries SET data=X'00010203' WHERE tsid=?", oid2)
+	require.NoError(t, err)
+
+	problems, err = CheckBatches(adb, true)
+	require.NoError(t, err)
+	require.Len(t, problems, 2)
+	for _, p := range problems {
+		if p.Object == oid1 {
+			require.True(t, p.Repaired, p.Description)
+		} else {
+			require.Equal(t, oid2, p.Object)
+			require.False(t, p.Repaired)
+			require.Empty(t, p.Repair)
+		}
+	}
+
+	// Only the undecodable batch remains
+	problems, err = CheckBatches(adb, false)
+	require.NoError(t, err)
+	require.Len(t, problems, 1)
+	cmpQuery(t, s, &Query{Timeseries: oid1}, dpa6)
+
+	// A batch whose datapoints start at the tstart of another batch can't be repaired
+	_, err = adb.Exec(`INSERT INTO timeseries(tsid,tstart,tend,length,tlast,dcount,dmin,dmax,dsum,data)
+		SELECT tsid,tend+100,tend+100,length,tlast,dcount,dmin,dmax,dsum,data FROM timeseries WHERE tsid=?`, oid1)
+	require.NoError(t, err)
+
+	problems, err = CheckBatches(adb, true)
+	require.NoError(t, err)
+	require.Len(t, problems, 2)
+	for _, p := range problems {
+		if p.Object == oid1 {
+			require.False(t, p.Repaired, p.Description)
+			require.Empty(t, p.Repair)
+			require.Empty(t, p.RepairError)
+		}
+	}
+}
+
+func TestCheckBatchesMigrate(t *testing.T) {
+	adb, oid1, _, cleanup := newDBWithObjects(t)
+	defer cleanup()
+
+	s := TimeseriesDB{
+		DB:           adb,
+		BatchSize:    3,
+		MaxBatchSize: 5,
+	}
+	require.NoError(t, s.Insert(oid1, NewDatapointArrayIterator(dpa6), nil))
+
+	// Go back to the table from before the statistics were added, as if heedy was upgraded but not yet started
+	for _, c := range []string{"tlast", "dcount", "dmin", "dmax", "dsum"} {
+		_, err := adb.Exec("ALTER TABLE timeseries DROP COLUMN " + c)
+		require.NoError(t, err)
+	}
+	require.NoError(t, adb.WritePluginDatabaseVersion(PluginName, 1))
+
+	// The batches are still checked, and the migration is reported
+	problems, err := CheckBatches(adb, false)
+	require.NoError(t, err)
+	require.Len(t, problems, 1)
+	require.Empty(t, problems[0].Object)
+
+	problems, err = CheckBatches(adb, true)
+	require.NoError(t, err)
+	require.Len(t, problems, 1)
+	require.True(t, problems[0].Repaired, problems[0].RepairError)
+
+	problems, err = CheckBatches(adb, false)
+	require.NoError(t, err)
+	require.Len(t, problems, 0)
+	st, err := s.Stats(&Query{Timeseries: oid1})
+	require.NoError(t, err)
+	require.EqualValues(t, len(dpa6), st.Count)
+}
@@ -0,0 +1,333 @@
+package timeseries
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/heedy/heedy/backend/assets"
+	"github.com/heedy/heedy/backend/cmd"
+	"github.com/heedy/heedy/backend/database"
+	"github.com/heedy/heedy/backend/database/dbutil"
+	"github.com/mailru/easyjson"
+
+	"github.com/spf13/cobra"
+)
+
+var compactTimeseries string
+
+var dataFormat string
+var dataOutput string
+var exportT1 string
+var exportT2 string
+var dataActions bool
+var importMethod string
+var importValidate bool
+
+// TimeseriesCmd groups the command-line maintenance tools of the timeseries plugin
+var TimeseriesCmd = &cobra.Command{
+	Use:   "timeseries",
+	Short: "Maintenance of timeseries data",
+}
+
+// CompactCmd merges undersized batches directly in the database
+var CompactCmd = &cobra.Command{
+	Use:   "compact [location of database]",
+	Short: "Merges small batches of datapoints to reclaim space",
+	Long: `Merges adjacent undersized batches of timeseries datapoints into batches of the configured batch_size.
+Timeseries that get data one datapoint at a time accumulate many small batches, which take more space and are slower to query.
+The compaction is safe to run while heedy is running.`,
+	RunE: func(c *cobra.Command, args []string) error {
+		directory, err := cmd.GetDirectory(args)
+		if err != nil {
+			return err
+		}
+		a, err := assets.Open(directory, nil)
+		if err != nil {
+			return err
+		}
+		db, err := database.Open(a)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		if err = Configure(db); err != nil {
+			return err
+		}
+
+		var res *CompactionResult
+		if compactTimeseries != "" {
+			res, err = TSDB.Compact(compactTimeseries)
+		} else {
+			res, err = TSDB.CompactAll()
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Merged %d batches in %d timeseries into %d batches, reclaiming %d bytes\n", res.BatchesMerged, res.Timeseries, res.BatchesWritten, res.Reclaimed)
+		return nil
+	},
+}
+
+// openTimeseries opens the database with the timeseries plugin configured, and reads the given timeseries
+func openTimeseries(tsid string, args []string) (*database.AdminDB, *database.Object, error) {
+	db, err := cmd.OpenDatabase(args)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = Configure(db); err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	// The commands can be run before the server was started with a new version of heedy, so the table
+	// might not have been migrated yet
+	if err = db.Migrate(PluginName, migrations); err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	if tsid == "" {
+		return db, nil, nil
+	}
+	o, err := db.ReadObject(tsid, nil)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	if *o.Type != "timeseries" {
+		db.Close()
+		return nil, nil, fmt.Errorf("bad_query: Object '%s' is not a timeseries", tsid)
+	}
+	return db, o, nil
+}
+
+// getFormat returns the format of the data, which is json or csv. Unless given explicitly,
+// the format is csv if the filename has a csv extension, and json otherwise.
+func getFormat(filename string) (string, error) {
+	switch dataFormat {
+	case "json", "csv":
+		return dataFormat, nil
+	case "":
+		if strings.ToLower(filepath.Ext(filename)) == ".csv" {
+			return "csv", nil
+		}
+		return "json", nil
+	}
+	return "", fmt.Errorf("Unknown format '%s', must be json or csv", dataFormat)
+}
+
+// outputFile returns the file to write the results to, or stdout if no output file was given
+func outputFile() (io.WriteCloser, error) {
+	if dataOutput == "" || dataOutput == "-" {
+		return os.Stdout, nil
+	}
+	return os.Create(dataOutput)
+}
+
+// inputFile opens the given file, or stdin for -
+func inputFile(filename string) (io.ReadCloser, error) {
+	if filename == "-" {
+		return os.Stdin, nil
+	}
+	return os.Open(filename)
+}
+
+// flagTimestamp converts a timestamp given on the command line to the format used in queries,
+// where unix times are numbers, and everything else (such as now-1d) is parsed as a string.
+func flagTimestamp(ts string) interface{} {
+	if ts == "" {
+		return nil
+	}
+	if f, err := strconv.ParseFloat(ts, 64); err == nil {
+		return f
+	}
+	return ts
+}
+
+// ExportCmd writes the datapoints of a timeseries as json or csv
+var ExportCmd = &cobra.Command{
+	Use:   "export [timeseries id] [location of database]",
+	Short: "Exports the data of a timeseries",
+	Long: `Writes the datapoints of a timeseries as a json array or as csv with t, dt and d columns.
+The time range can be restricted with --t1 and --t2, which accept unix timestamps, RFC3339 dates or relative times such as now-1d.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(c *cobra.Command, args []string) error {
+		format, err := getFormat(dataOutput)
+		if err != nil {
+			return err
+		}
+		db, _, err := openTimeseries(args[0], args[1:])
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		iter, err := TSDB.Query(&Query{
+			Timeseries: args[0],
+			T1:         flagTimestamp(exportT1),
+			T2:         flagTimestamp(exportT2),
+			Actions:    &dataActions,
+		})
+		if err != nil {
+			return err
+		}
+		defer iter.Close()
+
+		out, err := outputFile()
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		if format == "csv" {
+			return WriteCSV(out, iter, dataActions)
+		}
+		r, err := NewJsonArrayReader(iter, 2048)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, r)
+		return err
+	},
+}
+
+// ImportCmd inserts datapoints from a json or csv file into a timeseries
+var ImportCmd = &cobra.Command{
+	Use:   "import [timeseries id] [file] [location of database]",
+	Short: "Imports data into a timeseries",
+	Long: `Inserts the datapoints in the file (or stdin if the file is -) into the timeseries.
+The file is either a json array of datapoints, or csv with t and d columns, and an optional dt column.
+In csv, data that looks like a number, boolean, or json object/array is decoded as such, and anything else is a string.
+The data is validated against the timeseries schema before any of it is inserted.`,
+	Args: cobra.RangeArgs(2, 3),
+	RunE: func(c *cobra.Command, args []string) error {
+		format, err := getFormat(args[1])
+		if err != nil {
+			return err
+		}
+		f, err := inputFile(args[1])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		var datapoints DatapointArray
+		if format == "csv" {
+			datapoints, err = ReadCSV(f)
+		} else {
+			var b []byte
+			if b, err = ioutil.ReadAll(f); err == nil {
+				err = easyjson.Unmarshal(b, &datapoints)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		for i := range datapoints {
+			if datapoints[i] == nil {
+				return errors.New("bad_request: null datapoint")
+			}
+			datapoints[i].Actor = ""
+		}
+
+		db, o, err := openTimeseries(args[0], args[2:])
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		if schema, ok := (*o.Meta)["schema"].(map[string]interface{}); ok && len(schema) > 0 && importValidate {
+			if err = validateData(datapoints, schema, ""); err != nil {
+				return err
+			}
+		}
+
+		ii := NewInfoIterator(NewDatapointArrayIterator(datapoints))
+		err = TSDB.Insert(args[0], ii, &InsertQuery{
+			Actions: &dataActions,
+			Method:  &importMethod,
+		})
+		if err != nil {
+			return err
+		}
+		if ii.Count > 0 {
+			ne := dbutil.Date(time.Now().UTC())
+			err = db.UpdateObject(&database.Object{
+				Details:      database.Details{ID: args[0]},
+				ModifiedDate: &ne,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(os.Stderr, "Inserted %d datapoints into %s\n", ii.Count, args[0])
+		return nil
+	},
+}
+
+// DatasetCmd runs a dataset query, in the same format as the dataset API
+var DatasetCmd = &cobra.Command{
+	Use:   "dataset [query file] [location of database]",
+	Short: "Runs a dataset query",
+	Long: `Runs the dataset query in the given json file (or stdin if the file is -), and writes the result as json.
+The query has the same format as the body of a POST to /api/timeseries/dataset, and has access to all timeseries in the database.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(c *cobra.Command, args []string) error {
+		f, err := inputFile(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		var d map[string]*Dataset
+		if err = json.NewDecoder(f).Decode(&d); err != nil {
+			return err
+		}
+
+		db, _, err := openTimeseries("", args[1:])
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		readers, closeAll, err := datasetReaders(db, d)
+		if err != nil {
+			return err
+		}
+		defer closeAll()
+
+		out, err := outputFile()
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		return writeDataset(out, readers)
+	},
+}
+
+func init() {
+	CompactCmd.Flags().StringVar(&compactTimeseries, "timeseries", "", "Only compact the timeseries with the given id")
+
+	ef := ExportCmd.Flags()
+	ef.StringVar(&dataFormat, "format", "", "The output format, json or csv. Defaults to csv if the output file ends in .csv, and json otherwise.")
+	ef.StringVarP(&dataOutput, "output", "o", "", "The file to write the data to. Defaults to stdout.")
+	ef.StringVar(&exportT1, "t1", "", "Only export datapoints starting at this time")
+	ef.StringVar(&exportT2, "t2", "", "Only export datapoints before this time")
+	ef.BoolVar(&dataActions, "actions", false, "Export the timeseries actions instead of its data")
+
+	imf := ImportCmd.Flags()
+	imf.StringVar(&dataFormat, "format", "", "The input format, json or csv. Defaults to csv if the file ends in .csv, and json otherwise.")
+	imf.StringVar(&importMethod, "method", "update", "How to insert the data: update replaces existing datapoints with the same timestamps, append only allows data after the existing data, and insert fails on overlap.")
+	imf.BoolVar(&importValidate, "validate", true, "Validate the data against the timeseries schema")
+	imf.BoolVar(&dataActions, "actions", false, "Import the data as actions")
+
+	DatasetCmd.Flags().StringVarP(&dataOutput, "output", "o", "", "The file to write the dataset to. Defaults to stdout.")
+
+	TimeseriesCmd.AddCommand(CompactCmd, ExportCmd, ImportCmd, DatasetCmd)
+	cmd.RootCmd.AddCommand(TimeseriesCmd)
+}
@@ -0,0 +1,199 @@
+package timeseries
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/heedy/heedy/backend/database"
+	"github.com/sirupsen/logrus"
+)
+
+// CompactionResult gives the statistics of a batch compaction run
+type CompactionResult struct {
+	// The number of timeseries that had batches merged
+	Timeseries int `json:"timeseries"`
+	// The number of batches that were merged, and the number of batches they were merged into
+	BatchesMerged  int `json:"batches_merged"`
+	BatchesWritten int `json:"batches_written"`
+	// The number of bytes of batch data freed by the compaction
+	Reclaimed int64 `json:"reclaimed"`
+}
+
+func (cr *CompactionResult) add(r *CompactionResult) {
+	if r.BatchesMerged > 0 {
+		cr.Timeseries++
+	}
+	cr.BatchesMerged += r.BatchesMerged
+	cr.BatchesWritten += r.BatchesWritten
+	cr.Reclaimed += r.Reclaimed
+}
+
+type batchSize struct {
+	Tstart float64
+	Length int
+	Size   int64
+}
+
+// compactionGroups splits the batches into groups of adjacent undersized batches whose combined length is
+// at most the target batch size. Only groups of more than one batch are returned, since they are the ones to merge.
+func (ts *TimeseriesDB) compactionGroups(batches []batchSize) [][]batchSize {
+	groups := [][]batchSize{}
+	cur := []batchSize{}
+	curLength := 0
+	for _, b := range batches {
+		if b.Length < ts.BatchSize && curLength+b.Length <= ts.BatchSize {
+			cur = append(cur, b)
+			curLength += b.Length
+			continue
+		}
+		if len(cur) > 1 {
+			groups = append(groups, cur)
+		}
+		cur = []batchSize{}
+		curLength = 0
+		if b.Length < ts.BatchSize {
+			cur = append(cur, b)
+			curLength = b.Length
+		}
+	}
+	if len(cur) > 1 {
+		groups = append(groups, cur)
+	}
+	return groups
+}
+
+// compact merges adjacent undersized batches of the given timeseries within the transaction
+func (ts *TimeseriesDB) compact(tx database.TxWrapper, table, tsid string) (*CompactionResult, error) {
+	res := &CompactionResult{}
+
+	var batches []batchSize
+	err := tx.Select(&batches, fmt.Sprintf("SELECT tstart,length,LENGTH(data) AS size FROM %s WHERE tsid=? ORDER BY tstart ASC", table), tsid)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range ts.compactionGroups(batches) {
+		rows, err := tx.Queryx(fmt.Sprintf("SELECT data FROM %s WHERE tsid=? AND tstart>=? AND tstart<=? ORDER BY tstart ASC", table), tsid, g[0].Tstart, g[len(g)-1].Tstart)
+		if err != nil {
+			return nil, err
+		}
+		bi := SQLBatchIterator{rows, nil}
+		merged := make(DatapointArray, 0, ts.BatchSize)
+		for {
+			da, err := bi.NextBatch()
+			if err != nil {
+				bi.Close()
+				return nil, err
+			}
+			if da == nil {
+				break
+			}
+			merged = append(merged, da...)
+		}
+		bi.Close()
+
+		b, err := merged.ToBytes()
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE tsid=? AND tstart>=? AND tstart<=?", table), tsid, g[0].Tstart, g[len(g)-1].Tstart)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec(batchStatement(table), batchValues(tsid, merged, b)...)
+		if err != nil {
+			return nil, err
+		}
+
+		res.BatchesMerged += len(g)
+		res.BatchesWritten++
+		for _, gb := range g {
+			res.Reclaimed += gb.Size
+		}
+		res.Reclaimed -= int64(len(b))
+	}
+	return res, nil
+}
+
+// Compact merges adjacent batches of the given timeseries that are smaller than the batch size. Batches are
+// written one datapoint at a time by plugins syncing data, so over time a timeseries can end up with many small batches,
+// which take more space and are slower to query. The compaction happens in a single transaction, so it is safe to
+// run while the timeseries is being written and queried.
+func (ts *TimeseriesDB) Compact(tsid string) (res *CompactionResult, err error) {
+	var tx database.TxWrapper
+	tx, err = ts.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+	r, err := ts.compact(tx, "timeseries", tsid)
+	if err != nil {
+		return nil, err
+	}
+	res = &CompactionResult{}
+	res.add(r)
+	return res, nil
+}
+
+// CompactAll compacts all timeseries that have more than one undersized batch
+func (ts *TimeseriesDB) CompactAll() (*CompactionResult, error) {
+	var tsids []string
+	err := ts.DB.Select(&tsids, "SELECT tsid FROM timeseries WHERE length<? GROUP BY tsid HAVING COUNT(*)>1", ts.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	res := &CompactionResult{}
+	for _, tsid := range tsids {
+		// Each timeseries is compacted in its own transaction, so that inserts are not blocked for the entire run
+		r, err := ts.Compact(tsid)
+		if err != nil {
+			return res, err
+		}
+		res.add(r)
+	}
+	return res, nil
+}
+
+// Compactor periodically runs CompactAll in the background
+type Compactor struct {
+	ts   *TimeseriesDB
+	done chan struct{}
+}
+
+// NewCompactor starts compacting the timeseries every interval
+func NewCompactor(ts *TimeseriesDB, interval time.Duration) *Compactor {
+	c := &Compactor{
+		ts:   ts,
+		done: make(chan struct{}),
+	}
+	go c.run(interval)
+	return c
+}
+
+func (c *Compactor) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			res, err := c.ts.CompactAll()
+			if err != nil {
+				logrus.WithField("plugin", PluginName).Errorf("Batch compaction failed: %s", err.Error())
+			} else if res.BatchesMerged > 0 {
+				logrus.WithField("plugin", PluginName).Infof("Compacted %d batches in %d timeseries into %d, reclaiming %d bytes", res.BatchesMerged, res.Timeseries, res.BatchesWritten, res.Reclaimed)
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Close stops the background compaction
+func (c *Compactor) Close() {
+	close(c.done)
+}
@@ -0,0 +1,60 @@
+package timeseries
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompact(t *testing.T) {
+	adb, oid1, oid2, cleanup := newDBWithObjects(t)
+	defer cleanup()
+
+	s := TimeseriesDB{
+		DB:                    adb,
+		BatchSize:             3,
+		MaxBatchSize:          5,
+		BatchCompressionLevel: 2,
+	}
+
+	// Write each datapoint as its own batch, as would happen with trickling inserts
+	tx, err := adb.Beginx()
+	require.NoError(t, err)
+	for _, dp := range dpa6 {
+		require.NoError(t, s.writeBatch(tx, "timeseries", oid1, DatapointArray{dp}))
+	}
+	require.NoError(t, s.writeBatch(tx, "timeseries", oid2, dpa4))
+	require.NoError(t, tx.Commit())
+
+	var batches int
+	require.NoError(t, adb.Get(&batches, "SELECT COUNT(*) FROM timeseries WHERE tsid=?", oid1))
+	require.Equal(t, len(dpa6), batches)
+
+	res, err := s.CompactAll()
+	require.NoError(t, err)
+	require.Equal(t, 1, res.Timeseries)
+	require.Equal(t, len(dpa6), res.BatchesMerged)
+	require.Equal(t, 2, res.BatchesWritten)
+	require.True(t, res.Reclaimed > 0)
+
+	require.NoError(t, adb.Get(&batches, "SELECT COUNT(*) FROM timeseries WHERE tsid=?", oid1))
+	require.Equal(t, 2, batches)
+
+	// The data is unchanged
+	cmpQuery(t, s, &Query{Timeseries: oid1}, dpa6)
+	cmpQuery(t, s, &Query{Timeseries: oid2}, dpa4)
+	l, err := s.Length(oid1, false)
+	require.NoError(t, err)
+	require.EqualValues(t, len(dpa6), l)
+
+	// Compacting again does nothing
+	res, err = s.Compact(oid1)
+	require.NoError(t, err)
+	require.Equal(t, 0, res.BatchesMerged)
+
+	// Inserts work as usual on the compacted batches
+	require.NoError(t, s.Insert(oid1, NewDatapointArrayIterator(DatapointArray{&Datapoint{6.0, 0, 6., ""}}), nil))
+	l, err = s.Length(oid1, false)
+	require.NoError(t, err)
+	require.EqualValues(t, len(dpa6)+1, l)
+}
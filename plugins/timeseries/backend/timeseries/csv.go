@@ -0,0 +1,135 @@
+package timeseries
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// formatCSVData returns the csv representation of a datapoint's data. Numbers, booleans and strings
+// are written as-is, so that they can be used directly in spreadsheets, and other data is written as json.
+func formatCSVData(d interface{}) (string, error) {
+	switch v := d.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	}
+	b, err := json.Marshal(d)
+	return string(b), err
+}
+
+// parseCSVData is the inverse of formatCSVData. Values that look like numbers, booleans or json objects
+// and arrays are decoded as such, and everything else is a string.
+func parseCSVData(s string) interface{} {
+	switch s {
+	case "":
+		return nil
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	if ts := strings.TrimSpace(s); strings.HasPrefix(ts, "{") || strings.HasPrefix(ts, "[") {
+		var v interface{}
+		if err := json.Unmarshal([]byte(ts), &v); err == nil {
+			return v
+		}
+	}
+	return s
+}
+
+// WriteCSV writes the datapoints as csv with a header of t, dt and d. The actor of each datapoint
+// is included in an a column if actions is true.
+func WriteCSV(w io.Writer, data DatapointIterator, actions bool) error {
+	cw := csv.NewWriter(w)
+	header := []string{"t", "dt", "d"}
+	if actions {
+		header = append(header, "a")
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	row := make([]string, len(header))
+	dp, err := data.Next()
+	for ; err == nil && dp != nil; dp, err = data.Next() {
+		row[0] = strconv.FormatFloat(dp.Timestamp, 'f', -1, 64)
+		row[1] = strconv.FormatFloat(dp.Duration, 'f', -1, 64)
+		if row[2], err = formatCSVData(dp.Data); err != nil {
+			return err
+		}
+		if actions {
+			row[3] = dp.Actor
+		}
+		if err = cw.Write(row); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReadCSV reads datapoints from csv with a header row. The t and d columns are required, and the
+// optional dt column gives the duration. Timestamps can be unix times or RFC3339 strings.
+func ReadCSV(r io.Reader) (DatapointArray, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err == io.EOF {
+		return DatapointArray{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cols := map[string]int{"t": -1, "dt": -1, "d": -1}
+	for i, h := range header {
+		if _, ok := cols[strings.TrimSpace(h)]; ok {
+			cols[strings.TrimSpace(h)] = i
+		}
+	}
+	if cols["t"] < 0 || cols["d"] < 0 {
+		return nil, fmt.Errorf("bad_request: The csv header must have 't' and 'd' columns")
+	}
+
+	dpa := DatapointArray{}
+	for line := 2; ; line++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return dpa, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(row) < len(header) {
+			return nil, fmt.Errorf("bad_request: Line %d of the csv is missing columns", line)
+		}
+		dp := &Datapoint{Data: parseCSVData(row[cols["d"]])}
+		ts := strings.TrimSpace(row[cols["t"]])
+		if dp.Timestamp, err = strconv.ParseFloat(ts, 64); err != nil {
+			if dp.Timestamp, err = ParseTimestamp(ts); err != nil {
+				return nil, fmt.Errorf("bad_request: Invalid timestamp '%s' on line %d of the csv", ts, line)
+			}
+		}
+		if i := cols["dt"]; i >= 0 && strings.TrimSpace(row[i]) != "" {
+			if dp.Duration, err = strconv.ParseFloat(strings.TrimSpace(row[i]), 64); err != nil {
+				return nil, fmt.Errorf("bad_request: Invalid duration '%s' on line %d of the csv", row[i], line)
+			}
+		}
+		dpa = append(dpa, dp)
+	}
+}
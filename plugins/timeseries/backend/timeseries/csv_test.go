@@ -0,0 +1,38 @@
+package timeseries
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSV(t *testing.T) {
+	dpa := DatapointArray{
+		&Datapoint{Timestamp: 1, Data: 2.5},
+		&Datapoint{Timestamp: 2, Duration: 1, Data: "hello, world"},
+		&Datapoint{Timestamp: 3.5, Data: true},
+		&Datapoint{Timestamp: 4, Data: map[string]interface{}{"steps": 12.0}},
+		&Datapoint{Timestamp: 5, Data: []interface{}{1.0, "a"}},
+	}
+	var b bytes.Buffer
+	require.NoError(t, WriteCSV(&b, NewDatapointArrayIterator(dpa), false))
+	require.Equal(t, "t,dt,d\n1,0,2.5\n2,1,\"hello, world\"\n3.5,0,true\n4,0,\"{\"\"steps\"\":12}\"\n5,0,\"[1,\"\"a\"\"]\"\n", b.String())
+
+	res, err := ReadCSV(&b)
+	require.NoError(t, err)
+	require.True(t, dpa.IsEqual(res), res.String())
+
+	// Columns can be in any order, dt is optional, and timestamps can be dates
+	res, err = ReadCSV(strings.NewReader("d,t\nhi,2020-01-01T00:00:00Z\n"))
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	require.Equal(t, "hi", res[0].Data)
+	require.EqualValues(t, 1577836800, res[0].Timestamp)
+
+	_, err = ReadCSV(strings.NewReader("time,d\n1,2\n"))
+	require.Error(t, err)
+	_, err = ReadCSV(strings.NewReader("t,d\nyesterdayish,2\n"))
+	require.Error(t, err)
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"sort"
 	"strings"
 	"time"
 
@@ -38,9 +39,7 @@ of the direct approach.
 
 */
 
-var SQLVersion = 1
-
-// sqlSchema is initialized in plugin.go (SQLUpdater)
+// sqlSchema is the first version of the timeseries table, which is upgraded by migrations
 const sqlSchema = `
 
 CREATE TABLE timeseries (
@@ -88,6 +87,29 @@ CREATE INDEX timeseries_actions_duration ON timeseries_actions(tsid,tend,tstart)
 `
 */
 
+// statsVersion is the version of the timeseries table that added the summary statistics of batches
+const statsVersion = 2
+
+// migrations upgrade the timeseries table one version at a time
+var migrations = database.Migrations{
+	{
+		Version:     1,
+		Description: "Create the timeseries table",
+		Up: func(tx database.TxWrapper) error {
+			_, err := tx.Exec(sqlSchema)
+			return err
+		},
+	},
+	{
+		Version:     statsVersion,
+		Description: "Add the summary statistics of batches",
+		Up:          migrateStats,
+	},
+}
+
+// SQLVersion is the current version of the timeseries table
+var SQLVersion = migrations.Latest()
+
 //go:generate msgp -o=database_msgp.go -tests=false
 //msgp:ignore Query
 //msgp:ignore TimeseriesDB
@@ -182,6 +204,8 @@ type TimeseriesDB struct {
 	MaxBatchSize          int               `mapstructure:"max_batch_size"`
 	BatchCompressionLevel int               `mapstructure:"batch_compression_level"`
 	CompressQueryResponse bool              `mapstructure:"compress_query_response"`
+	CompactionInterval    string            `mapstructure:"compaction_interval"`
+	InfluxRules           []InfluxRule      `mapstructure:"influx_rules"`
 }
 
 func (ts *TimeseriesDB) Length(tsid string, actions bool) (l int64, err error) {
@@ -213,6 +237,55 @@ func (q Query) String() string {
 	return string(b)
 }
 
+// Restrict limits the query to the time range of data that can be read through db, which is set for share links.
+// Index-based queries are not allowed when the time range is limited.
+func (q *Query) Restrict(db database.DB) error {
+	tstart, tend := database.TimeRange(db)
+	if tstart == nil && tend == nil {
+		return nil
+	}
+	if q.I != nil || q.I1 != nil || q.I2 != nil {
+		return database.ErrAccessDenied("Only data in a time range can be read through this share link")
+	}
+	if q.T != nil {
+		t, err := ParseTimestamp(q.T)
+		if err != nil {
+			return err
+		}
+		if tstart != nil && t < *tstart || tend != nil && t >= *tend {
+			return database.ErrAccessDenied("The timestamp is outside of the share link's time range")
+		}
+		return nil
+	}
+	if tstart != nil {
+		if q.T1 == nil {
+			q.T1 = *tstart
+		} else {
+			t1, err := ParseTimestamp(q.T1)
+			if err != nil {
+				return err
+			}
+			if t1 < *tstart {
+				q.T1 = *tstart
+			}
+		}
+	}
+	if tend != nil {
+		if q.T2 == nil {
+			q.T2 = *tend
+		} else {
+			t2, err := ParseTimestamp(q.T2)
+			if err != nil {
+				return err
+			}
+			if t2 > *tend {
+				q.T2 = *tend
+			}
+		}
+	}
+	return nil
+}
+
 func (ts *TimeseriesDB) rawQuery(q *Query) (DatapointIterator, error) {
 	table := "timeseries"
 	if q.Timeseries == "" {
@@ -285,6 +358,10 @@ func (ts *TimeseriesDB) rawQuery(q *Query) (DatapointIterator, error) {
 			return nil, err
 		}
 		bi := BatchIterator(SQLBatchIterator{rows, nil})
+		if q.T2 != nil {
+			// The end time needs to apply to the first batch too, which can extend past t2
+			bi = BatchEndTime{bi, t2}
+		}
 		da, err := bi.NextBatch()
 		if err != nil || da == nil {
 			return EmptyIterator{}, err
@@ -295,9 +372,6 @@ func (ts *TimeseriesDB) rawQuery(q *Query) (DatapointIterator, error) {
 				return EmptyIterator{}, err
 			}
 		}
-		if q.T2 != nil {
-			bi = BatchEndTime{bi, t2}
-		}
 		return NewBatchDatapointIterator(NewChanBatchIterator(bi), da), nil
 
 	}
@@ -789,7 +863,7 @@ func (ts *TimeseriesDB) writeBatch(tx database.TxWrapper, table, tsid string, cu
 	if ts.DB.Assets().Config.Verbose {
 		logrus.WithField("timeseries", tsid).Debugln("Writing Batch: ", curBatch.String())
 	}
-	_, err = tx.Exec(fmt.Sprintf("INSERT OR REPLACE INTO %s(tsid,tstart,tend,length,data) VALUES (?,?,?,?,?);", table), tsid, curBatch[0].Timestamp, curBatch[len(curBatch)-1].EndTime(), len(curBatch), b)
+	_, err = tx.Exec(batchStatement(table), batchValues(tsid, curBatch, b)...)
 	return err
 }
 
@@ -941,12 +1015,8 @@ func (ts *TimeseriesDB) mergeBatch(tx database.TxWrapper, table, tsid string, cb
 
 }
 
-type batchinfo struct {
-	tstart float64
-	tend   float64
-	length int
-	data   []byte
-}
+// batchinfo holds the values of a batch that is ready to be written
+type batchinfo []interface{}
 
 func (ts *TimeseriesDB) append(tx database.TxWrapper, table, tsid string, curBatch DatapointArray, data DatapointIterator, dp *Datapoint) error {
 	// This is an appending insert. Let's DO THIS, we are now free to go crazy - we can prepare the batches in another thread entirely,
@@ -954,7 +1024,7 @@ func (ts *TimeseriesDB) append(tx database.TxWrapper, table, tsid string, curBat
 
 	var gerr error
 	closer := make(chan bool, 1)
-	batcher := make(chan *batchinfo, 3)
+	batcher := make(chan batchinfo, 3)
 
 	go func() {
 		for {
@@ -969,12 +1039,7 @@ func (ts *TimeseriesDB) append(tx database.TxWrapper, table, tsid string, curBat
 					logrus.WithField("timeseries", tsid).Debugln("Appending Batch: ", curBatch.String())
 				}
 				// Write the remaining elements of this batch, and exit
-				batcher <- &batchinfo{
-					tstart: curBatch[0].Timestamp,
-					tend:   curBatch[len(curBatch)-1].Timestamp + curBatch[len(curBatch)-1].Duration,
-					length: len(curBatch),
-					data:   b,
-				}
+				batcher <- batchValues(tsid, curBatch, b)
 				batcher <- nil
 				return
 			}
@@ -997,12 +1062,7 @@ func (ts *TimeseriesDB) append(tx database.TxWrapper, table, tsid string, curBat
 				case <-closer:
 					batcher <- nil
 					return
-				case batcher <- &batchinfo{
-					tstart: prevBatch[0].Timestamp,
-					tend:   prevBatch[len(prevBatch)-1].Timestamp + prevBatch[len(prevBatch)-1].Duration,
-					length: len(prevBatch),
-					data:   b,
-				}:
+				case batcher <- batchValues(tsid, prevBatch, b):
 
 				}
 
@@ -1017,10 +1077,10 @@ func (ts *TimeseriesDB) append(tx database.TxWrapper, table, tsid string, curBat
 
 	}()
 
-	statement := fmt.Sprintf("INSERT OR REPLACE INTO %s(tsid,tstart,tend,length,data) VALUES (?,?,?,?,?);", table)
+	statement := batchStatement(table)
 
 	for b := <-batcher; b != nil; b = <-batcher {
-		_, err := tx.Exec(statement, tsid, b.tstart, b.tend, b.length, b.data)
+		_, err := tx.Exec(statement, b...)
 		if err != nil {
 			closer <- true
 			for b = <-batcher; b != nil; b = <-batcher {
@@ -1039,36 +1099,78 @@ type InsertQuery struct {
 	Method *string `json:"method,omitempty"`
 }
 
-func (ts *TimeseriesDB) Insert(tsid string, data DatapointIterator, q *InsertQuery) (err error) {
-	table := "timeseries"
-	method := 0 // 0 is update
-
-	// Make sure data comes in sorted and without any funny business
-	data = NewSortChecker(data)
-
-	if q != nil {
-		if q.Actions != nil && *q.Actions {
-			table = "timeseries_actions"
-		}
+// insertMethod returns the table and method of the insert query
+func (q *InsertQuery) insertMethod() (table string, method int, err error) {
+	table = "timeseries"
+	method = 0 // 0 is update
+	if q == nil {
+		return
+	}
+	if q.Actions != nil && *q.Actions {
+		table = "timeseries_actions"
+	}
 
-		if q.Method != nil {
-			if *q.Method == "insert" {
-				method = 1
-			} else if *q.Method == "append" {
-				method = 2
-			} else if *q.Method == "update" {
-			} else {
-				return errors.New("bad_query: Unrecognized insert method")
-			}
+	if q.Method != nil {
+		if *q.Method == "insert" {
+			method = 1
+		} else if *q.Method == "append" {
+			method = 2
+		} else if *q.Method == "update" {
+		} else {
+			err = errors.New("bad_query: Unrecognized insert method")
 		}
 	}
+	return
+}
 
-	delStatement := fmt.Sprintf("DELETE FROM %s WHERE tsid=? AND tstart=?", table)
+// SeriesInsert is the data inserted into one of the timeseries of InsertMany
+type SeriesInsert struct {
+	Data  DatapointIterator
+	Query *InsertQuery
+}
 
-	var dp *Datapoint
-	dp, err = data.Next()
-	if err != nil || dp == nil {
-		return err
+func (ts *TimeseriesDB) Insert(tsid string, data DatapointIterator, q *InsertQuery) (err error) {
+	return ts.InsertMany(map[string]*SeriesInsert{tsid: {Data: data, Query: q}})
+}
+
+// InsertMany inserts data into multiple timeseries, given by their IDs, in a single transaction.
+// Either the data of all timeseries is inserted, or nothing is.
+func (ts *TimeseriesDB) InsertMany(series map[string]*SeriesInsert) (err error) {
+	type pendingInsert struct {
+		tsid   string
+		table  string
+		method int
+		dp     *Datapoint
+		data   DatapointIterator
+	}
+	tsids := make([]string, 0, len(series))
+	for tsid := range series {
+		tsids = append(tsids, tsid)
+	}
+	sort.Strings(tsids)
+
+	pending := make([]pendingInsert, 0, len(series))
+	for _, tsid := range tsids {
+		p := pendingInsert{tsid: tsid}
+		if p.table, p.method, err = series[tsid].Query.insertMethod(); err != nil {
+			return err
+		}
+		// Make sure data comes in sorted and without any funny business
+		p.data = NewSortChecker(series[tsid].Data)
+		p.dp, err = p.data.Next()
+		if err != nil {
+			return err
+		}
+		if p.dp == nil {
+			continue
+		}
+		if err = ts.DB.CheckObjectStorageQuota(tsid); err != nil {
+			return err
+		}
+		pending = append(pending, p)
+	}
+	if len(pending) == 0 {
+		return nil
 	}
 
 	var tx database.TxWrapper
@@ -1083,6 +1185,17 @@ func (ts *TimeseriesDB) Insert(tsid string, data DatapointIterator, q *InsertQue
 			err = tx.Commit()
 		}
 	}()
+	for _, p := range pending {
+		if err = ts.insert(tx, p.table, p.tsid, p.method, p.dp, p.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insert merges the data, starting with the datapoint dp, into the timeseries
+func (ts *TimeseriesDB) insert(tx database.TxWrapper, table, tsid string, method int, dp *Datapoint, data DatapointIterator) (err error) {
+	delStatement := fmt.Sprintf("DELETE FROM %s WHERE tsid=? AND tstart=?", table)
 
 	// Get the batch immediately preceding the datapoint
 	var rows *sqlx.Rows
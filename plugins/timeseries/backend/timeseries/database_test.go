@@ -121,6 +121,24 @@ func cmpQuery(t *testing.T, s TimeseriesDB, q *Query, res DatapointArray) {
 	require.True(t, res.IsEqual(dpa), "%s different from %s", res.String(), dpa.String())
 }
 
+func TestQueryTimeRange(t *testing.T) {
+	adb, oid1, _, cleanup := newDBWithObjects(t)
+	defer cleanup()
+
+	s := TimeseriesDB{
+		DB:           adb,
+		BatchSize:    3,
+		MaxBatchSize: 5,
+	}
+	require.NoError(t, s.Insert(oid1, NewDatapointArrayIterator(dpa6), nil))
+
+	// The end of the range applies within the first batch read, and not only to the batches after it
+	cmpQuery(t, s, &Query{Timeseries: oid1, T2: 2.0}, dpa6[:1])
+	cmpQuery(t, s, &Query{Timeseries: oid1, T1: 2.0, T2: 4.0}, dpa6[1:3])
+	cmpQuery(t, s, &Query{Timeseries: oid1, T1: 2.0, T2: 10.0}, dpa6[1:])
+	cmpQuery(t, s, &Query{Timeseries: oid1, T1: 4.0, T2: 4.0}, DatapointArray{})
+}
+
 func TestDatabase(t *testing.T) {
 	adb, oid1, oid2, cleanup := newDBWithObjects(t)
 	defer cleanup()
@@ -624,6 +642,38 @@ func TestBatching(t *testing.T) {
 	})
 }
 
+func TestInsertMany(t *testing.T) {
+	adb, oid1, oid2, cleanup := newDBWithObjects(t)
+	defer cleanup()
+
+	s := TimeseriesDB{
+		DB:                    adb,
+		BatchSize:             3,
+		MaxBatchSize:          5,
+		BatchCompressionLevel: 2,
+	}
+	insert := "insert"
+	require.NoError(t, s.Insert(oid2, NewDatapointArrayIterator(DatapointArray{
+		&Datapoint{1., 0, 1, ""},
+	}), nil))
+
+	// A conflict in one timeseries means that nothing is written to the others
+	require.Error(t, s.InsertMany(map[string]*SeriesInsert{
+		oid1: {Data: NewDatapointArrayIterator(DatapointArray{&Datapoint{1., 0, 1, ""}, &Datapoint{2., 0, 2, ""}})},
+		oid2: {Data: NewDatapointArrayIterator(DatapointArray{&Datapoint{1., 0, 3, ""}}), Query: &InsertQuery{Method: &insert}},
+	}))
+	l, err := s.Length(oid1, false)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, l)
+
+	require.NoError(t, s.InsertMany(map[string]*SeriesInsert{
+		oid1: {Data: NewDatapointArrayIterator(DatapointArray{&Datapoint{1., 0, 1, ""}, &Datapoint{2., 0, 2, ""}})},
+		oid2: {Data: NewDatapointArrayIterator(DatapointArray{&Datapoint{2., 0, 3, ""}}), Query: &InsertQuery{Method: &insert}},
+	}))
+	cmpQuery(t, s, &Query{Timeseries: oid1}, DatapointArray{&Datapoint{1., 0, 1, ""}, &Datapoint{2., 0, 2, ""}})
+	cmpQuery(t, s, &Query{Timeseries: oid2}, DatapointArray{&Datapoint{1., 0, 1, ""}, &Datapoint{2., 0, 3, ""}})
+}
+
 func TestDurationUpdate(t *testing.T) {
 	adb, oid1, _, cleanup := newDBWithObjects(t)
 	defer cleanup()
@@ -667,3 +717,35 @@ func TestDurationUpdate(t *testing.T) {
 
 	require.True(t, output.IsEqual(dpa), "%s different from %s", dpa.String(), output.String())
 }
+
+func TestQueryRestrict(t *testing.T) {
+	q := &Query{Timeseries: "ts", T1: 1.0}
+	require.NoError(t, q.Restrict(nil))
+	require.Equal(t, 1.0, q.T1)
+
+	tstart, tend := 10.0, 20.0
+	sdb := database.NewShareLinkDB(nil, &database.ShareLink{TStart: &tstart, TEnd: &tend})
+
+	q = &Query{Timeseries: "ts", T1: 5.0, T2: 15.0}
+	require.NoError(t, q.Restrict(sdb))
+	require.Equal(t, 10.0, q.T1)
+	require.Equal(t, 15.0, q.T2)
+
+	q = &Query{Timeseries: "ts"}
+	require.NoError(t, q.Restrict(sdb))
+	require.Equal(t, 10.0, q.T1)
+	require.Equal(t, 20.0, q.T2)
+
+	q = &Query{Timeseries: "ts", T: 25.0}
+	require.Error(t, q.Restrict(sdb))
+
+	// The end of the range is excluded, like in range queries
+	q = &Query{Timeseries: "ts", T: 10.0}
+	require.NoError(t, q.Restrict(sdb))
+	q = &Query{Timeseries: "ts", T: 20.0}
+	require.Error(t, q.Restrict(sdb))
+
+	i := int64(-5)
+	q = &Query{Timeseries: "ts", I1: &i}
+	require.Error(t, q.Restrict(sdb))
+}
@@ -46,6 +46,9 @@ func (q *Query) Get(db database.DB, tstart float64) (*DatasetIterator, error) {
 	if !obj.Access.HasScope("read") {
 		return nil, errors.New("access_denied: The given object can't be read")
 	}
+	if err = q.Restrict(db); err != nil {
+		return nil, err
+	}
 
 	iter, err := TSDB.Query(q)
 	if err != nil {
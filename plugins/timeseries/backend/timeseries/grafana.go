@@ -0,0 +1,346 @@
+package timeseries
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/heedy/heedy/api/golang/rest"
+	"github.com/heedy/heedy/backend/database"
+	"github.com/heedy/pipescript"
+)
+
+/* The Grafana data source implements the API expected by Grafana's JSON/SimpleJSON data source plugin,
+so that heedy timeseries can be graphed directly in Grafana. The data source URL is set to
+https://myheedy/api/timeseries/grafana, and authenticated by an app's access token, either given as
+a bearer token in a custom Authorization header, or as the password when using basic auth.
+
+A query target is the ID of a timeseries, as returned from /search. The target's additional JSON data
+(payload) can be a full Dataset query, allowing PipeScript transforms, merges and datasets to be graphed.
+*/
+
+// grafanaRange is the time range of a Grafana query
+type grafanaRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+type grafanaTarget struct {
+	Target  string          `json:"target"`
+	RefID   string          `json:"refId"`
+	Type    string          `json:"type"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+type grafanaQuery struct {
+	Range   grafanaRange    `json:"range"`
+	Targets []grafanaTarget `json:"targets"`
+}
+
+type grafanaAnnotationQuery struct {
+	Range      grafanaRange           `json:"range"`
+	Annotation map[string]interface{} `json:"annotation"`
+}
+
+type grafanaSeries struct {
+	Target     string           `json:"target"`
+	Datapoints [][2]interface{} `json:"datapoints"`
+}
+
+type grafanaColumn struct {
+	Text string `json:"text"`
+	Type string `json:"type,omitempty"`
+}
+
+type grafanaTable struct {
+	Type    string          `json:"type"`
+	Columns []grafanaColumn `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+type grafanaAnnotation struct {
+	Annotation map[string]interface{} `json:"annotation"`
+	Time       int64                  `json:"time"`
+	TimeEnd    int64                  `json:"timeEnd,omitempty"`
+	IsRegion   bool                   `json:"isRegion,omitempty"`
+	Title      string                 `json:"title"`
+	Text       string                 `json:"text"`
+	Tags       []string               `json:"tags"`
+}
+
+type grafanaSearchResult struct {
+	Text  string `json:"text"`
+	Value string `json:"value"`
+}
+
+// grafanaTime converts a timestamp in seconds to the milliseconds used by Grafana
+func grafanaTime(t float64) int64 {
+	return int64(t * 1000)
+}
+
+// grafanaValue converts datapoint data to a value that Grafana can graph
+func grafanaValue(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	if f, ok := pipescript.Float(v); ok {
+		return f
+	}
+	return nil
+}
+
+// timeseriesName returns the name to display for the given timeseries
+func timeseriesName(db database.DB, tsid string) string {
+	o, err := db.ReadObject(tsid, &database.ReadObjectOptions{Icon: false})
+	if err != nil || o.Name == nil {
+		return tsid
+	}
+	return *o.Name
+}
+
+// grafanaDataset returns the dataset query for a Grafana target over the given range
+func grafanaDataset(t *grafanaTarget, rng grafanaRange) (*Dataset, error) {
+	d := &Dataset{}
+	payload := t.Payload
+	if len(payload) == 0 {
+		payload = t.Data
+	}
+	if len(payload) > 0 && string(payload) != "null" && string(payload) != "{}" {
+		if err := json.Unmarshal(payload, d); err != nil {
+			return nil, fmt.Errorf("bad_query: invalid query data for target '%s': %w", t.Target, err)
+		}
+	}
+	if d.Timeseries == "" && len(d.Merge) == 0 && d.Dt == nil {
+		if t.Target == "" {
+			return nil, errors.New("bad_query: no timeseries specified")
+		}
+		d.Timeseries = t.Target
+	}
+	if d.T1 == nil && d.I1 == nil && d.T == nil && d.I == nil {
+		d.T1 = float64(rng.From.UnixNano()) * 1e-9
+	}
+	if d.T2 == nil && d.I2 == nil && d.T == nil && d.I == nil {
+		d.T2 = float64(rng.To.UnixNano()) * 1e-9
+	}
+	return d, nil
+}
+
+// grafanaRead reads the result of the target's query, splitting data that is an object (such as the output of a dataset)
+// into a separate column for each key.
+func grafanaRead(db database.DB, t *grafanaTarget, rng grafanaRange) (keys []string, times []int64, values []map[string]interface{}, err error) {
+	d, err := grafanaDataset(t, rng)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	di, err := d.Get(db)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer di.Close()
+
+	keyset := make(map[string]bool)
+	var buf pipescript.Datapoint
+	for {
+		dp, err := di.Next(&buf)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if dp == nil {
+			break
+		}
+		row := make(map[string]interface{})
+		if m, ok := dp.Data.(map[string]interface{}); ok {
+			for k, v := range m {
+				keyset[k] = true
+				row[k] = v
+			}
+		} else {
+			keyset[""] = true
+			row[""] = dp.Data
+		}
+		times = append(times, grafanaTime(dp.Timestamp))
+		values = append(values, row)
+	}
+	keys = make([]string, 0, len(keyset))
+	for k := range keyset {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, times, values, nil
+}
+
+// GrafanaSearch returns the timeseries accessible to the authenticated app, filtered by the search target
+func GrafanaSearch(w http.ResponseWriter, r *http.Request) {
+	c := rest.CTX(r)
+	var s struct {
+		Target string `json:"target"`
+	}
+	if err := rest.UnmarshalRequest(r, &s); err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	otype := "timeseries"
+	objs, err := c.DB.ListObjects(&database.ListObjectsOptions{
+		Type: &otype,
+	})
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	search := strings.ToLower(s.Target)
+	res := make([]grafanaSearchResult, 0, len(objs))
+	for _, o := range objs {
+		name := o.ID
+		if o.Name != nil {
+			name = *o.Name
+		}
+		if search == "" || strings.Contains(strings.ToLower(name), search) || o.ID == s.Target {
+			res = append(res, grafanaSearchResult{Text: name, Value: o.ID})
+		}
+	}
+	rest.WriteJSON(w, r, res, nil)
+}
+
+// GrafanaQuery returns the data of each target, in either timeseries or table format
+func GrafanaQuery(w http.ResponseWriter, r *http.Request) {
+	c := rest.CTX(r)
+	var q grafanaQuery
+	if err := rest.UnmarshalRequest(r, &q); err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	res := make([]interface{}, 0, len(q.Targets))
+	for i := range q.Targets {
+		t := &q.Targets[i]
+		keys, times, values, err := grafanaRead(c.DB, t, q.Range)
+		if err != nil {
+			rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+			return
+		}
+		name := t.Target
+		if name == "" {
+			name = t.RefID
+		} else {
+			name = timeseriesName(c.DB, t.Target)
+		}
+
+		if t.Type == "table" {
+			tbl := &grafanaTable{
+				Type:    "table",
+				Columns: []grafanaColumn{{Text: "Time", Type: "time"}},
+				Rows:    make([][]interface{}, len(times)),
+			}
+			for _, k := range keys {
+				if k == "" {
+					tbl.Columns = append(tbl.Columns, grafanaColumn{Text: name})
+				} else {
+					tbl.Columns = append(tbl.Columns, grafanaColumn{Text: k})
+				}
+			}
+			for j := range times {
+				row := make([]interface{}, 1, len(keys)+1)
+				row[0] = times[j]
+				for _, k := range keys {
+					row = append(row, values[j][k])
+				}
+				tbl.Rows[j] = row
+			}
+			res = append(res, tbl)
+			continue
+		}
+
+		for _, k := range keys {
+			s := &grafanaSeries{
+				Target:     name,
+				Datapoints: make([][2]interface{}, 0, len(times)),
+			}
+			if k != "" {
+				s.Target = name + "." + k
+			}
+			for j := range times {
+				if v, ok := values[j][k]; ok {
+					s.Datapoints = append(s.Datapoints, [2]interface{}{grafanaValue(v), times[j]})
+				}
+			}
+			res = append(res, s)
+		}
+	}
+	rest.WriteJSON(w, r, res, nil)
+}
+
+// GrafanaAnnotations returns the datapoints of the timeseries given in the annotation query as annotations.
+// The query is either a timeseries ID, or a JSON query object, allowing a transform to filter the relevant datapoints.
+func GrafanaAnnotations(w http.ResponseWriter, r *http.Request) {
+	c := rest.CTX(r)
+	var q grafanaAnnotationQuery
+	if err := rest.UnmarshalRequest(r, &q); err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	query, _ := q.Annotation["query"].(string)
+	query = strings.TrimSpace(query)
+	t := &grafanaTarget{Target: query}
+	if strings.HasPrefix(query, "{") {
+		t = &grafanaTarget{Data: json.RawMessage(query)}
+	}
+	d, err := grafanaDataset(t, q.Range)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	title := ""
+	if d.Timeseries != "" {
+		title = timeseriesName(c.DB, d.Timeseries)
+	}
+	di, err := d.Get(c.DB)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	defer di.Close()
+
+	res := []grafanaAnnotation{}
+	var buf pipescript.Datapoint
+	for {
+		dp, err := di.Next(&buf)
+		if err != nil {
+			rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+			return
+		}
+		if dp == nil {
+			break
+		}
+		a := grafanaAnnotation{
+			Annotation: q.Annotation,
+			Time:       grafanaTime(dp.Timestamp),
+			Title:      title,
+			Text:       dp.ToString(),
+			Tags:       []string{},
+		}
+		if dp.Duration > 0 {
+			a.IsRegion = true
+			a.TimeEnd = grafanaTime(dp.Timestamp + dp.Duration)
+		}
+		res = append(res, a)
+	}
+	rest.WriteJSON(w, r, res, nil)
+}
+
+// GrafanaHandler serves the Grafana data source API
+var GrafanaHandler = func() *chi.Mux {
+	m := chi.NewMux()
+	// Grafana checks the connection with a GET request on the data source's root
+	m.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		rest.WriteResult(w, r, nil)
+	})
+	m.Post("/search", GrafanaSearch)
+	m.Post("/query", GrafanaQuery)
+	m.Post("/annotations", GrafanaAnnotations)
+	return m
+}()
@@ -0,0 +1,50 @@
+package timeseries
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGrafanaRead(t *testing.T) {
+	adb, oid1, oid2, cleanup := newDBWithObjects(t)
+	defer cleanup()
+
+	sd := TimeseriesDB{DB: adb,
+		BatchSize:             3,
+		MaxBatchSize:          5,
+		BatchCompressionLevel: 3}
+	TSDB = sd
+	require.NoError(t, sd.Insert(oid1, NewDatapointArrayIterator(dpa6), &InsertQuery{}))
+	require.NoError(t, sd.Insert(oid2, NewDatapointArrayIterator(dpa1), &InsertQuery{}))
+
+	rng := grafanaRange{From: time.Unix(2, 0), To: time.Unix(4, 0)}
+
+	// A plain target reads the timeseries within the range
+	keys, times, values, err := grafanaRead(adb, &grafanaTarget{Target: oid1}, rng)
+	require.NoError(t, err)
+	require.Equal(t, []string{""}, keys)
+	require.Equal(t, []int64{2000, 3000}, times)
+	require.Equal(t, 2.0, grafanaValue(values[0][""]))
+
+	// Query data in the payload can transform the data into an object, which is split by key
+	keys, times, values, err = grafanaRead(adb, &grafanaTarget{
+		Target:  oid1,
+		Payload: json.RawMessage(`{"transform": "{'x': d, 'y': d*2}"}`),
+	}, rng)
+	require.NoError(t, err)
+	require.Equal(t, []string{"x", "y"}, keys)
+	require.Len(t, times, 2)
+	require.Equal(t, 6.0, grafanaValue(values[1]["y"]))
+
+	// Strings can't be graphed
+	_, _, values, err = grafanaRead(adb, &grafanaTarget{Target: oid2}, grafanaRange{From: time.Unix(0, 0), To: time.Unix(10, 0)})
+	require.NoError(t, err)
+	require.Len(t, values, 2)
+	require.Nil(t, grafanaValue(values[0][""]))
+
+	_, _, _, err = grafanaRead(adb, &grafanaTarget{}, rng)
+	require.Error(t, err)
+}
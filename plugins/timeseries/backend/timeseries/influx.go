@@ -0,0 +1,308 @@
+package timeseries
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/klauspost/compress/gzip"
+
+	"github.com/heedy/heedy/api/golang/rest"
+	"github.com/heedy/heedy/backend/database"
+)
+
+/* The InfluxDB endpoints allow sensors, Telegraf and other IoT devices to write data to heedy with
+InfluxDB line protocol. Writes must be authenticated with an app's access token, and each series
+(measurement and identifying tags) is mapped to a timeseries belonging to the app, which is created
+on first write. The object key of the timeseries identifies the series, so renaming the timeseries
+or changing its schema in heedy doesn't affect the mapping.
+*/
+
+// InfluxRule configures how the points of matching measurements are mapped to timeseries
+type InfluxRule struct {
+	// A glob pattern of the measurements to which the rule applies
+	Measurement string `mapstructure:"measurement"`
+	// Drop the points of matching measurements
+	Ignore bool `mapstructure:"ignore"`
+	// The tags that identify a timeseries. Points with different values of other tags are written to the same timeseries.
+	// If not set, all tags are used.
+	Tags *[]string `mapstructure:"tags"`
+	// Write each field to its own timeseries, rather than writing an object of all fields as the datapoint data
+	SplitFields bool `mapstructure:"split_fields"`
+	// The name of created timeseries, where {measurement}, {field} and {tag.mytag} are replaced with their values
+	Name string `mapstructure:"name"`
+}
+
+// defaultInfluxRule applies to measurements that match no configured rule
+var defaultInfluxRule = InfluxRule{Measurement: "*"}
+
+// influxRule returns the first rule matching the measurement
+func (ts *TimeseriesDB) influxRule(measurement string) *InfluxRule {
+	for i := range ts.InfluxRules {
+		if ok, _ := path.Match(ts.InfluxRules[i].Measurement, measurement); ok {
+			return &ts.InfluxRules[i]
+		}
+	}
+	return &defaultInfluxRule
+}
+
+// influxSeries holds the points written to a single timeseries
+type influxSeries struct {
+	Key  string
+	Name string
+	Data map[float64]interface{}
+}
+
+// name returns the name of the timeseries to create for the given point and field
+func (r *InfluxRule) name(p *LinePoint, tags []string, field string) string {
+	if r.Name != "" {
+		name := strings.ReplaceAll(r.Name, "{measurement}", p.Measurement)
+		name = strings.ReplaceAll(name, "{field}", field)
+		for k, v := range p.Tags {
+			name = strings.ReplaceAll(name, "{tag."+k+"}", v)
+		}
+		return name
+	}
+	name := p.Measurement
+	if field != "" {
+		name += " " + field
+	}
+	if len(tags) > 0 {
+		tv := make([]string, len(tags))
+		for i, t := range tags {
+			tv[i] = p.Tags[t]
+		}
+		name += " (" + strings.Join(tv, ", ") + ")"
+	}
+	return name
+}
+
+// InfluxSeries groups the points into the timeseries they are written to, according to the configured mapping rules.
+// Points without a timestamp are given the time t.
+func (ts *TimeseriesDB) InfluxSeries(points []*LinePoint, t float64) []*influxSeries {
+	series := make(map[string]*influxSeries)
+	add := func(key, name string, timestamp float64, data interface{}) {
+		s, ok := series[key]
+		if !ok {
+			s = &influxSeries{Key: key, Name: name, Data: make(map[float64]interface{})}
+			series[key] = s
+		}
+		// Fields of the same point can be spread over multiple lines, so objects with the same timestamp are merged
+		if m, ok := data.(map[string]interface{}); ok {
+			if cur, ok := s.Data[timestamp].(map[string]interface{}); ok {
+				for k, v := range m {
+					cur[k] = v
+				}
+				return
+			}
+		}
+		s.Data[timestamp] = data
+	}
+
+	for _, p := range points {
+		r := ts.influxRule(p.Measurement)
+		if r.Ignore {
+			continue
+		}
+		var tags []string
+		if r.Tags == nil {
+			for k := range p.Tags {
+				tags = append(tags, k)
+			}
+		} else {
+			for _, k := range *r.Tags {
+				if _, ok := p.Tags[k]; ok {
+					tags = append(tags, k)
+				}
+			}
+		}
+		sort.Strings(tags)
+
+		key := "influx:" + p.Measurement
+		for _, k := range tags {
+			key += "," + k + "=" + p.Tags[k]
+		}
+		timestamp := t
+		if p.Timestamp != nil {
+			timestamp = *p.Timestamp
+		}
+
+		if r.SplitFields {
+			for f, v := range p.Fields {
+				add(key+" "+f, r.name(p, tags, f), timestamp, v)
+			}
+		} else {
+			fields := make(map[string]interface{}, len(p.Fields))
+			for f, v := range p.Fields {
+				fields[f] = v
+			}
+			add(key, r.name(p, tags, ""), timestamp, fields)
+		}
+	}
+
+	res := make([]*influxSeries, 0, len(series))
+	for _, s := range series {
+		res = append(res, s)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Key < res[j].Key })
+	return res
+}
+
+// Datapoints returns the series' data as a sorted DatapointArray
+func (s *influxSeries) Datapoints() DatapointArray {
+	dpa := make(DatapointArray, 0, len(s.Data))
+	for t, v := range s.Data {
+		dpa = append(dpa, &Datapoint{Timestamp: t, Data: v})
+	}
+	sort.Slice(dpa, func(i, j int) bool { return dpa[i].Timestamp < dpa[j].Timestamp })
+	return dpa
+}
+
+// influxTarget is a timeseries that is written by a line protocol request. Its ID is empty until the timeseries is created.
+type influxTarget struct {
+	ID       string
+	Modified *string
+	Data     DatapointArray
+
+	series *influxSeries
+}
+
+// getInfluxTarget returns the app's timeseries for the series, and validates the data against its schema.
+// Timeseries that don't exist yet are only created by create, once all series of the request were validated.
+func getInfluxTarget(db database.DB, s *influxSeries) (*influxTarget, error) {
+	self := "self"
+	otype := "timeseries"
+	objs, err := db.ListObjects(&database.ListObjectsOptions{
+		App:  &self,
+		Key:  &s.Key,
+		Type: &otype,
+	})
+	if err != nil {
+		return nil, err
+	}
+	it := &influxTarget{Data: s.Datapoints(), series: s}
+	if len(objs) == 0 {
+		return it, nil
+	}
+	o := objs[0]
+	if !o.Access.HasScope("write") {
+		return nil, database.ErrAccessDenied("Insufficient permissions to write timeseries '%s'", *o.Name)
+	}
+	it.ID = o.ID
+	if o.ModifiedDate != nil {
+		d := o.ModifiedDate.String()
+		it.Modified = &d
+	}
+	if o.Meta != nil {
+		if schema, ok := (*o.Meta)["schema"].(map[string]interface{}); ok && len(schema) > 0 {
+			if err = validateData(it.Data, schema, ""); err != nil {
+				return nil, fmt.Errorf("%w (timeseries '%s')", err, *o.Name)
+			}
+		}
+	}
+	return it, nil
+}
+
+// create creates the target's timeseries if it doesn't exist yet
+func (it *influxTarget) create(db database.DB) (err error) {
+	if it.ID != "" {
+		return nil
+	}
+	otype := "timeseries"
+	it.ID, err = db.CreateObject(&database.Object{
+		Details: database.Details{
+			Name: &it.series.Name,
+		},
+		Type: &otype,
+		Key:  &it.series.Key,
+	})
+	return err
+}
+
+// errBodyTooLarge is the error returned by http.MaxBytesReader once the body is over its limit
+const errBodyTooLarge = "http: request body too large"
+
+// InfluxWrite inserts data written with InfluxDB line protocol into the app's timeseries
+func InfluxWrite(w http.ResponseWriter, r *http.Request) {
+	c := rest.CTX(r)
+	if c.DB.Type() != database.AppType {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, errors.New("bad_request: line protocol writes must be authenticated with an app's access token"))
+		return
+	}
+	now := float64(time.Now().UnixNano()) * 1e-9
+
+	// The body is limited by the server's request_body_byte_limit, which also applies to the decompressed data
+	// of gzipped bodies
+	limit := TSDB.DB.Assets().Config.GetRequestBodyByteLimit()
+	if limit > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+	}
+	var body io.ReadCloser = r.Body
+	defer r.Body.Close()
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gzr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+			return
+		}
+		defer gzr.Close()
+		body = gzr
+		if limit > 0 {
+			body = http.MaxBytesReader(w, gzr, limit)
+		}
+	}
+	points, err := ParseLineProtocol(body, r.URL.Query().Get("precision"))
+	if err != nil {
+		status := http.StatusBadRequest
+		if err.Error() == errBodyTooLarge {
+			status = http.StatusRequestEntityTooLarge
+		}
+		rest.WriteJSONError(w, r, status, err)
+		return
+	}
+
+	// All series are prepared and validated before creating any timeseries or inserting any data, and the data is
+	// inserted in a single transaction, so that a bad point doesn't cause a partial write
+	series := TSDB.InfluxSeries(points, now)
+	targets := make([]*influxTarget, len(series))
+	for i, s := range series {
+		targets[i], err = getInfluxTarget(c.DB, s)
+		if err != nil {
+			rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+			return
+		}
+	}
+	writes := make(map[string]*seriesWrite, len(targets))
+	for _, it := range targets {
+		if err = it.create(c.DB); err != nil {
+			rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+			return
+		}
+		writes[it.ID] = &seriesWrite{Modified: it.Modified, Data: it.Data, Query: &InsertQuery{}}
+	}
+	if _, err = insertSeries(c, writes); err != nil {
+		rest.WriteJSONError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// InfluxHandler serves the InfluxDB-compatible write API. Clients are given the /api/timeseries/influx
+// as the server URL, and append the v1 or v2 write path.
+var InfluxHandler = func() *chi.Mux {
+	m := chi.NewMux()
+	ping := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+	m.Get("/ping", ping)
+	m.Head("/ping", ping)
+	m.Post("/write", InfluxWrite)
+	m.Post("/api/v2/write", InfluxWrite)
+	return m
+}()
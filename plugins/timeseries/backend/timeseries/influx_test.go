@@ -0,0 +1,231 @@
+package timeseries
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/heedy/heedy/api/golang/rest"
+	"github.com/heedy/heedy/backend/database"
+	"github.com/heedy/heedy/backend/database/dbutil"
+	"github.com/heedy/heedy/backend/events"
+	"github.com/klauspost/compress/gzip"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLineProtocol(t *testing.T) {
+	points, err := ParseLineProtocol(strings.NewReader(`
+# comment
+weather,location=us\ midwest,station=a temperature=82,humidity=71i,raining=f 1465839830100400200
+weather,location=us\ midwest temp\=x=1u,note="hello, \"world\" =" 1465839830
+cpu value=0.5
+`), "s")
+	require.NoError(t, err)
+	require.Len(t, points, 3)
+
+	require.Equal(t, "weather", points[0].Measurement)
+	require.Equal(t, map[string]string{"location": "us midwest", "station": "a"}, points[0].Tags)
+	require.Equal(t, map[string]interface{}{"temperature": 82.0, "humidity": 71.0, "raining": false}, points[0].Fields)
+
+	require.Equal(t, map[string]interface{}{"temp=x": 1.0, "note": `hello, "world" =`}, points[1].Fields)
+	require.Equal(t, 1465839830.0, *points[1].Timestamp)
+	require.Nil(t, points[2].Timestamp)
+
+	points, err = ParseLineProtocol(strings.NewReader("cpu value=1 1500"), "ms")
+	require.NoError(t, err)
+	require.Equal(t, 1.5, *points[0].Timestamp)
+
+	for _, bad := range []string{"cpu", "cpu value=", "cpu,host value=1", "cpu value=\"hi", "cpu value=1 notatime", "cpu value=1x"} {
+		_, err = ParseLineProtocol(strings.NewReader(bad), "")
+		require.Error(t, err, bad)
+	}
+	_, err = ParseLineProtocol(strings.NewReader("cpu value=1"), "d")
+	require.Error(t, err)
+}
+
+func TestInfluxSeries(t *testing.T) {
+	points, err := ParseLineProtocol(strings.NewReader(`
+weather,location=home,sensor=1 temperature=20 1
+weather,location=home,sensor=2 humidity=50 1
+weather,location=office temperature=22 2
+debug value=1 1
+`), "s")
+	require.NoError(t, err)
+
+	// By default, each combination of tags is a separate timeseries
+	ts := &TimeseriesDB{}
+	series := ts.InfluxSeries(points, 10)
+	require.Len(t, series, 4)
+	require.Equal(t, "influx:debug", series[0].Key)
+	require.Equal(t, "influx:weather,location=home,sensor=1", series[1].Key)
+	require.Equal(t, "weather (home, 1)", series[1].Name)
+
+	tags := []string{"location"}
+	ts.InfluxRules = []InfluxRule{
+		{Measurement: "deb*", Ignore: true},
+		{Measurement: "weather", Tags: &tags, Name: "{tag.location} weather"},
+	}
+	series = ts.InfluxSeries(points, 10)
+	require.Len(t, series, 2)
+	require.Equal(t, "influx:weather,location=home", series[0].Key)
+	require.Equal(t, "home weather", series[0].Name)
+	// Fields of points with the same timestamp are merged
+	dpa := series[0].Datapoints()
+	require.Len(t, dpa, 1)
+	require.Equal(t, map[string]interface{}{"temperature": 20.0, "humidity": 50.0}, dpa[0].Data)
+
+	ts.InfluxRules = []InfluxRule{{Measurement: "*", Tags: &[]string{}, SplitFields: true}}
+	series = ts.InfluxSeries(points, 10)
+	require.Len(t, series, 3)
+	require.Equal(t, "influx:weather temperature", series[2].Key)
+	require.Equal(t, "weather temperature", series[2].Name)
+	dpa = series[2].Datapoints()
+	require.Len(t, dpa, 2)
+	require.Equal(t, 22.0, dpa[1].Data)
+}
+
+func TestInfluxTarget(t *testing.T) {
+	adb, cleanup := newDBWithUser(t)
+	defer cleanup()
+
+	name := "test"
+	aid, _, err := adb.CreateApp(&database.App{
+		Details: database.Details{
+			Name: &name,
+		},
+		Owner: &name,
+		Scope: &database.AppScopeArray{ScopeArray: database.ScopeArray{Scope: []string{"self.objects.timeseries"}}},
+	})
+	require.NoError(t, err)
+	app, err := adb.ReadApp(aid, nil)
+	require.NoError(t, err)
+	db := database.NewAppDB(adb, app)
+
+	s := &influxSeries{Key: "influx:cpu", Name: "cpu", Data: map[float64]interface{}{1: 1.0, 2: "hi"}}
+	it, err := getInfluxTarget(db, s)
+	require.NoError(t, err)
+	require.Empty(t, it.ID)
+	require.NoError(t, it.create(db))
+	o, err := db.ReadObject(it.ID, nil)
+	require.NoError(t, err)
+	require.Equal(t, "cpu", *o.Name)
+	require.Equal(t, aid, *o.App)
+
+	// The same timeseries is returned on the next write, and the data is validated against its schema
+	require.NoError(t, adb.UpdateObject(&database.Object{
+		Details: database.Details{ID: it.ID},
+		Meta:    &dbutil.JSONObject{"schema": map[string]interface{}{"type": "number"}},
+	}))
+	_, err = getInfluxTarget(db, s)
+	require.Error(t, err)
+	delete(s.Data, 2)
+	it2, err := getInfluxTarget(db, s)
+	require.NoError(t, err)
+	require.Equal(t, it.ID, it2.ID)
+}
+
+func TestInfluxWriteLimit(t *testing.T) {
+	adb, cleanup := newDBWithUser(t)
+	defer cleanup()
+	TSDB = TimeseriesDB{DB: adb, BatchSize: 3, MaxBatchSize: 5}
+	limit := int64(64)
+	adb.Assets().Config.RequestBodyByteLimit = &limit
+
+	name := "test"
+	aid, _, err := adb.CreateApp(&database.App{
+		Details: database.Details{
+			Name: &name,
+		},
+		Owner: &name,
+		Scope: &database.AppScopeArray{ScopeArray: database.ScopeArray{Scope: []string{"self.objects.timeseries"}}},
+	})
+	require.NoError(t, err)
+	app, err := adb.ReadApp(aid, nil)
+	require.NoError(t, err)
+	db := database.NewAppDB(adb, app)
+
+	write := func(body []byte, gzipped bool) int {
+		r := httptest.NewRequest("POST", "/api/timeseries/influx/write", bytes.NewReader(body))
+		if gzipped {
+			r.Header.Set("Content-Encoding", "gzip")
+		}
+		r = r.WithContext(context.WithValue(r.Context(), rest.HeedyContext, &rest.Context{
+			DB:     db,
+			Log:    logrus.NewEntry(logrus.StandardLogger()),
+			Events: events.GlobalHandler,
+		}))
+		w := httptest.NewRecorder()
+		InfluxWrite(w, r)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusNoContent, write([]byte("cpu value=1 1000000000\n"), false))
+	large := []byte(strings.Repeat("cpu value=1 1000000000\n", 10))
+	require.Equal(t, http.StatusRequestEntityTooLarge, write(large, false))
+
+	// Compressed bodies are limited by their decompressed size
+	var b bytes.Buffer
+	gz := gzip.NewWriter(&b)
+	gz.Write(large)
+	gz.Close()
+	require.True(t, int64(b.Len()) < limit)
+	require.Equal(t, http.StatusRequestEntityTooLarge, write(b.Bytes(), true))
+}
+
+func TestInfluxWriteInvalid(t *testing.T) {
+	adb, cleanup := newDBWithUser(t)
+	defer cleanup()
+	TSDB = TimeseriesDB{DB: adb, BatchSize: 3, MaxBatchSize: 5}
+
+	name := "test"
+	aid, _, err := adb.CreateApp(&database.App{
+		Details: database.Details{
+			Name: &name,
+		},
+		Owner: &name,
+		Scope: &database.AppScopeArray{ScopeArray: database.ScopeArray{Scope: []string{"self.objects.timeseries"}}},
+	})
+	require.NoError(t, err)
+	app, err := adb.ReadApp(aid, nil)
+	require.NoError(t, err)
+	db := database.NewAppDB(adb, app)
+
+	write := func(body string) int {
+		r := httptest.NewRequest("POST", "/api/timeseries/influx/write", strings.NewReader(body))
+		r = r.WithContext(context.WithValue(r.Context(), rest.HeedyContext, &rest.Context{
+			DB:     db,
+			Log:    logrus.NewEntry(logrus.StandardLogger()),
+			Events: events.GlobalHandler,
+		}))
+		w := httptest.NewRecorder()
+		InfluxWrite(w, r)
+		return w.Code
+	}
+	count := func(key string) int {
+		self := "self"
+		objs, err := db.ListObjects(&database.ListObjectsOptions{App: &self, Key: &key})
+		require.NoError(t, err)
+		return len(objs)
+	}
+
+	require.Equal(t, http.StatusNoContent, write("mem value=1 1000000000\n"))
+	objs, err := db.ListObjects(&database.ListObjectsOptions{})
+	require.NoError(t, err)
+	require.Len(t, objs, 1)
+	require.NoError(t, adb.UpdateObject(&database.Object{
+		Details: database.Details{ID: objs[0].ID},
+		Meta: &dbutil.JSONObject{"schema": map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{"value": map[string]interface{}{"type": "number"}},
+		}},
+	}))
+
+	// A series that fails validation doesn't leave the timeseries of the other series behind
+	require.Equal(t, http.StatusBadRequest, write("cpu value=1 1000000000\nmem value=\"hi\" 2000000000\n"))
+	require.Equal(t, 0, count("influx:cpu"))
+	require.Equal(t, 1, count("influx:mem"))
+}
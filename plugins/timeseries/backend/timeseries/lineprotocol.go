@@ -0,0 +1,188 @@
+package timeseries
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// LinePoint is a single point parsed from InfluxDB line protocol
+type LinePoint struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]interface{}
+	// The timestamp of the point in seconds, or nil if the line had no timestamp
+	Timestamp *float64
+}
+
+// lineProtocolPrecision gives the number of seconds per unit of each supported timestamp precision.
+// Both the InfluxDB v1 and v2 names are accepted.
+var lineProtocolPrecision = map[string]float64{
+	"":   1e-9,
+	"n":  1e-9,
+	"ns": 1e-9,
+	"u":  1e-6,
+	"us": 1e-6,
+	"ms": 1e-3,
+	"s":  1,
+	"m":  60,
+	"h":  3600,
+}
+
+// ParseLineProtocol reads all points written in InfluxDB line protocol, with timestamps in the given precision
+func ParseLineProtocol(r io.Reader, precision string) ([]*LinePoint, error) {
+	mult, ok := lineProtocolPrecision[precision]
+	if !ok {
+		return nil, fmt.Errorf("bad_request: invalid precision '%s'", precision)
+	}
+	points := []*LinePoint{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		p, err := parseLine(string(line), mult)
+		if err != nil {
+			return nil, fmt.Errorf("bad_request: line %d: %s", lineNumber, err.Error())
+		}
+		points = append(points, p)
+	}
+	return points, scanner.Err()
+}
+
+// splitUnescaped splits s at each unescaped occurrence of sep, outside of double quotes if quotes is set.
+// Escape sequences are kept, and are removed with unescape.
+func splitUnescaped(s string, sep byte, quotes bool) []string {
+	parts := []string{}
+	inQuote := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case quotes && s[i] == '"':
+			inQuote = !inQuote
+		case s[i] == sep && !inQuote:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unescape removes the backslashes that escape commas, equals signs and spaces
+func unescape(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(", =\\", s[i+1]) >= 0 {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func parseLine(line string, mult float64) (*LinePoint, error) {
+	// A line is made up of the series (measurement and tags), the fields, and an optional timestamp,
+	// separated by unescaped spaces outside of string field values
+	sections := splitUnescaped(line, ' ', true)
+	if len(sections) < 2 || len(sections) > 3 {
+		return nil, errors.New("expected measurement, fields and optional timestamp separated by spaces")
+	}
+
+	series := splitUnescaped(sections[0], ',', false)
+	p := &LinePoint{
+		Measurement: unescape(series[0]),
+		Tags:        make(map[string]string),
+		Fields:      make(map[string]interface{}),
+	}
+	if p.Measurement == "" {
+		return nil, errors.New("missing measurement")
+	}
+	for _, t := range series[1:] {
+		kv := splitUnescaped(t, '=', false)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, fmt.Errorf("invalid tag '%s'", t)
+		}
+		p.Tags[unescape(kv[0])] = unescape(kv[1])
+	}
+
+	for _, f := range splitUnescaped(sections[1], ',', true) {
+		kv := splitUnescaped(f, '=', true)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, fmt.Errorf("invalid field '%s'", f)
+		}
+		v, err := parseFieldValue(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("field '%s': %s", unescape(kv[0]), err.Error())
+		}
+		p.Fields[unescape(kv[0])] = v
+	}
+
+	if len(sections) == 3 {
+		ts, err := strconv.ParseInt(sections[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp '%s'", sections[2])
+		}
+		t := float64(ts) * mult
+		p.Timestamp = &t
+	}
+	return p, nil
+}
+
+func parseFieldValue(v string) (interface{}, error) {
+	if v[0] == '"' {
+		if len(v) < 2 || v[len(v)-1] != '"' {
+			return nil, errors.New("unterminated string")
+		}
+		s := v[1 : len(v)-1]
+		if !strings.Contains(s, "\\") {
+			return s, nil
+		}
+		var b strings.Builder
+		for i := 0; i < len(s); i++ {
+			if s[i] == '\\' && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\') {
+				i++
+			}
+			b.WriteByte(s[i])
+		}
+		return b.String(), nil
+	}
+	switch v {
+	case "t", "T", "true", "True", "TRUE":
+		return true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return false, nil
+	}
+	// Integers are converted to floats, since all numbers are stored as JSON numbers
+	switch v[len(v)-1] {
+	case 'i':
+		i, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer '%s'", v)
+		}
+		return float64(i), nil
+	case 'u':
+		u, err := strconv.ParseUint(v[:len(v)-1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid unsigned integer '%s'", v)
+		}
+		return float64(u), nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value '%s'", v)
+	}
+	return f, nil
+}
@@ -2,6 +2,9 @@ package timeseries
 
 import (
 	"errors"
+	"fmt"
+	"path"
+	"time"
 
 	"github.com/heedy/heedy/backend/database"
 	"github.com/heedy/heedy/backend/plugins/run"
@@ -17,31 +20,22 @@ const PluginName = "timeseries"
 // The global timeseries DB object that is initialized on database start
 var TSDB TimeseriesDB
 
+// The background batch compaction, which is nil if disabled
+var compactor *Compactor
+
 // SQLUpdater is in the format expected by Heedy to update the database
 func SQLUpdater(db *database.AdminDB, i *run.Info, h run.BuiltinHelper, curversion int) error {
-	if curversion == SQLVersion {
-		return nil
-	}
-	if curversion != 0 {
-		return errors.New("Timeseries database version incompatible")
-	}
-	_, err := db.ExecUncached(sqlSchema)
-	return err
+	return db.Migrate(PluginName, migrations)
 }
 
-// StartTimeseries prepares the plugin by initializing the database
-func StartTimeseries(db *database.AdminDB, i *run.Info, h run.BuiltinHelper) error {
-	err := run.WithVersion(PluginName, SQLVersion, SQLUpdater)(db, i, h)
-	if err != nil {
-		return err
-	}
-
+// Configure sets up the global timeseries DB from the timeseries plugin configuration
+func Configure(db *database.AdminDB) error {
 	tsc, ok := db.Assets().Config.Plugins["timeseries"]
 	if !ok {
 		return errors.New("Could not find timeseries plugin configuration")
 	}
 
-	err = mapstructure.Decode(tsc.Config, &TSDB)
+	err := mapstructure.Decode(tsc.Config, &TSDB)
 	if err != nil {
 		return err
 	}
@@ -51,6 +45,12 @@ func StartTimeseries(db *database.AdminDB, i *run.Info, h run.BuiltinHelper) err
 		return errors.New("Timeseries batch size must be at least 1, and max batch size must be more than batch size")
 	}
 
+	for _, r := range TSDB.InfluxRules {
+		if _, err = path.Match(r.Measurement, ""); err != nil {
+			return fmt.Errorf("Invalid influx_rules measurement pattern '%s'", r.Measurement)
+		}
+	}
+
 	if TSDB.BatchCompressionLevel < 0 {
 		logrus.WithField("plugin", "timeseries").Warn("Batch compression off: timeseries won't be compressed")
 		zencoder = nil // set to nil means no compression
@@ -63,6 +63,37 @@ func StartTimeseries(db *database.AdminDB, i *run.Info, h run.BuiltinHelper) err
 	return err
 }
 
+// StartTimeseries prepares the plugin by initializing the database
+func StartTimeseries(db *database.AdminDB, i *run.Info, h run.BuiltinHelper) error {
+	err := run.WithVersion(PluginName, SQLVersion, SQLUpdater)(db, i, h)
+	if err != nil {
+		return err
+	}
+	if err = Configure(db); err != nil {
+		return err
+	}
+
+	if TSDB.CompactionInterval != "" {
+		d, err := time.ParseDuration(TSDB.CompactionInterval)
+		if err != nil {
+			return errors.New("Invalid timeseries compaction_interval")
+		}
+		if d > 0 {
+			compactor = NewCompactor(&TSDB, d)
+		}
+	}
+	return nil
+}
+
+// StopTimeseries stops the background batch compaction
+func StopTimeseries(db *database.AdminDB, apikey string) error {
+	if compactor != nil {
+		compactor.Close()
+		compactor = nil
+	}
+	return nil
+}
+
 // This is not needed for normal plugins. The init simply registers the plugin with heedy internals
 // for when it is compiled directly into the main heedy executable.
 func init() {
@@ -74,8 +105,24 @@ func init() {
 	run.Builtin.Add(&run.BuiltinRunner{
 		Key:     PluginName,
 		Start:   StartTimeseries,
+		Stop:    StopTimeseries,
 		Handler: Handler,
 	})
+	// Batches are verified by heedy db check
+	database.AddCheckHook(CheckBatches)
+
 	// Runs schema creation on database create instead of on first start
 	database.AddCreateHook(run.WithNilInfo(run.WithVersion(PluginName, SQLVersion, SQLUpdater)))
+
+	// Changes to a timeseries schema must be compatible with the data already in the timeseries
+	database.AddObjectMetaHook("timeseries", func(tx database.TxWrapper, id string, meta map[string]interface{}) error {
+		if schema, ok := meta["schema"]; ok && schema != nil {
+			return CheckSchema(tx, id, schema)
+		}
+		return nil
+	})
+
+	// The compressed batches count towards the storage of each timeseries
+	database.AddObjectStorage(database.StorageTable{Table: "timeseries", Column: "tsid", Size: "COALESCE(LENGTH(data),0)"})
+	database.AddObjectStorage(database.StorageTable{Table: "timeseries_actions", Column: "tsid", Size: "COALESCE(LENGTH(data),0)"})
 }
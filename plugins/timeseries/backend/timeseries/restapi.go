@@ -125,6 +125,10 @@ func ReadData(w http.ResponseWriter, r *http.Request, action bool) {
 		return
 	}
 	q.Timeseries = si.ObjectInfo.ID
+	if err = q.Restrict(c.DB); err != nil {
+		rest.WriteJSONError(w, r, http.StatusForbidden, err)
+		return
+	}
 
 	di, err := TSDB.Query(&q)
 	if err != nil {
@@ -221,6 +225,126 @@ func UnmarshalEasyRequestNoLimit(request *http.Request, unmarshalTo easyjson.Unm
 	return easyjson.Unmarshal(data, unmarshalTo)
 }
 
+// validateData checks the datapoints against the timeseries schema
+func validateData(datapoints DatapointArray, schema map[string]interface{}, actor string) error {
+	dv, err := NewDataValidator(NewDatapointArrayIterator(datapoints), schema, actor)
+	if err != nil {
+		return err
+	}
+	var dp *Datapoint
+	for dp, err = dv.Next(); err == nil && dp != nil; dp, err = dv.Next() {
+	}
+	return err
+}
+
+// insertHook runs the timeseries_insert hooks of plugins, which can modify or reject the datapoints.
+// Datapoints modified by a hook are validated against the timeseries schema again.
+func insertHook(c *rest.Context, tsid string, datapoints DatapointArray) (DatapointArray, error) {
+	if !events.Hooked("timeseries_insert") || len(datapoints) == 0 {
+		return datapoints, nil
+	}
+	evt := &events.Event{
+		Event:  "timeseries_insert",
+		Object: tsid,
+	}
+	if err := database.FillEvent(c.DB.AdminDB(), evt); err != nil {
+		return nil, err
+	}
+	evt.Data = datapoints
+	actor := datapoints[0].Actor
+	var modified DatapointArray
+	if ok, err := events.RunHooks(evt, c.DB.ID(), &modified); err != nil || !ok {
+		return datapoints, err
+	}
+	// Hooks can't change who made the datapoints
+	for i := range modified {
+		if modified[i] == nil {
+			return nil, errors.New("bad_request: null datapoint returned by timeseries_insert hook")
+		}
+		modified[i].Actor = actor
+	}
+	o, err := c.DB.AdminDB().ReadObject(tsid, nil)
+	if err != nil {
+		return nil, err
+	}
+	if schema, ok := (*o.Meta)["schema"].(map[string]interface{}); ok && len(schema) > 0 {
+		if err = validateData(modified, schema, actor); err != nil {
+			return nil, err
+		}
+	}
+	return modified, nil
+}
+
+// seriesWrite is the data written to one of the timeseries of a bulk write
+type seriesWrite struct {
+	Modified *string
+	Data     DatapointArray
+	Query    *InsertQuery
+}
+
+// insertSeries inserts the data of multiple timeseries in a single transaction, after running the insert hooks of each.
+// The modified dates of the timeseries are then updated, and the corresponding write events are fired. It returns the
+// written range and count of each timeseries.
+func insertSeries(c *rest.Context, series map[string]*seriesWrite) (map[string]*TimeseriesWriteEvent, error) {
+	inserts := make(map[string]*SeriesInsert, len(series))
+	infos := make(map[string]*InfoIterator, len(series))
+	for tsid, s := range series {
+		datapoints, err := insertHook(c, tsid, s.Data)
+		if err != nil {
+			return nil, err
+		}
+		infos[tsid] = NewInfoIterator(NewDatapointArrayIterator(datapoints))
+		inserts[tsid] = &SeriesInsert{Data: infos[tsid], Query: s.Query}
+	}
+	if err := TSDB.InsertMany(inserts); err != nil {
+		return nil, err
+	}
+
+	var err error
+	results := make(map[string]*TimeseriesWriteEvent, len(series))
+	for tsid, ii := range infos {
+		if ii.Count == 0 {
+			results[tsid] = &TimeseriesWriteEvent{}
+			continue
+		}
+		results[tsid] = &TimeseriesWriteEvent{
+			T1:    ii.Tstart,
+			T2:    ii.Tend,
+			Count: ii.Count,
+			DP:    ii.LastPoint,
+		}
+		if shouldUpdateModifed(series[tsid].Modified) {
+			ne := dbutil.Date(time.Now().UTC())
+			// The timeseries is now non-empty, so label it as such
+			if err2 := c.DB.AdminDB().UpdateObject(&database.Object{
+				Details: database.Details{
+					ID: tsid,
+				},
+				ModifiedDate: &ne,
+			}); err == nil {
+				err = err2
+			}
+		}
+		evt := "timeseries_data_write"
+		if iq := series[tsid].Query; iq.Actions != nil && *iq.Actions {
+			evt = "timeseries_actions_write"
+		}
+		c.Events.Fire(&events.Event{
+			Event:  evt,
+			Object: tsid,
+			Data:   results[tsid],
+		})
+	}
+	return results, err
+}
+
+// insertData inserts the datapoints into the timeseries, updating its modified date and firing the
+// corresponding write event
+func insertData(c *rest.Context, tsid string, modified *string, datapoints DatapointArray, iq *InsertQuery) error {
+	_, err := insertSeries(c, map[string]*seriesWrite{tsid: {Modified: modified, Data: datapoints, Query: iq}})
+	return err
+}
+
 func WriteData(w http.ResponseWriter, r *http.Request, action bool) {
 	c := rest.CTX(r)
 	scope := "write"
@@ -274,50 +398,92 @@ func WriteData(w http.ResponseWriter, r *http.Request, action bool) {
 
 	if len(si.Schema) > 0 && (iq.Validate == nil || iq.Validate != nil && *iq.Validate || action) {
 		// JSON schema validation can take a long time, so do it before we start insert so that it doesn't block the database
-		dv, err := NewDataValidator(NewDatapointArrayIterator(datapoints), si.Schema, actor)
-		if err != nil {
-			rest.WriteJSONError(w, r, http.StatusInternalServerError, err)
+		if err = validateData(datapoints, si.Schema, actor); err != nil {
+			rest.WriteJSONError(w, r, http.StatusBadRequest, err)
 			return
 		}
-		var dp *Datapoint
-		for dp, err = dv.Next(); err == nil && dp != nil; dp, err = dv.Next() {
+	}
+
+	err = insertData(c, si.ObjectInfo.ID, si.ModifiedDate, datapoints, &iq)
+	rest.WriteResult(w, r, err)
+}
+
+// SeriesData is the data written to a single timeseries with WriteSeries, with the insert query of the timeseries
+type SeriesData struct {
+	InsertQuery
+	Data DatapointArray `json:"data"`
+}
+
+// WriteSeries writes data to multiple timeseries at once. The permissions and schemas of all timeseries are checked
+// before any data is inserted, and the data is then inserted in a single transaction, so that either all timeseries
+// are written, or none are.
+func WriteSeries(w http.ResponseWriter, r *http.Request) {
+	c := rest.CTX(r)
+	defer r.Body.Close()
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	var body map[string]*SeriesData
+	if err = json.Unmarshal(b, &body); err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, fmt.Errorf("bad_request: %w", err))
+		return
+	}
+	if len(body) == 0 {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, errors.New("bad_query: no timeseries given"))
+		return
+	}
+
+	noActions := false
+	series := make(map[string]*seriesWrite, len(body))
+	for tsid, sd := range body {
+		if sd == nil {
+			rest.WriteJSONError(w, r, http.StatusBadRequest, fmt.Errorf("bad_request: no data given for timeseries %s", tsid))
+			return
 		}
+		o, err := c.DB.ReadObject(tsid, nil)
 		if err != nil {
+			rest.WriteJSONError(w, r, http.StatusForbidden, fmt.Errorf("%w (timeseries %s)", err, tsid))
+			return
+		}
+		if *o.Type != "timeseries" {
+			rest.WriteJSONError(w, r, http.StatusBadRequest, fmt.Errorf("bad_query: object %s is not a timeseries", tsid))
+			return
+		}
+		if !o.Access.HasScope("write") {
+			rest.WriteJSONError(w, r, http.StatusForbidden, database.ErrAccessDenied("Insufficient permissions to write timeseries %s", tsid))
+			return
+		}
+		// Actions are written by the timeseries' actors, so they can't be written in bulk
+		sd.Actions = &noActions
+		if _, _, err = sd.insertMethod(); err != nil {
 			rest.WriteJSONError(w, r, http.StatusBadRequest, err)
 			return
 		}
-	}
-
-	ii := NewInfoIterator(NewDatapointArrayIterator(datapoints))
-	err = TSDB.Insert(si.ObjectInfo.ID, ii, &iq)
-	if err == nil && ii.Count > 0 {
-		if shouldUpdateModifed(si.ModifiedDate) {
-			ne := dbutil.Date(time.Now().UTC())
-			// The timeseries is now non-empty, so label it as such
-			err = c.DB.AdminDB().UpdateObject(&database.Object{
-				Details: database.Details{
-					ID: si.ID,
-				},
-				ModifiedDate: &ne,
-			})
+		for i := range sd.Data {
+			if sd.Data[i] == nil {
+				rest.WriteJSONError(w, r, http.StatusBadRequest, fmt.Errorf("bad_request: null datapoint (timeseries %s)", tsid))
+				return
+			}
+			sd.Data[i].Actor = ""
 		}
-		evt := "timeseries_data_write"
-		if action {
-			evt = "timeseries_actions_write"
+		if schema, ok := (*o.Meta)["schema"].(map[string]interface{}); ok && len(schema) > 0 && (sd.Validate == nil || *sd.Validate) {
+			if err = validateData(sd.Data, schema, ""); err != nil {
+				rest.WriteJSONError(w, r, http.StatusBadRequest, fmt.Errorf("%w (timeseries %s)", err, tsid))
+				return
+			}
 		}
-		c.Events.Fire(&events.Event{
-			Event:  evt,
-			Object: si.ObjectInfo.ID,
-			Data: &TimeseriesWriteEvent{
-				T1:    ii.Tstart,
-				T2:    ii.Tend,
-				Count: ii.Count,
-				DP:    ii.LastPoint,
-			},
-		})
+		sw := &seriesWrite{Data: sd.Data, Query: &sd.InsertQuery}
+		if o.ModifiedDate != nil {
+			d := o.ModifiedDate.String()
+			sw.Modified = &d
+		}
+		series[tsid] = sw
 	}
 
-	rest.WriteResult(w, r, err)
+	results, err := insertSeries(c, series)
+	rest.WriteJSON(w, r, results, err)
 }
 
 func DataLength(w http.ResponseWriter, r *http.Request, action bool) {
@@ -329,10 +495,44 @@ func DataLength(w http.ResponseWriter, r *http.Request, action bool) {
 		rest.WriteJSONError(w, r, http.StatusBadRequest, ErrNotActor)
 		return
 	}
+	if tstart, tend := database.TimeRange(rest.CTX(r).DB); tstart != nil || tend != nil {
+		rest.WriteJSONError(w, r, http.StatusForbidden, database.ErrAccessDenied("The length of the timeseries can't be read through this share link"))
+		return
+	}
 	l, err := TSDB.Length(si.ObjectInfo.ID, action)
 	rest.WriteJSON(w, r, l, err)
 }
 
+// DataStats returns the summary statistics of the datapoints in the queried time range
+func DataStats(w http.ResponseWriter, r *http.Request, action bool) {
+	c := rest.CTX(r)
+	si, ok := validateRequest(w, r, "read")
+	if !ok {
+		return
+	}
+	if action && !si.Actor {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, ErrNotActor)
+		return
+	}
+	q, err := decodeQuery(r)
+	if err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	q.Actions = &action
+	if q.Timeseries != "" {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, errors.New("timeseries arg is set automatically when querying objects"))
+		return
+	}
+	q.Timeseries = si.ObjectInfo.ID
+	if err = q.Restrict(c.DB); err != nil {
+		rest.WriteJSONError(w, r, http.StatusForbidden, err)
+		return
+	}
+	s, err := TSDB.Stats(&q)
+	rest.WriteJSON(w, r, s, err)
+}
+
 // Act is given just the data portion of a datapoint, and it is inserted at the current timestamp
 func Act(w http.ResponseWriter, r *http.Request) {
 	c := rest.CTX(r)
@@ -392,34 +592,32 @@ func Act(w http.ResponseWriter, r *http.Request) {
 	rest.WriteResult(w, r, err)
 }
 
-func GenerateDataset(rw http.ResponseWriter, r *http.Request) {
-	// Generate a dataset
-	c := rest.CTX(r)
-	var d map[string]*Dataset
-	err := rest.UnmarshalRequest(r, &d)
-	if err != nil {
-		rest.WriteJSONError(rw, r, http.StatusBadRequest, err)
-		return
-	}
+// datasetReaders validates the dataset query, and returns the json readers of each of its keys.
+// The returned function closes the underlying queries, and must be called once the readers are done.
+func datasetReaders(db database.DB, d map[string]*Dataset) (map[string]*JsonArrayReader, func(), error) {
 	if _, ok := d["error"]; ok {
-		rest.WriteJSONError(rw, r, http.StatusBadRequest, errors.New("The key 'error' is disallowed in dataset query."))
-		return
+		return nil, nil, errors.New("bad_query: The key 'error' is disallowed in dataset query.")
 	}
 	if _, ok := d["error_description"]; ok {
-		rest.WriteJSONError(rw, r, http.StatusBadRequest, errors.New("The key 'error_description' is disallowed in datset query."))
-		return
+		return nil, nil, errors.New("bad_query: The key 'error_description' is disallowed in datset query.")
 	}
 
 	readers := make(map[string]*JsonArrayReader)
+	iterators := make([]DatapointIterator, 0, len(d))
+	closeAll := func() {
+		for _, pi := range iterators {
+			pi.Close()
+		}
+	}
 	for k, v := range d {
 		if v == nil {
-			rest.WriteJSONError(rw, r, http.StatusBadRequest, fmt.Errorf("Invalid query at '%s'", k))
-			return
+			closeAll()
+			return nil, nil, fmt.Errorf("bad_query: Invalid query at '%s'", k)
 		}
-		di, err := v.Get(c.DB)
+		di, err := v.Get(db)
 		if err != nil {
-			rest.WriteJSONError(rw, r, http.StatusBadRequest, fmt.Errorf("Invalid query at '%s': %w", k, err))
-			return
+			closeAll()
+			return nil, nil, fmt.Errorf("Invalid query at '%s': %w", k, err)
 		}
 		var pi DatapointIterator
 		/*
@@ -430,75 +628,93 @@ func GenerateDataset(rw http.ResponseWriter, r *http.Request) {
 			}
 		*/
 		pi = &TransformIterator{dpi: di, it: di}
-		defer pi.Close()
+		iterators = append(iterators, pi)
 
 		ai, err := NewJsonArrayReader(pi, 2048)
 		if err != nil {
-			rest.WriteJSONError(rw, r, http.StatusInternalServerError, err)
-			return
+			closeAll()
+			return nil, nil, err
 		}
 		readers[k] = ai
 	}
-	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
-	var w io.Writer
-	w = rw
-
-	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") && !assets.Get().Config.Verbose && TSDB.CompressQueryResponse {
-		// If gzip is supported, compress the output
-		rw.Header().Set("Content-Encoding", "gzip")
-		rw.WriteHeader(http.StatusOK)
-		gzw := gzip.NewWriter(rw)
-		defer gzw.Close()
-		aw := rest.NewAsyncWriter(gzw)
-		defer aw.Close()
-		w = aw
-
-	} else {
-		rw.WriteHeader(http.StatusOK)
-	}
+	return readers, closeAll, nil
+}
 
-	_, err = w.Write([]byte(`{`))
+// writeDataset writes the results of the dataset query to w as a json object
+func writeDataset(w io.Writer, readers map[string]*JsonArrayReader) error {
+	_, err := w.Write([]byte(`{`))
 	if err != nil {
-		c.Log.Warnf("Dataset: %s", err.Error())
-		return
+		return err
 	}
 	hasPrev := false
 	for k, v := range readers {
 		if hasPrev {
 			_, err = w.Write([]byte{','})
 			if err != nil {
-				c.Log.Warnf("Dataset: %s", err.Error())
-				return
+				return err
 			}
 		}
 		hasPrev = true
 		ks, err := json.Marshal(k)
 		if err != nil {
-			c.Log.Warnf("Dataset key '%s': %s", k, err.Error())
-			return
+			return fmt.Errorf("Dataset key '%s': %w", k, err)
 		}
 		_, err = w.Write(ks)
 		if err != nil {
-			c.Log.Warnf("Dataset key '%s': %s", k, err.Error())
-			return
+			return fmt.Errorf("Dataset key '%s': %w", k, err)
 		}
 		_, err = w.Write([]byte(`:`))
 		if err != nil {
-			c.Log.Warnf("Dataset key '%s': %s", k, err.Error())
-			return
+			return fmt.Errorf("Dataset key '%s': %w", k, err)
 		}
 		_, err = io.Copy(w, v)
 
 		if err != nil {
-			c.Log.Warnf("Dataset key '%s': %s", k, err.Error())
-			return
+			return fmt.Errorf("Dataset key '%s': %w", k, err)
 		}
 	}
 	_, err = w.Write([]byte(`}`))
+	return err
+}
+
+func GenerateDataset(rw http.ResponseWriter, r *http.Request) {
+	// Generate a dataset
+	c := rest.CTX(r)
+	var d map[string]*Dataset
+	err := rest.UnmarshalRequest(r, &d)
 	if err != nil {
-		c.Log.Warnf("Dataset: %s", err.Error())
+		rest.WriteJSONError(rw, r, http.StatusBadRequest, err)
+		return
+	}
+
+	readers, closeAll, err := datasetReaders(c.DB, d)
+	if err != nil {
+		rest.WriteJSONError(rw, r, http.StatusBadRequest, err)
 		return
 	}
+	defer closeAll()
+
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	var w io.Writer
+	w = rw
+
+	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") && !assets.Get().Config.Verbose && TSDB.CompressQueryResponse {
+		// If gzip is supported, compress the output
+		rw.Header().Set("Content-Encoding", "gzip")
+		rw.WriteHeader(http.StatusOK)
+		gzw := gzip.NewWriter(rw)
+		defer gzw.Close()
+		aw := rest.NewAsyncWriter(gzw)
+		defer aw.Close()
+		w = aw
+
+	} else {
+		rw.WriteHeader(http.StatusOK)
+	}
+
+	if err = writeDataset(w, readers); err != nil {
+		c.Log.Warnf("Dataset: %s", err.Error())
+	}
 }
 
 /*
@@ -638,6 +854,78 @@ func GenerateDashboardDataset(w http.ResponseWriter, r *http.Request) {
 }
 */
 
+// SchemaMigration is the body of a request to change the schema of a timeseries
+type SchemaMigration struct {
+	Schema    map[string]interface{} `json:"schema"`
+	Transform string                 `json:"transform,omitempty"`
+	DryRun    bool                   `json:"dry_run,omitempty"`
+}
+
+// MigrateSchema changes the timeseries schema, optionally running a transform on the existing data
+// to bring it into the new schema's format
+func MigrateSchema(w http.ResponseWriter, r *http.Request) {
+	c := rest.CTX(r)
+	si, ok := validateRequest(w, r, "write")
+	if !ok {
+		return
+	}
+	if !si.Access.HasScope("update") {
+		rest.WriteJSONError(w, r, http.StatusForbidden, database.ErrAccessDenied("Insufficient permissions"))
+		return
+	}
+	var m SchemaMigration
+	if err := rest.UnmarshalRequest(r, &m); err != nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if m.Schema == nil {
+		rest.WriteJSONError(w, r, http.StatusBadRequest, errors.New("bad_query: no schema given"))
+		return
+	}
+	res, err := TSDB.MigrateSchema(si.ID, m.Schema, m.Transform, m.DryRun)
+	if err == nil && m.Transform != "" && !m.DryRun {
+		// The data was rewritten, so notify any listeners that the old data is gone, and new data is present
+		c.Events.Fire(&events.Event{
+			Event:  "timeseries_data_delete",
+			Object: si.ID,
+			Data:   Query{},
+		})
+		if res.Count > 0 {
+			c.Events.Fire(&events.Event{
+				Event:  "timeseries_data_write",
+				Object: si.ID,
+				Data: &TimeseriesWriteEvent{
+					T1:    res.tstart,
+					T2:    res.tend,
+					Count: res.Count,
+				},
+			})
+		}
+	}
+	rest.WriteJSON(w, r, res, err)
+}
+
+// Compact merges undersized batches, either of a single timeseries given in the query, or of all timeseries.
+// Only admins can run compaction.
+func Compact(w http.ResponseWriter, r *http.Request) {
+	c := rest.CTX(r)
+	if c.DB.Type() != database.AdminType && !c.DB.AdminDB().Assets().Config.UserIsAdmin(c.DB.ID()) {
+		rest.WriteJSONError(w, r, http.StatusForbidden, database.ErrAccessDenied("Only admins can compact timeseries"))
+		return
+	}
+	var res *CompactionResult
+	var err error
+	if tsid := r.URL.Query().Get("timeseries"); tsid != "" {
+		res, err = TSDB.Compact(tsid)
+	} else {
+		res, err = TSDB.CompactAll()
+	}
+	if err == nil {
+		c.Log.Infof("Compacted %d batches in %d timeseries into %d, reclaiming %d bytes", res.BatchesMerged, res.Timeseries, res.BatchesWritten, res.Reclaimed)
+	}
+	rest.WriteJSON(w, r, res, err)
+}
+
 // Handler is the global router for the timeseries API
 var Handler = func() *chi.Mux {
 	m := chi.NewMux()
@@ -654,6 +942,10 @@ var Handler = func() *chi.Mux {
 	m.Get("/object/timeseries/length", func(w http.ResponseWriter, r *http.Request) {
 		DataLength(w, r, false)
 	})
+	m.Get("/object/timeseries/stats", func(w http.ResponseWriter, r *http.Request) {
+		DataStats(w, r, false)
+	})
+	m.Post("/object/timeseries/schema", MigrateSchema)
 	/*
 		m.Get("/object/actions", func(w http.ResponseWriter, r *http.Request) {
 			ReadData(w, r, true)
@@ -667,11 +959,18 @@ var Handler = func() *chi.Mux {
 		m.Get("/object/actions/length", func(w http.ResponseWriter, r *http.Request) {
 			DataLength(w, r, true)
 		})
+		m.Get("/object/actions/stats", func(w http.ResponseWriter, r *http.Request) {
+			DataStats(w, r, true)
+		})
 
 		m.Post("/object/act", Act)
 	*/
 
 	m.Post("/api/timeseries/dataset", GenerateDataset)
+	m.Post("/api/timeseries/write", WriteSeries)
+	m.Post("/api/timeseries/compact", Compact)
+	m.Mount("/api/timeseries/grafana", GrafanaHandler)
+	m.Mount("/api/timeseries/influx", InfluxHandler)
 
 	//m.Post("/dashboard/", GenerateDashboardDataset)
 
@@ -0,0 +1,156 @@
+package timeseries
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/heedy/heedy/backend/database"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// schemaViolationLimit is the number of violations that are reported when existing data doesn't match a schema
+const schemaViolationLimit = 5
+
+// SchemaViolation is a datapoint that does not conform to a timeseries schema
+type SchemaViolation struct {
+	Timestamp float64 `json:"t"`
+	Error     string  `json:"error"`
+}
+
+// SchemaReport gives the result of checking the data in a timeseries against a schema
+type SchemaReport struct {
+	// The number of datapoints checked
+	Count int64 `json:"count"`
+	// The number of datapoints that did not conform to the schema
+	Violations int64 `json:"violations"`
+	// The first few violations
+	First []SchemaViolation `json:"first"`
+
+	// The time range of the migrated data
+	tstart, tend float64
+}
+
+// Err returns an error describing the violations, or nil if all data conforms to the schema
+func (r *SchemaReport) Err() error {
+	if r.Violations == 0 {
+		return nil
+	}
+	v := make([]string, len(r.First))
+	for i, sv := range r.First {
+		v[i] = fmt.Sprintf("t=%v: %s", sv.Timestamp, sv.Error)
+	}
+	return fmt.Errorf("bad_query: %d of %d existing datapoints don't conform to the schema (%s)", r.Violations, r.Count, strings.Join(v, "; "))
+}
+
+// checkData validates all the data of the timeseries against the schema. If a transform is given, the data
+// is first passed through the transform, and if keep is true, the resulting data is returned.
+func checkData(tx database.TxWrapper, tsid string, schema interface{}, transform string, keep bool) (*SchemaReport, DatapointArray, error) {
+	s, err := gojsonschema.NewSchema(gojsonschema.NewGoLoader(schema))
+	if err != nil {
+		return nil, nil, fmt.Errorf("bad_query: invalid schema: %w", err)
+	}
+	rows, err := tx.Queryx("SELECT data FROM timeseries WHERE tsid=? ORDER BY tstart ASC", tsid)
+	if err != nil {
+		return nil, nil, err
+	}
+	var it DatapointIterator = NewBatchDatapointIterator(SQLBatchIterator{rows, nil}, nil)
+	defer it.Close()
+	if transform != "" {
+		it, err = NewTransformIterator(transform, it)
+		if err != nil {
+			return nil, nil, err
+		}
+		it = NewSortChecker(it)
+	}
+
+	r := &SchemaReport{First: []SchemaViolation{}}
+	var data DatapointArray
+	for {
+		dp, err := it.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+		if dp == nil {
+			break
+		}
+		r.Count++
+		result, err := s.Validate(gojsonschema.NewGoLoader(dp.Data))
+		if err != nil {
+			return nil, nil, err
+		}
+		if !result.Valid() {
+			r.Violations++
+			if len(r.First) < schemaViolationLimit {
+				r.First = append(r.First, SchemaViolation{
+					Timestamp: dp.Timestamp,
+					Error:     result.Errors()[0].String(),
+				})
+			}
+		} else if keep {
+			data = append(data, dp)
+		}
+	}
+	return r, data, nil
+}
+
+// CheckSchema validates the existing data of the timeseries against a new schema, returning an error
+// listing the first violations if the data doesn't conform to it
+func CheckSchema(tx database.TxWrapper, tsid string, schema interface{}) error {
+	r, _, err := checkData(tx, tsid, schema, "", false)
+	if err != nil {
+		return err
+	}
+	return r.Err()
+}
+
+// MigrateSchema sets a new schema for the timeseries. If a transform is given, it is run on the existing data,
+// and the data is replaced with the transform's output, which must conform to the new schema. If dryRun is set,
+// the data is checked, but nothing is modified. All of the transformed data is held in memory during the migration.
+func (ts *TimeseriesDB) MigrateSchema(tsid string, schema map[string]interface{}, transform string, dryRun bool) (r *SchemaReport, err error) {
+	if err = ts.DB.Assets().Config.ValidateObjectMetaUpdate("timeseries", map[string]interface{}{"schema": schema}); err != nil {
+		return nil, err
+	}
+
+	var tx database.TxWrapper
+	tx, err = ts.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil || dryRun {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	r, data, err := checkData(tx, tsid, schema, transform, transform != "" && !dryRun)
+	if err != nil || dryRun {
+		return r, err
+	}
+	if err = r.Err(); err != nil {
+		return r, err
+	}
+
+	if transform != "" {
+		if _, err = tx.Exec("DELETE FROM timeseries WHERE tsid=?", tsid); err != nil {
+			return r, err
+		}
+		if len(data) > 0 {
+			r.tstart = data[0].Timestamp
+			r.tend = data[len(data)-1].EndTime()
+			if err = ts.append(tx, "timeseries", tsid, DatapointArray{}, NewDatapointArrayIterator(data[1:]), data[0]); err != nil {
+				return r, err
+			}
+		}
+	}
+
+	b, err := json.Marshal(schema)
+	if err != nil {
+		return r, err
+	}
+	result, err := tx.Exec("UPDATE objects SET meta=json_set(json(meta),'$.schema',json(?)) WHERE id=?", string(b), tsid)
+	err = database.GetExecError(result, err)
+	return r, err
+}
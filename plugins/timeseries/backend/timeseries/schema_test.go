@@ -0,0 +1,65 @@
+package timeseries
+
+import (
+	"testing"
+
+	"github.com/heedy/heedy/backend/database"
+	"github.com/heedy/heedy/backend/database/dbutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaChange(t *testing.T) {
+	adb, oid1, _, cleanup := newDBWithObjects(t)
+	defer cleanup()
+
+	s := TimeseriesDB{
+		DB:                    adb,
+		BatchSize:             3,
+		MaxBatchSize:          5,
+		BatchCompressionLevel: 2,
+	}
+	require.NoError(t, s.Insert(oid1, NewDatapointArrayIterator(dpa6), nil))
+
+	setSchema := func(schema map[string]interface{}) error {
+		return adb.UpdateObject(&database.Object{
+			Details: database.Details{
+				ID: oid1,
+			},
+			Meta: &dbutil.JSONObject{"schema": schema},
+		})
+	}
+
+	// The existing data is numbers, so a string schema is rejected
+	err := setSchema(map[string]interface{}{"type": "string"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "5 of 5")
+	require.NoError(t, setSchema(map[string]interface{}{"type": "number", "minimum": 1}))
+
+	// A dry run reports the violations without modifying anything
+	r, err := s.MigrateSchema(oid1, map[string]interface{}{"type": "boolean"}, "", true)
+	require.NoError(t, err)
+	require.EqualValues(t, 5, r.Violations)
+	require.Len(t, r.First, schemaViolationLimit)
+
+	// Transforming data that still doesn't match fails
+	_, err = s.MigrateSchema(oid1, map[string]interface{}{"type": "boolean"}, "d+1", false)
+	require.Error(t, err)
+	cmpQuery(t, s, &Query{Timeseries: oid1}, dpa6)
+
+	r, err = s.MigrateSchema(oid1, map[string]interface{}{"type": "boolean"}, "d > 2", false)
+	require.NoError(t, err)
+	require.EqualValues(t, 5, r.Count)
+	require.EqualValues(t, 0, r.Violations)
+
+	o, err := adb.ReadObject(oid1, nil)
+	require.NoError(t, err)
+	require.Equal(t, "boolean", (*o.Meta)["schema"].(map[string]interface{})["type"])
+
+	cmpQuery(t, s, &Query{Timeseries: oid1}, DatapointArray{
+		&Datapoint{1.0, 0, false, ""},
+		&Datapoint{2.0, 0, false, ""},
+		&Datapoint{3.0, 0, true, ""},
+		&Datapoint{4.0, 0, true, ""},
+		&Datapoint{5.0, 0, true, ""},
+	})
+}
@@ -0,0 +1,332 @@
+package timeseries
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/heedy/heedy/backend/database"
+)
+
+// statsSchema adds the summary statistics of each batch, so that the statistics of a timeseries can be computed
+// without decoding its data. The numeric statistics only include datapoints whose data is a number, and are null
+// for batches without numeric data.
+const statsSchema = `
+ALTER TABLE timeseries ADD COLUMN tlast REAL;
+ALTER TABLE timeseries ADD COLUMN dcount INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE timeseries ADD COLUMN dmin REAL;
+ALTER TABLE timeseries ADD COLUMN dmax REAL;
+ALTER TABLE timeseries ADD COLUMN dsum REAL;
+`
+
+// batchColumns are the columns written for each batch, with its time range and statistics along with its data
+const batchColumns = "tsid,tstart,tend,length,tlast,dcount,dmin,dmax,dsum,data"
+
+// batchStatement returns the statement that writes a batch to the given table, replacing any batch with the same tstart
+func batchStatement(table string) string {
+	return fmt.Sprintf("INSERT OR REPLACE INTO %s(%s) VALUES (?,?,?,?,?,?,?,?,?,?);", table, batchColumns)
+}
+
+// numericValue returns the value of datapoint data that is a number
+func numericValue(d interface{}) (float64, bool) {
+	switch v := d.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// dataStats accumulates the summary statistics of datapoints. First and Last are only valid if Count > 0,
+// and Min, Max and Sum are only valid if Numeric > 0.
+type dataStats struct {
+	Count       int64
+	First, Last float64
+
+	Numeric       int64
+	Min, Max, Sum float64
+}
+
+// add includes the datapoint in the statistics. Datapoints must be added in order.
+func (s *dataStats) add(dp *Datapoint) {
+	if s.Count == 0 {
+		s.First = dp.Timestamp
+	}
+	s.Last = dp.Timestamp
+	s.Count++
+	v, ok := numericValue(dp.Data)
+	if !ok || math.IsNaN(v) {
+		return
+	}
+	if s.Numeric == 0 || v < s.Min {
+		s.Min = v
+	}
+	if s.Numeric == 0 || v > s.Max {
+		s.Max = v
+	}
+	s.Sum += v
+	s.Numeric++
+}
+
+// merge includes the statistics of other datapoints, which can come in any order
+func (s *dataStats) merge(o *dataStats) {
+	if o.Count == 0 {
+		return
+	}
+	if s.Count == 0 || o.First < s.First {
+		s.First = o.First
+	}
+	if s.Count == 0 || o.Last > s.Last {
+		s.Last = o.Last
+	}
+	s.Count += o.Count
+	if o.Numeric == 0 {
+		return
+	}
+	if s.Numeric == 0 || o.Min < s.Min {
+		s.Min = o.Min
+	}
+	if s.Numeric == 0 || o.Max > s.Max {
+		s.Max = o.Max
+	}
+	s.Sum += o.Sum
+	s.Numeric += o.Numeric
+}
+
+// batchStats holds the statistics columns of a batch as they are stored in the database
+type batchStats struct {
+	Tlast  sql.NullFloat64 `db:"tlast"`
+	DCount int64           `db:"dcount"`
+	DMin   sql.NullFloat64 `db:"dmin"`
+	DMax   sql.NullFloat64 `db:"dmax"`
+	DSum   sql.NullFloat64 `db:"dsum"`
+}
+
+func newBatchStats(dpa DatapointArray) batchStats {
+	var s dataStats
+	for _, dp := range dpa {
+		s.add(dp)
+	}
+	numeric := s.Numeric > 0
+	return batchStats{
+		Tlast:  sql.NullFloat64{Float64: s.Last, Valid: s.Count > 0},
+		DCount: s.Numeric,
+		DMin:   sql.NullFloat64{Float64: s.Min, Valid: numeric},
+		DMax:   sql.NullFloat64{Float64: s.Max, Valid: numeric},
+		DSum:   sql.NullFloat64{Float64: s.Sum, Valid: numeric},
+	}
+}
+
+// batchValues returns the values of batchColumns for the given batch and its encoded data
+func batchValues(tsid string, dpa DatapointArray, data []byte) []interface{} {
+	s := newBatchStats(dpa)
+	return []interface{}{tsid, dpa[0].Timestamp, dpa[len(dpa)-1].EndTime(), len(dpa), s.Tlast, s.DCount, s.DMin, s.DMax, s.DSum, data}
+}
+
+// migrateStats adds the statistics columns, and fills them in for existing batches by decoding their data
+func migrateStats(tx database.TxWrapper) error {
+	if _, err := tx.Exec(statsSchema); err != nil {
+		return err
+	}
+	rows, err := tx.Queryx("SELECT tsid,tstart,data FROM timeseries;")
+	if err != nil {
+		return err
+	}
+	type batchUpdate struct {
+		tsid   string
+		tstart float64
+		stats  batchStats
+	}
+	updates := []batchUpdate{}
+	for rows.Next() {
+		var b struct {
+			TSID   string  `db:"tsid"`
+			Tstart float64 `db:"tstart"`
+			Data   []byte  `db:"data"`
+		}
+		if err = rows.StructScan(&b); err != nil {
+			rows.Close()
+			return err
+		}
+		dpa, err := decodeBatch(b.Data)
+		if err != nil {
+			// Batches that can't be decoded are left for heedy db check to report
+			continue
+		}
+		updates = append(updates, batchUpdate{b.TSID, b.Tstart, newBatchStats(dpa)})
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	for _, u := range updates {
+		s := u.stats
+		_, err = tx.Exec("UPDATE timeseries SET tlast=?,dcount=?,dmin=?,dmax=?,dsum=? WHERE tsid=? AND tstart=?;", s.Tlast, s.DCount, s.DMin, s.DMax, s.DSum, u.tsid, u.tstart)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stats summarizes the datapoints of a timeseries in a time range
+type Stats struct {
+	// Count is the number of datapoints, and First and Last are the timestamps of the first and last datapoint
+	Count int64    `json:"count"`
+	First *float64 `json:"first"`
+	Last  *float64 `json:"last"`
+
+	// Numeric is the number of datapoints whose data is a number, which are summarized by Min, Max and Mean
+	Numeric int64    `json:"numeric"`
+	Min     *float64 `json:"min"`
+	Max     *float64 `json:"max"`
+	Mean    *float64 `json:"mean"`
+}
+
+// Stats returns the summary statistics of the datapoints in the query's time range, which is given by t1 and t2,
+// or t for the datapoints at a single timestamp. Batches that are entirely in the range are summarized from
+// their stored statistics, so only the batches at the edges of the range are decoded.
+func (ts *TimeseriesDB) Stats(q *Query) (*Stats, error) {
+	table := "timeseries"
+	if q.Timeseries == "" {
+		return nil, errors.New("bad_query: no timeseries specified")
+	}
+	if q.Actions != nil && *q.Actions {
+		table = "timeseries_actions"
+	}
+	if q.I != nil || q.I1 != nil || q.I2 != nil || q.Limit != nil || q.Transform != nil && *q.Transform != "" {
+		return nil, errors.New("bad_query: stats can only be computed for a time range")
+	}
+
+	// The range includes datapoints with t1 <= timestamp < t2, which matches Query
+	var err error
+	t1, t2 := math.Inf(-1), math.Inf(1)
+	if q.T != nil {
+		if q.T1 != nil || q.T2 != nil {
+			return nil, errors.New("bad_query: Cannot query by range and by single timestamp at the same time")
+		}
+		if t1, err = ParseTimestamp(q.T); err != nil {
+			return nil, err
+		}
+		t2 = math.Nextafter(t1, math.Inf(1))
+	}
+	if q.T1 != nil {
+		if t1, err = ParseTimestamp(q.T1); err != nil {
+			return nil, err
+		}
+	}
+	if q.T2 != nil {
+		if t2, err = ParseTimestamp(q.T2); err != nil {
+			return nil, err
+		}
+	}
+
+	var s dataStats
+	if t1 < t2 {
+		// Both queries are in a transaction, so that they see the same batches
+		tx, err := ts.DB.Beginx()
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+
+		inside := []string{"tsid=?"}
+		insideValues := []interface{}{q.Timeseries}
+		edges := []string{"tsid=?"}
+		edgeValues := []interface{}{q.Timeseries}
+		outside := []string{}
+		outsideValues := []interface{}{}
+		if !math.IsInf(t1, -1) {
+			inside = append(inside, "tstart>=?")
+			insideValues = append(insideValues, t1)
+			edges = append(edges, "tlast>=?")
+			edgeValues = append(edgeValues, t1)
+			outside = append(outside, "tstart<?")
+			outsideValues = append(outsideValues, t1)
+		}
+		if !math.IsInf(t2, 1) {
+			inside = append(inside, "tlast<?")
+			insideValues = append(insideValues, t2)
+			edges = append(edges, "tstart<?")
+			edgeValues = append(edgeValues, t2)
+			outside = append(outside, "tlast>=?")
+			outsideValues = append(outsideValues, t2)
+		}
+
+		var b struct {
+			Count   int64           `db:"count"`
+			First   sql.NullFloat64 `db:"first"`
+			Last    sql.NullFloat64 `db:"last"`
+			Numeric int64           `db:"numeric"`
+			Min     sql.NullFloat64 `db:"min"`
+			Max     sql.NullFloat64 `db:"max"`
+			Sum     sql.NullFloat64 `db:"sum"`
+		}
+		err = tx.Get(&b, fmt.Sprintf("SELECT COALESCE(SUM(length),0) AS count, MIN(tstart) AS first, MAX(tlast) AS last, COALESCE(SUM(dcount),0) AS numeric, MIN(dmin) AS min, MAX(dmax) AS max, SUM(dsum) AS sum FROM %s WHERE %s;", table, strings.Join(inside, " AND ")), insideValues...)
+		if err != nil {
+			return nil, err
+		}
+		s.merge(&dataStats{
+			Count:   b.Count,
+			First:   b.First.Float64,
+			Last:    b.Last.Float64,
+			Numeric: b.Numeric,
+			Min:     b.Min.Float64,
+			Max:     b.Max.Float64,
+			Sum:     b.Sum.Float64,
+		})
+
+		// The batches that overlap the range without being entirely in it are decoded, and their datapoints filtered
+		if len(outside) > 0 {
+			edges = append(edges, "("+strings.Join(outside, " OR ")+")")
+			edgeValues = append(edgeValues, outsideValues...)
+			var batches [][]byte
+			err = tx.Select(&batches, fmt.Sprintf("SELECT data FROM %s WHERE %s;", table, strings.Join(edges, " AND ")), edgeValues...)
+			if err != nil {
+				return nil, err
+			}
+			for _, data := range batches {
+				dpa, err := DatapointArrayFromBytes(data)
+				if err != nil {
+					return nil, err
+				}
+				var es dataStats
+				for _, dp := range dpa {
+					if dp.Timestamp >= t1 && dp.Timestamp < t2 {
+						es.add(dp)
+					}
+				}
+				s.merge(&es)
+			}
+		}
+	}
+
+	res := &Stats{
+		Count:   s.Count,
+		Numeric: s.Numeric,
+	}
+	if s.Count > 0 {
+		res.First = &s.First
+		res.Last = &s.Last
+	}
+	if s.Numeric > 0 {
+		mean := s.Sum / float64(s.Numeric)
+		res.Min = &s.Min
+		res.Max = &s.Max
+		res.Mean = &mean
+	}
+	return res, nil
+}
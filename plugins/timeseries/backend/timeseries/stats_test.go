@@ -0,0 +1,84 @@
+package timeseries
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func cmpStats(t *testing.T, s TimeseriesDB, q *Query, count, numeric int64, first, last, min, max, mean float64) {
+	st, err := s.Stats(q)
+	require.NoError(t, err)
+	require.Equal(t, count, st.Count)
+	require.Equal(t, numeric, st.Numeric)
+	if count == 0 {
+		require.Nil(t, st.First)
+		require.Nil(t, st.Last)
+	} else {
+		require.Equal(t, first, *st.First)
+		require.Equal(t, last, *st.Last)
+	}
+	if numeric == 0 {
+		require.Nil(t, st.Min)
+		require.Nil(t, st.Max)
+		require.Nil(t, st.Mean)
+	} else {
+		require.Equal(t, min, *st.Min)
+		require.Equal(t, max, *st.Max)
+		require.Equal(t, mean, *st.Mean)
+	}
+}
+
+func TestStats(t *testing.T) {
+	adb, oid1, oid2, cleanup := newDBWithObjects(t)
+	defer cleanup()
+
+	s := TimeseriesDB{
+		DB:           adb,
+		BatchSize:    3,
+		MaxBatchSize: 5,
+	}
+	require.NoError(t, s.Insert(oid1, NewDatapointArrayIterator(dpa6), nil))
+	require.NoError(t, s.Insert(oid1, NewDatapointArrayIterator(DatapointArray{&Datapoint{6.0, 0, "hi", ""}}), nil))
+	var batches int
+	require.NoError(t, adb.Get(&batches, "SELECT COUNT(*) FROM timeseries WHERE tsid=?", oid1))
+	require.Equal(t, 2, batches)
+
+	cmpStats(t, s, &Query{Timeseries: oid1}, 6, 5, 1, 6, 1, 5, 3)
+	cmpStats(t, s, &Query{Timeseries: oid2}, 0, 0, 0, 0, 0, 0, 0)
+
+	// Time ranges include t1 but not t2, like queries, and can split batches
+	cmpStats(t, s, &Query{Timeseries: oid1, T1: 2.0, T2: 5.0}, 3, 3, 2, 4, 2, 4, 3)
+	cmpStats(t, s, &Query{Timeseries: oid1, T1: 4.0}, 3, 2, 4, 6, 4, 5, 4.5)
+	cmpStats(t, s, &Query{Timeseries: oid1, T2: 4.0}, 3, 3, 1, 3, 1, 3, 2)
+	cmpStats(t, s, &Query{Timeseries: oid1, T: 3.0}, 1, 1, 3, 3, 3, 3, 3)
+	cmpStats(t, s, &Query{Timeseries: oid1, T1: 10.0}, 0, 0, 0, 0, 0, 0, 0)
+	cmpStats(t, s, &Query{Timeseries: oid1, T1: 3.0, T2: 2.0}, 0, 0, 0, 0, 0, 0, 0)
+
+	// Only time ranges are supported
+	i := int64(1)
+	_, err := s.Stats(&Query{Timeseries: oid1, I1: &i})
+	require.Error(t, err)
+	_, err = s.Stats(&Query{Timeseries: oid1, T: 3.0, T1: 2.0})
+	require.Error(t, err)
+
+	// The statistics are kept up to date by deletes and compaction
+	require.NoError(t, s.Delete(&Query{Timeseries: oid1, T1: 1.0, T2: 3.0}))
+	cmpStats(t, s, &Query{Timeseries: oid1}, 4, 3, 3, 6, 3, 5, 4)
+	require.NoError(t, s.Insert(oid1, NewDatapointArrayIterator(DatapointArray{&Datapoint{3.5, 0, 10.0, ""}}), nil))
+	cmpStats(t, s, &Query{Timeseries: oid1}, 5, 4, 3, 6, 3, 10, 5.5)
+	_, err = s.Compact(oid1)
+	require.NoError(t, err)
+	cmpStats(t, s, &Query{Timeseries: oid1}, 5, 4, 3, 6, 3, 10, 5.5)
+
+	// Incorrect statistics are found and rebuilt by the database check
+	_, err = adb.Exec("UPDATE timeseries SET dsum=0, dmax=NULL WHERE tsid=?", oid1)
+	require.NoError(t, err)
+	problems, err := CheckBatches(adb, true)
+	require.NoError(t, err)
+	require.NotEmpty(t, problems)
+	for _, p := range problems {
+		require.True(t, p.Repaired, p.Description)
+	}
+	cmpStats(t, s, &Query{Timeseries: oid1}, 5, 4, 3, 6, 3, 10, 5.5)
+}